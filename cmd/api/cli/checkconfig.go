@@ -0,0 +1,25 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/leleo886/lopic/internal/config"
+	"go.yaml.in/yaml/v3"
+)
+
+// CheckConfig 加载并校验配置，输出合并环境变量后生效的配置，敏感配置项被隐藏
+func CheckConfig(configPath string) error {
+	appConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(appConfig.Redacted()); err != nil {
+		return fmt.Errorf("failed to encode configuration: %w", err)
+	}
+	fmt.Println("# Configuration is valid")
+	return nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/database"
+	"github.com/leleo886/lopic/migrations"
+	"github.com/leleo886/lopic/models"
+	"github.com/leleo886/lopic/services"
+)
+
+// ImportDirectory 将服务器目录中的图片导入指定用户，子目录对应同名相册
+func ImportDirectory(configPath, dir, username string, opts services.ImportOptions) error {
+	// 加载配置
+	appConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// 连接数据库
+	db, err := database.Connect(&appConfig.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := migrations.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// 缩略图尺寸和配额设置保存在数据库中
+	systemSettings, err := config.LoadSystemSettingsFromDatabase(db)
+	if err != nil {
+		return fmt.Errorf("failed to load system settings: %w", err)
+	}
+	appConfig.SystemSettings = systemSettings
+
+	if err := services.SetupSearchIndex(db); err != nil {
+		fmt.Printf("Warning: failed to set up search index, falling back to LIKE search: %v\n", err)
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", username).First(&user).Error; err != nil {
+		return fmt.Errorf("user %q not found", username)
+	}
+
+	importService := services.NewImportService(db, appConfig, nil, services.NewImageService(db, appConfig))
+	result, err := importService.ImportDirectory(context.Background(), user.ID, dir, opts, func(processed, total int) {
+		fmt.Printf("\rImporting: %d/%d", processed, total)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import directory: %w", err)
+	}
+	fmt.Println()
+
+	for _, importError := range result.Errors {
+		fmt.Printf("  Failed: %s: %s\n", importError.Path, importError.Error)
+	}
+	fmt.Printf("Success: Imported %d of %d files into user '%s' (skipped %d duplicates, %d failed, %d albums created)\n",
+		result.Imported, result.Total, user.Username, result.Skipped, result.Failed, result.AlbumsCreated)
+	return nil
+}
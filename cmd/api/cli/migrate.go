@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/database"
+	"github.com/leleo886/lopic/migrations"
+)
+
+// MigrateUsage migrate 命令的用法
+const MigrateUsage = "migrate status | migrate up | migrate down [steps] | migrate to <version>"
+
+// Migrate 查看迁移状态，或执行、回滚迁移
+func Migrate(configPath string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", MigrateUsage)
+	}
+
+	// 加载配置
+	appConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// 连接数据库
+	db, err := database.Connect(&appConfig.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	switch {
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := migrations.GetStatus(db)
+		if err != nil {
+			return fmt.Errorf("failed to get migration status: %w", err)
+		}
+		for _, status := range statuses {
+			appliedAt := ""
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-30s  %-8s  %s\n", status.Version, status.Name, status.State, appliedAt)
+		}
+		return nil
+	case args[0] == "up" && len(args) == 1:
+		err = migrations.Migrate(db)
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		err = migrations.Down(db, steps)
+	case args[0] == "to" && len(args) == 2:
+		version, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			return fmt.Errorf("invalid version: %s", args[1])
+		}
+		err = migrations.To(db, uint(version))
+	default:
+		return fmt.Errorf("usage: %s", MigrateUsage)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	version, err := migrations.Version(db)
+	if err != nil {
+		return fmt.Errorf("failed to get migration version: %w", err)
+	}
+	fmt.Printf("Success: Database is at version %d (latest %d)\n", version, migrations.Latest())
+	return nil
+}
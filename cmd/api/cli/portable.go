@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/database"
+	"github.com/leleo886/lopic/migrations"
+	"github.com/leleo886/lopic/services"
+	"github.com/leleo886/lopic/services/admin_services"
+)
+
+// ExportPortable 将数据库导出为与数据库类型无关的 JSON Lines 文件，可通过 ImportPortable 导入其他类型的数据库
+func ExportPortable(configPath, outputPath string) error {
+	// 加载配置
+	appConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// 连接数据库
+	db, err := database.Connect(&appConfig.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	counts, err := admin_services.ExportPortable(db, file)
+	if err != nil {
+		return fmt.Errorf("failed to export database: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write export file: %w", err)
+	}
+
+	fmt.Printf("Success: Database exported to %s\n", outputPath)
+	printTableCounts(counts)
+	return nil
+}
+
+// ImportPortable 将 ExportPortable 导出的文件导入配置的数据库，会替换数据库中的现有数据
+// 上传目录中的文件不在导出文件中，需另行复制
+func ImportPortable(configPath, inputPath string) error {
+	// 加载配置
+	appConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// 连接数据库
+	db, err := database.Connect(&appConfig.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := migrations.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	file, err := os.Open(inputPath)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	counts, err := admin_services.ImportPortable(db, file)
+	if err != nil {
+		return fmt.Errorf("failed to import database: %w", err)
+	}
+
+	// 导出文件没有记录迁移版本，重新执行所有数据迁移
+	if err := migrations.MigrateData(db, 0); err != nil {
+		return fmt.Errorf("failed to migrate imported data: %w", err)
+	}
+
+	// 检索文档不在导出文件中，按导入的数据重建
+	if err := services.SetupSearchIndex(db); err != nil {
+		fmt.Printf("Warning: failed to set up search index, falling back to LIKE search: %v\n", err)
+	}
+	if _, err := services.RebuildSearchIndex(db); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+
+	fmt.Printf("Success: Database imported from %s\n", inputPath)
+	printTableCounts(counts)
+	return nil
+}
+
+func printTableCounts(counts map[string]int64) {
+	tables := make([]string, 0, len(counts))
+	for table := range counts {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	for _, table := range tables {
+		fmt.Printf("  %s: %d rows\n", table, counts[table])
+	}
+}
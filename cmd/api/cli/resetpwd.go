@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"fmt"
 	"github.com/leleo886/lopic/internal/config"
 	"github.com/leleo886/lopic/internal/database"
@@ -49,7 +50,7 @@ func ResetAdminPassword(newPassword string) error {
 	}
 
 	// 调用UpdateUser方法更新密码
-	updatedUser, err := userService.UpdateUser(user.ID, 0, req)
+	updatedUser, err := userService.UpdateUser(context.Background(), user.ID, 0, req)
 	if err != nil {
 		return fmt.Errorf("failed to change password: %w", err)
 	}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/database"
+	"github.com/leleo886/lopic/migrations"
+	"github.com/leleo886/lopic/services"
+)
+
+// RebuildSearchIndex 根据数据库中的图片重建全文检索索引
+func RebuildSearchIndex(configPath string) error {
+	// 加载配置
+	appConfig, err := config.LoadConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// 连接数据库
+	db, err := database.Connect(&appConfig.Database)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := migrations.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if err := services.SetupSearchIndex(db); err != nil {
+		return fmt.Errorf("failed to set up search index: %w", err)
+	}
+
+	count, err := services.RebuildSearchIndex(db)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+
+	fmt.Printf("Success: Search index rebuilt for %d images\n", count)
+	return nil
+}
@@ -1,8 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 	"github.com/leleo886/lopic/cmd/api/cli"
 	_ "github.com/leleo886/lopic/docs"
@@ -11,7 +18,11 @@ import (
 	"github.com/leleo886/lopic/internal/database"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/internal/mail"
+	"github.com/leleo886/lopic/internal/metrics"
+	"github.com/leleo886/lopic/internal/queue"
 	"github.com/leleo886/lopic/internal/routes"
+	"github.com/leleo886/lopic/internal/shutdown"
+	"github.com/leleo886/lopic/internal/tracing"
 	"github.com/leleo886/lopic/internal/storage"
 	"github.com/leleo886/lopic/internal/websocket"
 	"github.com/leleo886/lopic/migrations"
@@ -19,6 +30,9 @@ import (
 	"github.com/leleo886/lopic/services/admin_services"
 )
 
+// defaultShutdownTimeout 退出时等待请求和后台任务完成的默认时间
+const defaultShutdownTimeout = 30 * time.Second
+
 // @title Lopic API
 // @version 1.0.0
 // @description RESTful API 
@@ -32,16 +46,49 @@ import (
 
 func main() {
 	var (
-		resetPwd    string
-		startServer bool
-		configPath  string
+		resetPwd           string
+		startServer        bool
+		configPath         string
+		rebuildSearchIndex bool
+		exportPortable     string
+		importPortable     string
+		importDir          string
+		importUser         string
+		importTags         string
+		importTagPattern   string
+		checkConfig        bool
 	)
 
 	flag.StringVar(&resetPwd, "resetpwd", "", "Reset admin password: --resetpwd=<new-password>")
 	flag.BoolVar(&startServer, "serve", false, "Start server: --serve")
 	flag.StringVar(&configPath, "config", "configs/config.yaml", "Configuration file path: --config=<path>")
+	flag.BoolVar(&rebuildSearchIndex, "rebuild-search-index", false, "Rebuild full-text search index: --rebuild-search-index")
+	flag.StringVar(&exportPortable, "export-portable", "", "Export database to a portable file: --export-portable=<file>")
+	flag.StringVar(&importPortable, "import-portable", "", "Import a portable file, replacing existing data: --import-portable=<file>")
+	flag.StringVar(&importDir, "import-dir", "", "Import images from a directory, folders become albums: --import-dir=<dir> --import-user=<username>")
+	flag.StringVar(&importUser, "import-user", "", "User to import images into: --import-user=<username>")
+	flag.StringVar(&importTags, "import-tags", "", "Tags added to all imported images: --import-tags=<tag1,tag2>")
+	flag.StringVar(&importTagPattern, "import-tag-pattern", "", "Regular expression extracting tags from file names, defaults to #tag: --import-tag-pattern=<regexp>")
+	flag.BoolVar(&checkConfig, "check-config", false, "Validate the configuration and print it with secrets redacted: --check-config")
 	flag.Parse()
 
+	if checkConfig {
+		if err := cli.CheckConfig(configPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// 子命令 migrate，如 ./lopic --config=config.yaml migrate status
+	if flag.Arg(0) == "migrate" {
+		if err := cli.Migrate(configPath, flag.Args()[1:]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	if resetPwd != "" {
 		if err := cli.ResetAdminPassword(resetPwd); err != nil {
 			fmt.Printf("Error: %v\n", err)
@@ -50,9 +97,51 @@ func main() {
 		return
 	}
 
+	if rebuildSearchIndex {
+		if err := cli.RebuildSearchIndex(configPath); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
+	if exportPortable != "" {
+		if err := cli.ExportPortable(configPath, exportPortable); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
+	if importPortable != "" {
+		if err := cli.ImportPortable(configPath, importPortable); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
+	if importDir != "" {
+		if importUser == "" {
+			fmt.Println("Error: --import-user is required")
+			return
+		}
+		opts := services.ImportOptions{TagPattern: importTagPattern}
+		if importTags != "" {
+			opts.Tags = strings.Split(importTags, ",")
+		}
+		if err := cli.ImportDirectory(configPath, importDir, importUser, opts); err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		return
+	}
+
 	if !startServer {
 		fmt.Println("Start server: --serve")
 		fmt.Println("Reset admin password: --resetpwd=<new-password>")
+		fmt.Println("Rebuild full-text search index: --rebuild-search-index")
+		fmt.Println("Export database to a portable file: --export-portable=<file>")
+		fmt.Println("Import a portable file, replacing existing data: --import-portable=<file>")
+		fmt.Println("Import images from a directory: --import-dir=<dir> --import-user=<username> [--import-tags=<tag1,tag2>] [--import-tag-pattern=<regexp>]")
+		fmt.Println("Validate the configuration and print it with secrets redacted: --check-config")
+		fmt.Println("Show, apply or roll back database migrations: " + cli.MigrateUsage)
 		return
 	}
 
@@ -73,15 +162,30 @@ func main() {
 		appConfig.Log.ConsoleOutput,
 	)
 
+	// 初始化链路追踪
+	shutdownTracing, err := tracing.Init(&appConfig.Tracing)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
 	// 连接数据库
 	db, err := database.Connect(&appConfig.Database)
 	if err != nil {
 		fmt.Println("Failed to connect to database. Please check your configuration.")
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if appConfig.Tracing.Enabled {
+		if err := tracing.RegisterGORM(db); err != nil {
+			log.Fatalf("Failed to register database tracing: %v", err)
+		}
+	}
 
 	if err := migrations.Migrate(db); err != nil {
-		fmt.Println("Database migration failed. Please check your configuration.")
+		if errors.Is(err, migrations.ErrSchemaTooNew) {
+			fmt.Println("The database was migrated by a newer version of lopic. Please upgrade lopic.")
+		} else {
+			fmt.Println("Database migration failed. Please check your configuration.")
+		}
 		log.Fatalf("Database migration failed: %v", err)
 		
 	}
@@ -92,6 +196,11 @@ func main() {
 		
 	}
 
+	// 初始化全文检索索引，失败时搜索退回到模糊匹配
+	if err := services.InitSearchIndex(db); err != nil {
+		log.Errorf("Failed to initialize search index, falling back to LIKE search: %v", err)
+	}
+
 	// 清理过期的刷新令牌黑名单条目
 	if err := services.CleanupBlacklist(db); err != nil {
 		log.Errorf("Failed to cleanup refresh token blacklist: %v", err)
@@ -125,32 +234,120 @@ func main() {
 	authService := services.NewAuthService(db, mailService, appConfig)
 	albumService := services.NewAlbumService(db)
 	userService := services.NewUserService(db, appConfig)
-	backupService := admin_services.NewBackupService(db, storageService, &appConfig.Database, &appConfig.Server)
+	backupService := admin_services.NewBackupService(db, storageService, &appConfig.Database, &appConfig.Server, &appConfig.Backup)
 	adminRoleService := admin_services.NewRoleService(db)
 	adminUserService := admin_services.NewUserService(db, appConfig)
 	adminImageService := admin_services.NewImageService(db, appConfig)
 	adminAlbumService := admin_services.NewAlbumService(db)
 	galleryService := services.NewGalleryService(db)
 	adminStorageService := admin_services.NewStorageService(db)
+	trashService := services.NewTrashService(db, appConfig)
+	tagService := services.NewTagService(db)
+	adminTagService := admin_services.NewTagService(db)
+	exportService := services.NewExportService(db, appConfig, hub)
+	importService := services.NewImportService(db, appConfig, hub, imageService)
+
+	// 初始化后台任务队列
+	jobQueue := queue.New(db)
+	imageService.RegisterJobs(jobQueue, hub)
+	backupService.RegisterJobs(jobQueue)
+	exportService.RegisterJobs(jobQueue)
+	importService.RegisterJobs(jobQueue)
+	maintenanceJobs := []services.MaintenanceJob{
+		{
+			// 清理过期刷新令牌黑名单
+			Name:     "blacklist_cleanup",
+			Interval: 24 * time.Hour,
+			Run:      func(ctx context.Context) error { return services.CleanupBlacklist(db) },
+		},
+		{
+			// 清理回收站中过期内容
+			Name:     "trash_purge",
+			Interval: time.Hour,
+			Run: func(ctx context.Context) error {
+				result, err := trashService.PurgeExpired(ctx)
+				if err == nil && (result.Images > 0 || result.Albums > 0) {
+					log.Infof("Purged expired trash: images=%d, albums=%d", result.Images, result.Albums)
+				}
+				return err
+			},
+		},
+		{
+			// 删除过期导出文件
+			Name:     "export_purge",
+			Interval: time.Hour,
+			Run: func(ctx context.Context) error {
+				count, err := exportService.PurgeExpired()
+				if err == nil && count > 0 {
+					log.Infof("Purged expired exports: %d", count)
+				}
+				return err
+			},
+		},
+	}
+	services.RegisterMaintenanceJobs(jobQueue, maintenanceJobs)
+	adminJobService := admin_services.NewJobService(db, jobQueue)
+	healthService := services.NewHealthService(db, appConfig, mailService)
+
+	// 恢复上次退出时未完成的任务
+	if requeued, err := jobQueue.Recover(); err != nil {
+		log.Errorf("Failed to recover jobs: %v", err)
+	} else if requeued > 0 {
+		log.Infof("Requeued %d interrupted jobs", requeued)
+	}
+	if failed, err := backupService.RecoverTasks(); err != nil {
+		log.Errorf("Failed to recover backup tasks: %v", err)
+	} else if failed > 0 {
+		log.Infof("Marked %d interrupted backup and restore tasks as failed", failed)
+	}
+	if failed, err := exportService.RecoverTasks(); err != nil {
+		log.Errorf("Failed to recover export tasks: %v", err)
+	} else if failed > 0 {
+		log.Infof("Marked %d interrupted export tasks as failed", failed)
+	}
+
+	// 后台任务，退出时停止接收新的工作并等待正在执行的工作完成
+	background := shutdown.New()
+	background.Go(func(ctx context.Context) {
+		jobQueue.Run(ctx)
+		// 等待正在执行的上传、导出、导入、备份和恢复任务
+		jobQueue.Wait()
+	})
+	services.ScheduleMaintenance(background.Context(), jobQueue, maintenanceJobs)
+
+	// Prometheus 指标
+	var metricsServer *http.Server
+	if appConfig.Metrics.Enabled {
+		metrics.RegisterWebsocketConnections(hub.ClientCount)
+		if sqlDB, err := db.DB(); err == nil {
+			metrics.RegisterDB(sqlDB)
+		}
+		if appConfig.Metrics.Listen != "" {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler(appConfig.Metrics.Token))
+			metricsServer = &http.Server{Addr: appConfig.Metrics.Listen, Handler: mux}
+			go func() {
+				if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+					log.Errorf("Metrics server failed: %v", err)
+				}
+			}()
+			log.Infof("Metrics available at http://%s/metrics", appConfig.Metrics.Listen)
+		}
+	}
 
 	// 设置路由
 	router := routes.SetupRouter(appConfig, hub,
 		imageService, mailService, authService, albumService, userService, backupService,
-		adminRoleService, adminUserService, adminImageService, adminAlbumService, adminStorageService, galleryService)
+		adminRoleService, adminUserService, adminImageService, adminAlbumService, adminStorageService, galleryService, trashService,
+		tagService, adminTagService, exportService, importService, adminJobService, healthService)
 
-	// 启动定期清理过期刷新令牌黑名单的goroutine
-	go func() {
-		ticker := time.NewTicker(24 * time.Hour) // 每24小时执行一次
-		defer ticker.Stop()
-		for range ticker.C {
-			log.Infof("Running periodic cleanup of refresh token blacklist")
-			if err := services.CleanupBlacklist(db); err != nil {
-				log.Errorf("Failed to cleanup refresh token blacklist: %v", err)
-			} else {
-				log.Infof("Successfully cleaned up refresh token blacklist")
-			}
-		}
-	}()
+	// 启动自动备份调度
+	backupScheduler := admin_services.NewBackupScheduler(db, backupService, &appConfig.SystemSettings.Backup, mailService, hub)
+	background.Go(backupScheduler.Run)
+
+	// 启动监视目录导入
+	ingestWatcher := services.NewIngestWatcher(db, &appConfig.Ingest, hub, imageService, importService)
+	background.Go(ingestWatcher.Run)
 
 	// 启动服务器
 	serverAddr := fmt.Sprintf(":%d", appConfig.Server.Port)
@@ -160,9 +357,44 @@ func main() {
 		fmt.Printf("Swagger documentation available at http://localhost%s%s/index.html\n", serverAddr, appConfig.Swagger.Path)
 	}
 
-	if err := router.Run(serverAddr); err != nil {
+	server := &http.Server{Addr: serverAddr, Handler: router}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	// 等待退出信号，收到第二次信号时直接退出
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-serverErr:
+		stopSignals()
 		fmt.Println("Server failed to start. Please check your configuration.")
 		log.Fatalf("Server failed to start: %v", err)
-		
+	case <-signalCtx.Done():
+	}
+	stopSignals()
+
+	timeout := time.Duration(appConfig.Server.ShutdownTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	log.Infof("Shutting down, waiting up to %s for requests and background tasks", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 先停止接收新请求，再停止后台任务，最后断开 WebSocket 连接，以便任务完成的消息能送达
+	if err := server.Shutdown(ctx); err != nil {
+		log.Errorf("Failed to shut down HTTP server: %v", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(ctx)
+	}
+	if err := background.Shutdown(ctx); err != nil {
+		log.Errorf("Background tasks did not finish before the shutdown deadline, they will be recovered on next start: %v", err)
+	}
+	hub.Close()
+	if err := shutdownTracing(ctx); err != nil {
+		log.Errorf("Failed to flush traces: %v", err)
 	}
+	log.Infof("Server stopped")
 }
@@ -60,7 +60,7 @@ func (h *AlbumController) GetAllAlbums(c *gin.Context) {
 	orderby = strings.TrimSpace(orderby)
 	order = strings.TrimSpace(order)
 
-	albums, err := h.albumService.GetAllAlbums(page, pageSize, offset, searchkey, orderby, order)
+	albums, err := h.albumService.GetAllAlbums(c.Request.Context(), page, pageSize, offset, searchkey, orderby, order)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -135,7 +135,7 @@ func (h *AlbumController) DeleteAlbum(c *gin.Context) {
 	var ErrorIDs map[uint]string
 	var SuccessIDs map[uint]string
 	for _, id := range ids {
-		err := h.albumService.DeleteAlbum(id)
+		err := h.albumService.DeleteAlbum(c.Request.Context(), id)
 		if err != nil {
 			if ErrorIDs == nil {
 				ErrorIDs = make(map[uint]string)
@@ -3,6 +3,7 @@ package admin_controllers
 import (
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"time"
 
@@ -24,12 +25,21 @@ func NewBackupController(backupService *admin_services.BackupService) *BackupCon
 	}
 }
 
+// BackupPassphraseRequest 备份口令请求
+type BackupPassphraseRequest struct {
+	Passphrase string `json:"passphrase"` // 加密口令，为空时使用配置的密钥
+}
+
 // CreateBackup 创建备份
 // @Summary 创建备份
-// @Description 创建系统全量备份
+// @Description 创建系统备份，incremental 为 true 时基于最近一次备份做增量备份，只保存新增或变化的文件；指定 passphrase 时使用该口令加密，否则使用配置的密钥加密，都没有时不加密
+// @Description portable 为 true 时数据库导出为与数据库类型无关的 JSON Lines，可以恢复到其他类型的数据库（如从 SQLite 迁移到 MySQL）
 // @Tags backup
 // @Accept json
 // @Produce json
+// @Param incremental query bool false "是否为增量备份"
+// @Param portable query bool false "是否使用可移植格式导出数据库"
+// @Param request body BackupPassphraseRequest false "加密口令"
 // @Success 200 {object} success.DataResponse{data=models.BackupTask}
 // @Failure 400 {object} cerrors.ErrorResponse
 // @Failure 401 {object} cerrors.ErrorResponse
@@ -39,7 +49,22 @@ func NewBackupController(backupService *admin_services.BackupService) *BackupCon
 // @Security ApiKeyAuth
 // @Router /api/admin/backup [post]
 func (h *BackupController) CreateBackup(c *gin.Context) {
-	task, err := h.backupService.CreateBackup()
+	incremental, _ := strconv.ParseBool(c.Query("incremental"))
+	portable, _ := strconv.ParseBool(c.Query("portable"))
+	var req BackupPassphraseRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+			c.JSON(statusCode, errorResponse)
+			return
+		}
+	}
+
+	task, err := h.backupService.CreateBackup(admin_services.BackupOptions{
+		Incremental: incremental,
+		Portable:    portable,
+		Passphrase:  req.Passphrase,
+	})
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -51,7 +76,7 @@ func (h *BackupController) CreateBackup(c *gin.Context) {
 
 // GetBackupList 获取备份列表
 // @Summary 获取备份列表
-// @Description 获取所有备份任务列表
+// @Description 获取所有备份任务列表，chain 为恢复该备份需要的备份链，size 为备份文件实际占用的大小，data_size 为备份包含的文件总大小
 // @Tags backup
 // @Accept json
 // @Produce json
@@ -122,7 +147,7 @@ func (h *BackupController) DeleteBackup(c *gin.Context) {
 		return
 	}
 
-	if err := h.backupService.DeleteBackup(uint(id)); err != nil {
+	if err := h.backupService.DeleteBackup(c.Request.Context(), uint(id)); err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
 		return
@@ -131,13 +156,22 @@ func (h *BackupController) DeleteBackup(c *gin.Context) {
 	c.JSON(http.StatusOK, success.NewSuccessResponse("备份删除成功"))
 }
 
+// RestoreBackupRequest 恢复备份请求
+type RestoreBackupRequest struct {
+	StorageMap map[string]string `json:"storage_map"` // 原存储名称 -> 目标存储名称
+	Passphrase string            `json:"passphrase"`  // 加密备份的口令，为空时使用配置的密钥
+}
+
 // RestoreBackup 恢复备份
 // @Summary 恢复备份
-// @Description 从指定备份恢复系统
+// @Description 从指定备份恢复系统，非本地存储中的图片默认恢复到原存储，可通过 storage_map 指定恢复到其他存储（原存储名称 -> 目标存储名称）；加密的备份需要提供 passphrase
+// @Description dry_run=true 时只校验备份并返回恢复会带来的变化（admin_services.RestorePlan），不创建恢复任务
 // @Tags backup
 // @Accept json
 // @Produce json
 // @Param id path int true "备份ID"
+// @Param dry_run query bool false "只预演恢复"
+// @Param request body RestoreBackupRequest false "恢复选项"
 // @Success 200 {object} success.DataResponse{data=models.RestoreTask}
 // @Failure 400 {object} cerrors.ErrorResponse
 // @Failure 401 {object} cerrors.ErrorResponse
@@ -154,7 +188,27 @@ func (h *BackupController) RestoreBackup(c *gin.Context) {
 		return
 	}
 
-	task, err := h.backupService.RestoreBackup(uint(id))
+	var req RestoreBackupRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+			c.JSON(statusCode, errorResponse)
+			return
+		}
+	}
+
+	if dryRun, _ := strconv.ParseBool(c.Query("dry_run")); dryRun {
+		plan, err := h.backupService.PlanRestore(c.Request.Context(), uint(id), req.StorageMap, req.Passphrase)
+		if err != nil {
+			statusCode, errorResponse := cerrors.NewErrorResponse(err)
+			c.JSON(statusCode, errorResponse)
+			return
+		}
+		c.JSON(http.StatusOK, success.NewDataResponse("Backup restore planned successfully", plan))
+		return
+	}
+
+	task, err := h.backupService.RestoreBackup(c.Request.Context(), uint(id), req.StorageMap, req.Passphrase)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -164,6 +218,49 @@ func (h *BackupController) RestoreBackup(c *gin.Context) {
 	c.JSON(http.StatusOK, success.NewDataResponse("Backup restore task created successfully", task))
 }
 
+// VerifyBackup 校验备份
+// @Summary 校验备份
+// @Description 校验备份能否解密、归档是否完整，并按清单核对文件校验和、数据库类型和表行数，建议在恢复前调用；加密的备份需要提供 passphrase，未提供时使用配置的密钥
+// @Tags backup
+// @Accept json
+// @Produce json
+// @Param id path int true "备份ID"
+// @Param request body BackupPassphraseRequest false "加密口令"
+// @Success 200 {object} success.DataResponse{data=admin_services.BackupVerification}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /api/admin/backup/verify/{id} [post]
+func (h *BackupController) VerifyBackup(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	var req BackupPassphraseRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+			c.JSON(statusCode, errorResponse)
+			return
+		}
+	}
+
+	result, err := h.backupService.VerifyBackup(c.Request.Context(), uint(id), req.Passphrase)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Backup verified successfully", result))
+}
+
 // DeleteRestoreTask 删除恢复任务
 // @Summary 删除恢复任务
 // @Description 删除指定的恢复任务记录
@@ -198,7 +295,7 @@ func (h *BackupController) DeleteRestoreTask(c *gin.Context) {
 
 // DownloadBackup 下载备份文件
 // @Summary 下载备份文件
-// @Description 下载指定的备份文件
+// @Description 下载指定的备份文件，存放在远程存储中的备份会经服务器转发
 // @Tags backup
 // @Accept json
 // @Produce application/octet-stream
@@ -234,6 +331,27 @@ func (h *BackupController) DownloadBackup(c *gin.Context) {
 		return
 	}
 
+	// 远程存储中的备份通过存储读取后转发
+	if backupTask.Location != "" {
+		reader, err := h.backupService.OpenBackupArchive(backupTask)
+		if err != nil {
+			statusCode, errorResponse := cerrors.NewErrorResponse(err)
+			c.JSON(statusCode, errorResponse)
+			return
+		}
+		defer reader.Close()
+
+		c.DataFromReader(http.StatusOK, backupTask.Size, "application/octet-stream", reader, map[string]string{
+			"Content-Description":       "File Transfer",
+			"Content-Disposition":       "attachment; filename=" + path.Base(backupTask.StoragePath),
+			"Content-Transfer-Encoding": "binary",
+			"Expires":                   "0",
+			"Cache-Control":             "must-revalidate",
+			"Pragma":                    "public",
+		})
+		return
+	}
+
 	// 获取文件信息
 	fileInfo, err := os.Stat(backupTask.StoragePath)
 	if err != nil {
@@ -258,11 +376,12 @@ func (h *BackupController) DownloadBackup(c *gin.Context) {
 
 // UploadBackup 上传备份文件
 // @Summary 上传备份文件
-// @Description 上传备份文件压缩包，上传完成后会添加记录到备份表中，上传逻辑异步
+// @Description 上传备份文件压缩包，上传完成后会添加记录到备份表中，上传逻辑异步；上传加密的备份时可提供 passphrase 校验能否解密
 // @Tags backup
 // @Accept multipart/form-data
 // @Produce json
 // @Param file formData file true "备份文件压缩包"
+// @Param passphrase formData string false "加密口令"
 // @Success 200 {object} success.DataResponse{data=models.BackupTask}
 // @Failure 400 {object} cerrors.ErrorResponse
 // @Failure 401 {object} cerrors.ErrorResponse
@@ -282,7 +401,7 @@ func (h *BackupController) UploadBackup(c *gin.Context) {
 	}
 
 	// 创建备份任务
-	task, err := h.backupService.CreateUploadBackupTask(startTime, file)
+	task, err := h.backupService.CreateUploadBackupTask(c.Request.Context(), startTime, file, c.PostForm("passphrase"))
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
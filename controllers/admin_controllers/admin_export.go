@@ -0,0 +1,90 @@
+package admin_controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/success"
+	"github.com/leleo886/lopic/services"
+)
+
+type ExportController struct {
+	exportService *services.ExportService
+}
+
+func NewExportController(exportService *services.ExportService) *ExportController {
+	return &ExportController{exportService: exportService}
+}
+
+// CreateUserExport 导出指定用户的数据
+// @Summary 导出指定用户的数据
+// @Description 在后台导出指定用户的原图和清单，进度和结果同时推送给该用户和发起导出的管理员
+// @Tags 用户管理员
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 202 {object} success.DataResponse{data=models.ExportTask}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 409 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/users/{id}/export [post]
+func (h *ExportController) CreateUserExport(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	task, err := h.exportService.CreateExport(c.Request.Context(), uint(id), currentUserID.(uint))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, success.NewDataResponse("Export started", task))
+}
+
+// GetUserExports 获取指定用户的导出任务
+// @Summary 获取指定用户的导出任务
+// @Description 获取指定用户的导出任务，已完成且未过期的任务带有下载链接
+// @Tags 用户管理员
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Success 200 {object} success.DataResponse{data=[]models.ExportTask}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/users/{id}/exports [get]
+func (h *ExportController) GetUserExports(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	tasks, err := h.exportService.GetExports(uint(id))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Exports retrieved successfully", tasks))
+}
@@ -30,7 +30,7 @@ func NewImageController(imageService *admin_services.ImageService, hub *websocke
 // @Produce json
 // @Param page query int false "页码，默认为1"
 // @Param page_size query int false "每页数量，默认为10"
-// @Param searchkey query string false "搜索关键词"
+// @Param searchkey query string false "搜索语句，语法与图片搜索相同"
 // @Param field query string false "查询字段名"
 // @Param value query string false "查询字段值"
 // @Param orderby query string false "排序字段，默认为created_at"
@@ -67,7 +67,7 @@ func (h *ImageController) GetAllImages(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	images, err := h.imageService.GetAllImages(page, pageSize, offset, searchkey, field, value, orderby, order)
+	images, err := h.imageService.GetAllImages(c.Request.Context(), page, pageSize, offset, searchkey, field, value, orderby, order)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -153,9 +153,9 @@ func (h *ImageController) DeleteImage(c *gin.Context) {
 	isExistError := false
 	var ExistError error
 	for _, id := range ids {
-		err := h.imageService.DeleteImage(id)
+		err := h.imageService.DeleteImage(c.Request.Context(), id)
 		if err != nil {
-			log.Errorf("Failed to delete image %d: %v", id, err)
+			log.Ctx(c.Request.Context()).Errorf("Failed to delete image %d: %v", id, err)
 			isExistError = true
 			ExistError = err
 		}
@@ -212,7 +212,7 @@ func (h *ImageController) UpdateImageStorage(c *gin.Context) {
 	var ErrorIDs map[uint]string
 	var SuccessIDs map[uint]string
 	for _, id := range req.IDs {
-		err := h.imageService.UpdateImageStorage(id, req.StorageName)
+		err := h.imageService.UpdateImageStorage(c.Request.Context(), id, req.StorageName)
 		if err != nil {
 			if ErrorIDs == nil {
 				ErrorIDs = make(map[uint]string)
@@ -0,0 +1,73 @@
+package admin_controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/success"
+	"github.com/leleo886/lopic/services"
+)
+
+type ImportController struct {
+	importService *services.ImportService
+}
+
+func NewImportController(importService *services.ImportService) *ImportController {
+	return &ImportController{importService: importService}
+}
+
+type ImportDirectoryRequest struct {
+	Dir        string   `json:"dir" binding:"required"`
+	Tags       []string `json:"tags"`
+	TagPattern string   `json:"tag_pattern"`
+}
+
+// ImportDirectory 将服务器目录导入指定用户
+// @Summary 将服务器目录导入指定用户
+// @Description 作为后台任务导入服务器目录中的图片，可通过任务管理取消，目录需位于配置的 import.allowed_dirs 下；子目录对应同名相册，标签来自请求、同名的 JSON 文件（tags 或 keywords）和文件名，重复的图片会被跳过，文件的修改时间作为创建时间。通过 WebSocket 推送 import_progress、import_complete 和 import_failed 消息
+// @Tags 用户管理员
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "用户ID"
+// @Param req body ImportDirectoryRequest true "导入目录"
+// @Success 202 {object} success.SuccessResponse
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/users/{id}/import [post]
+func (h *ImportController) ImportDirectory(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	var req ImportDirectoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	opts := services.ImportOptions{Tags: req.Tags, TagPattern: req.TagPattern}
+	if err := h.importService.StartImport(c.Request.Context(), uint(id), currentUserID.(uint), req.Dir, opts); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, success.NewSuccessResponse("Import started"))
+}
@@ -0,0 +1,123 @@
+package admin_controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/success"
+	"github.com/leleo886/lopic/services/admin_services"
+)
+
+type JobController struct {
+	jobService *admin_services.JobService
+}
+
+func NewJobController(jobService *admin_services.JobService) *JobController {
+	return &JobController{jobService: jobService}
+}
+
+// GetJobs 获取后台任务列表
+// @Summary 获取后台任务列表
+// @Description 获取上传、备份、恢复和维护等后台任务，按创建时间倒序，支持按状态和类型过滤
+// @Tags 任务管理员
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page query int false "页码，默认为1"
+// @Param page_size query int false "每页数量，默认为10"
+// @Param status query string false "状态：pending、running、completed、failed、canceled"
+// @Param type query string false "任务类型"
+// @Success 200 {object} success.DataResponse{data=admin_services.GetJobsResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/jobs [get]
+func (h *JobController) GetJobs(c *gin.Context) {
+	page, err1 := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, err2 := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+	if err1 != nil || err2 != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	jobs, err := h.jobService.GetJobs(c.Request.Context(), page, pageSize, c.Query("status"), c.Query("type"))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+	c.JSON(http.StatusOK, success.NewDataResponse("Jobs retrieved successfully", jobs))
+}
+
+// CancelJob 取消任务
+// @Summary 取消任务
+// @Description 取消等待中或执行中的任务，执行中的任务在当前步骤结束后停止
+// @Tags 任务管理员
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "任务ID"
+// @Success 200 {object} success.DataResponse{data=models.Job}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 409 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/jobs/{id}/cancel [post]
+func (h *JobController) CancelJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	job, err := h.jobService.CancelJob(uint(id))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+	c.JSON(http.StatusOK, success.NewDataResponse("Job canceled successfully", job))
+}
+
+// RetryJob 重试任务
+// @Summary 重试任务
+// @Description 重新执行失败或已取消的任务，执行次数从零开始计算
+// @Tags 任务管理员
+// @Produce json
+// @Security ApiKeyAuth
+// @Param id path int true "任务ID"
+// @Success 200 {object} success.DataResponse{data=models.Job}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 409 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/jobs/{id}/retry [post]
+func (h *JobController) RetryJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	job, err := h.jobService.RetryJob(uint(id))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+	c.JSON(http.StatusOK, success.NewDataResponse("Job retried successfully", job))
+}
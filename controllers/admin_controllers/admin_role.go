@@ -65,7 +65,7 @@ func (h *RoleController) GetRoles(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	roles, err := h.roleService.GetRoles(page, pageSize, offset, searchkey, orderby, order)
+	roles, err := h.roleService.GetRoles(c.Request.Context(), page, pageSize, offset, searchkey, orderby, order)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -133,7 +133,7 @@ func (h *RoleController) CreateRole(c *gin.Context) {
 		return
 	}
 
-	err := h.roleService.CreateRole(&models.Role{
+	err := h.roleService.CreateRole(c.Request.Context(), &models.Role{
 		Name:              role.Name,
 		Description:       role.Description,
 		AllowedExtensions: role.AllowedExtensions,
@@ -189,7 +189,7 @@ func (h *RoleController) UpdateRole(c *gin.Context) {
 		return
 	}
 
-	err = h.roleService.UpdateRole(uint(id), &role)
+	err = h.roleService.UpdateRole(c.Request.Context(), uint(id), &role)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -221,7 +221,7 @@ func (h *RoleController) DeleteRole(c *gin.Context) {
 		return
 	}
 
-	err = h.roleService.DeleteRole(uint(id))
+	err = h.roleService.DeleteRole(c.Request.Context(), uint(id))
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -244,7 +244,7 @@ func (h *RoleController) DeleteRole(c *gin.Context) {
 // @Failure 500 {object} cerrors.ErrorResponse
 // @Router /api/admin/roles/users-count [get]
 func (h *RoleController) GetUsersCountByRole(c *gin.Context) {
-	counts, err := h.roleService.GetUsersCountByRole()
+	counts, err := h.roleService.GetUsersCountByRole(c.Request.Context())
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -66,7 +66,7 @@ func (h *StorageController) GetStorages(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	storages, err := h.storageService.GetStorages(page, pageSize, offset, searchkey, orderby, order)
+	storages, err := h.storageService.GetStorages(c.Request.Context(), page, pageSize, offset, searchkey, orderby, order)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -171,7 +171,7 @@ func (h *StorageController) CreateStorage(c *gin.Context) {
 		return
 	}
 
-	err := h.storageService.CreateStorage(&storage)
+	err := h.storageService.CreateStorage(c.Request.Context(), &storage)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -217,7 +217,7 @@ func (h *StorageController) UpdateStorage(c *gin.Context) {
 		return
 	}
 
-	err = h.storageService.UpdateStorage(uint(id), &storage)
+	err = h.storageService.UpdateStorage(c.Request.Context(), uint(id), &storage)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -292,7 +292,7 @@ func (h *StorageController) DeleteStorage(c *gin.Context) {
 		return
 	}
 
-	err = h.storageService.DeleteStorage(uint(id))
+	err = h.storageService.DeleteStorage(c.Request.Context(), uint(id))
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
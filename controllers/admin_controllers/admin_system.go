@@ -5,6 +5,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/cron"
 	"github.com/leleo886/lopic/internal/database"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/mail"
@@ -16,10 +17,12 @@ type SystemController struct {
 	mailService   *mail.MailService
 	generalConfig *models.GeneralConfig
 	galleryConfig *models.GalleryConfig
+	trashConfig   *models.TrashConfig
+	backupConfig  *models.BackupConfig
 }
 
-func NewSystemController(mailService *mail.MailService, generalConfig *models.GeneralConfig, galleryConfig *models.GalleryConfig) *SystemController {
-	return &SystemController{mailService: mailService, generalConfig: generalConfig, galleryConfig: galleryConfig}
+func NewSystemController(mailService *mail.MailService, generalConfig *models.GeneralConfig, galleryConfig *models.GalleryConfig, trashConfig *models.TrashConfig, backupConfig *models.BackupConfig) *SystemController {
+	return &SystemController{mailService: mailService, generalConfig: generalConfig, galleryConfig: galleryConfig, trashConfig: trashConfig, backupConfig: backupConfig}
 }
 
 // GetSystemInfo 获取系统信息
@@ -52,7 +55,7 @@ func (s *SystemController) GetSystemInfo(c *gin.Context) {
 
 // UpdateSystemInfo 更新系统信息
 // @Summary 更新系统信息
-// @Description 更新系统信息
+// @Description 更新系统信息，启用自动备份时 Backup.Schedule 需为合法的 cron 表达式（分 时 日 月 周），Backup.Destination 需为已配置的远程存储名称
 // @Tags 系统
 // @Accept json
 // @Produce json
@@ -81,6 +84,26 @@ func (s *SystemController) UpdateSystemInfo(c *gin.Context) {
 		c.JSON(statusCode, errorResponse)
 		return
 	}
+	if req.Backup.KeepLast < 0 || req.Backup.KeepDaily < 0 || req.Backup.KeepWeekly < 0 || req.Backup.FullEvery < 0 {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+	if req.Backup.Destination != "" {
+		var destination models.Storage
+		if err := database.GetDB().Where("name = ?", req.Backup.Destination).First(&destination).Error; err != nil || destination.Type == "local" {
+			statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrInvalidBackupDestination)
+			c.JSON(statusCode, errorResponse)
+			return
+		}
+	}
+	if req.Backup.Enabled {
+		if _, err := cron.Parse(req.Backup.Schedule); err != nil {
+			statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrInvalidBackupSchedule)
+			c.JSON(statusCode, errorResponse)
+			return
+		}
+	}
 
 	err := config.ImportSystemSettingsToDatabase(database.GetDB(), req)
 	if err != nil {
@@ -92,6 +115,8 @@ func (s *SystemController) UpdateSystemInfo(c *gin.Context) {
 	// 更新系统配置
 	*s.generalConfig = req.General
 	*s.galleryConfig = req.Gallery
+	*s.trashConfig = req.Trash
+	*s.backupConfig = req.Backup
 
 	// 为了避免热更新问题，手动更新邮件服务配置
 	s.mailService.UpdateConfig(&req.Mail)
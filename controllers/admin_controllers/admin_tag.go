@@ -0,0 +1,110 @@
+package admin_controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leleo886/lopic/controllers"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/success"
+	"github.com/leleo886/lopic/services/admin_services"
+)
+
+type TagController struct {
+	tagService *admin_services.TagService
+}
+
+func NewTagController(tagService *admin_services.TagService) *TagController {
+	return &TagController{tagService: tagService}
+}
+
+// GetAllTags 按前缀获取所有用户的标签
+// @Summary 按前缀获取所有用户的标签
+// @Description 获取所有用户以指定前缀开头的标签，同名标签合并计数
+// @Tags 标签管理员
+// @Produce json
+// @Security ApiKeyAuth
+// @Param prefix query string false "标签前缀"
+// @Param limit query int false "返回数量" default(10)
+// @Success 200 {object} success.DataResponse{data=[]services.TagCloudItem}
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/tags [get]
+func (h *TagController) GetAllTags(c *gin.Context) {
+	prefix, limit := controllers.TagQuery(c)
+	tags, err := h.tagService.GetAllTags(c.Request.Context(), prefix, limit)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Tags retrieved successfully", tags))
+}
+
+// RenameTag 重命名所有用户的标签
+// @Summary 重命名所有用户的标签
+// @Description 重命名所有用户的同名标签，新名称已存在时合并到该标签
+// @Tags 标签管理员
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body controllers.RenameTagRequest true "标签名称"
+// @Success 200 {object} success.DataResponse{data=services.MergeTagsResult}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/tags/rename [put]
+func (h *TagController) RenameTag(c *gin.Context) {
+	var req controllers.RenameTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	result, err := h.tagService.RenameTag(c.Request.Context(), req.OldName, req.NewName)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Tag renamed successfully", result))
+}
+
+// MergeTags 合并所有用户的标签
+// @Summary 合并所有用户的标签
+// @Description 将所有用户的源标签合并到目标标签，每个用户的标签分别合并
+// @Tags 标签管理员
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body controllers.MergeTagsRequest true "源标签和目标标签"
+// @Success 200 {object} success.DataResponse{data=services.MergeTagsResult}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/admin/tags/merge [post]
+func (h *TagController) MergeTags(c *gin.Context) {
+	var req controllers.MergeTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	result, err := h.tagService.MergeTags(c.Request.Context(), req.Sources, req.Target)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Tags merged successfully", result))
+}
@@ -73,7 +73,7 @@ func (h *UserController) GetUsers(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	users, err := h.userService.GetUsers(page, pageSize, offset, searchkey, orderby, order)
+	users, err := h.userService.GetUsers(c.Request.Context(), page, pageSize, offset, searchkey, orderby, order)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -205,7 +205,7 @@ func (h *UserController) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.UpdateUser(id, currentUserID.(uint), req)
+	user, err := h.userService.UpdateUser(c.Request.Context(), id, currentUserID.(uint), req)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -247,10 +247,10 @@ func (h *UserController) DeleteUser(c *gin.Context) {
 	// 立即返回响应，告知客户端删除已开始
 	c.JSON(http.StatusOK, success.NewSuccessResponse("User deletion started"))
 
-	err = h.userService.DeleteUser(id)
+	err = h.userService.DeleteUser(c.Request.Context(), id)
 	if err != nil {
 		_, errorResponse := cerrors.NewErrorResponse(err)
-		log.Errorf("Failed to delete user %d: %v", id, err)
+		log.Ctx(c.Request.Context()).Errorf("Failed to delete user %d: %v", id, err)
 		h.hub.BroadcastToUser(currentUserID.(uint), "delete_user_error", map[string]interface{}{
 			"message": "Failed to delete user, some images may not be deleted",
 			"error":   errorResponse.Message,
@@ -290,7 +290,7 @@ func (h *UserController) GetUserImagesTagsCloud(c *gin.Context) {
 		c.JSON(statusCode, errorResponse)
 		return
 	}
-	tagsCloud, err := h.naUserService.GetImagesTagsCloud(uint(id))
+	tagsCloud, err := h.naUserService.GetImagesTagsCloud(c.Request.Context(), uint(id))
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -313,7 +313,7 @@ func (h *UserController) GetUserImagesTagsCloud(c *gin.Context) {
 // @Failure 500 {object} cerrors.ErrorResponse
 // @Router /api/admin/users/tags-cloud [get]
 func (h *UserController) GetAllImagesTagsCloud(c *gin.Context) {
-	tagsCloud, err := h.userService.GetAllImagesTagsCloud()
+	tagsCloud, err := h.userService.GetAllImagesTagsCloud(c.Request.Context())
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
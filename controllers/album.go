@@ -57,7 +57,7 @@ func (h *AlbumController) CreateAlbum(c *gin.Context) {
 		return
 	}
 
-	albumResponse, err := h.albumService.CreateAlbum(req.Name, req.Description, req.GalleryEnabled, currentUserID.(uint), req.SerialNumber)
+	albumResponse, err := h.albumService.CreateAlbum(c.Request.Context(), req.Name, req.Description, req.GalleryEnabled, currentUserID.(uint), req.SerialNumber)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -102,7 +102,7 @@ func (h *AlbumController) GetAlbums(c *gin.Context) {
 
 	offset := (page - 1) * pageSize
 
-	albumResponses, err := h.albumService.GetAlbums(currentUserID.(uint), page, pageSize, offset)
+	albumResponses, err := h.albumService.GetAlbums(c.Request.Context(), currentUserID.(uint), page, pageSize, offset)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -189,7 +189,7 @@ func (h *AlbumController) UpdateAlbum(c *gin.Context) {
 		return
 	}
 
-	albumResponse, err := h.albumService.UpdateAlbum(uint(id), currentUserID.(uint), req.Name, req.Description, req.GalleryEnabled, req.SerialNumber)
+	albumResponse, err := h.albumService.UpdateAlbum(c.Request.Context(), uint(id), currentUserID.(uint), req.Name, req.Description, req.GalleryEnabled, req.SerialNumber)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -228,7 +228,7 @@ func (h *AlbumController) DeleteAlbum(c *gin.Context) {
 		return
 	}
 
-	err = h.albumService.DeleteAlbum(uint(id), currentUserID.(uint))
+	err = h.albumService.DeleteAlbum(c.Request.Context(), uint(id), currentUserID.(uint))
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
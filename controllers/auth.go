@@ -111,7 +111,7 @@ func (h *AuthController) Register(c *gin.Context) {
 		return
 	}
 
-	message, err := h.authService.Register(req.Username, req.Password, req.Email, req.Locale)
+	message, err := h.authService.Register(c.Request.Context(), req.Username, req.Password, req.Email, req.Locale)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -173,7 +173,7 @@ func (h *AuthController) RequestPasswordReset(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.RequestPasswordReset(req.Email, req.Locale)
+	err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email, req.Locale)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -202,7 +202,7 @@ func (h *AuthController) ResetPassword(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.ResetPassword(req.Email, req.Code, req.NewPassword)
+	err := h.authService.ResetPassword(c.Request.Context(), req.Email, req.Code, req.NewPassword)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -231,7 +231,7 @@ func (h *AuthController) VerifyEmail(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.VerifyEmail(token)
+	err := h.authService.VerifyEmail(c.Request.Context(), token)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.Data(statusCode, "text/html; charset=utf-8", []byte(fmt.Sprintf(errorHTML, errorResponse.Message)))
@@ -262,7 +262,7 @@ func (h *AuthController) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	tokenResponse, err := h.authService.RefreshToken(req.RefreshToken, &h.cfg.JWT)
+	tokenResponse, err := h.authService.RefreshToken(c.Request.Context(), req.RefreshToken, &h.cfg.JWT)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -292,7 +292,7 @@ func (h *AuthController) Logout(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.Logout(req.RefreshToken, &h.cfg.JWT)
+	err := h.authService.Logout(c.Request.Context(), req.RefreshToken, &h.cfg.JWT)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/success"
+	"github.com/leleo886/lopic/services"
+)
+
+type ExportController struct {
+	exportService *services.ExportService
+}
+
+func NewExportController(exportService *services.ExportService) *ExportController {
+	return &ExportController{exportService: exportService}
+}
+
+// CreateMyExport 导出当前用户的数据
+// @Summary 导出当前用户的数据
+// @Description 在后台将当前用户的原图按相册目录打包，并附带图片、标签和相册的 JSON/CSV 清单；通过 WebSocket 推送 export_progress、export_complete 和 export_failed 消息，完成后的下载链接有效期为 24 小时
+// @Tags 用户查询
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 202 {object} success.DataResponse{data=models.ExportTask}
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 409 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/users/me/export [post]
+func (h *ExportController) CreateMyExport(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	task, err := h.exportService.CreateExport(c.Request.Context(), currentUserID.(uint), currentUserID.(uint))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, success.NewDataResponse("Export started", task))
+}
+
+// GetMyExports 获取当前用户的导出任务
+// @Summary 获取当前用户的导出任务
+// @Description 获取当前用户的导出任务，已完成且未过期的任务带有下载链接
+// @Tags 用户查询
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} success.DataResponse{data=[]models.ExportTask}
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/users/me/exports [get]
+func (h *ExportController) GetMyExports(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	tasks, err := h.exportService.GetExports(currentUserID.(uint))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Exports retrieved successfully", tasks))
+}
+
+// DownloadExport 下载导出文件
+// @Summary 下载导出文件
+// @Description 通过导出任务中的签名链接下载导出文件，无需登录，链接过期后返回 410
+// @Tags 用户查询
+// @Produce application/zip
+// @Param token query string true "下载令牌"
+// @Success 200 {file} binary "导出文件"
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 410 {object} cerrors.ErrorResponse
+// @Router /api/exports/download [get]
+func (h *ExportController) DownloadExport(c *gin.Context) {
+	filePath, filename, err := h.exportService.OpenDownload(c.Query("token"))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.FileAttachment(filePath, filename)
+}
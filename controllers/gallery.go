@@ -38,7 +38,7 @@ func (h *GalleryController) GetGallerys(c *gin.Context) {
 		return
 	}
 
-	gallery, err := h.galleryService.GetGallery(currentUserID.(uint))
+	gallery, err := h.galleryService.GetGallery(c.Request.Context(), currentUserID.(uint))
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -96,11 +96,11 @@ func (h *GalleryController) GetGalleryImages(c *gin.Context) {
 
 // SearchGalleryImages 搜索画廊相册图片
 // @Summary 搜索画廊相册图片
-// @Description 搜索画廊相册图片
+// @Description 搜索画廊相册图片，不带字段的词按相关度排序并返回高亮，支持 tag:、album:、type:、width:、height:、size:、created:、name: 字段及 AND、OR、NOT、括号和引号，如 tag:sunset -tag:draft size:<5mb
 // @Tags 画廊
 // @Produce json
 // @Param user_name path string true "用户名"
-// @Param query query string true "搜索查询"
+// @Param query query string true "搜索语句"
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
 // @Success 200 {object} success.DataResponse{data=services.GetGalleryImagesResponse}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leleo886/lopic/internal/health"
+	"github.com/leleo886/lopic/services"
+)
+
+// HealthController 存活和就绪检查控制器，响应不使用统一的响应格式，便于编排系统探测
+type HealthController struct {
+	healthService *services.HealthService
+}
+
+// NewHealthController 创建存活和就绪检查控制器实例
+func NewHealthController(healthService *services.HealthService) *HealthController {
+	return &HealthController{healthService: healthService}
+}
+
+// Livez 存活检查
+// @Summary 存活检查
+// @Description 进程能够处理请求时返回 200，不检查依赖
+// @Tags 健康检查
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /livez [get]
+func (h *HealthController) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// Readyz 就绪检查
+// @Summary 就绪检查
+// @Description 检查数据库、存储连接、磁盘可用空间和邮件配置，返回每项检查的状态，失败原因只记录在日志中，有检查失败时返回 503
+// @Tags 健康检查
+// @Produce json
+// @Success 200 {object} health.Report
+// @Failure 503 {object} health.Report
+// @Router /readyz [get]
+func (h *HealthController) Readyz(c *gin.Context) {
+	report := h.healthService.Readiness(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
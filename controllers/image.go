@@ -54,7 +54,7 @@ type AddOrDelImageToAlbumResponse struct {
 
 // UploadImage 批量上传图片
 // @Summary 批量上传图片
-// @Description 上传图片文件
+// @Description 上传图片文件，文件暂存后在后台任务中处理，失败时自动重试，处理进度通过 WebSocket 推送
 // @Tags 图片管理
 // @Accept multipart/form-data
 // @Produce json
@@ -102,7 +102,7 @@ func (h *ImageController) UploadImage(c *gin.Context) {
 		return
 	}
 
-	err = h.imageService.UploadImageLimitCheck(currentUserID.(uint), files)
+	err = h.imageService.UploadImageLimitCheck(c.Request.Context(), currentUserID.(uint), files)
 	if err != nil {
 		_, errorResponse := cerrors.NewErrorResponse(err)
 		h.hub.BroadcastToUser(currentUserID.(uint), "upload_processing_error", map[string]interface{}{
@@ -122,40 +122,16 @@ func (h *ImageController) UploadImage(c *gin.Context) {
 		req.Tags = append(req.Tags, tag)
 	}
 
-	// 在后台处理文件上传
-	go func() {
-		userID := currentUserID.(uint)
-
-		// 发送内部处理开始的消息
-		h.hub.BroadcastToUser(userID, "upload_processing_start", map[string]interface{}{
-			"message":    "Start processing images",
-			"file_count": len(files),
+	// 文件暂存后由任务队列在后台处理
+	if _, err := h.imageService.EnqueueUpload(c.Request.Context(), currentUserID.(uint), req.AlbumIDs, req.Tags, files); err != nil {
+		_, errorResponse := cerrors.NewErrorResponse(err)
+		h.hub.BroadcastToUser(currentUserID.(uint), "upload_processing_error", map[string]interface{}{
+			"message": "Image processing failed",
+			"error":   errorResponse.Message,
+			"code":    errorResponse.Code,
 		})
-
-		err = h.imageService.UploadImage(
-			userID,
-			req.AlbumIDs,
-			req.Tags,
-			files,
-		)
-
-		if err != nil {
-			_, errorResponse := cerrors.NewErrorResponse(err)
-			// 发送内部处理错误的消息
-			h.hub.BroadcastToUser(userID, "upload_processing_error", map[string]interface{}{
-				"message": "Image processing failed",
-				"error":   errorResponse.Message,
-				"code":    errorResponse.Code,
-			})
-			log.Errorf("Failed to process upload: %v", err)
-		} else {
-			// 发送内部处理完成的消息
-			h.hub.BroadcastToUser(userID, "upload_processing_complete", map[string]interface{}{
-				"message":    "Image processing completed",
-				"file_count": len(files),
-			})
-		}
-	}()
+		log.Ctx(c.Request.Context()).Errorf("Failed to enqueue upload: %v", err)
+	}
 }
 
 // GetImages 获取图片列表
@@ -278,7 +254,7 @@ func (h *ImageController) UpdateImage(c *gin.Context) {
 	}
 
 	for _, id := range req.IDs {
-		imageResponse, err := h.imageService.UpdateImage(currentUserID.(uint), id, req.OriginalName, req.Tags)
+		imageResponse, err := h.imageService.UpdateImage(c.Request.Context(), currentUserID.(uint), id, req.OriginalName, req.Tags)
 		if err != nil {
 			if ErrorIDs == nil {
 				ErrorIDs = make(map[uint]string)
@@ -343,9 +319,9 @@ func (h *ImageController) DeleteImage(c *gin.Context) {
 	isExistError := false
 	var ExistError error
 	for _, id := range ids {
-		err := h.imageService.DeleteImage(currentUserID.(uint), id)
+		err := h.imageService.DeleteImage(c.Request.Context(), currentUserID.(uint), id)
 		if err != nil {
-			log.Errorf("Failed to delete image %d: %v", id, err)
+			log.Ctx(c.Request.Context()).Errorf("Failed to delete image %d: %v", id, err)
 			isExistError = true
 			ExistError = err
 		} 
@@ -408,7 +384,7 @@ func (h *ImageController) AddImageToAlbum(c *gin.Context) {
 	var ErrorIDs map[uint]string
 	var SuccessIDs map[uint]string
 	for _, id := range req.IDs {
-		err := h.imageService.AddImageToAlbum(currentUserID.(uint), id, req.AlbumID)
+		err := h.imageService.AddImageToAlbum(c.Request.Context(), currentUserID.(uint), id, req.AlbumID)
 		if err != nil {
 			if errors.Is(err, cerrors.ErrAlbumNotFound) {
 				statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrAlbumNotFound)
@@ -478,7 +454,7 @@ func (h *ImageController) RemoveImageFromAlbum(c *gin.Context) {
 	var SuccessIDs map[uint]string
 
 	for _, id := range req.IDs {
-		err := h.imageService.RemoveImageFromAlbum(currentUserID.(uint), id, req.AlbumID)
+		err := h.imageService.RemoveImageFromAlbum(c.Request.Context(), currentUserID.(uint), id, req.AlbumID)
 		if err != nil {
 			if errors.Is(err, cerrors.ErrAlbumNotFound) {
 				statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrAlbumNotFound)
@@ -505,12 +481,12 @@ func (h *ImageController) RemoveImageFromAlbum(c *gin.Context) {
 }
 
 // SearchImagesByTagsOrTitle 标签或标题模糊搜索图片8
-// @Summary 标签或标题模糊搜索图片
-// @Description 标签、标题只提供其一可针对提供值的字段进行模糊搜索，若都提供则对两个值进行模糊搜索
+// @Summary 搜索图片
+// @Description 不带字段的词通过全文索引匹配标题、标签和相册名称描述，结果按相关度排序并在 highlight 中标记命中内容；支持 tag:、album:、type:、width:、height:、size:、created:、name: 字段及 AND、OR、NOT、括号和引号，如 tag:sunset -tag:draft size:<5mb
 // @Tags 图片管理
 // @Produce json
 // @Security ApiKeyAuth
-// @Param search_key query string false "搜索关键词"
+// @Param search_key query string false "搜索语句"
 // @Param page query int false "页码" default(1)
 // @Param page_size query int false "每页数量" default(10)
 // @Success 200 {object} success.DataResponse{data=services.GetImagesResponse}
@@ -554,3 +530,43 @@ func (h *ImageController) SearchImagesByTagsOrTitle(c *gin.Context) {
 
 	c.JSON(http.StatusOK, success.NewDataResponse("Images searched successfully", imagesResponse))
 }
+
+// BatchImages 批量操作图片
+// @Summary 批量操作图片
+// @Description 对指定ID或搜索结果中的图片执行同一操作，所有修改在一个事务中完成。operation 可选 add_tags、remove_tags、set_tags、add_to_album、remove_from_album、move_to_album、delete、set_visibility
+// @Tags 图片管理
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body services.BatchImageRequest true "批量操作参数"
+// @Success 200 {object} success.DataResponse{data=services.BatchImageResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/images/batch [post]
+func (h *ImageController) BatchImages(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	var req services.BatchImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	batchResponse, err := h.imageService.BatchImages(c.Request.Context(), currentUserID.(uint), req)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Batch operation completed", batchResponse))
+}
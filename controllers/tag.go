@@ -0,0 +1,153 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/success"
+	"github.com/leleo886/lopic/services"
+)
+
+type TagController struct {
+	tagService *services.TagService
+}
+
+func NewTagController(tagService *services.TagService) *TagController {
+	return &TagController{tagService: tagService}
+}
+
+type RenameTagRequest struct {
+	OldName string `json:"old_name" binding:"required"`
+	NewName string `json:"new_name" binding:"required"`
+}
+
+type MergeTagsRequest struct {
+	Sources []string `json:"sources" binding:"required"`
+	Target  string   `json:"target" binding:"required"`
+}
+
+// GetTags 按前缀获取标签
+// @Summary 按前缀获取标签
+// @Description 获取当前用户以指定前缀开头的标签及使用次数，按使用次数降序，用于输入补全
+// @Tags 标签
+// @Produce json
+// @Security ApiKeyAuth
+// @Param prefix query string false "标签前缀"
+// @Param limit query int false "返回数量" default(10)
+// @Success 200 {object} success.DataResponse{data=[]services.TagCloudItem}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/tags [get]
+func (h *TagController) GetTags(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	prefix, limit := TagQuery(c)
+	tags, err := h.tagService.GetTags(c.Request.Context(), currentUserID.(uint), prefix, limit)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Tags retrieved successfully", tags))
+}
+
+// RenameTag 重命名标签
+// @Summary 重命名标签
+// @Description 重命名当前用户的标签，新名称已存在时合并到该标签
+// @Tags 标签
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body RenameTagRequest true "标签名称"
+// @Success 200 {object} success.DataResponse{data=services.MergeTagsResult}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/tags/rename [put]
+func (h *TagController) RenameTag(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	var req RenameTagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	result, err := h.tagService.RenameTag(c.Request.Context(), currentUserID.(uint), req.OldName, req.NewName)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Tag renamed successfully", result))
+}
+
+// MergeTags 合并标签
+// @Summary 合并标签
+// @Description 将当前用户的多个标签合并到目标标签，目标标签不存在时自动创建
+// @Tags 标签
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body MergeTagsRequest true "源标签和目标标签"
+// @Success 200 {object} success.DataResponse{data=services.MergeTagsResult}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/tags/merge [post]
+func (h *TagController) MergeTags(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	var req MergeTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	result, err := h.tagService.MergeTags(c.Request.Context(), currentUserID.(uint), req.Sources, req.Target)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Tags merged successfully", result))
+}
+
+// TagQuery 解析标签查询的 prefix 和 limit 参数
+func TagQuery(c *gin.Context) (string, int) {
+	prefix := strings.TrimSpace(c.Query("prefix"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit < 1 || limit > 100 {
+		limit = 10
+	}
+	return prefix, limit
+}
@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/success"
+	"github.com/leleo886/lopic/services"
+)
+
+// TrashController 回收站控制器
+type TrashController struct {
+	trashService *services.TrashService
+}
+
+// NewTrashController 创建回收站控制器实例
+func NewTrashController(trashService *services.TrashService) *TrashController {
+	return &TrashController{trashService: trashService}
+}
+
+type TrashRequest struct {
+	IDs []uint `json:"ids" binding:"required"`
+}
+
+type TrashResponse struct {
+	SuccessIDs map[uint]string `json:"success_ids"`
+	ErrorIDs   map[uint]string `json:"error_ids"`
+}
+
+// GetTrashedImages 获取回收站中的图片
+// @Summary 获取回收站中的图片
+// @Description 获取当前用户回收站中的图片列表，按删除时间倒序
+// @Tags 回收站
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} success.DataResponse{data=services.GetImagesResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/trash/images [get]
+func (h *TrashController) GetTrashedImages(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	offset := (page - 1) * pageSize
+
+	imagesResponse, err := h.trashService.GetTrashedImages(c.Request.Context(), currentUserID.(uint), page, pageSize, offset)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Trashed images retrieved successfully", imagesResponse))
+}
+
+// GetTrashedAlbums 获取回收站中的相册
+// @Summary 获取回收站中的相册
+// @Description 获取当前用户回收站中的相册列表，按删除时间倒序
+// @Tags 回收站
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page query int false "页码" default(1)
+// @Param page_size query int false "每页数量" default(10)
+// @Success 200 {object} success.DataResponse{data=services.GetAlbumsResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/trash/albums [get]
+func (h *TrashController) GetTrashedAlbums(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	offset := (page - 1) * pageSize
+
+	albumsResponse, err := h.trashService.GetTrashedAlbums(c.Request.Context(), currentUserID.(uint), page, pageSize, offset)
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Trashed albums retrieved successfully", albumsResponse))
+}
+
+// RestoreImages 从回收站恢复图片
+// @Summary 从回收站恢复图片
+// @Description 恢复图片及其相册关联，回收站不计入配额时，超出存储配额的图片不会被恢复
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body TrashRequest true "图片ID列表"
+// @Success 200 {object} success.DataResponse{data=TrashResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/trash/images/restore [post]
+func (h *TrashController) RestoreImages(c *gin.Context) {
+	h.handleBatch(c, h.trashService.RestoreImage, "Restore success", "Images restored successfully")
+}
+
+// RestoreAlbums 从回收站恢复相册
+// @Summary 从回收站恢复相册
+// @Description 恢复相册及其图片关联，恢复时会检查相册数量限制
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body TrashRequest true "相册ID列表"
+// @Success 200 {object} success.DataResponse{data=TrashResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/trash/albums/restore [post]
+func (h *TrashController) RestoreAlbums(c *gin.Context) {
+	h.handleBatch(c, h.trashService.RestoreAlbum, "Restore success", "Albums restored successfully")
+}
+
+// PurgeImages 永久删除回收站中的图片
+// @Summary 永久删除回收站中的图片
+// @Description 永久删除图片记录和存储中的文件，无法恢复
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body TrashRequest true "图片ID列表"
+// @Success 200 {object} success.DataResponse{data=TrashResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/trash/images [delete]
+func (h *TrashController) PurgeImages(c *gin.Context) {
+	h.handleBatch(c, h.trashService.PurgeImage, "Purge success", "Images purged successfully")
+}
+
+// PurgeAlbums 永久删除回收站中的相册
+// @Summary 永久删除回收站中的相册
+// @Description 永久删除相册，相册中的图片不受影响
+// @Tags 回收站
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param req body TrashRequest true "相册ID列表"
+// @Success 200 {object} success.DataResponse{data=TrashResponse}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/trash/albums [delete]
+func (h *TrashController) PurgeAlbums(c *gin.Context) {
+	h.handleBatch(c, h.trashService.PurgeAlbum, "Purge success", "Albums purged successfully")
+}
+
+// EmptyTrash 清空回收站
+// @Summary 清空回收站
+// @Description 永久删除当前用户回收站中的所有图片和相册
+// @Tags 回收站
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} success.DataResponse{data=services.PurgeResult}
+// @Failure 400 {object} cerrors.ErrorResponse
+// @Failure 401 {object} cerrors.ErrorResponse
+// @Failure 403 {object} cerrors.ErrorResponse
+// @Failure 404 {object} cerrors.ErrorResponse
+// @Failure 500 {object} cerrors.ErrorResponse
+// @Router /api/trash [delete]
+func (h *TrashController) EmptyTrash(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	result, err := h.trashService.EmptyTrash(c.Request.Context(), currentUserID.(uint))
+	if err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(err)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse("Trash emptied successfully", result))
+}
+
+// handleBatch 对请求中的每个ID执行操作并汇总结果
+func (h *TrashController) handleBatch(c *gin.Context, action func(context.Context, uint, uint) error, itemMessage, message string) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrUnauthorized)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	var req TrashRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrBadRequest)
+		c.JSON(statusCode, errorResponse)
+		return
+	}
+
+	// remove duplicates
+	uniqueIDs := make(map[uint]bool)
+	for _, id := range req.IDs {
+		uniqueIDs[id] = true
+	}
+
+	var ErrorIDs map[uint]string
+	var SuccessIDs map[uint]string
+	for id := range uniqueIDs {
+		if err := action(c.Request.Context(), currentUserID.(uint), id); err != nil {
+			if ErrorIDs == nil {
+				ErrorIDs = make(map[uint]string)
+			}
+			ErrorIDs[id] = err.Error()
+		} else {
+			if SuccessIDs == nil {
+				SuccessIDs = make(map[uint]string)
+			}
+			SuccessIDs[id] = itemMessage
+		}
+	}
+
+	c.JSON(http.StatusOK, success.NewDataResponse(message, &TrashResponse{
+		SuccessIDs: SuccessIDs,
+		ErrorIDs:   ErrorIDs,
+	}))
+}
@@ -84,7 +84,7 @@ func (h *UserController) UpdateMe(c *gin.Context) {
 	}
 
 	// 更新用户信息
-	user, err := h.userService.UpdateMe(currentUserID.(uint), req.Username, req.Password)
+	user, err := h.userService.UpdateMe(c.Request.Context(), currentUserID.(uint), req.Username, req.Password)
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -142,7 +142,7 @@ func (h *UserController) GetImagesTagsCloud(c *gin.Context) {
 		c.JSON(statusCode, errorResponse)
 		return
 	}
-	tagsCloud, err := h.userService.GetImagesTagsCloud(currentUserID.(uint))
+	tagsCloud, err := h.userService.GetImagesTagsCloud(c.Request.Context(), currentUserID.(uint))
 	if err != nil {
 		statusCode, errorResponse := cerrors.NewErrorResponse(err)
 		c.JSON(statusCode, errorResponse)
@@ -5,14 +5,18 @@ import (
 	_ "embed"
 	"encoding/binary"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/models"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
 
@@ -27,6 +31,77 @@ type Config struct {
 	Swagger        SwaggerConfig         `mapstructure:"swagger"`
 	SystemSettings models.SystemSettings `mapstructure:"systemSettings"`
 	Log            LogConfig             `mapstructure:"log"`
+	Backup         BackupConfig          `mapstructure:"backup"`
+	Import         ImportConfig          `mapstructure:"import"`
+	Ingest         IngestConfig          `mapstructure:"ingest"`
+	Metrics        MetricsConfig         `mapstructure:"metrics"`
+	Tracing        TracingConfig         `mapstructure:"tracing"`
+	Health         HealthConfig          `mapstructure:"health"`
+}
+
+// HealthConfig 就绪检查配置结构体
+type HealthConfig struct {
+	MinFreeDiskMB       uint64 `mapstructure:"min_free_disk_mb"`      // 上传目录和备份目录所需的最小可用空间，默认 100 MB
+	StorageTimeout      int    `mapstructure:"storage_timeout"`       // 检查存储连接的超时秒数，默认 5
+	StorageCacheSeconds int    `mapstructure:"storage_cache_seconds"` // 存储检查结果的缓存秒数，默认 30
+}
+
+// MetricsConfig Prometheus 指标配置结构体
+// 配置 listen 时在单独的地址上提供 /metrics，否则在 API 端口上提供并要求 token
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Token   string `mapstructure:"token"`  // 访问 /metrics 需要的 Bearer 令牌
+	Listen  string `mapstructure:"listen"` // 单独监听的地址，如 127.0.0.1:9100
+}
+
+// ImportConfig 服务器目录导入配置结构体
+type ImportConfig struct {
+	AllowedDirs []string `mapstructure:"allowed_dirs"` // 管理员接口可以导入的目录，未配置时只能通过命令行导入
+}
+
+// TracingConfig OpenTelemetry 链路追踪配置结构体
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Exporter    string  `mapstructure:"exporter"`     // otlp 或 stdout，默认 otlp
+	Endpoint    string  `mapstructure:"endpoint"`     // OTLP/HTTP 地址，如 localhost:4318，为空时使用 OTEL_EXPORTER_OTLP_ENDPOINT
+	Insecure    bool    `mapstructure:"insecure"`     // OTLP 使用 HTTP 而不是 HTTPS
+	SampleRatio float64 `mapstructure:"sample_ratio"` // 采样比例，0 或 1 表示全部采样
+	ServiceName string  `mapstructure:"service_name"` // 默认 lopic
+}
+
+// IngestConfig 监视目录配置结构体，放入监视目录的图片会自动导入对应的用户
+type IngestConfig struct {
+	StableSeconds int            `mapstructure:"stable_seconds"` // 文件大小和修改时间保持不变多少秒后导入，默认 5 秒
+	Folders       []IngestFolder `mapstructure:"folders"`
+}
+
+// IngestFolder 监视目录，处理后的文件移动到其中的 done 或 failed 子目录
+type IngestFolder struct {
+	Path  string   `mapstructure:"path"`
+	User  string   `mapstructure:"user"`  // 导入的用户名
+	Album string   `mapstructure:"album"` // 默认相册，不存在时创建，为空时不加入相册
+	Tags  []string `mapstructure:"tags"`  // 导入的图片添加的标签
+}
+
+// BackupConfig 备份加密配置结构体
+type BackupConfig struct {
+	EncryptionKeyFile string `mapstructure:"encryption_key_file"` // 备份加密密钥文件，配置后未指定口令的备份（包括自动备份）使用该密钥加密
+}
+
+// EncryptionKey 读取备份加密密钥，未配置时返回空字符串
+func (c *BackupConfig) EncryptionKey() (string, error) {
+	if c == nil || c.EncryptionKeyFile == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(c.EncryptionKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup encryption key file: %v", err)
+	}
+	key := strings.TrimSpace(string(content))
+	if key == "" {
+		return "", fmt.Errorf("backup encryption key file %s is empty", c.EncryptionKeyFile)
+	}
+	return key, nil
 }
 
 // LogConfig 日志配置结构体
@@ -47,6 +122,8 @@ type ServerConfig struct {
 	StaticPath   string   `mapstructure:"static_path"`
 	UploadDir    string   `mapstructure:"upload_dir"`
 	AllowOrigins []string `mapstructure:"allowOrigins"`
+	// ShutdownTimeout 退出时等待请求和后台任务完成的秒数，默认 30
+	ShutdownTimeout int `mapstructure:"shutdown_timeout"`
 }
 
 // DatabaseConfig 数据库配置结构体
@@ -60,6 +137,8 @@ type DatabaseConfig struct {
 	Charset   string `mapstructure:"charset"`
 	ParseTime bool   `mapstructure:"parseTime"`
 	Loc       string `mapstructure:"loc"`
+	// SSLMode PostgreSQL 的 sslmode，默认 disable
+	SSLMode string `mapstructure:"sslmode"`
 }
 
 // JWTConfig JWT配置结构体
@@ -106,43 +185,54 @@ func ImportSystemSettingsToDatabase(db *gorm.DB, settings models.SystemSettings)
 	return db.Save(&systemSetting).Error
 }
 
-// 加载配置文件
+// LoadConfig 加载配置文件，环境变量（如 LOPIC_DATABASE_PASSWORD）覆盖文件中的配置，加载后校验配置
+// 配置文件不存在时从内嵌的默认配置创建，无法写入时（如只读的容器文件系统）直接使用默认配置
 func LoadConfig(configPath string) (*Config, error) {
 	if configPath == "" {
 		configPath = "configs/config.yaml"
 	}
 
+	v := viper.New()
+	v.SetConfigType("yaml")
+	v.SetDefault("database.charset", "utf8mb4")
+	v.SetDefault("database.loc", "Local")
+
 	// 检查配置文件是否存在
+	useDefaults := false
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		// 创建配置目录
-		configDir := filepath.Dir(configPath)
-		if err := os.MkdirAll(configDir, 0755); err != nil {
-			log.Errorf("failed to create config directory: %v", err)
-			return nil, fmt.Errorf("failed to create config directory: %v", err)
+		if err := writeDefaultConfig(configPath); err != nil {
+			log.Warn("failed to create default config file, using built-in defaults", zap.String("path", configPath), zap.Error(err))
+			useDefaults = true
+		} else {
+			log.Infof("created default config file: %s", configPath)
 		}
+	}
 
-		// 从内嵌的默认配置创建文件
-		if err := os.WriteFile(configPath, []byte(defaultConfigYAML), 0644); err != nil {
-			log.Errorf("failed to create default config file: %v", err)
-			return nil, fmt.Errorf("failed to create default config file: %v", err)
+	// 读取配置文件
+	if useDefaults {
+		if err := v.ReadConfig(strings.NewReader(defaultConfigYAML)); err != nil {
+			return nil, fmt.Errorf("failed to read default config: %v", err)
+		}
+	} else {
+		v.SetConfigFile(configPath)
+		if err := v.ReadInConfig(); err != nil {
+			log.Errorf("failed to read config file: %v", err)
+			return nil, fmt.Errorf("failed to read config file: %v", err)
 		}
-		log.Infof("created default config file: %s", configPath)
 	}
 
-	viper.SetConfigFile(configPath)
-	viper.SetConfigType("yaml")
-
-	// 读取配置文件
-	if err := viper.ReadInConfig(); err != nil {
-		log.Errorf("failed to read config file: %v", err)
-		return nil, fmt.Errorf("failed to read config file: %v", err)
+	if err := bindEnv(v); err != nil {
+		return nil, err
 	}
 
-	// 解析配置到结构体
+	// 解析配置到结构体，配置文件中有未知的配置项时报错
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	if err := v.UnmarshalExact(&config); err != nil {
 		log.Errorf("failed to unmarshal config: %v", err)
-		return nil, fmt.Errorf("failed to unmarshal config: %v", err)
+		return nil, fmt.Errorf("invalid config %s: %v", configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s:\n%v", configPath, err)
 	}
 
 	if config.Server.Mode == gin.ReleaseMode || !isSecureSecret(config.JWT.Secret) || !isSecureSecret(config.JWT.TokenSecret) {
@@ -159,12 +249,42 @@ func LoadConfig(configPath string) (*Config, error) {
 	return &config, nil
 }
 
+// writeDefaultConfig 从内嵌的默认配置创建配置文件
+func writeDefaultConfig(configPath string) error {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %v", err)
+	}
+	if err := os.WriteFile(configPath, []byte(defaultConfigYAML), 0644); err != nil {
+		return fmt.Errorf("failed to create default config file: %v", err)
+	}
+	return nil
+}
+
 // 获取数据库DSN字符串
 func (c *DatabaseConfig) GetDSN() string {
 	switch c.Type {
 	case "mysql":
 		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=%s&parseTime=%t&loc=%s",
 			c.User, c.Password, c.Host, c.Port, c.DBName, c.Charset, c.ParseTime, c.Loc)
+	case "postgres":
+		query := url.Values{}
+		sslMode := c.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		query.Set("sslmode", sslMode)
+		// loc 为 Local 时使用数据库服务器的时区
+		if c.Loc != "" && c.Loc != "Local" {
+			query.Set("TimeZone", c.Loc)
+		}
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.User, c.Password),
+			Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+			Path:     "/" + c.DBName,
+			RawQuery: query.Encode(),
+		}
+		return u.String()
 	case "sqlite":
 		return c.DBName
 	default:
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	t.Chdir(t.TempDir())
+	secretFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOPIC_SERVER_PORT", "8080")
+	t.Setenv("LOPIC_DATABASE_TYPE", "mysql")
+	t.Setenv("LOPIC_DATABASE_HOST", "db")
+	t.Setenv("LOPIC_DATABASE_PORT", "3306")
+	t.Setenv("LOPIC_DATABASE_USER", "lopic")
+	t.Setenv("LOPIC_DATABASE_DBNAME", "lopic")
+	t.Setenv("LOPIC_DATABASE_PASSWORD_FILE", secretFile)
+	t.Setenv("LOPIC_METRICS_ENABLED", "true")
+
+	// 配置文件不存在时创建默认配置
+	cfg, err := LoadConfig("configs/config.yaml")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if _, err := os.Stat("configs/config.yaml"); err != nil {
+		t.Errorf("default config file not created: %v", err)
+	}
+	if cfg.Server.Port != 8080 || !cfg.Metrics.Enabled || cfg.Database.Password != "from-file" || cfg.Database.Charset != "utf8mb4" {
+		t.Errorf("config = %+v %+v", cfg.Server, cfg.Database)
+	}
+	// 文件中的其他配置保留
+	if cfg.Server.UploadDir != "data/uploads" {
+		t.Errorf("upload_dir = %q, want data/uploads", cfg.Server.UploadDir)
+	}
+
+	redacted := cfg.Redacted()
+	if got := redacted["database"].(map[string]interface{})["password"]; got != redactedValue {
+		t.Errorf("redacted password = %v", got)
+	}
+	if _, ok := redacted["systemSettings"]; ok {
+		t.Error("redacted config contains systemSettings")
+	}
+
+	t.Setenv("LOPIC_DATABASE_PASSWORD", "both")
+	if _, err := LoadConfig("configs/config.yaml"); err == nil || !strings.Contains(err.Error(), "LOPIC_DATABASE_PASSWORD_FILE") {
+		t.Errorf("LoadConfig() with both variables error = %v", err)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	valid := defaultConfigYAML
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		want   string
+	}{
+		{"unknown key", strings.Replace(valid, "server:\n", "server:\n  prot: 1\n", 1), nil, "invalid keys: prot"},
+		{"unknown env", valid, map[string]string{"LOPIC_SERVR_PORT": "1"}, "LOPIC_SERVR_PORT"},
+		{"bad port", valid, map[string]string{"LOPIC_SERVER_PORT": "70000"}, "server.port"},
+		{"missing dsn", valid, map[string]string{"LOPIC_DATABASE_TYPE": "mysql"}, "database.host: is required"},
+		{"bad sslmode", valid, map[string]string{"LOPIC_DATABASE_TYPE": "postgres", "LOPIC_DATABASE_HOST": "db", "LOPIC_DATABASE_PORT": "5432",
+			"LOPIC_DATABASE_USER": "lopic", "LOPIC_DATABASE_DBNAME": "lopic", "LOPIC_DATABASE_SSLMODE": "on"}, "database.sslmode"},
+		{"bad listen", valid, map[string]string{"LOPIC_METRICS_LISTEN": "9100"}, "metrics.listen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			_, err := LoadConfig(writeConfig(t, tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadConfig() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetDSNPostgres(t *testing.T) {
+	cfg := DatabaseConfig{Type: "postgres", Host: "db", Port: 5432, User: "lopic", Password: "p@ss word/", DBName: "lopic", Loc: "Local"}
+	if got, want := cfg.GetDSN(), "postgres://lopic:p%40ss%20word%2F@db:5432/lopic?sslmode=disable"; got != want {
+		t.Errorf("GetDSN() = %q, want %q", got, want)
+	}
+
+	cfg.Host, cfg.SSLMode, cfg.Loc = "::1", "require", "Asia/Shanghai"
+	if got, want := cfg.GetDSN(), "postgres://lopic:p%40ss%20word%2F@[::1]:5432/lopic?TimeZone=Asia%2FShanghai&sslmode=require"; got != want {
+		t.Errorf("GetDSN() = %q, want %q", got, want)
+	}
+}
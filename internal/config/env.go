@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix 环境变量前缀，配置项的 . 替换为 _ 后转为大写，如 LOPIC_DATABASE_PASSWORD 覆盖 database.password
+// 加 _FILE 后缀的环境变量指向的文件内容作为配置值，用于 Docker 和 Kubernetes 的 secrets
+const EnvPrefix = "LOPIC"
+
+// envSkippedKeys 不通过环境变量配置的配置项，系统设置保存在数据库中
+var envSkippedKeys = map[string]bool{"systemsettings": true}
+
+// EnvName 返回配置项对应的环境变量名
+func EnvName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// bindEnv 将所有配置项绑定到环境变量，设置了未知的 LOPIC_ 环境变量时报错
+func bindEnv(v *viper.Viper) error {
+	known := make(map[string]bool)
+	for _, key := range configKeys(reflect.TypeOf(Config{}), "") {
+		name := EnvName(key)
+		known[name] = true
+		known[name+"_FILE"] = true
+
+		file, hasFile := os.LookupEnv(name + "_FILE")
+		if !hasFile {
+			if err := v.BindEnv(key, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, ok := os.LookupEnv(name); ok {
+			return fmt.Errorf("both %s and %s_FILE are set", name, name)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s_FILE: %v", name, err)
+		}
+		v.Set(key, strings.TrimRight(string(content), "\r\n"))
+	}
+
+	var unknown []string
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, EnvPrefix+"_") && !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown environment variables: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// configKeys 返回结构体中所有配置项的键（小写，以 . 分隔），切片和 map 作为一个配置项
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := strings.ToLower(tag)
+		if prefix != "" {
+			key = prefix + "." + key
+		} else if envSkippedKeys[key] {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(field.Type, key)...)
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
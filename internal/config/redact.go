@@ -0,0 +1,44 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// redactedValue 替换敏感配置项的值
+const redactedValue = "******"
+
+// secretKeys 敏感的配置项名称
+var secretKeys = map[string]bool{"password": true, "secret": true, "token_secret": true, "token": true}
+
+// Redacted 返回以配置项为键的配置，敏感配置项的值被替换，用于输出生效的配置
+func (c *Config) Redacted() map[string]interface{} {
+	return redact(reflect.ValueOf(*c), true)
+}
+
+func redact(v reflect.Value, root bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("mapstructure")
+		if tag == "" || tag == "-" || (root && envSkippedKeys[strings.ToLower(tag)]) {
+			continue
+		}
+		field := v.Field(i)
+		switch {
+		case field.Kind() == reflect.Struct:
+			result[tag] = redact(field, false)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct:
+			items := make([]interface{}, field.Len())
+			for j := range items {
+				items[j] = redact(field.Index(j), false)
+			}
+			result[tag] = items
+		case secretKeys[tag] && field.Kind() == reflect.String && field.String() != "":
+			result[tag] = redactedValue
+		default:
+			result[tag] = field.Interface()
+		}
+	}
+	return result
+}
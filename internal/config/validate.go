@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Validate 校验配置，返回所有不合法的配置项
+func (c *Config) Validate() error {
+	var errs []error
+	add := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	// 服务器
+	if !validPort(c.Server.Port) {
+		add("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	switch c.Server.Mode {
+	case gin.DebugMode, gin.ReleaseMode, gin.TestMode:
+	default:
+		add("server.mode", "must be debug, release or test, got %q", c.Server.Mode)
+	}
+	if c.Server.UploadDir == "" {
+		add("server.upload_dir", "is required")
+	}
+	if !strings.HasPrefix(c.Server.StaticPath, "/") {
+		add("server.static_path", "must start with /, got %q", c.Server.StaticPath)
+	}
+	if c.Server.ShutdownTimeout < 0 {
+		add("server.shutdown_timeout", "must not be negative")
+	}
+
+	// 数据库
+	switch c.Database.Type {
+	case "sqlite":
+		if c.Database.DBName == "" {
+			add("database.dbname", "is required (path of the sqlite database file)")
+		}
+	case "mysql", "postgres":
+		required := []struct{ key, value string }{{"host", c.Database.Host}, {"user", c.Database.User}, {"dbname", c.Database.DBName}}
+		for _, field := range required {
+			if field.value == "" {
+				add("database."+field.key, "is required for %s", c.Database.Type)
+			}
+		}
+		if !validPort(c.Database.Port) {
+			add("database.port", "must be between 1 and 65535, got %d", c.Database.Port)
+		}
+		if c.Database.Type == "postgres" {
+			switch c.Database.SSLMode {
+			case "", "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+			default:
+				add("database.sslmode", "must be disable, allow, prefer, require, verify-ca or verify-full, got %q", c.Database.SSLMode)
+			}
+		}
+	default:
+		add("database.type", "must be sqlite, mysql or postgres, got %q", c.Database.Type)
+	}
+
+	// JWT
+	if c.JWT.Expire <= 0 {
+		add("jwt.expire", "must be positive, got %d", c.JWT.Expire)
+	}
+	if c.JWT.RefreshTokenExpire <= 0 {
+		add("jwt.refresh_token_expire", "must be positive, got %d", c.JWT.RefreshTokenExpire)
+	}
+
+	// 日志
+	switch strings.ToLower(c.Log.Level) {
+	case "", "debug", "info", "warn", "error":
+	default:
+		add("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+
+	// 监视目录
+	if c.Ingest.StableSeconds < 0 {
+		add("ingest.stable_seconds", "must not be negative")
+	}
+	for i, folder := range c.Ingest.Folders {
+		if folder.Path == "" || folder.User == "" {
+			add(fmt.Sprintf("ingest.folders[%d]", i), "path and user are required")
+		}
+	}
+
+	// 指标和链路追踪
+	if c.Metrics.Listen != "" {
+		if err := validListenAddress(c.Metrics.Listen); err != nil {
+			add("metrics.listen", "%v", err)
+		}
+	}
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		add("tracing.exporter", "must be otlp or stdout, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		add("tracing.sample_ratio", "must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+
+	// 就绪检查
+	if c.Health.StorageTimeout < 0 || c.Health.StorageCacheSeconds < 0 {
+		add("health", "storage_timeout and storage_cache_seconds must not be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+// validListenAddress 校验 host:port 格式的监听地址
+func validListenAddress(address string) error {
+	_, portText, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("must be host:port, got %q", address)
+	}
+	port, err := strconv.Atoi(portText)
+	if err != nil || !validPort(port) {
+		return fmt.Errorf("invalid port in %q", address)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	at := func(y int, m time.Month, d, h, min int) time.Time { return time.Date(y, m, d, h, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{expr: "0 3 * * *", from: at(2024, 5, 10, 2, 59), want: at(2024, 5, 10, 3, 0)},
+		{expr: "0 3 * * *", from: at(2024, 5, 10, 3, 0), want: at(2024, 5, 11, 3, 0)},
+		{expr: "*/15 * * * *", from: at(2024, 5, 10, 3, 7), want: at(2024, 5, 10, 3, 15)},
+		{expr: "30 2 * * sun", from: at(2024, 5, 10, 0, 0), want: at(2024, 5, 12, 2, 30)},
+		{expr: "0 0 1 jan-mar/2 *", from: at(2024, 1, 1, 0, 0), want: at(2024, 3, 1, 0, 0)},
+		{expr: "0 0 29 2 *", from: at(2023, 3, 1, 0, 0), want: at(2024, 2, 29, 0, 0)},
+		{expr: "0 12 13 * 5", from: at(2024, 5, 10, 12, 0), want: at(2024, 5, 13, 12, 0)},
+		{expr: "0 12 * * 7", from: at(2024, 5, 10, 12, 0), want: at(2024, 5, 12, 12, 0)},
+		{expr: "@daily", from: at(2024, 12, 31, 23, 59), want: at(2025, 1, 1, 0, 0)},
+		{expr: "0 0 31 2 *", from: at(2024, 1, 1, 0, 0), want: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", tt.expr, err)
+			}
+			if got := schedule.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, want %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "a * * * *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", expr)
+		}
+	}
+}
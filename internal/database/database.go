@@ -8,6 +8,7 @@ import (
 	"github.com/leleo886/lopic/internal/config"
 	"github.com/leleo886/lopic/internal/log"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"github.com/glebarez/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -24,6 +25,8 @@ func Connect(config *config.DatabaseConfig) (*gorm.DB, error) {
 	switch config.Type {
 	case "mysql":
 		dialector = mysql.Open(config.GetDSN())
+	case "postgres":
+		dialector = postgres.Open(config.GetDSN())
 	case "sqlite":
 		// 创建SQLite数据库文件（如果不存在）
 		if _, err := os.Stat(config.DBName); os.IsNotExist(err) {
@@ -0,0 +1,21 @@
+package database
+
+import "gorm.io/gorm"
+
+// Like 返回不区分大小写的模糊匹配运算符
+// MySQL 和 SQLite 的 LIKE 默认不区分大小写，PostgreSQL 需使用 ILIKE
+func Like(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return "ILIKE"
+	}
+	return "LIKE"
+}
+
+// Text 返回将列转为文本的表达式，用于在 JSON 列上模糊匹配
+// PostgreSQL 的 json 类型不支持 LIKE，需先转为 text
+func Text(db *gorm.DB, column string) string {
+	if db.Dialector.Name() == "postgres" {
+		return column + "::text"
+	}
+	return column
+}
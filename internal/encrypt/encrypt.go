@@ -0,0 +1,233 @@
+// Package encrypt 实现备份归档的流式认证加密
+//
+// 格式：魔数 "LOPICENC" | 版本(1) | scrypt logN(1) | 盐(16) | 数据块...
+// 数据使用 scrypt 从口令派生的密钥进行 AES-256-GCM 加密，每块 64KiB 明文，
+// nonce 为 11 字节块序号加 1 字节结束标记，最后一块带结束标记，可检测截断、重排和篡改
+package encrypt
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	magic     = "LOPICENC"
+	version   = 1
+	saltSize  = 16
+	chunkSize = 64 * 1024
+	// scrypt 参数 N = 2^logN
+	defaultLogN = 15
+	maxLogN     = 20
+)
+
+// HeaderSize 加密文件头的长度
+const HeaderSize = len(magic) + 2 + saltSize
+
+var (
+	// ErrDecrypt 口令错误或数据被篡改
+	ErrDecrypt = errors.New("encrypt: wrong passphrase or corrupted data")
+	// ErrTruncated 数据不完整
+	ErrTruncated = errors.New("encrypt: data is truncated")
+	// ErrEmptyPassphrase 口令为空
+	ErrEmptyPassphrase = errors.New("encrypt: passphrase is empty")
+)
+
+// IsEncrypted 判断数据开头是否为加密文件头
+func IsEncrypted(header []byte) bool {
+	return len(header) >= len(magic) && string(header[:len(magic)]) == magic
+}
+
+func deriveAEAD(passphrase string, salt []byte, logN byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<logN, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(counter uint64, last bool) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[3:11], counter)
+	if last {
+		n[11] = 1
+	}
+	return n
+}
+
+type writer struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint64
+	closed  bool
+}
+
+// NewWriter 返回加密写入器，必须调用 Close 写入最后一块
+func NewWriter(dst io.Writer, passphrase string) (io.WriteCloser, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := deriveAEAD(passphrase, salt, defaultLogN)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(magic), version, defaultLogN)
+	header = append(header, salt...)
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+	return &writer{dst: dst, aead: aead, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("encrypt: write after close")
+	}
+	written := 0
+	for len(p) > 0 {
+		// 缓冲区满且还有数据时才写出，保证最后一块由 Close 写出
+		if len(w.buf) == chunkSize {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (w *writer) flush(last bool) error {
+	sealed := w.aead.Seal(nil, nonce(w.counter, last), w.buf, nil)
+	if _, err := w.dst.Write(sealed); err != nil {
+		return err
+	}
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close 写入最后一块，不会关闭底层写入器
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+type reader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	buf     []byte // 密文块
+	out     []byte // 明文块，解密失败时会被清零，不能与 buf 共用
+	plain   []byte
+	counter uint64
+	done    bool
+}
+
+// NewReader 返回解密读取器，读取到末尾前遇到错误时返回 ErrDecrypt 或 ErrTruncated
+func NewReader(src io.Reader, passphrase string) (io.Reader, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	header := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(src, header); err != nil {
+		return nil, ErrTruncated
+	}
+	if !IsEncrypted(header) {
+		return nil, errors.New("encrypt: not an encrypted file")
+	}
+	if header[len(magic)] != version {
+		return nil, fmt.Errorf("encrypt: unsupported version %d", header[len(magic)])
+	}
+	logN := header[len(magic)+1]
+	if logN == 0 || logN > maxLogN {
+		return nil, fmt.Errorf("encrypt: invalid scrypt parameter %d", logN)
+	}
+	aead, err := deriveAEAD(passphrase, header[len(magic)+2:], logN)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{
+		src:  bufio.NewReaderSize(src, chunkSize+aead.Overhead()+1),
+		aead: aead,
+		buf:  make([]byte, chunkSize+aead.Overhead()),
+		out:  make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *reader) next() error {
+	n, err := io.ReadFull(r.src, r.buf)
+	if err == io.EOF {
+		return ErrTruncated
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	// 读满一块后再看是否还有数据，没有则为最后一块
+	last := n < len(r.buf)
+	if !last {
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+
+	plain, err := r.aead.Open(r.out[:0], nonce(r.counter, last), r.buf[:n], nil)
+	if err != nil {
+		if last {
+			// 恰好在块边界被截断时，该块按非最后一块可以解密
+			if _, openErr := r.aead.Open(nil, nonce(r.counter, false), r.buf[:n], nil); openErr == nil {
+				return ErrTruncated
+			}
+		}
+		return ErrDecrypt
+	}
+	r.counter++
+	r.plain = plain
+	r.done = last
+	return nil
+}
+
+// Verify 完整解密数据以检查口令和完整性，不保存明文
+func Verify(src io.Reader, passphrase string) error {
+	r, err := NewReader(src, passphrase)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
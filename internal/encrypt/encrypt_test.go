@@ -0,0 +1,76 @@
+package encrypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func encrypt(t *testing.T, data []byte, passphrase string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17} {
+		data := make([]byte, size)
+		rand.Read(data)
+		sealed := encrypt(t, data, "secret")
+		if !IsEncrypted(sealed) {
+			t.Fatalf("size %d: missing header", size)
+		}
+
+		r, err := NewReader(bytes.NewReader(sealed), "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("size %d: plaintext mismatch", size)
+		}
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	data := make([]byte, 2*chunkSize+100)
+	sealed := encrypt(t, data, "secret")
+	overhead := 16
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		want       error
+	}{
+		{"wrong passphrase", sealed, "wrong", ErrDecrypt},
+		{"truncated at chunk boundary", sealed[:HeaderSize+2*(chunkSize+overhead)], "secret", ErrTruncated},
+		{"truncated after header", sealed[:HeaderSize], "secret", ErrTruncated},
+		{"tampered", append(append([]byte{}, sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1), "secret", ErrDecrypt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(bytes.NewReader(tt.data), tt.passphrase); err != tt.want {
+				t.Errorf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if err := Verify(bytes.NewReader(sealed), "secret"); err != nil {
+		t.Errorf("Verify() = %v, want nil", err)
+	}
+}
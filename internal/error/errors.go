@@ -243,6 +243,31 @@ var (
 		Message:    "image already in album",
 		StatusCode: http.StatusConflict,
 	}
+	ErrInvalidBatchOperation = &AppError{
+		Code:       "INVALID_BATCH_OPERATION",
+		Message:    "invalid batch operation",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrBatchTooLarge = &AppError{
+		Code:       "BATCH_TOO_LARGE",
+		Message:    "too many images in one batch",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrTagNotFound = &AppError{
+		Code:       "TAG_NOT_FOUND",
+		Message:    "tag not found",
+		StatusCode: http.StatusNotFound,
+	}
+	ErrInvalidTagName = &AppError{
+		Code:       "INVALID_TAG_NAME",
+		Message:    "invalid tag name",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrInvalidSearchQuery = &AppError{
+		Code:       "INVALID_SEARCH_QUERY",
+		Message:    "invalid search query",
+		StatusCode: http.StatusBadRequest,
+	}
 	ErrUnsupportedMimeType = &AppError{
 		Code:       "UNSUPPORTED_MIME_TYPE",
 		Message:    "unsupported mime type",
@@ -332,6 +357,11 @@ var (
 		Message:    "storage is associated with existing images, cannot be deleted",
 		StatusCode: http.StatusForbidden,
 	}
+	ErrStorageAssociatedWithBackups = &AppError{
+		Code:       "STORAGE_ASSOCIATED_WITH_BACKUPS",
+		Message:    "storage is used as backup destination or holds existing backups, cannot be deleted",
+		StatusCode: http.StatusForbidden,
+	}
 	ErrStorageConnectionFailed = &AppError{
 		Code:       "STORAGE_CONNECTION_FAILED",
 		Message:    "failed to connect to storage",
@@ -389,11 +419,107 @@ var (
 		Message:    "error restoring SQLite database",
 		StatusCode: http.StatusInternalServerError,
 	}
+	ErrPortableRestore = &AppError{
+		Code:       "PORTABLE_RESTORE_ERROR",
+		Message:    "error importing portable database backup",
+		StatusCode: http.StatusInternalServerError,
+	}
 	ErrRestoreFiles = &AppError{
 		Code:       "RESTORE_FILES_ERROR",
 		Message:    "error restoring files",
 		StatusCode: http.StatusInternalServerError,
 	}
+	ErrInvalidBackupDestination = &AppError{
+		Code:       "INVALID_BACKUP_DESTINATION",
+		Message:    "backup destination must be an existing remote storage",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrBackupUpload = &AppError{
+		Code:       "BACKUP_UPLOAD_ERROR",
+		Message:    "error uploading backup to destination storage",
+		StatusCode: http.StatusInternalServerError,
+	}
+	ErrInvalidBackupSchedule = &AppError{
+		Code:       "INVALID_BACKUP_SCHEDULE",
+		Message:    "invalid backup schedule",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrBackupHasDependents = &AppError{
+		Code:       "BACKUP_HAS_DEPENDENTS",
+		Message:    "backup is the base of incremental backups, delete them first",
+		StatusCode: http.StatusConflict,
+	}
+	ErrBackupChainBroken = &AppError{
+		Code:       "BACKUP_CHAIN_BROKEN",
+		Message:    "a backup in the incremental backup chain is missing",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrBackupPassphraseRequired = &AppError{
+		Code:       "BACKUP_PASSPHRASE_REQUIRED",
+		Message:    "backup is encrypted, passphrase is required",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrBackupDecrypt = &AppError{
+		Code:       "BACKUP_DECRYPT_ERROR",
+		Message:    "failed to decrypt backup, wrong passphrase or corrupted archive",
+		StatusCode: http.StatusBadRequest,
+	}
+	ErrBackupCorrupted = &AppError{
+		Code:       "BACKUP_CORRUPTED",
+		Message:    "backup archive is corrupted",
+		StatusCode: http.StatusBadRequest,
+	}
+
+	// Export errors
+	ErrExportNotFound = &AppError{
+		Code:       "EXPORT_NOT_FOUND",
+		Message:    "export not found",
+		StatusCode: http.StatusNotFound,
+	}
+	ErrExportInProgress = &AppError{
+		Code:       "EXPORT_IN_PROGRESS",
+		Message:    "an export for this user is already in progress",
+		StatusCode: http.StatusConflict,
+	}
+	ErrExportExpired = &AppError{
+		Code:       "EXPORT_EXPIRED",
+		Message:    "export download link has expired",
+		StatusCode: http.StatusGone,
+	}
+
+	// Import errors
+	ErrDuplicateImage = &AppError{
+		Code:       "DUPLICATE_IMAGE",
+		Message:    "the same image already exists",
+		StatusCode: http.StatusConflict,
+	}
+	ErrImportDirNotAllowed = &AppError{
+		Code:       "IMPORT_DIR_NOT_ALLOWED",
+		Message:    "import directory is not under an allowed import directory",
+		StatusCode: http.StatusForbidden,
+	}
+	ErrImportDirNotFound = &AppError{
+		Code:       "IMPORT_DIR_NOT_FOUND",
+		Message:    "import directory not found",
+		StatusCode: http.StatusNotFound,
+	}
+
+	// Job errors
+	ErrJobNotFound = &AppError{
+		Code:       "JOB_NOT_FOUND",
+		Message:    "job not found",
+		StatusCode: http.StatusNotFound,
+	}
+	ErrJobNotCancelable = &AppError{
+		Code:       "JOB_NOT_CANCELABLE",
+		Message:    "only pending or running jobs can be canceled",
+		StatusCode: http.StatusConflict,
+	}
+	ErrJobNotRetryable = &AppError{
+		Code:       "JOB_NOT_RETRYABLE",
+		Message:    "only failed or canceled jobs can be retried",
+		StatusCode: http.StatusConflict,
+	}
 
 )
 
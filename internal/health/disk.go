@@ -0,0 +1,36 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DiskSpace 检查 path 所在文件系统的可用空间不少于 minFreeMB，path 不存在时检查最近的上级目录，不支持的平台上跳过
+func DiskSpace(path string, minFreeMB uint64) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		free, err := freeBytes(existingParent(path))
+		if err != nil {
+			return err
+		}
+		if freeMB := free / 1024 / 1024; freeMB < minFreeMB {
+			return fmt.Errorf("%d MB free, need at least %d MB", freeMB, minFreeMB)
+		}
+		return nil
+	}
+}
+
+func existingParent(path string) string {
+	path = filepath.Clean(path)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
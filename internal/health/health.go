@@ -0,0 +1,157 @@
+// Package health 执行就绪检查并汇总每项检查的结果
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK      = "ok"
+	StatusFail    = "fail"
+	StatusSkipped = "skipped"
+
+	// defaultTimeout 未指定超时时间时单项检查的超时时间
+	defaultTimeout = 5 * time.Second
+)
+
+// ErrSkipped 检查不适用（如未启用邮件）时返回，不影响就绪状态
+var ErrSkipped = errors.New("check skipped")
+
+// Check 单项检查，Run 超时后检查结果为失败
+type Check struct {
+	Name    string
+	Timeout time.Duration
+	Run     func(ctx context.Context) error
+}
+
+// Result 单项检查的结果
+type Result struct {
+	Status string `json:"status"`
+	// Error 失败原因，可能包含存储地址、SMTP 主机等内部信息，只写入日志，不返回给客户端
+	Error      string `json:"-"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Report 就绪检查的结果，所有检查都成功或跳过时 Status 为 ok
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Ready 返回是否所有检查都成功或跳过
+func (r *Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Run 并发执行所有检查
+func Run(ctx context.Context, checks []Check) *Report {
+	report := &Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := runCheck(ctx, check)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			if result.Status == StatusFail {
+				report.Status = StatusFail
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func runCheck(ctx context.Context, check Check) Result {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		done <- check.Run(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	result := Result{Status: StatusOK, DurationMS: time.Since(start).Milliseconds()}
+	switch {
+	case errors.Is(err, ErrSkipped):
+		result.Status = StatusSkipped
+	case err != nil:
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Cache 缓存检查结果，用于开销较大或可能长时间阻塞的检查（如远程存储）
+// 同一时间只执行一次检查，超时返回后检查仍在后台执行，完成后更新缓存
+type Cache struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	err       error
+	checkedAt time.Time
+	running   chan struct{}
+}
+
+// NewCache 创建缓存，检查结果在 ttl 内有效
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl}
+}
+
+// Do 返回缓存的结果，缓存过期时执行 fn，fn 不支持取消时由 ctx 控制等待时间
+func (c *Cache) Do(ctx context.Context, fn func() error) error {
+	c.mu.Lock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.ttl {
+		err := c.err
+		c.mu.Unlock()
+		return err
+	}
+	running := c.running
+	if running == nil {
+		running = make(chan struct{})
+		c.running = running
+		go func() {
+			err := fn()
+			c.mu.Lock()
+			c.err = err
+			c.checkedAt = time.Now()
+			c.running = nil
+			c.mu.Unlock()
+			close(running)
+		}()
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-running:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	report := Run(context.Background(), []Check{
+		{Name: "ok", Run: func(ctx context.Context) error { return nil }},
+		{Name: "skipped", Run: func(ctx context.Context) error { return ErrSkipped }},
+		{Name: "broken", Run: func(ctx context.Context) error { return errors.New("connection refused") }},
+		{Name: "slow", Timeout: 20 * time.Millisecond, Run: func(ctx context.Context) error { <-block; return nil }},
+		{Name: "panic", Run: func(ctx context.Context) error { panic("boom") }},
+	})
+
+	if report.Ready() || report.Status != StatusFail {
+		t.Errorf("report status = %s, want %s", report.Status, StatusFail)
+	}
+	want := map[string]string{"ok": StatusOK, "skipped": StatusSkipped, "broken": StatusFail, "slow": StatusFail, "panic": StatusFail}
+	for name, status := range want {
+		if got := report.Checks[name]; got.Status != status {
+			t.Errorf("check %s = %+v, want %s", name, got, status)
+		}
+	}
+	if !strings.Contains(report.Checks["slow"].Error, "timed out") {
+		t.Errorf("slow check error = %q", report.Checks["slow"].Error)
+	}
+	// 失败原因不返回给客户端
+	if data, err := json.Marshal(report); err != nil || strings.Contains(string(data), "connection refused") {
+		t.Errorf("report JSON = %s, %v, want no error details", data, err)
+	}
+
+	report = Run(context.Background(), []Check{{Name: "skipped", Run: func(ctx context.Context) error { return ErrSkipped }}})
+	if !report.Ready() {
+		t.Errorf("report with skipped check = %+v, want ready", report)
+	}
+}
+
+func TestCache(t *testing.T) {
+	cache := NewCache(time.Hour)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	fn := func() error {
+		calls.Add(1)
+		<-release
+		return errors.New("unreachable")
+	}
+
+	// 超时返回后检查仍在执行，不会重复执行
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		if err := cache.Do(ctx, fn); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Do() while running error = %v", err)
+		}
+		cancel()
+	}
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := cache.Do(context.Background(), fn); err != nil && err.Error() == "unreachable" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cached result not available")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("check ran %d times, want 1", calls.Load())
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := DiskSpace(dir+"/missing/uploads", 0)(context.Background()); err != nil && !errors.Is(err, ErrSkipped) {
+		t.Errorf("DiskSpace() error = %v", err)
+	}
+	if err := DiskSpace(dir, 1<<40)(context.Background()); err == nil {
+		t.Error("DiskSpace() with 1 EB requirement succeeded")
+	}
+}
@@ -0,0 +1,77 @@
+package log
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+type fieldsKey struct{}
+
+// WithFields 返回附加了日志字段的 context，通过 Ctx 输出的日志会带上这些字段
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	existing := Fields(ctx)
+	merged := make([]zap.Field, 0, len(existing)+len(fields))
+	merged = append(merged, existing...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// Fields 返回 context 中的日志字段，包括 WithFields 附加的字段和当前 span 的 trace_id
+func Fields(ctx context.Context) []zap.Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]zap.Field)
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		fields = append(fields[:len(fields):len(fields)], zap.String("trace_id", sc.TraceID().String()))
+	}
+	return fields
+}
+
+// ContextLogger 带有 context 中日志字段（如请求 ID 和用户 ID）的日志
+type ContextLogger struct {
+	fields []zap.Field
+}
+
+// Ctx 返回带有 ctx 中日志字段的日志，用于将请求 ID 和用户 ID 带入服务层的日志
+func Ctx(ctx context.Context) *ContextLogger {
+	return &ContextLogger{fields: Fields(ctx)}
+}
+
+// Info 输出info级别的日志
+func (l *ContextLogger) Info(msg string, fields ...zap.Field) {
+	if Logger != nil {
+		Logger.Info(msg, append(fields, l.fields...)...)
+	}
+}
+
+// Warn 输出warn级别的日志
+func (l *ContextLogger) Warn(msg string, fields ...zap.Field) {
+	if Logger != nil {
+		Logger.Warn(msg, append(fields, l.fields...)...)
+	}
+}
+
+// Error 输出error级别的日志
+func (l *ContextLogger) Error(msg string, fields ...zap.Field) {
+	if Logger != nil {
+		Logger.Error(msg, append(fields, l.fields...)...)
+	}
+}
+
+// Infof 格式化输出info级别的日志
+func (l *ContextLogger) Infof(format string, args ...interface{}) {
+	if Logger != nil {
+		Logger.Info(fmt.Sprintf(format, args...), l.fields...)
+	}
+}
+
+// Errorf 格式化输出error级别的日志
+func (l *ContextLogger) Errorf(format string, args ...interface{}) {
+	if Logger != nil {
+		Logger.Error(fmt.Sprintf(format, args...), l.fields...)
+	}
+}
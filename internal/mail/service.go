@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/smtp"
+	"time"
 
 	"github.com/jordan-wright/email"
 	cerrors "github.com/leleo886/lopic/internal/error"
@@ -64,6 +65,20 @@ func (s *MailService) IsEnabled() bool {
 	return s.enabled
 }
 
+// Validate 检查发送邮件所需的配置是否完整
+func (s *MailService) Validate() error {
+	if s.smtpHost == "" {
+		return fmt.Errorf("smtp host is not configured")
+	}
+	if s.smtpPort <= 0 || s.smtpPort > 65535 {
+		return fmt.Errorf("invalid smtp port: %d", s.smtpPort)
+	}
+	if s.from == "" {
+		return fmt.Errorf("smtp sender address is not configured")
+	}
+	return nil
+}
+
 func (s *MailService) SendResetPasswordCode(to, code, locale string) error {
 	data := struct {
 		Code string
@@ -98,6 +113,21 @@ func (s *MailService) SendEmailVerification(to, username, verifyLink, locale str
 	return s.sendTemplate("email_verification.html", "Email Verification", to, data)
 }
 
+// SendBackupFailed 通知管理员自动备份失败
+func (s *MailService) SendBackupFailed(to string, taskID uint, startTime time.Time, errMsg string) error {
+	data := struct {
+		TaskID    uint
+		StartTime string
+		Error     string
+	}{
+		TaskID:    taskID,
+		StartTime: startTime.Format("2006-01-02 15:04:05"),
+		Error:     errMsg,
+	}
+
+	return s.sendTemplate("backup_failed.html", "Scheduled Backup Failed", to, data)
+}
+
 func (s *MailService) sendTemplate(templateName, subject, to string, data interface{}) error {
 	tpl, err := template.ParseFS(templatesFS, "templates/"+templateName)
 	if err != nil {
@@ -0,0 +1,162 @@
+// Package metrics Prometheus 指标
+//
+// 指标注册在独立的 Registry 中，通过 Handler 以 /metrics 暴露。
+package metrics
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "lopic"
+
+// Registry 所有指标注册在此
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route template and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route template.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	uploads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploads_total",
+		Help:      "Uploaded images by storage backend and result.",
+	}, []string{"storage", "result"})
+
+	uploadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_bytes_total",
+		Help:      "Bytes of successfully uploaded images by storage backend.",
+	}, []string{"storage"})
+
+	thumbnailDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "thumbnail_duration_seconds",
+		Help:      "Time spent generating and storing a thumbnail.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+
+	backupDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backup_duration_seconds",
+		Help:      "Duration of backup and restore runs by operation and result.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1800, 3600},
+	}, []string{"operation", "result"})
+
+	rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by the rate limiter by route template.",
+	}, []string{"route"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration,
+		uploads, uploadBytes, thumbnailDuration,
+		backupDuration, rateLimitRejections,
+	)
+}
+
+// Middleware 记录请求数和耗时，按路由模板统计，未匹配的路由记为 unmatched
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.WithLabelValues(method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Handler 返回 /metrics 处理函数，token 不为空时要求 Authorization: Bearer <token>
+func Handler(token string) http.Handler {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	if token == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ObserveUpload 记录一次图片上传，err 不为空时记为失败
+func ObserveUpload(storage string, size int64, err error) {
+	if storage == "" {
+		storage = "unknown"
+	}
+	if err != nil {
+		uploads.WithLabelValues(storage, "failure").Inc()
+		return
+	}
+	uploads.WithLabelValues(storage, "success").Inc()
+	uploadBytes.WithLabelValues(storage).Add(float64(size))
+}
+
+// ObserveThumbnail 记录生成缩略图的耗时
+func ObserveThumbnail(start time.Time) {
+	thumbnailDuration.Observe(time.Since(start).Seconds())
+}
+
+// ObserveBackup 记录备份或恢复的耗时和结果，operation 为 backup 或 restore
+func ObserveBackup(operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	backupDuration.WithLabelValues(operation, result).Observe(time.Since(start).Seconds())
+}
+
+// RateLimitRejected 记录一次被速率限制拒绝的请求
+func RateLimitRejected(route string) {
+	if route == "" {
+		route = "unmatched"
+	}
+	rateLimitRejections.WithLabelValues(route).Inc()
+}
+
+// RegisterWebsocketConnections 注册当前 WebSocket 连接数
+func RegisterWebsocketConnections(count func() int) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Active websocket connections.",
+	}, func() float64 { return float64(count()) }))
+}
+
+// RegisterDB 注册数据库连接池指标
+func RegisterDB(db *sql.DB) {
+	Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/images/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.GET("/metrics", gin.WrapH(Handler("secret")))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/images/42", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	ObserveUpload("local", 1024, nil)
+	ObserveUpload("webdav", 10, errors.New("put failed"))
+	ObserveBackup("backup", time.Now(), nil)
+	RateLimitRejected("/api/auth/login")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("/metrics without token status = %d, want 401", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("/metrics status = %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`lopic_http_requests_total{method="GET",route="/api/images/:id",status="204"} 1`,
+		`lopic_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`lopic_uploads_total{result="success",storage="local"} 1`,
+		`lopic_uploads_total{result="failure",storage="webdav"} 1`,
+		`lopic_upload_bytes_total{storage="local"} 1024`,
+		`lopic_backup_duration_seconds_count{operation="backup",result="success"} 1`,
+		`lopic_rate_limit_rejections_total{route="/api/auth/login"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
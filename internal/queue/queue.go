@@ -0,0 +1,432 @@
+// Package queue 基于数据库的后台任务队列
+//
+// 任务保存在 jobs 表中，按类型注册处理函数，每种类型有独立的并发数、最大执行次数和重试退避时间。
+// 处理函数返回错误时按指数退避重试，返回 Permanent 包装的错误时不再重试。
+// 启动时 Recover 将上次退出时仍在执行的任务重新排队，达到最大执行次数的标记为失败。
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/tracing"
+	"github.com/leleo886/lopic/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCanceled  = "canceled"
+
+	// pollInterval 检查到期任务的间隔
+	pollInterval = time.Second
+	// maxBackoff 重试等待时间的上限
+	maxBackoff = time.Hour
+)
+
+// Handler 任务处理函数，取消任务时 ctx 被取消
+type Handler func(ctx context.Context, job *models.Job) error
+
+// JobType 任务类型
+type JobType struct {
+	Name        string
+	Handle      Handler
+	Concurrency int           // 同时执行的任务数，默认 1
+	MaxAttempts int           // 最多执行次数，默认 3
+	Backoff     time.Duration // 第一次重试前的等待时间，之后每次加倍，默认 10 秒
+	// OnAbort 任务最终失败或被取消后调用，用于更新任务对应的业务记录，可以为空
+	OnAbort func(job *models.Job)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent 包装不需要重试的错误
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Decode 解析任务参数
+func Decode(job *models.Job, v interface{}) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return Permanent(fmt.Errorf("invalid payload of job %d: %w", job.ID, err))
+	}
+	return nil
+}
+
+// Queue 后台任务队列
+type Queue struct {
+	db    *gorm.DB
+	types map[string]*JobType
+
+	mu       sync.Mutex
+	active   map[string]int
+	running  map[uint]context.CancelFunc
+	canceled map[uint]bool
+	wake     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func New(db *gorm.DB) *Queue {
+	return &Queue{
+		db:       db,
+		types:    make(map[string]*JobType),
+		active:   make(map[string]int),
+		running:  make(map[uint]context.CancelFunc),
+		canceled: make(map[uint]bool),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register 注册任务类型，需在 Recover 和 Run 之前调用
+func (q *Queue) Register(jobType JobType) {
+	if jobType.Concurrency <= 0 {
+		jobType.Concurrency = 1
+	}
+	if jobType.MaxAttempts <= 0 {
+		jobType.MaxAttempts = 3
+	}
+	if jobType.Backoff <= 0 {
+		jobType.Backoff = 10 * time.Second
+	}
+	q.types[jobType.Name] = &jobType
+}
+
+// Enqueue 添加任务，payload 保存为 JSON
+func (q *Queue) Enqueue(jobType string, payload interface{}) (*models.Job, error) {
+	return q.EnqueueContext(context.Background(), jobType, payload)
+}
+
+// EnqueueContext 添加任务并保存 ctx 中的追踪上下文，任务执行的 span 作为其子 span
+func (q *Queue) EnqueueContext(ctx context.Context, jobType string, payload interface{}) (*models.Job, error) {
+	t, ok := q.types[jobType]
+	if !ok {
+		return nil, fmt.Errorf("unknown job type: %s", jobType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &models.Job{
+		Type:         jobType,
+		Payload:      string(data),
+		TraceContext: tracing.Inject(ctx),
+		Status:       StatusPending,
+		MaxAttempts:  t.MaxAttempts,
+		RunAt:        time.Now(),
+	}
+	if err := q.db.Create(job).Error; err != nil {
+		log.Errorf("failed to enqueue job: type=%s, error=%v", jobType, err)
+		return nil, cerrors.ErrInternalServer
+	}
+	q.signal()
+	return job, nil
+}
+
+// EnqueueOnce 同类型的任务都已结束时才添加任务，用于周期性的维护任务，已有未结束的任务时返回 nil
+func (q *Queue) EnqueueOnce(jobType string, payload interface{}) (*models.Job, error) {
+	var count int64
+	if err := q.db.Model(&models.Job{}).Where("type = ? AND status IN ?", jobType, []string{StatusPending, StatusRunning}).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+	return q.Enqueue(jobType, payload)
+}
+
+// Recover 处理上次退出时仍在执行的任务，未达到最大执行次数的重新排队，否则标记为失败，返回重新排队的任务数
+func (q *Queue) Recover() (int, error) {
+	var jobs []models.Job
+	if err := q.db.Where("status = ?", StatusRunning).Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	for i := range jobs {
+		job := &jobs[i]
+		job.Error = "interrupted by restart"
+		if job.Attempts < job.MaxAttempts {
+			job.Status = StatusPending
+			job.RunAt = time.Now()
+			requeued++
+		} else {
+			now := time.Now()
+			job.Status = StatusFailed
+			job.FinishedAt = &now
+		}
+		if err := q.db.Save(job).Error; err != nil {
+			return requeued, err
+		}
+		if job.Status == StatusFailed {
+			q.abort(job)
+		}
+	}
+	return requeued, nil
+}
+
+// Run 执行到期的任务，直到 ctx 被取消；ctx 被取消后不再领取新任务，正在执行的任务不受影响，可用 Wait 等待其结束
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		q.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// Wait 等待正在执行的任务结束
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Cancel 取消等待中或执行中的任务，执行中的任务在处理函数返回后标记为已取消
+func (q *Queue) Cancel(id uint) (*models.Job, error) {
+	var job models.Job
+	if err := q.db.First(&job, id).Error; err != nil {
+		return nil, cerrors.ErrJobNotFound
+	}
+
+	switch job.Status {
+	case StatusPending:
+		now := time.Now()
+		result := q.db.Model(&job).Where("status = ?", StatusPending).
+			Updates(map[string]interface{}{"status": StatusCanceled, "finished_at": now})
+		if result.Error != nil {
+			return nil, cerrors.ErrInternalServer
+		}
+		if result.RowsAffected == 0 {
+			// 任务刚开始执行，按执行中的任务取消
+			return q.Cancel(id)
+		}
+		job.Status = StatusCanceled
+		job.FinishedAt = &now
+		q.abort(&job)
+		return &job, nil
+	case StatusRunning:
+		q.mu.Lock()
+		cancel, ok := q.running[id]
+		if ok {
+			q.canceled[id] = true
+			cancel()
+		}
+		q.mu.Unlock()
+		if !ok {
+			return nil, cerrors.ErrJobNotCancelable
+		}
+		return &job, nil
+	default:
+		return nil, cerrors.ErrJobNotCancelable
+	}
+}
+
+// Retry 重新执行失败或已取消的任务，执行次数从零开始计算
+func (q *Queue) Retry(id uint) (*models.Job, error) {
+	var job models.Job
+	if err := q.db.First(&job, id).Error; err != nil {
+		return nil, cerrors.ErrJobNotFound
+	}
+	if job.Status != StatusFailed && job.Status != StatusCanceled {
+		return nil, cerrors.ErrJobNotRetryable
+	}
+	if _, ok := q.types[job.Type]; !ok {
+		return nil, cerrors.ErrJobNotRetryable
+	}
+
+	result := q.db.Model(&job).Where("status = ?", job.Status).Updates(map[string]interface{}{
+		"status":      StatusPending,
+		"attempts":    0,
+		"run_at":      time.Now(),
+		"finished_at": nil,
+	})
+	if result.Error != nil {
+		return nil, cerrors.ErrInternalServer
+	}
+	if result.RowsAffected == 0 {
+		return nil, cerrors.ErrJobNotRetryable
+	}
+	q.signal()
+	if err := q.db.First(&job, id).Error; err != nil {
+		return nil, cerrors.ErrInternalServer
+	}
+	return &job, nil
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 按各类型的空闲并发数领取到期的任务
+func (q *Queue) dispatch(ctx context.Context) {
+	for name, t := range q.types {
+		q.mu.Lock()
+		free := t.Concurrency - q.active[name]
+		q.mu.Unlock()
+		if free <= 0 {
+			continue
+		}
+
+		var jobs []models.Job
+		if err := q.db.Where("type = ? AND status = ? AND run_at <= ?", name, StatusPending, time.Now()).
+			Order("run_at, id").Limit(free).Find(&jobs).Error; err != nil {
+			log.Errorf("Failed to find pending jobs: type=%s, error=%v", name, err)
+			continue
+		}
+		for i := range jobs {
+			if ctx.Err() != nil {
+				return
+			}
+			q.start(ctx, t, &jobs[i])
+		}
+	}
+}
+
+// start 将任务标记为执行中并在新的 goroutine 中执行
+func (q *Queue) start(ctx context.Context, t *JobType, job *models.Job) {
+	now := time.Now()
+	result := q.db.Model(job).Where("status = ?", StatusPending).Updates(map[string]interface{}{
+		"status":     StatusRunning,
+		"attempts":   gorm.Expr("attempts + 1"),
+		"started_at": now,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+	job.Status = StatusRunning
+	job.Attempts++
+	job.StartedAt = &now
+
+	// 退出时正在执行的任务继续执行，只在取消任务时取消
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	jobCtx = log.WithFields(jobCtx, zap.Uint("job_id", job.ID), zap.String("job_type", t.Name))
+	jobCtx, span := tracing.Start(tracing.Extract(jobCtx, job.TraceContext), "job "+t.Name,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.Int64("job.id", int64(job.ID)),
+			attribute.String("job.type", t.Name),
+			attribute.Int("job.attempt", job.Attempts),
+		),
+	)
+	q.mu.Lock()
+	q.active[t.Name]++
+	q.running[job.ID] = cancel
+	q.mu.Unlock()
+
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+		err := q.execute(jobCtx, t, job)
+		tracing.End(span, err)
+
+		q.mu.Lock()
+		q.active[t.Name]--
+		delete(q.running, job.ID)
+		canceled := q.canceled[job.ID]
+		delete(q.canceled, job.ID)
+		q.mu.Unlock()
+		cancel()
+
+		q.finish(t, job, err, canceled)
+		q.signal()
+	}()
+}
+
+// execute 执行处理函数，处理函数 panic 时视为失败
+func (q *Queue) execute(ctx context.Context, t *JobType, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return t.Handle(ctx, job)
+}
+
+// finish 记录任务的执行结果，失败且未达到最大执行次数时按退避时间重新排队
+func (q *Queue) finish(t *JobType, job *models.Job, err error, canceled bool) {
+	now := time.Now()
+	updates := map[string]interface{}{}
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		job.Status = StatusCompleted
+		job.Error = ""
+	case canceled:
+		job.Status = StatusCanceled
+		job.Error = err.Error()
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		job.Status = StatusFailed
+		job.Error = err.Error()
+	default:
+		job.Status = StatusPending
+		job.Error = err.Error()
+		job.RunAt = now.Add(backoff(t.Backoff, job.Attempts))
+		updates["run_at"] = job.RunAt
+	}
+	updates["status"] = job.Status
+	updates["error"] = job.Error
+	if job.Status != StatusPending {
+		job.FinishedAt = &now
+		updates["finished_at"] = now
+	}
+
+	if err := q.db.Model(job).Updates(updates).Error; err != nil {
+		log.Errorf("Failed to update job %d: %v", job.ID, err)
+	}
+	switch job.Status {
+	case StatusPending:
+		log.Warn(fmt.Sprintf("Job %d (%s) failed, retrying at %s: %s", job.ID, job.Type, job.RunAt.Format(time.RFC3339), job.Error))
+	case StatusFailed, StatusCanceled:
+		log.Errorf("Job %d (%s) %s: %s", job.ID, job.Type, job.Status, job.Error)
+		q.abort(job)
+	}
+}
+
+func (q *Queue) abort(job *models.Job) {
+	t, ok := q.types[job.Type]
+	if !ok || t.OnAbort == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Job %d abort handler panicked: %v", job.ID, r)
+		}
+	}()
+	t.OnAbort(job)
+}
+
+// backoff 第 attempts 次执行失败后的等待时间
+func backoff(base time.Duration, attempts int) time.Duration {
+	d := base
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
@@ -0,0 +1,374 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+func newTestQueue(t *testing.T) (*Queue, *gorm.DB) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.Job{}); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return New(db), db
+}
+
+// runQueue 执行队列直到测试结束
+func runQueue(t *testing.T, q *Queue) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		q.Wait()
+	})
+}
+
+// waitStatus 等待任务变为指定状态
+func waitStatus(t *testing.T, db *gorm.DB, id uint, status string) models.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var job models.Job
+		if err := db.First(&job, id).Error; err != nil {
+			t.Fatalf("failed to load job %d: %v", id, err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d status = %s, want %s (error %q)", id, job.Status, status, job.Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// eventually 等待 cond 成立，OnAbort 在任务状态更新之后调用
+func eventually(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func TestQueueRetry(t *testing.T) {
+	q, db := newTestQueue(t)
+	var calls atomic.Int32
+	q.Register(JobType{
+		Name:    "flaky",
+		Backoff: time.Millisecond,
+		Handle: func(ctx context.Context, job *models.Job) error {
+			var payload struct{ Fail int }
+			if err := Decode(job, &payload); err != nil {
+				return err
+			}
+			if int(calls.Add(1)) <= payload.Fail {
+				return errors.New("temporary failure")
+			}
+			return nil
+		},
+	})
+	runQueue(t, q)
+
+	job, err := q.Enqueue("flaky", map[string]int{"Fail": 2})
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	done := waitStatus(t, db, job.ID, StatusCompleted)
+	if done.Attempts != 3 || done.Error != "" || done.FinishedAt == nil {
+		t.Errorf("completed job = attempts %d, error %q, finished %v", done.Attempts, done.Error, done.FinishedAt)
+	}
+
+	if _, err := q.Enqueue("unknown", nil); err == nil {
+		t.Error("Enqueue() with unknown type succeeded")
+	}
+}
+
+func TestQueueFailure(t *testing.T) {
+	q, db := newTestQueue(t)
+	var aborted sync.Map
+	q.Register(JobType{
+		Name:        "broken",
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		Handle: func(ctx context.Context, job *models.Job) error {
+			var payload struct{ Permanent bool }
+			if err := Decode(job, &payload); err != nil {
+				return err
+			}
+			if payload.Permanent {
+				return Permanent(errors.New("bad input"))
+			}
+			panic("boom")
+		},
+		OnAbort: func(job *models.Job) { aborted.Store(job.ID, job.Error) },
+	})
+	runQueue(t, q)
+
+	permanent, _ := q.Enqueue("broken", map[string]bool{"Permanent": true})
+	exhausted, _ := q.Enqueue("broken", map[string]bool{"Permanent": false})
+
+	job := waitStatus(t, db, permanent.ID, StatusFailed)
+	if job.Attempts != 1 || job.Error != "bad input" {
+		t.Errorf("permanent failure = attempts %d, error %q", job.Attempts, job.Error)
+	}
+	job = waitStatus(t, db, exhausted.ID, StatusFailed)
+	if job.Attempts != 2 || job.Error != "job panicked: boom" {
+		t.Errorf("exhausted job = attempts %d, error %q", job.Attempts, job.Error)
+	}
+	for _, id := range []uint{permanent.ID, exhausted.ID} {
+		if !eventually(t, func() bool { _, ok := aborted.Load(id); return ok }) {
+			t.Errorf("OnAbort not called for job %d", id)
+		}
+	}
+
+	retried, err := q.Retry(permanent.ID)
+	if err != nil {
+		t.Fatalf("Retry() error = %v", err)
+	}
+	if retried.Status != StatusPending || retried.Attempts != 0 {
+		t.Errorf("Retry() = status %s, attempts %d", retried.Status, retried.Attempts)
+	}
+	waitStatus(t, db, permanent.ID, StatusFailed)
+
+	if _, err := q.Retry(9999); !errors.Is(err, cerrors.ErrJobNotFound) {
+		t.Errorf("Retry() unknown job error = %v", err)
+	}
+}
+
+func TestQueueConcurrency(t *testing.T) {
+	q, db := newTestQueue(t)
+	var running, peak atomic.Int32
+	q.Register(JobType{
+		Name:        "limited",
+		Concurrency: 2,
+		Handle: func(ctx context.Context, job *models.Job) error {
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			running.Add(-1)
+			return nil
+		},
+	})
+
+	var ids []uint
+	for i := 0; i < 5; i++ {
+		job, err := q.Enqueue("limited", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+	runQueue(t, q)
+	for _, id := range ids {
+		waitStatus(t, db, id, StatusCompleted)
+	}
+	if peak.Load() != 2 {
+		t.Errorf("peak concurrency = %d, want 2", peak.Load())
+	}
+}
+
+func TestQueueCancel(t *testing.T) {
+	q, db := newTestQueue(t)
+	started := make(chan uint, 1)
+	var aborted atomic.Int32
+	q.Register(JobType{
+		Name: "slow",
+		Handle: func(ctx context.Context, job *models.Job) error {
+			started <- job.ID
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		OnAbort: func(job *models.Job) { aborted.Add(1) },
+	})
+
+	first, _ := q.Enqueue("slow", nil)
+	second, _ := q.Enqueue("slow", nil)
+	runQueue(t, q)
+	if id := <-started; id != first.ID {
+		t.Fatalf("started job %d, want %d", id, first.ID)
+	}
+
+	// 并发数为 1，第二个任务仍在等待
+	job, err := q.Cancel(second.ID)
+	if err != nil || job.Status != StatusCanceled {
+		t.Fatalf("Cancel() pending = %v, %v", job, err)
+	}
+	if _, err := q.Cancel(first.ID); err != nil {
+		t.Fatalf("Cancel() running error = %v", err)
+	}
+	waitStatus(t, db, first.ID, StatusCanceled)
+	if !eventually(t, func() bool { return aborted.Load() == 2 }) {
+		t.Errorf("OnAbort called %d times, want 2", aborted.Load())
+	}
+	if _, err := q.Cancel(first.ID); !errors.Is(err, cerrors.ErrJobNotCancelable) {
+		t.Errorf("Cancel() finished job error = %v", err)
+	}
+}
+
+func TestQueueRecover(t *testing.T) {
+	q, db := newTestQueue(t)
+	var aborted []uint
+	q.Register(JobType{
+		Name:    "work",
+		Handle:  func(ctx context.Context, job *models.Job) error { return nil },
+		OnAbort: func(job *models.Job) { aborted = append(aborted, job.ID) },
+	})
+
+	now := time.Now()
+	interrupted := models.Job{Type: "work", Status: StatusRunning, Attempts: 1, MaxAttempts: 3, RunAt: now, StartedAt: &now}
+	exhausted := models.Job{Type: "work", Status: StatusRunning, Attempts: 3, MaxAttempts: 3, RunAt: now, StartedAt: &now}
+	for _, job := range []*models.Job{&interrupted, &exhausted} {
+		if err := db.Create(job).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requeued, err := q.Recover()
+	if err != nil || requeued != 1 {
+		t.Fatalf("Recover() = %d, %v, want 1", requeued, err)
+	}
+	var job models.Job
+	db.First(&job, interrupted.ID)
+	if job.Status != StatusPending || job.Error != "interrupted by restart" {
+		t.Errorf("interrupted job = status %s, error %q", job.Status, job.Error)
+	}
+	job = models.Job{}
+	db.First(&job, exhausted.ID)
+	if job.Status != StatusFailed || job.FinishedAt == nil {
+		t.Errorf("exhausted job = status %s, finished %v", job.Status, job.FinishedAt)
+	}
+	if len(aborted) != 1 || aborted[0] != exhausted.ID {
+		t.Errorf("OnAbort called for %v, want [%d]", aborted, exhausted.ID)
+	}
+
+	if job, err := q.EnqueueOnce("work", nil); err != nil || job != nil {
+		t.Errorf("EnqueueOnce() with pending job = %v, %v, want nil", job, err)
+	}
+	runQueue(t, q)
+	waitStatus(t, db, interrupted.ID, StatusCompleted)
+	if job, err := q.EnqueueOnce("work", nil); err != nil || job == nil {
+		t.Errorf("EnqueueOnce() = %v, %v", job, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{4, 80 * time.Second},
+		{20, maxBackoff},
+	}
+	for _, tt := range tests {
+		if got := backoff(10*time.Second, tt.attempts); got != tt.want {
+			t.Errorf("backoff(10s, %d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestQueueRunStop(t *testing.T) {
+	q, db := newTestQueue(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	q.Register(JobType{
+		Name: "drain",
+		Handle: func(ctx context.Context, job *models.Job) error {
+			close(started)
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+	job, _ := q.Enqueue("drain", nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx)
+		close(done)
+	}()
+	<-started
+	cancel()
+	<-done
+
+	// 停止领取新任务后正在执行的任务不被取消
+	next, _ := q.Enqueue("drain", nil)
+	close(release)
+	q.Wait()
+	waitStatus(t, db, job.ID, StatusCompleted)
+	waitStatus(t, db, next.ID, StatusPending)
+}
+
+func TestQueueTraceContext(t *testing.T) {
+	q, db := newTestQueue(t)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	traced := make(chan trace.SpanContext, 1)
+	q.Register(JobType{
+		Name: "traced",
+		Handle: func(ctx context.Context, job *models.Job) error {
+			traced <- trace.SpanContextFromContext(ctx)
+			return nil
+		},
+	})
+	runQueue(t, q)
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	job, err := q.EnqueueContext(trace.ContextWithSpanContext(context.Background(), parent), "traced", nil)
+	if err != nil {
+		t.Fatalf("EnqueueContext() error = %v", err)
+	}
+	if job.TraceContext == "" {
+		t.Error("EnqueueContext() did not store the trace context")
+	}
+	if got := <-traced; got.TraceID() != parent.TraceID() {
+		t.Errorf("job trace ID = %s, want %s", got.TraceID(), parent.TraceID())
+	}
+	waitStatus(t, db, job.ID, StatusCompleted)
+}
@@ -14,6 +14,8 @@ import (
 	"github.com/leleo886/lopic/internal/config"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/internal/mail"
+	"github.com/leleo886/lopic/internal/metrics"
+	"github.com/leleo886/lopic/internal/tracing"
 	"github.com/leleo886/lopic/internal/websocket"
 	"github.com/leleo886/lopic/middleware"
 	"github.com/leleo886/lopic/services"
@@ -40,19 +42,27 @@ func SetupRouter(config *config.Config,
 	adminAlbumService *admin_services.AlbumService,
 	adminStorageService *admin_services.StorageService,
 	galleryService *services.GalleryService,
+	trashService *services.TrashService,
+	tagService *services.TagService,
+	adminTagService *admin_services.TagService,
+	exportService *services.ExportService,
+	importService *services.ImportService,
+	adminJobService *admin_services.JobService,
+	healthService *services.HealthService,
 ) *gin.Engine {
 	gin.SetMode(config.Server.Mode)
 
-	// 创建GIN引擎
-	router := gin.Default()
+	// 创建GIN引擎，使用 zap 输出访问日志代替 gin 默认的文本日志
+	router := gin.New()
+	router.Use(middleware.RequestID(), middleware.AccessLog(), gin.Recovery())
 
 	// 配置CORS
 	oconfig := cors.DefaultConfig()
 	if len(config.Server.AllowOrigins) > 0 {
 		oconfig.AllowOrigins = config.Server.AllowOrigins
 		oconfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-		oconfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "Cookie", "X-CSRF-TOKEN"}
-		oconfig.ExposeHeaders = []string{"Content-Length"}
+		oconfig.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "Cookie", "X-CSRF-TOKEN", middleware.RequestIDHeader}
+		oconfig.ExposeHeaders = []string{"Content-Length", middleware.RequestIDHeader}
 
 		// 安全检查：允许凭证时必须指定具体的来源，不能使用 *
 		hasWildcard := false
@@ -73,6 +83,23 @@ func SetupRouter(config *config.Config,
 		router.Use(cors.New(oconfig))
 	}
 
+	// 链路追踪，为每个请求创建 span
+	if config.Tracing.Enabled {
+		router.Use(tracing.Middleware())
+	}
+
+	// Prometheus 指标，未配置单独的监听地址时在 API 端口上提供，需要令牌
+	if config.Metrics.Enabled {
+		router.Use(metrics.Middleware())
+		if config.Metrics.Listen == "" {
+			if config.Metrics.Token != "" {
+				router.GET("/metrics", gin.WrapH(metrics.Handler(config.Metrics.Token)))
+			} else {
+				log.Warn("Metrics are enabled without listen address or token, /metrics is not served")
+			}
+		}
+	}
+
 	// 创建处理器
 	imageController := controllers.NewImageController(imageService, hub)
 	albumController := controllers.NewAlbumController(albumService)
@@ -82,10 +109,18 @@ func SetupRouter(config *config.Config,
 	adminUserController := admin_controllers.NewUserController(userService, adminUserService, hub)
 	adminImageController := admin_controllers.NewImageController(adminImageService, hub)
 	adminAlbumController := admin_controllers.NewAlbumController(adminAlbumService)
-	adminSystemController := admin_controllers.NewSystemController(mailService, &config.SystemSettings.General, &config.SystemSettings.Gallery)
+	adminSystemController := admin_controllers.NewSystemController(mailService, &config.SystemSettings.General, &config.SystemSettings.Gallery, &config.SystemSettings.Trash, &config.SystemSettings.Backup)
 	galleryController := controllers.NewGalleryController(galleryService, &config.SystemSettings.Gallery)
+	trashController := controllers.NewTrashController(trashService)
+	tagController := controllers.NewTagController(tagService)
+	adminTagController := admin_controllers.NewTagController(adminTagService)
 	backupController := admin_controllers.NewBackupController(backupService)
 	adminStorageController := admin_controllers.NewStorageController(adminStorageService)
+	exportController := controllers.NewExportController(exportService)
+	adminExportController := admin_controllers.NewExportController(exportService)
+	adminImportController := admin_controllers.NewImportController(importService)
+	adminJobController := admin_controllers.NewJobController(adminJobService)
+	healthController := controllers.NewHealthController(healthService)
 
 	// 配置Swagger
 	if config.Swagger.Enabled {
@@ -96,6 +131,9 @@ func SetupRouter(config *config.Config,
 	if config.Server.Mode == gin.DebugMode {
 		router.GET("/health", controllers.HealthCheck)
 	}
+	// 存活和就绪检查，供编排系统探测
+	router.GET("/livez", healthController.Livez)
+	router.GET("/readyz", healthController.Readyz)
 
 	// 上传进度中间件
 	uploadProgressMiddleware := middleware.NewUploadProgressMiddleware(hub)
@@ -154,6 +192,9 @@ func SetupRouter(config *config.Config,
 		authGroup.POST("/logout", authController.Logout)
 	}
 
+	// 导出文件下载，通过签名链接鉴权
+	router.GET("/api/exports/download", exportController.DownloadExport)
+
 	// 需要认证的API路由组
 	// WebSocket路由
 	wsGroup := router.Group("/ws")
@@ -183,6 +224,8 @@ func SetupRouter(config *config.Config,
 			userGroup.PUT("/me", userController.UpdateMe)
 			userGroup.GET("/me/storage", userController.GetStorageUsage)
 			userGroup.GET("/me/tags-cloud", userController.GetImagesTagsCloud)
+			userGroup.POST("/me/export", exportController.CreateMyExport)
+			userGroup.GET("/me/exports", exportController.GetMyExports)
 		}
 
 		// 图片路由
@@ -196,6 +239,7 @@ func SetupRouter(config *config.Config,
 			imageGroup.POST("/albums", imageController.AddImageToAlbum)
 			imageGroup.DELETE("/albums", imageController.RemoveImageFromAlbum)
 			imageGroup.GET("/search", imageController.SearchImagesByTagsOrTitle)
+			imageGroup.POST("/batch", imageController.BatchImages)
 		}
 
 		// 相册路由
@@ -210,6 +254,25 @@ func SetupRouter(config *config.Config,
 			albumGroup.GET("/images/not-in-any", albumController.GetNotInAnyAlbum)
 		}
 
+		// 回收站路由
+		trashGroup := apiGroup.Group("/trash")
+		{
+			trashGroup.GET("/images", trashController.GetTrashedImages)
+			trashGroup.GET("/albums", trashController.GetTrashedAlbums)
+			trashGroup.POST("/images/restore", trashController.RestoreImages)
+			trashGroup.POST("/albums/restore", trashController.RestoreAlbums)
+			trashGroup.DELETE("/images", trashController.PurgeImages)
+			trashGroup.DELETE("/albums", trashController.PurgeAlbums)
+			trashGroup.DELETE("", trashController.EmptyTrash)
+		}
+
+		tagGroup := apiGroup.Group("/tags")
+		{
+			tagGroup.GET("", tagController.GetTags)
+			tagGroup.PUT("/rename", tagController.RenameTag)
+			tagGroup.POST("/merge", tagController.MergeTags)
+		}
+
 		// 管理员路由
 		adminGroup := apiGroup.Group("/admin")
 		{
@@ -222,6 +285,9 @@ func SetupRouter(config *config.Config,
 				adminUserGroup.DELETE("/:id", adminUserController.DeleteUser)
 				adminUserGroup.GET("/tags-cloud", adminUserController.GetAllImagesTagsCloud)
 				adminUserGroup.GET("/:id/tags-cloud", adminUserController.GetUserImagesTagsCloud)
+				adminUserGroup.POST("/:id/export", adminExportController.CreateUserExport)
+				adminUserGroup.GET("/:id/exports", adminExportController.GetUserExports)
+				adminUserGroup.POST("/:id/import", adminImportController.ImportDirectory)
 			}
 
 			adminRoleGroup := adminGroup.Group("/roles")
@@ -249,6 +315,13 @@ func SetupRouter(config *config.Config,
 				adminAlbumGroup.DELETE("", adminAlbumController.DeleteAlbum)
 			}
 
+			adminTagGroup := adminGroup.Group("/tags")
+			{
+				adminTagGroup.GET("", adminTagController.GetAllTags)
+				adminTagGroup.PUT("/rename", adminTagController.RenameTag)
+				adminTagGroup.POST("/merge", adminTagController.MergeTags)
+			}
+
 			adminSystemGroup := adminGroup.Group("/system")
 			{
 				adminSystemGroup.GET("/info", adminSystemController.GetSystemInfo)
@@ -264,6 +337,7 @@ func SetupRouter(config *config.Config,
 				adminBackupGroup.POST("/restore/:id", backupController.RestoreBackup)
 				adminBackupGroup.DELETE("/restore/:id", backupController.DeleteRestoreTask)
 				adminBackupGroup.GET("/download/:id", backupController.DownloadBackup)
+				adminBackupGroup.POST("/verify/:id", backupController.VerifyBackup)
 				adminBackupGroup.POST("/upload", uploadProgressMiddleware.Handle(), backupController.UploadBackup)
 			}
 
@@ -277,6 +351,13 @@ func SetupRouter(config *config.Config,
 				adminStorageGroup.DELETE("/:id", adminStorageController.DeleteStorage)
 				adminStorageGroup.POST("/test", adminStorageController.TestStorageConnection)
 			}
+
+			adminJobGroup := adminGroup.Group("/jobs")
+			{
+				adminJobGroup.GET("", adminJobController.GetJobs)
+				adminJobGroup.POST("/:id/cancel", adminJobController.CancelJob)
+				adminJobGroup.POST("/:id/retry", adminJobController.RetryJob)
+			}
 		}
 	}
 
@@ -0,0 +1,329 @@
+package search
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 标签和相册条件使用的子查询，外层查询需包含 images 表
+const (
+	tagSubquery   = "images.id IN (SELECT image_tags.image_id FROM image_tags JOIN tags ON tags.id = image_tags.tag_id WHERE tags.name %s)"
+	albumSubquery = "images.id IN (SELECT image_albums.image_id FROM image_albums JOIN albums ON albums.id = image_albums.album_id WHERE albums.deleted_at IS NULL AND albums.name = ?)"
+)
+
+var sizePattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*(b|k|kb|m|mb|g|gb)?$`)
+
+var sizeUnits = map[string]float64{
+	"":   1,
+	"b":  1,
+	"k":  1 << 10,
+	"kb": 1 << 10,
+	"m":  1 << 20,
+	"mb": 1 << 20,
+	"g":  1 << 30,
+	"gb": 1 << 30,
+}
+
+// mimeAliases type 字段的简写
+var mimeAliases = map[string]string{
+	"jpg": "jpeg",
+	"tif": "tiff",
+	"svg": "svg+xml",
+}
+
+// Options 编译选项
+type Options struct {
+	// FreeText 编译不带字段的词，为空时按标题模糊匹配或标签精确匹配
+	FreeText func(value string) (string, []interface{})
+	// Like 模糊匹配的运算符，为空时使用 LIKE；PostgreSQL 使用 ILIKE 以便不区分大小写
+	Like string
+}
+
+// Compile 将搜索语句编译为带 ? 占位符的 SQL 条件，语句为空时返回空字符串
+// 所有用户输入都作为参数传递，列名均为固定值
+func Compile(query string) (string, []interface{}, error) {
+	return CompileWith(query, Options{})
+}
+
+// CompileWith 使用指定选项编译搜索语句
+func CompileWith(query string, opts Options) (string, []interface{}, error) {
+	node, err := Parse(query)
+	if err != nil || node == nil {
+		return "", nil, err
+	}
+
+	c := &compiler{query: query, loc: time.Local, opts: opts}
+	sql, err := c.compile(node)
+	if err != nil {
+		return "", nil, err
+	}
+	return sql, c.args, nil
+}
+
+// FreeTextTerms 返回语句中未被取反的自由文本，用于相关度排序和高亮，语法错误时返回 nil
+func FreeTextTerms(query string) []string {
+	node, err := Parse(query)
+	if err != nil || node == nil {
+		return nil
+	}
+	var terms []string
+	var walk func(Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case *AndNode:
+			walk(n.Left)
+			walk(n.Right)
+		case *OrNode:
+			walk(n.Left)
+			walk(n.Right)
+		case *TermNode:
+			if n.Field == "" || n.Field == "name" {
+				terms = append(terms, n.Value)
+			}
+		}
+	}
+	walk(node)
+	return terms
+}
+
+type compiler struct {
+	query string
+	loc   *time.Location
+	opts  Options
+	args  []interface{}
+}
+
+func (c *compiler) compile(node Node) (string, error) {
+	switch n := node.(type) {
+	case *AndNode:
+		return c.binary(n.Left, n.Right, "AND")
+	case *OrNode:
+		return c.binary(n.Left, n.Right, "OR")
+	case *NotNode:
+		expr, err := c.compile(n.Expr)
+		if err != nil {
+			return "", err
+		}
+		return "NOT (" + expr + ")", nil
+	case *TermNode:
+		return c.term(n)
+	}
+	return "", nil
+}
+
+func (c *compiler) like() string {
+	if c.opts.Like != "" {
+		return c.opts.Like
+	}
+	return "LIKE"
+}
+
+func (c *compiler) binary(left, right Node, op string) (string, error) {
+	l, err := c.compile(left)
+	if err != nil {
+		return "", err
+	}
+	r, err := c.compile(right)
+	if err != nil {
+		return "", err
+	}
+	return "(" + l + " " + op + " " + r + ")", nil
+}
+
+func (c *compiler) term(t *TermNode) (string, error) {
+	switch t.Field {
+	case "":
+		if c.opts.FreeText != nil {
+			sql, args := c.opts.FreeText(t.Value)
+			c.args = append(c.args, args...)
+			return sql, nil
+		}
+		c.args = append(c.args, "%"+escapeLike(t.Value)+"%", t.Value)
+		return "(images.original_name " + c.like() + " ? ESCAPE '!' OR " + strings.Replace(tagSubquery, "%s", "= ?", 1) + ")", nil
+	case "name":
+		c.args = append(c.args, "%"+escapeLike(t.Value)+"%")
+		return "images.original_name " + c.like() + " ? ESCAPE '!'", nil
+	case "tag":
+		// 未加引号且以 * 结尾时按前缀匹配
+		if !t.Quoted && len(t.Value) > 1 && strings.HasSuffix(t.Value, "*") {
+			c.args = append(c.args, escapeLike(strings.TrimSuffix(t.Value, "*"))+"%")
+			return strings.Replace(tagSubquery, "%s", c.like()+" ? ESCAPE '!'", 1), nil
+		}
+		c.args = append(c.args, t.Value)
+		return strings.Replace(tagSubquery, "%s", "= ?", 1), nil
+	case "album":
+		c.args = append(c.args, t.Value)
+		return albumSubquery, nil
+	case "type":
+		c.args = append(c.args, mimeType(t.Value))
+		return "images.mime_type = ?", nil
+	case "width":
+		return c.compare("images.width", t, parseInteger)
+	case "height":
+		return c.compare("images.height", t, parseInteger)
+	case "size":
+		return c.compare("images.file_size", t, parseSize)
+	case "created":
+		return c.compareDate("images.created_at", t)
+	}
+	return "", newSyntaxError(c.query, t.FieldPos, "unknown field %q", t.Field)
+}
+
+// compare 编译数值比较：N、=N、>N、>=N、<N、<=N、A..B（包含两端，任一端可省略）
+func (c *compiler) compare(column string, t *TermNode, parse func(string) (int64, error)) (string, error) {
+	value := t.Value
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		var conds []string
+		if from != "" {
+			n, err := parse(from)
+			if err != nil {
+				return "", newSyntaxError(c.query, t.Pos, "invalid %s value %q", t.Field, from)
+			}
+			conds = append(conds, column+" >= ?")
+			c.args = append(c.args, n)
+		}
+		if to != "" {
+			n, err := parse(to)
+			if err != nil {
+				return "", newSyntaxError(c.query, t.Pos+len(from)+2, "invalid %s value %q", t.Field, to)
+			}
+			conds = append(conds, column+" <= ?")
+			c.args = append(c.args, n)
+		}
+		if len(conds) == 0 {
+			return "", newSyntaxError(c.query, t.Pos, "empty range for field %q", t.Field)
+		}
+		return "(" + strings.Join(conds, " AND ") + ")", nil
+	}
+
+	op, operand := splitOperator(value)
+	n, err := parse(operand)
+	if err != nil {
+		return "", newSyntaxError(c.query, t.Pos+len(op), "invalid %s value %q", t.Field, operand)
+	}
+	if op == "" {
+		op = "="
+	}
+	c.args = append(c.args, n)
+	return column + " " + op + " ?", nil
+}
+
+// compareDate 编译日期比较，日期可为 2006、2006-01 或 2006-01-02，表示对应的整个时间段
+func (c *compiler) compareDate(column string, t *TermNode) (string, error) {
+	value := t.Value
+	if from, to, ok := strings.Cut(value, ".."); ok {
+		var conds []string
+		if from != "" {
+			start, _, err := parseDate(from, c.loc)
+			if err != nil {
+				return "", newSyntaxError(c.query, t.Pos, "invalid date %q", from)
+			}
+			conds = append(conds, column+" >= ?")
+			c.args = append(c.args, start)
+		}
+		if to != "" {
+			_, end, err := parseDate(to, c.loc)
+			if err != nil {
+				return "", newSyntaxError(c.query, t.Pos+len(from)+2, "invalid date %q", to)
+			}
+			conds = append(conds, column+" < ?")
+			c.args = append(c.args, end)
+		}
+		if len(conds) == 0 {
+			return "", newSyntaxError(c.query, t.Pos, "empty range for field %q", t.Field)
+		}
+		return "(" + strings.Join(conds, " AND ") + ")", nil
+	}
+
+	op, operand := splitOperator(value)
+	start, end, err := parseDate(operand, c.loc)
+	if err != nil {
+		return "", newSyntaxError(c.query, t.Pos+len(op), "invalid date %q", operand)
+	}
+	switch op {
+	case ">":
+		c.args = append(c.args, end)
+		return column + " >= ?", nil
+	case ">=":
+		c.args = append(c.args, start)
+		return column + " >= ?", nil
+	case "<":
+		c.args = append(c.args, start)
+		return column + " < ?", nil
+	case "<=":
+		c.args = append(c.args, end)
+		return column + " < ?", nil
+	}
+	c.args = append(c.args, start, end)
+	return "(" + column + " >= ? AND " + column + " < ?)", nil
+}
+
+func splitOperator(value string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			return op, value[len(op):]
+		}
+	}
+	return "", value
+}
+
+func parseInteger(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// parseSize 解析文件大小，支持 b、kb、mb、gb 单位（1024 进制）
+func parseSize(s string) (int64, error) {
+	m := sizePattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, strconv.ErrSyntax
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(n * sizeUnits[strings.ToLower(m[2])])), nil
+}
+
+// parseDate 返回日期所表示时间段的开始时间和下一个时间段的开始时间
+func parseDate(s string, loc *time.Location) (time.Time, time.Time, error) {
+	layouts := []struct {
+		layout string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006-01-02", 0, 0, 1},
+		{"2006-01", 0, 1, 0},
+		{"2006", 1, 0, 0},
+	}
+	for _, l := range layouts {
+		if len(s) != len(l.layout) {
+			continue
+		}
+		start, err := time.ParseInLocation(l.layout, s, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		return start, start.AddDate(l.years, l.months, l.days), nil
+	}
+	return time.Time{}, time.Time{}, strconv.ErrSyntax
+}
+
+func mimeType(value string) string {
+	value = strings.ToLower(value)
+	if strings.Contains(value, "/") {
+		return value
+	}
+	if alias, ok := mimeAliases[value]; ok {
+		value = alias
+	}
+	return "image/" + value
+}
+
+// escapeLike 转义 LIKE 模式中的通配符，使用 '!' 作为转义符以兼容 MySQL 与 SQLite
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,348 @@
+// Package search 解析图片搜索语句并编译为 SQL 条件
+//
+// 语法示例：
+//
+//	tag:sunset -tag:draft album:"Trip 2024" type:gif width:>2000 size:<5mb created:2024-01..2024-06 name:foo
+//
+// 多个条件默认为 AND，可使用 AND / OR / NOT、- 取反和括号分组；不带字段的词按标题或标签搜索。
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SyntaxError 搜索语句语法错误，Pos 为出错位置（从 1 开始的字符位置）
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Message)
+}
+
+// Node 搜索语句语法树节点
+type Node interface {
+	node()
+}
+
+// AndNode 两个条件同时满足
+type AndNode struct {
+	Left, Right Node
+}
+
+// OrNode 任一条件满足
+type OrNode struct {
+	Left, Right Node
+}
+
+// NotNode 条件取反
+type NotNode struct {
+	Expr Node
+}
+
+// TermNode 单个搜索条件，Field 为空时表示自由文本
+type TermNode struct {
+	Field    string
+	Value    string
+	Quoted   bool
+	Pos      int // 值在语句中的字节偏移，用于报告编译错误
+	FieldPos int // 字段在语句中的字节偏移
+}
+
+func (*AndNode) node()  {}
+func (*OrNode) node()   {}
+func (*NotNode) node()  {}
+func (*TermNode) node() {}
+
+// Fields 支持的搜索字段
+var Fields = []string{"tag", "album", "type", "width", "height", "size", "created", "name"}
+
+type tokenKind int
+
+const (
+	tokenTerm tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenLParen
+	tokenRParen
+	tokenEOF
+)
+
+type token struct {
+	kind tokenKind
+	term *TermNode
+	pos  int
+}
+
+// Parse 解析搜索语句，语句为空时返回 nil
+func Parse(query string) (Node, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{query: query, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, newSyntaxError(query, tok.pos, "unexpected %s", describe(query, tok))
+	}
+	return node, nil
+}
+
+func newSyntaxError(query string, offset int, format string, args ...interface{}) *SyntaxError {
+	if offset > len(query) {
+		offset = len(query)
+	}
+	return &SyntaxError{
+		Pos:     utf8.RuneCountInString(query[:offset]) + 1,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+func lex(query string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(query) {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, pos: i})
+			i += size
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, pos: i})
+			i += size
+		case r == '-' && i+size < len(query) && !isDelimiter(query[i+size:]):
+			// 只有紧跟条件的 - 才表示取反，单独的 - 视为普通文本
+			tokens = append(tokens, token{kind: tokenNot, pos: i})
+			i += size
+		default:
+			tok, next, err := lexTerm(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+			i = next
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(query)}), nil
+}
+
+// isDelimiter 判断字符串是否以空白或括号开头
+func isDelimiter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+// lexTerm 读取一个条件：word、"quoted phrase"、field:value 或 field:"quoted value"
+func lexTerm(query string, start int) (token, int, error) {
+	if query[start] == '"' {
+		value, next, err := lexQuoted(query, start)
+		if err != nil {
+			return token{}, 0, err
+		}
+		return token{kind: tokenTerm, pos: start, term: &TermNode{Value: value, Quoted: true, Pos: start, FieldPos: start}}, next, nil
+	}
+
+	end := start
+	for end < len(query) && !isDelimiter(query[end:]) && query[end] != '"' {
+		_, size := utf8.DecodeRuneInString(query[end:])
+		end += size
+	}
+	word := query[start:end]
+
+	colon := strings.IndexByte(word, ':')
+	if colon <= 0 || !isFieldName(word[:colon]) {
+		if end < len(query) && query[end] == '"' {
+			return token{}, 0, newSyntaxError(query, end, "unexpected quote")
+		}
+		switch word {
+		case "AND":
+			return token{kind: tokenAnd, pos: start}, end, nil
+		case "OR":
+			return token{kind: tokenOr, pos: start}, end, nil
+		case "NOT":
+			return token{kind: tokenNot, pos: start}, end, nil
+		}
+		return token{kind: tokenTerm, pos: start, term: &TermNode{Value: word, Pos: start, FieldPos: start}}, end, nil
+	}
+
+	field := strings.ToLower(word[:colon])
+	if !isKnownField(field) {
+		return token{}, 0, newSyntaxError(query, start, "unknown field %q", word[:colon])
+	}
+
+	valueStart := start + colon + 1
+	term := &TermNode{Field: field, Pos: valueStart, FieldPos: start}
+	if valueStart == end && end < len(query) && query[end] == '"' {
+		value, next, err := lexQuoted(query, end)
+		if err != nil {
+			return token{}, 0, err
+		}
+		term.Value = value
+		term.Quoted = true
+		return token{kind: tokenTerm, pos: start, term: term}, next, nil
+	}
+	if end < len(query) && query[end] == '"' {
+		return token{}, 0, newSyntaxError(query, end, "unexpected quote")
+	}
+
+	term.Value = query[valueStart:end]
+	if term.Value == "" {
+		return token{}, 0, newSyntaxError(query, valueStart, "missing value for field %q", field)
+	}
+	return token{kind: tokenTerm, pos: start, term: term}, end, nil
+}
+
+// lexQuoted 读取双引号中的内容，支持 \" 和 \\ 转义
+func lexQuoted(query string, start int) (string, int, error) {
+	var sb strings.Builder
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if i+1 < len(query) && (query[i+1] == '"' || query[i+1] == '\\') {
+				i++
+			}
+			sb.WriteByte(query[i])
+		case '"':
+			if sb.Len() == 0 {
+				return "", 0, newSyntaxError(query, start, "empty quoted string")
+			}
+			return sb.String(), i + 1, nil
+		default:
+			sb.WriteByte(query[i])
+		}
+	}
+	return "", 0, newSyntaxError(query, start, "unterminated quoted string")
+}
+
+func isFieldName(s string) bool {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isKnownField(field string) bool {
+	for _, f := range Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(query string, tok token) string {
+	switch tok.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenLParen:
+		return "'('"
+	case tokenRParen:
+		return "')'"
+	case tokenAnd:
+		return "AND"
+	case tokenOr:
+		return "OR"
+	case tokenNot:
+		return "NOT"
+	}
+	return fmt.Sprintf("%q", tok.term.Value)
+}
+
+type parser struct {
+	query  string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parseOr: and ("OR" and)*
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &OrNode{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd: unary (["AND"] unary)*，相邻条件默认为 AND
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.next()
+		case tokenTerm, tokenNot, tokenLParen:
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &AndNode{Left: left, Right: right}
+	}
+}
+
+// parseUnary: ("NOT" | "-") unary | "(" or ")" | term
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNot:
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Expr: expr}, nil
+	case tokenLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, newSyntaxError(p.query, tok.pos, "missing closing parenthesis")
+		}
+		return expr, nil
+	case tokenTerm:
+		return tok.term, nil
+	}
+	return nil, newSyntaxError(p.query, tok.pos, "expected search term, got %s", describe(p.query, tok))
+}
@@ -0,0 +1,179 @@
+package search
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompile(t *testing.T) {
+	tagEq := "images.id IN (SELECT image_tags.image_id FROM image_tags JOIN tags ON tags.id = image_tags.tag_id WHERE tags.name = ?)"
+	tagLike := "images.id IN (SELECT image_tags.image_id FROM image_tags JOIN tags ON tags.id = image_tags.tag_id WHERE tags.name LIKE ? ESCAPE '!')"
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		name  string
+		query string
+		sql   string
+		args  []interface{}
+	}{
+		{
+			name:  "empty",
+			query: "   ",
+			sql:   "",
+		},
+		{
+			name:  "free text",
+			query: "cat",
+			sql:   "(images.original_name LIKE ? ESCAPE '!' OR " + tagEq + ")",
+			args:  []interface{}{"%cat%", "cat"},
+		},
+		{
+			name:  "tag and negated tag",
+			query: "tag:sunset -tag:draft",
+			sql:   "(" + tagEq + " AND NOT (" + tagEq + "))",
+			args:  []interface{}{"sunset", "draft"},
+		},
+		{
+			name:  "tag prefix",
+			query: "tag:sun*",
+			sql:   tagLike,
+			args:  []interface{}{"sun%"},
+		},
+		{
+			name:  "quoted album",
+			query: `album:"Trip 2024"`,
+			sql:   albumSubquery,
+			args:  []interface{}{"Trip 2024"},
+		},
+		{
+			name:  "type alias",
+			query: "type:JPG",
+			sql:   "images.mime_type = ?",
+			args:  []interface{}{"image/jpeg"},
+		},
+		{
+			name:  "width comparison",
+			query: "width:>2000",
+			sql:   "images.width > ?",
+			args:  []interface{}{int64(2000)},
+		},
+		{
+			name:  "height range",
+			query: "height:100..200",
+			sql:   "(images.height >= ? AND images.height <= ?)",
+			args:  []interface{}{int64(100), int64(200)},
+		},
+		{
+			name:  "size with unit",
+			query: "size:<5mb",
+			sql:   "images.file_size < ?",
+			args:  []interface{}{int64(5 << 20)},
+		},
+		{
+			name:  "created month range",
+			query: "created:2024-01..2024-06",
+			sql:   "(images.created_at >= ? AND images.created_at < ?)",
+			args:  []interface{}{day(2024, 1, 1), day(2024, 7, 1)},
+		},
+		{
+			name:  "created single day",
+			query: "created:2024-03-05",
+			sql:   "(images.created_at >= ? AND images.created_at < ?)",
+			args:  []interface{}{day(2024, 3, 5), day(2024, 3, 6)},
+		},
+		{
+			name:  "created after year",
+			query: "created:>2023",
+			sql:   "images.created_at >= ?",
+			args:  []interface{}{day(2024, 1, 1)},
+		},
+		{
+			name:  "name escapes wildcards",
+			query: "name:50%_off",
+			sql:   "images.original_name LIKE ? ESCAPE '!'",
+			args:  []interface{}{"%50!%!_off%"},
+		},
+		{
+			name:  "or binds looser than and",
+			query: "type:gif OR type:png width:>10",
+			sql:   "(images.mime_type = ? OR (images.mime_type = ? AND images.width > ?))",
+			args:  []interface{}{"image/gif", "image/png", int64(10)},
+		},
+		{
+			name:  "parentheses and NOT",
+			query: "(type:gif OR type:png) AND NOT name:foo",
+			sql:   "((images.mime_type = ? OR images.mime_type = ?) AND NOT (images.original_name LIKE ? ESCAPE '!'))",
+			args:  []interface{}{"image/gif", "image/png", "%foo%"},
+		},
+		{
+			name:  "quoted phrase with escape",
+			query: `"say \"hi\""`,
+			sql:   "(images.original_name LIKE ? ESCAPE '!' OR " + tagEq + ")",
+			args:  []interface{}{`%say "hi"%`, `say "hi"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := Compile(tt.query)
+			if err != nil {
+				t.Fatalf("Compile(%q) error = %v", tt.query, err)
+			}
+			if sql != tt.sql {
+				t.Errorf("Compile(%q) sql = %q, want %q", tt.query, sql, tt.sql)
+			}
+			if len(args) != 0 || len(tt.args) != 0 {
+				if !reflect.DeepEqual(args, tt.args) {
+					t.Errorf("Compile(%q) args = %v, want %v", tt.query, args, tt.args)
+				}
+			}
+		})
+	}
+}
+
+func TestCompileWithLike(t *testing.T) {
+	sql, args, err := CompileWith("name:Cat tag:sun*", Options{Like: "ILIKE"})
+	if err != nil {
+		t.Fatalf("CompileWith() error = %v", err)
+	}
+	want := "(images.original_name ILIKE ? ESCAPE '!' AND images.id IN (SELECT image_tags.image_id FROM image_tags JOIN tags ON tags.id = image_tags.tag_id WHERE tags.name ILIKE ? ESCAPE '!'))"
+	if sql != want {
+		t.Errorf("CompileWith() sql = %q, want %q", sql, want)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"%Cat%", "sun%"}) {
+		t.Errorf("CompileWith() args = %v", args)
+	}
+}
+
+func TestCompileSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{query: "color:red", pos: 1},
+		{query: "cat tag:", pos: 9},
+		{query: `album:"Trip`, pos: 7},
+		{query: "(type:gif", pos: 1},
+		{query: "type:gif)", pos: 9},
+		{query: "cat OR", pos: 7},
+		{query: "width:>abc", pos: 8},
+		{query: "size:5tb", pos: 6},
+		{query: "created:2024-01..2024-13", pos: 18},
+		{query: "标签 colour:x", pos: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, _, err := Compile(tt.query)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Compile(%q) error = %v, want SyntaxError", tt.query, err)
+			}
+			if syntaxErr.Pos != tt.pos {
+				t.Errorf("Compile(%q) position = %d, want %d (%v)", tt.query, syntaxErr.Pos, tt.pos, syntaxErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Package shutdown 协调服务退出时后台任务的停止
+//
+// 收到退出信号后先停止接收新的 HTTP 请求，再取消 Coordinator 的 Context，
+// 后台任务据此停止接收新的工作，并在截止时间前等待正在执行的工作完成。
+package shutdown
+
+import (
+	"context"
+	"sync"
+)
+
+// Coordinator 跟踪后台 goroutine，退出时通知它们停止并等待其返回
+type Coordinator struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() *Coordinator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Coordinator{ctx: ctx, cancel: cancel}
+}
+
+// Context 开始退出时被取消
+func (c *Coordinator) Context() context.Context {
+	return c.ctx
+}
+
+// Go 在新的 goroutine 中执行 fn，fn 应在 ctx 被取消后尽快返回
+func (c *Coordinator) Go(fn func(ctx context.Context)) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		fn(c.ctx)
+	}()
+}
+
+// Shutdown 取消 Context 并等待所有 goroutine 返回，ctx 先结束时返回 ctx.Err()
+func (c *Coordinator) Shutdown(ctx context.Context) error {
+	c.cancel()
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,44 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCoordinatorShutdown(t *testing.T) {
+	c := New()
+	stopped := make(chan struct{})
+	c.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("Shutdown() returned before goroutine stopped")
+	}
+}
+
+func TestCoordinatorShutdownDeadline(t *testing.T) {
+	c := New()
+	release := make(chan struct{})
+	defer close(release)
+	c.Go(func(ctx context.Context) {
+		<-release
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown() error = %v, want deadline exceeded", err)
+	}
+	if c.Context().Err() == nil {
+		t.Error("Context() not canceled after Shutdown()")
+	}
+}
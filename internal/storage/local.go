@@ -107,10 +107,66 @@ func (s *LocalStorage) UploadFile(file *multipart.FileHeader, filePath string, u
 
 // DeleteFile 从本地存储删除文件
 func (s *LocalStorage) DeleteFile(fileURL string) error {
+	absPath, err := s.resolveFileURL(fileURL)
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(absPath)
+}
+
+// OpenFile 打开本地存储中的文件
+func (s *LocalStorage) OpenFile(fileURL string) (io.ReadCloser, error) {
+	absPath, err := s.resolveFileURL(fileURL)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(absPath)
+	if err != nil {
+		log.Errorf("failed to open file: path=%s, error=%v", absPath, err)
+		return nil, cerrors.ErrImageNotFound
+	}
+	return file, nil
+}
+
+// WriteFile 写入本地存储中的文件，自动创建目录
+func (s *LocalStorage) WriteFile(fileURL string, r io.Reader) error {
+	absPath, err := s.resolveFileURL(fileURL)
+	if err != nil {
+		return err
+	}
+
+	if err := s.CreateDirectory(filepath.Dir(absPath)); err != nil {
+		log.Errorf("failed to create directory: path=%s, error=%v", filepath.Dir(absPath), err)
+		return cerrors.ErrInternalServer
+	}
+
+	dst, err := os.Create(absPath)
+	if err != nil {
+		log.Errorf("failed to create file: path=%s, error=%v", absPath, err)
+		return cerrors.ErrInternalServer
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, r); err != nil {
+		log.Errorf("failed to write file: path=%s, error=%v", absPath, err)
+		return cerrors.ErrInternalServer
+	}
+	return dst.Close()
+}
+
+// RelativePath 返回文件 URL 相对于 StaticPath 的路径
+func (s *LocalStorage) RelativePath(fileURL string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(fileURL, s.StaticPath), "/")
+}
+
+// resolveFileURL 将文件 URL 转换为本地绝对路径，并检查路径是否在基础目录内
+func (s *LocalStorage) resolveFileURL(fileURL string) (string, error) {
 	// 安全检查：验证 fileURL 是否以 StaticPath 开头
 	if !strings.HasPrefix(fileURL, s.StaticPath) {
 		log.Errorf("invalid file URL: %s does not start with %s", fileURL, s.StaticPath)
-		return cerrors.ErrForbidden
+		return "", cerrors.ErrForbidden
 	}
 
 	// 将 URL 路径转换为本地路径
@@ -124,23 +180,23 @@ func (s *LocalStorage) DeleteFile(fileURL string) error {
 	absPath, err := filepath.Abs(fullPath)
 	if err != nil {
 		log.Errorf("failed to resolve absolute path: %v", err)
-		return cerrors.ErrInternalServer
+		return "", cerrors.ErrInternalServer
 	}
 
 	// 计算基础目录的绝对路径
 	baseAbsPath, err := filepath.Abs(filepath.Join(".", s.BasePath))
 	if err != nil {
 		log.Errorf("failed to resolve base path: %v", err)
-		return cerrors.ErrInternalServer
+		return "", cerrors.ErrInternalServer
 	}
 
 	// 安全检查：确保目标路径在基础目录内（防止路径遍历攻击）
 	if !strings.HasPrefix(absPath, baseAbsPath+string(filepath.Separator)) && absPath != baseAbsPath {
 		log.Errorf("path traversal detected: %s is outside of %s", absPath, baseAbsPath)
-		return cerrors.ErrForbidden
+		return "", cerrors.ErrForbidden
 	}
 
-	return os.Remove(absPath)
+	return absPath, nil
 }
 
 // CreateDirectory 创建本地目录
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"io"
 	"mime/multipart"
 )
 
@@ -14,4 +15,21 @@ type Storage interface {
 	CreateDirectory(dirPath string) error
 	// TestConnection 测试存储连接是否成功
 	TestConnection() error
+	// OpenFile 读取 UploadFile 返回的文件 URL 对应的文件，调用方负责关闭
+	OpenFile(fileURL string) (io.ReadCloser, error)
+	// WriteFile 将内容写入文件 URL 对应的位置，用于恢复备份
+	WriteFile(fileURL string, r io.Reader) error
+	// RelativePath 返回文件 URL 相对于图片目录的路径，即上传时的 uploadPath/fileName
+	RelativePath(fileURL string) string
+}
+
+// ObjectStorage 按存储内部路径读写文件，路径相对于存储根目录而不是图片目录，不会通过静态 URL 对外提供
+// 用于备份等非公开文件，目前由 WebDAV 存储实现
+type ObjectStorage interface {
+	// PutObject 写入文件，自动创建父目录
+	PutObject(name string, r io.Reader) error
+	// GetObject 读取文件，调用方负责关闭
+	GetObject(name string) (io.ReadCloser, error)
+	// RemoveObject 删除文件，文件不存在时不返回错误
+	RemoveObject(name string) error
 }
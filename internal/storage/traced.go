@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+
+	"github.com/leleo886/lopic/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedStorage 为每个存储操作创建 span
+type tracedStorage struct {
+	ctx     context.Context
+	storage Storage
+	name    string
+}
+
+// WithTracing 返回为每个操作创建 ctx 的子 span 的存储实例，name 为存储名称
+// ctx 中没有 span 时直接返回 s，不创建没有父 span 的 span
+func WithTracing(ctx context.Context, s Storage, name string) Storage {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return s
+	}
+	return &tracedStorage{ctx: ctx, storage: s, name: name}
+}
+
+func (t *tracedStorage) start(operation string, path string) trace.Span {
+	_, span := tracing.Start(t.ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("storage.name", t.name), attribute.String("storage.path", path)),
+	)
+	return span
+}
+
+func (t *tracedStorage) UploadFile(file *multipart.FileHeader, filePath string, uploadPath string, fileName string) (string, error) {
+	span := t.start("UploadFile", uploadPath+"/"+fileName)
+	if file != nil {
+		span.SetAttributes(attribute.Int64("storage.size", file.Size))
+	}
+	url, err := t.storage.UploadFile(file, filePath, uploadPath, fileName)
+	tracing.End(span, err)
+	return url, err
+}
+
+func (t *tracedStorage) DeleteFile(filePath string) error {
+	span := t.start("DeleteFile", filePath)
+	err := t.storage.DeleteFile(filePath)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) CreateDirectory(dirPath string) error {
+	span := t.start("CreateDirectory", dirPath)
+	err := t.storage.CreateDirectory(dirPath)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) TestConnection() error {
+	span := t.start("TestConnection", "")
+	err := t.storage.TestConnection()
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) OpenFile(fileURL string) (io.ReadCloser, error) {
+	span := t.start("OpenFile", fileURL)
+	r, err := t.storage.OpenFile(fileURL)
+	tracing.End(span, err)
+	return r, err
+}
+
+func (t *tracedStorage) WriteFile(fileURL string, r io.Reader) error {
+	span := t.start("WriteFile", fileURL)
+	err := t.storage.WriteFile(fileURL, r)
+	tracing.End(span, err)
+	return err
+}
+
+func (t *tracedStorage) RelativePath(fileURL string) string {
+	return t.storage.RelativePath(fileURL)
+}
@@ -91,6 +91,37 @@ func (s *WebDAVStorage) DeleteFile(fileURL string) error {
 	return nil
 }
 
+// OpenFile 读取 WebDAV 上的文件
+func (s *WebDAVStorage) OpenFile(fileURL string) (io.ReadCloser, error) {
+	webdavPath := s.webdavPath(fileURL)
+	reader, err := s.client.ReadStream(webdavPath)
+	if err != nil {
+		log.Errorf("WebDAV read failed for %q: error=%v", webdavPath, err)
+		return nil, cerrors.ErrImageNotFound
+	}
+	return reader, nil
+}
+
+// WriteFile 写入 WebDAV 上的文件，自动创建父目录
+func (s *WebDAVStorage) WriteFile(fileURL string, r io.Reader) error {
+	return s.PutObject(s.webdavPath(fileURL), r)
+}
+
+// RelativePath 返回文件 URL 相对于 basePath 的路径
+func (s *WebDAVStorage) RelativePath(fileURL string) string {
+	relativePath := strings.Trim(s.webdavPath(fileURL), "/")
+	if s.basePath != "" {
+		relativePath = strings.TrimPrefix(strings.TrimPrefix(relativePath, s.basePath), "/")
+	}
+	return relativePath
+}
+
+// webdavPath 将对外 URL 路径转换为 WebDAV 内部路径
+func (s *WebDAVStorage) webdavPath(fileURL string) string {
+	relativePath := strings.TrimPrefix(strings.Trim(fileURL, "/"), s.staticPath)
+	return path.Clean("/" + relativePath)
+}
+
 // CreateDirectory 创建 WebDAV 目录（支持多级）
 func (s *WebDAVStorage) CreateDirectory(dirPath string) error {
 	fullPath := path.Join(s.basePath, dirPath)
@@ -98,6 +129,41 @@ func (s *WebDAVStorage) CreateDirectory(dirPath string) error {
 	return s.client.MkdirAll(fullPath, 0755)
 }
 
+// PutObject 将内容写入 WebDAV 根目录下的 name
+func (s *WebDAVStorage) PutObject(name string, r io.Reader) error {
+	webdavPath := path.Clean("/" + name)
+	if err := s.client.MkdirAll(path.Dir(webdavPath), 0755); err != nil {
+		log.Errorf("failed to create WebDAV directory %q: error=%v", path.Dir(webdavPath), err)
+		return cerrors.ErrInternalServer
+	}
+	if err := s.client.WriteStream(webdavPath, r, 0644); err != nil {
+		log.Errorf("WebDAV upload failed for %q: error=%v", webdavPath, err)
+		return cerrors.ErrInternalServer
+	}
+	return nil
+}
+
+// GetObject 读取 WebDAV 根目录下的 name
+func (s *WebDAVStorage) GetObject(name string) (io.ReadCloser, error) {
+	webdavPath := path.Clean("/" + name)
+	reader, err := s.client.ReadStream(webdavPath)
+	if err != nil {
+		log.Errorf("WebDAV read failed for %q: error=%v", webdavPath, err)
+		return nil, cerrors.ErrInternalServer
+	}
+	return reader, nil
+}
+
+// RemoveObject 删除 WebDAV 根目录下的 name
+func (s *WebDAVStorage) RemoveObject(name string) error {
+	webdavPath := path.Clean("/" + name)
+	if err := s.client.Remove(webdavPath); err != nil {
+		log.Errorf("WebDAV delete failed for %q: error=%v", webdavPath, err)
+		return cerrors.ErrInternalServer
+	}
+	return nil
+}
+
 // TestConnection 测试 WebDAV 连接是否成功
 func (s *WebDAVStorage) TestConnection() error {
 //    client := gowebdav.NewClient(s.baseURL, s.username, s.password)
@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// RegisterGORM 为 GORM 的查询创建 span，父 span 来自 db.WithContext 传入的 context
+// context 中没有 span 的查询不创建 span，避免每个查询都成为单独的 trace
+func RegisterGORM(db *gorm.DB) error {
+	dbSystem := db.Dialector.Name()
+	if dbSystem == "postgres" {
+		// 语义约定中 PostgreSQL 的名称为 postgresql
+		dbSystem = "postgresql"
+	}
+	callbacks := []struct {
+		operation     string
+		before, after func(name string, fn func(*gorm.DB)) error
+	}{
+		{"create", db.Callback().Create().Before("gorm:create").Register, db.Callback().Create().After("gorm:create").Register},
+		{"query", db.Callback().Query().Before("gorm:query").Register, db.Callback().Query().After("gorm:query").Register},
+		{"update", db.Callback().Update().Before("gorm:update").Register, db.Callback().Update().After("gorm:update").Register},
+		{"delete", db.Callback().Delete().Before("gorm:delete").Register, db.Callback().Delete().After("gorm:delete").Register},
+		{"row", db.Callback().Row().Before("gorm:row").Register, db.Callback().Row().After("gorm:row").Register},
+		{"raw", db.Callback().Raw().Before("gorm:raw").Register, db.Callback().Raw().After("gorm:raw").Register},
+	}
+	for _, cb := range callbacks {
+		operation := cb.operation
+		if err := cb.before("tracing:before_"+operation, func(tx *gorm.DB) {
+			if tx.Statement.Context == nil || !trace.SpanContextFromContext(tx.Statement.Context).IsValid() {
+				return
+			}
+			ctx, span := Start(tx.Statement.Context, "gorm."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(semconv.DBSystemKey.String(dbSystem), semconv.DBOperationName(operation)),
+			)
+			tx.Statement.Context = ctx
+			tx.InstanceSet(gormSpanKey, span)
+		}); err != nil {
+			return err
+		}
+		if err := cb.after("tracing:after_"+operation, func(tx *gorm.DB) {
+			value, ok := tx.InstanceGet(gormSpanKey)
+			if !ok {
+				return
+			}
+			span := value.(trace.Span)
+			span.SetAttributes(
+				semconv.DBQueryText(tx.Statement.SQL.String()),
+				attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+			)
+			if tx.Statement.Table != "" {
+				span.SetAttributes(semconv.DBCollectionName(tx.Statement.Table))
+			}
+			err := tx.Error
+			if err == gorm.ErrRecordNotFound {
+				err = nil
+			}
+			End(span, err)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"github.com/leleo886/lopic/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+func newRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	t.Fatalf("span %q not recorded", name)
+	return nil
+}
+
+func TestMiddlewareAndGORM(t *testing.T) {
+	recorder := newRecorder(t)
+	t.Chdir(t.TempDir())
+	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := RegisterGORM(db); err != nil {
+		t.Fatalf("RegisterGORM() error = %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/images/:id", func(c *gin.Context) {
+		var n int
+		db.WithContext(c.Request.Context()).Raw("SELECT 1").Scan(&n)
+		c.Status(http.StatusInternalServerError)
+	})
+
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/images/42", nil)
+	otel.GetTextMapPropagator().Inject(trace.ContextWithRemoteSpanContext(context.Background(), parent), propagation.HeaderCarrier(req.Header))
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	server := findSpan(t, recorder, "GET /api/images/:id")
+	if server.Parent().SpanID() != parent.SpanID() || server.SpanContext().TraceID() != parent.TraceID() {
+		t.Errorf("server span parent = %v, want %v", server.Parent(), parent)
+	}
+	if server.Status().Code != codes.Error {
+		t.Errorf("server span status = %v, want error", server.Status())
+	}
+	query := findSpan(t, recorder, "gorm.row")
+	if query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("gorm span parent = %v, want server span", query.Parent().SpanID())
+	}
+}
+
+func TestGORMWithoutParentSpan(t *testing.T) {
+	recorder := newRecorder(t)
+	t.Chdir(t.TempDir())
+	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := RegisterGORM(db); err != nil {
+		t.Fatalf("RegisterGORM() error = %v", err)
+	}
+
+	var n int
+	if err := db.Raw("SELECT 1").Scan(&n).Error; err != nil {
+		t.Fatalf("query error = %v", err)
+	}
+	if err := db.WithContext(context.Background()).Raw("SELECT 1").Scan(&n).Error; err != nil {
+		t.Fatalf("query error = %v", err)
+	}
+	if spans := recorder.Ended(); len(spans) != 0 {
+		t.Errorf("queries without parent span recorded %d spans, want 0", len(spans))
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	newRecorder(t)
+	if got := Inject(context.Background()); got != "" {
+		t.Errorf("Inject() without span = %q, want empty", got)
+	}
+
+	ctx, span := Start(context.Background(), "enqueue")
+	defer span.End()
+	value := Inject(ctx)
+	restored := trace.SpanContextFromContext(Extract(context.Background(), value))
+	if restored.TraceID() != span.SpanContext().TraceID() || restored.SpanID() != span.SpanContext().SpanID() {
+		t.Errorf("Extract(%q) = %v, want %v", value, restored, span.SpanContext())
+	}
+	if got := Extract(context.Background(), "not json"); trace.SpanContextFromContext(got).IsValid() {
+		t.Error("Extract() with invalid value returned a span context")
+	}
+}
+
+func TestInitUnknownExporter(t *testing.T) {
+	if _, err := Init(&config.TracingConfig{Enabled: true, Exporter: "zipkin"}); err == nil {
+		t.Error("Init() with unknown exporter succeeded")
+	}
+}
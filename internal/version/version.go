@@ -0,0 +1,5 @@
+// Package version 记录应用版本
+package version
+
+// Version 应用版本，构建时可通过 -ldflags "-X github.com/leleo886/lopic/internal/version.Version=x.y.z" 覆盖
+var Version = "1.0.0"
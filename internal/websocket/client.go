@@ -52,7 +52,10 @@ type Client struct {
 // readPump 从WebSocket连接读取消息并处理
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
 		c.conn.Close()
 	}()
 
@@ -147,7 +150,13 @@ func HandleWebSocket(hub *Hub) gin.HandlerFunc {
 		}
 
 		// 注册客户端
-		client.hub.register <- client
+		select {
+		case client.hub.register <- client:
+		case <-hub.done:
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+			conn.Close()
+			return
+		}
 
 		// 启动goroutine处理读写操作
 		go client.writePump()
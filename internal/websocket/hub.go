@@ -20,6 +20,10 @@ type Hub struct {
 
 	// 互斥锁，保护clients映射
 	mutex sync.RWMutex
+
+	// 关闭Hub时关闭的通道
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // Message WebSocket消息结构
@@ -36,13 +40,26 @@ func NewHub() *Hub {
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[uint]map[*Client]bool),
+		done:       make(chan struct{}),
 	}
 }
 
-// Run 启动Hub的消息处理循环
+// Run 启动Hub的消息处理循环，Close 后断开所有连接并返回
 func (h *Hub) Run() {
 	for {
 		select {
+		case <-h.done:
+			h.mutex.Lock()
+			for userID, clients := range h.clients {
+				for client := range clients {
+					// 关闭发送通道后 writePump 发送关闭消息并断开连接
+					close(client.send)
+				}
+				delete(h.clients, userID)
+			}
+			h.mutex.Unlock()
+			return
+
 		case client := <-h.register:
 			h.mutex.Lock()
 			if _, ok := h.clients[client.userID]; !ok {
@@ -84,11 +101,32 @@ func (h *Hub) Run() {
 	}
 }
 
-// BroadcastToUser 向特定用户广播消息
+// BroadcastToUser 向特定用户广播消息，Hub 关闭后消息被丢弃
 func (h *Hub) BroadcastToUser(userID uint, msgType string, payload interface{}) {
-	h.broadcast <- &Message{
+	select {
+	case h.broadcast <- &Message{
 		UserID:  userID,
 		Type:    msgType,
 		Payload: payload,
+	}:
+	case <-h.done:
+	}
+}
+
+// ClientCount 返回当前的连接数
+func (h *Hub) ClientCount() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	count := 0
+	for _, clients := range h.clients {
+		count += len(clients)
 	}
+	return count
+}
+
+// Close 关闭Hub，断开所有连接，之后的新连接会被直接关闭
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
 }
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leleo886/lopic/internal/log"
+	"go.uber.org/zap"
+)
+
+// probePaths 存活和就绪检查的路径，成功时不输出访问日志
+var probePaths = map[string]bool{"/livez": true, "/readyz": true}
+
+// AccessLog 通过 zap 输出结构化的访问日志，需在 RequestID 之后使用
+// 5xx 输出为 error，4xx 输出为 warn，其余为 info
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		if status < 400 && probePaths[c.FullPath()] {
+			return
+		}
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("route", c.FullPath()),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", status),
+			zap.Int("bytes", max(c.Writer.Size(), 0)),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+
+		logger := log.Ctx(c.Request.Context())
+		switch {
+		case status >= 500:
+			logger.Error("request", fields...)
+		case status >= 400:
+			logger.Warn("request", fields...)
+		default:
+			logger.Info("request", fields...)
+		}
+	}
+}
@@ -63,6 +63,7 @@ func GalleryPermission() gin.HandlerFunc {
 		}
 
 		c.Set("user_id", user.ID)
+		setLogUser(c, user.ID)
 		c.Next()
 	}
 }
\ No newline at end of file
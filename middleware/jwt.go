@@ -71,6 +71,7 @@ func JWT(config *config.JWTConfig) gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.RoleName)
+		setLogUser(c, claims.UserID)
 
 		c.Next()
 	}
@@ -6,6 +6,7 @@ import (
 	"github.com/gin-gonic/gin"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/metrics"
 )
 
 // RateLimitConfig 速率限制配置
@@ -55,6 +56,7 @@ func RateLimit(config *RateLimitConfig) gin.HandlerFunc {
 		}
 		
 		if !limiter.Allow(key) {
+			metrics.RateLimitRejected(c.FullPath())
 			statusCode, errorResponse := cerrors.NewErrorResponse(cerrors.ErrTooManyRequests)
 			c.JSON(statusCode, errorResponse)
 			c.Abort()
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/leleo886/lopic/internal/log"
+	"go.uber.org/zap"
+)
+
+const (
+	// RequestIDHeader 请求 ID 的请求头和响应头
+	RequestIDHeader = "X-Request-ID"
+	// maxRequestIDLength 沿用请求头中请求 ID 的最大长度
+	maxRequestIDLength = 128
+)
+
+// RequestID 为每个请求分配请求 ID，请求头中带有合法的 X-Request-ID 时沿用，否则生成新的 ID
+// 请求 ID 写入响应头、gin 上下文的 request_id 和 c.Request 的 context，服务层通过 log.Ctx 输出带请求 ID 的日志
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(log.WithFields(c.Request.Context(), zap.String("request_id", requestID)))
+		c.Next()
+	}
+}
+
+// validRequestID 只接受长度有限的可打印 ASCII 字符，防止日志注入
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// setLogUser 将用户 ID 加入请求 context 的日志字段
+func setLogUser(c *gin.Context, userID uint) {
+	c.Request = c.Request.WithContext(log.WithFields(c.Request.Context(), zap.Uint("user_id", userID)))
+}
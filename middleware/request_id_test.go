@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/leleo886/lopic/internal/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	previous := log.Logger
+	log.Logger = zap.New(core)
+	t.Cleanup(func() { log.Logger = previous })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), AccessLog())
+	router.GET("/api/images/:id", func(c *gin.Context) {
+		setLogUser(c, 7)
+		log.Ctx(c.Request.Context()).Errorf("service failed")
+		c.String(http.StatusInternalServerError, "oops")
+	})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/images/42", nil)
+	req.Header.Set(RequestIDHeader, "abc-123")
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get(RequestIDHeader); got != "abc-123" {
+		t.Errorf("response %s = %q, want abc-123", RequestIDHeader, got)
+	}
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log entries, want 2", len(entries))
+	}
+	for _, entry := range entries {
+		fields := entry.ContextMap()
+		if fields["request_id"] != "abc-123" || fields["user_id"] != uint64(7) {
+			t.Errorf("%q fields = %v, want request_id and user_id", entry.Message, fields)
+		}
+	}
+	access := entries[1].ContextMap()
+	if entries[1].Level != zap.ErrorLevel || access["route"] != "/api/images/:id" || access["status"] != int64(500) || access["bytes"] != int64(4) {
+		t.Errorf("access log = %v %v", entries[1].Level, access)
+	}
+
+	// 不合法的请求 ID 被替换为新生成的 ID
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/missing", nil)
+	req.Header.Set(RequestIDHeader, "bad\nid")
+	router.ServeHTTP(w, req)
+	if got := w.Header().Get(RequestIDHeader); got == "" || strings.Contains(got, "\n") {
+		t.Errorf("response %s = %q, want a generated ID", RequestIDHeader, got)
+	}
+	if last := logs.AllUntimed()[2]; last.Level != zap.WarnLevel || last.ContextMap()["route"] != "" {
+		t.Errorf("404 access log = %v %v", last.Level, last.ContextMap())
+	}
+}
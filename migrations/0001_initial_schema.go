@@ -0,0 +1,264 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// initialSchema 初始表结构，也用于接管引入版本化迁移前由 AutoMigrate 创建的数据库
+// 表结构由本文件中的快照结构体定义，与 models 包解耦；之后的表结构变化需新增迁移，不要修改本文件
+var initialSchema = Migration{
+	Version: 1,
+	Name:    "initial_schema",
+	Schema:  initialSchemaModels(),
+	Up: func(tx *gorm.DB) error {
+		for _, model := range initialSchemaModels() {
+			if err := tx.AutoMigrate(model); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	Down: func(tx *gorm.DB) error {
+		tables := initialSchemaModels()
+		for i := len(tables) - 1; i >= 0; i-- {
+			if err := tx.Migrator().DropTable(tables[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// initialSchemaModels 初始表结构包含的模型，按依赖顺序排列，被引用的表在前
+func initialSchemaModels() []interface{} {
+	return []interface{}{
+		&v1Role{},
+		&v1User{},
+		&v1Album{},
+		&v1Image{},
+		&v1ImageAlbum{},
+		&v1Tag{},
+		&v1ImageTag{},
+		&v1SearchDocument{},
+		&v1PasswordResetCode{},
+		&v1SystemSetting{},
+		&v1RefreshTokenBlacklist{},
+		&v1BackupTask{},
+		&v1RestoreTask{},
+		&v1Storage{},
+		&v1ExportTask{},
+		&v1Job{},
+	}
+}
+
+// 以下为版本 1 的表结构快照，只保留影响表结构的字段和标签
+// 图片与相册的多对多关联由 v1ImageAlbum 定义，快照中不声明 many2many 字段
+
+type v1Base struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type v1Role struct {
+	Base              v1Base   `gorm:"embedded"`
+	Name              string   `gorm:"uniqueIndex;size:50;not null"`
+	Description       string   `gorm:"size:200"`
+	Users             []v1User `gorm:"foreignKey:RoleID"`
+	AllowedExtensions string   `gorm:"type:json"`
+	MaxFilesPerUpload int      `gorm:"default:10"`
+	MaxFileSizeMB     int      `gorm:"default:5"`
+	MaxAlbumsPerUser  int      `gorm:"default:5"`
+	MaxStorageSizeMB  int      `gorm:"default:300"`
+	GalleryOpen       bool     `gorm:"default:false"`
+	StorageName       string   `gorm:"size:50;default:'local'"`
+}
+
+func (v1Role) TableName() string { return "roles" }
+
+type v1User struct {
+	Base       v1Base `gorm:"embedded"`
+	Username   string `gorm:"uniqueIndex;size:50;not null"`
+	Password   string `gorm:"size:100;not null"`
+	Email      string `gorm:"uniqueIndex;size:100;not null"`
+	RoleID     uint   `gorm:"not null;default:2"`
+	Role       v1Role `gorm:"foreignKey:RoleID"`
+	Active     bool   `gorm:"default:false"`
+	TotalSize  int64  `gorm:"not null;default:0"`
+	ImageCount int    `gorm:"not null;default:0"`
+}
+
+func (v1User) TableName() string { return "users" }
+
+type v1Album struct {
+	Base           v1Base         `gorm:"embedded"`
+	Name           string         `gorm:"size:100;not null"`
+	Description    string         `gorm:"size:500"`
+	UserID         uint           `gorm:"not null;index"`
+	User           v1User         `gorm:"foreignKey:UserID"`
+	CoverImage     string         `gorm:"size:500"`
+	ImageCount     int            `gorm:"default:0"`
+	GalleryEnabled bool           `gorm:"default:false"`
+	SerialNumber   int            `gorm:"default:0"`
+	DeletedAt      gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Album) TableName() string { return "albums" }
+
+type v1Image struct {
+	Base            v1Base         `gorm:"embedded"`
+	FileName        string         `gorm:"size:255;not null"`
+	OriginalName    string         `gorm:"size:255;not null"`
+	FileURL         string         `gorm:"size:500;not null;uniqueIndex"`
+	FileSize        int64          `gorm:"not null"`
+	FileHash        string         `gorm:"size:64;index"`
+	Width           int            `gorm:"not null"`
+	Height          int            `gorm:"not null"`
+	MimeType        string         `gorm:"size:50;not null"`
+	UserID          uint           `gorm:"not null;index"`
+	User            v1User         `gorm:"foreignKey:UserID"`
+	ThumbnailURL    string         `gorm:"size:500"`
+	ThumbnailSize   int64          `gorm:"not null"`
+	ThumbnailWidth  int            `gorm:"not null"`
+	ThumbnailHeight int            `gorm:"not null"`
+	Tags            string         `gorm:"type:json"`
+	StorageName     string         `gorm:"size:50;not null;default:'local'"`
+	Hidden          bool           `gorm:"not null;default:false"`
+	DeletedAt       gorm.DeletedAt `gorm:"index"`
+}
+
+func (v1Image) TableName() string { return "images" }
+
+type v1ImageAlbum struct {
+	ImageID uint    `gorm:"primaryKey"`
+	AlbumID uint    `gorm:"primaryKey"`
+	Image   v1Image `gorm:"foreignKey:ImageID"`
+	Album   v1Album `gorm:"foreignKey:AlbumID"`
+}
+
+func (v1ImageAlbum) TableName() string { return "image_albums" }
+
+type v1Tag struct {
+	Base   v1Base `gorm:"embedded"`
+	UserID uint   `gorm:"not null;uniqueIndex:idx_tags_user_name"`
+	Name   string `gorm:"size:100;not null;uniqueIndex:idx_tags_user_name;index"`
+}
+
+func (v1Tag) TableName() string { return "tags" }
+
+type v1ImageTag struct {
+	ImageID uint `gorm:"primaryKey"`
+	TagID   uint `gorm:"primaryKey;index"`
+}
+
+func (v1ImageTag) TableName() string { return "image_tags" }
+
+type v1SearchDocument struct {
+	ImageID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	UserID    uint   `gorm:"not null;index"`
+	Name      string `gorm:"size:255;not null"`
+	Tags      string `gorm:"type:text"`
+	Albums    string `gorm:"type:text"`
+	UpdatedAt time.Time
+}
+
+func (v1SearchDocument) TableName() string { return "search_documents" }
+
+type v1PasswordResetCode struct {
+	Base      v1Base    `gorm:"embedded"`
+	Email     string    `gorm:"size:100;not null;index"`
+	Code      string    `gorm:"size:6;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	Used      bool      `gorm:"default:false"`
+}
+
+func (v1PasswordResetCode) TableName() string { return "password_reset_codes" }
+
+type v1SystemSetting struct {
+	Base  v1Base `gorm:"embedded"`
+	Value string `gorm:"type:json"`
+}
+
+func (v1SystemSetting) TableName() string { return "system_settings" }
+
+type v1RefreshTokenBlacklist struct {
+	ID        uint      `gorm:"primaryKey"`
+	TokenHash string    `gorm:"uniqueIndex;size:64;not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+func (v1RefreshTokenBlacklist) TableName() string { return "refresh_token_blacklist" }
+
+type v1BackupTask struct {
+	Base         v1Base `gorm:"embedded"`
+	Status       string `gorm:"size:20;not null"`
+	StartTime    time.Time
+	EndTime      *time.Time
+	Size         int64
+	StoragePath  string `gorm:"size:255"`
+	Error        string `gorm:"type:text"`
+	Scheduled    bool   `gorm:"not null;default:false"`
+	Location     string `gorm:"size:50"`
+	BaseBackupID *uint  `gorm:"index"`
+	DataSize     int64
+	Encrypted    bool `gorm:"not null;default:false"`
+}
+
+func (v1BackupTask) TableName() string { return "backup_tasks" }
+
+type v1RestoreTask struct {
+	Base         v1Base       `gorm:"embedded"`
+	BackupTask   v1BackupTask `gorm:"foreignKey:BackupTaskID"`
+	BackupTaskID uint
+	Status       string `gorm:"size:20;not null"`
+	StartTime    time.Time
+	EndTime      *time.Time
+	Error        string `gorm:"type:text"`
+}
+
+func (v1RestoreTask) TableName() string { return "restore_tasks" }
+
+type v1Storage struct {
+	Base   v1Base `gorm:"embedded"`
+	Name   string `gorm:"uniqueIndex;size:50;not null"`
+	Type   string `gorm:"size:20;not null"`
+	Config string `gorm:"type:json;not null"`
+}
+
+func (v1Storage) TableName() string { return "storages" }
+
+type v1ExportTask struct {
+	Base        v1Base `gorm:"embedded"`
+	UserID      uint   `gorm:"not null;index"`
+	RequestedBy uint   `gorm:"not null"`
+	Status      string `gorm:"size:20;not null"`
+	Total       int
+	Processed   int
+	Size        int64
+	FilePath    string `gorm:"size:255"`
+	Error       string `gorm:"type:text"`
+	StartTime   time.Time
+	EndTime     *time.Time
+	ExpiresAt   *time.Time `gorm:"index"`
+}
+
+func (v1ExportTask) TableName() string { return "export_tasks" }
+
+type v1Job struct {
+	Base         v1Base    `gorm:"embedded"`
+	Type         string    `gorm:"size:50;not null;index"`
+	Payload      string    `gorm:"type:text"`
+	Status       string    `gorm:"size:20;not null;index"`
+	Attempts     int       `gorm:"not null;default:0"`
+	MaxAttempts  int       `gorm:"not null;default:1"`
+	RunAt        time.Time `gorm:"index"`
+	StartedAt    *time.Time
+	FinishedAt   *time.Time
+	Error        string `gorm:"type:text"`
+	TraceContext string `gorm:"type:text"`
+}
+
+func (v1Job) TableName() string { return "jobs" }
@@ -0,0 +1,102 @@
+package migrations
+
+import (
+	"strings"
+	"time"
+
+	"github.com/leleo886/lopic/internal/log"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// backfillImageTags 数据迁移，导入旧版本的数据后重新执行以补全标签关联
+var backfillImageTags = Migration{
+	Version: 2,
+	Name:    "backfill_image_tags",
+	Data:    true,
+	Schema:  []interface{}{&v2Image{}, &v2Tag{}, &v2ImageTag{}},
+	Up:      migrateImageTags,
+	// 标签数据由图片的 Tags 字段生成，回滚时保留
+	Down: func(tx *gorm.DB) error { return nil },
+}
+
+// migrateImageTags 将图片 JSON 字段中的标签回填到 tags / image_tags 表，仅在关联表为空时执行
+func migrateImageTags(db *gorm.DB) error {
+	var count int64
+	if err := db.Model(&v2ImageTag{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var images []v2Image
+	tagIDs := make(map[uint]map[string]uint)
+	filled := 0
+	// 快照中没有 DeletedAt，回收站中的图片同样回填
+	result := db.Select("id", "user_id", "tags").
+		Where("tags IS NOT NULL").
+		FindInBatches(&images, 500, func(tx *gorm.DB, batch int) error {
+			for _, image := range images {
+				if tagIDs[image.UserID] == nil {
+					tagIDs[image.UserID] = make(map[string]uint)
+				}
+				for _, name := range image.Tags {
+					name = strings.TrimSpace(name)
+					if name == "" {
+						continue
+					}
+					tagID, ok := tagIDs[image.UserID][name]
+					if !ok {
+						tag := v2Tag{UserID: image.UserID, Name: name}
+						if err := db.Where(tag).FirstOrCreate(&tag).Error; err != nil {
+							return err
+						}
+						tagID = tag.ID
+						tagIDs[image.UserID][name] = tagID
+					}
+					if err := db.Clauses(clause.OnConflict{DoNothing: true}).
+						Create(&v2ImageTag{ImageID: image.ID, TagID: tagID}).Error; err != nil {
+						return err
+					}
+				}
+				filled++
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if filled > 0 {
+		log.Infof("Migrated tags of %d images", filled)
+	}
+	return nil
+}
+
+// 以下为本迁移使用的表结构快照，只包含用到的字段
+
+type v2Image struct {
+	ID     uint
+	UserID uint
+	Tags   []string `gorm:"serializer:json"`
+}
+
+func (v2Image) TableName() string { return "images" }
+
+type v2Tag struct {
+	ID        uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint
+	Name      string
+}
+
+func (v2Tag) TableName() string { return "tags" }
+
+type v2ImageTag struct {
+	ImageID uint `gorm:"primaryKey"`
+	TagID   uint `gorm:"primaryKey"`
+}
+
+func (v2ImageTag) TableName() string { return "image_tags" }
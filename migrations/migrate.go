@@ -1,58 +1,303 @@
 package migrations
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/models"
 	"gorm.io/gorm"
 )
 
-func Migrate(db *gorm.DB) error {
-	log.Infof("Starting database migration...")
+// Migration 一次数据库迁移，Version 从 1 开始连续递增
+// 每个迁移位于名为 <四位版本号>_<Name>.go 的文件中，迁移执行后不应再修改其行为
+// 迁移使用在自身文件中声明的表结构快照，不引用 models 包，避免模型变化改变已发布迁移的行为
+type Migration struct {
+	Version uint
+	Name    string
+	// Data 只修改数据、不修改表结构，导入旧版本的数据后会重新执行，需可重复执行
+	Data bool
+	// Schema 迁移使用的表结构快照，与版本号和名称一起计算校验和
+	Schema []interface{}
+	Up     func(tx *gorm.DB) error
+	// Down 回滚迁移，为 nil 时不可回滚
+	Down func(tx *gorm.DB) error
+}
 
-	if err := db.AutoMigrate(&models.Role{}); err != nil {
-		return err
+// all 所有迁移，按版本号排列
+var all = []Migration{
+	initialSchema,
+	backfillImageTags,
+}
+
+const (
+	StateApplied  = "applied"
+	StatePending  = "pending"
+	StateModified = "modified" // 已执行，但名称或表结构快照在执行后被修改
+	StateUnknown  = "unknown"  // 数据库中有记录，但当前版本没有该迁移
+)
+
+var (
+	// ErrSchemaTooNew 数据库由更新版本的程序迁移过，当前版本不能使用
+	ErrSchemaTooNew = errors.New("database schema is newer than this version of lopic")
+	// ErrChecksumMismatch 已执行的迁移在执行后被修改
+	ErrChecksumMismatch = errors.New("applied migration has been modified")
+	// ErrIrreversible 迁移不可回滚
+	ErrIrreversible = errors.New("migration is irreversible")
+)
+
+// Status 迁移的执行状态
+type Status struct {
+	Version   uint       `json:"version"`
+	Name      string     `json:"name"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Latest 返回最新的迁移版本
+func Latest() uint {
+	return all[len(all)-1].Version
+}
+
+// checksum 返回按版本号、名称和表结构快照（表名、字段名、类型和 gorm 标签）计算的 SHA-256
+// 只修改注释、格式或代码不改变校验和
+func (m Migration) checksum() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d %s %t\n", m.Version, m.Name, m.Data)
+	for _, model := range m.Schema {
+		var table string
+		if tabler, ok := model.(interface{ TableName() string }); ok {
+			table = tabler.TableName()
+		}
+		fmt.Fprintf(h, "table %s\n", table)
+		writeSchemaFields(h, reflect.Indirect(reflect.ValueOf(model)).Type())
 	}
+	return hex.EncodeToString(h.Sum(nil))
+}
 
-	if err := db.AutoMigrate(&models.User{}); err != nil {
-		return err
+// writeSchemaFields 写入结构体的字段，嵌入的结构体按其字段展开
+func writeSchemaFields(w io.Writer, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			writeSchemaFields(w, field.Type)
+			continue
+		}
+		fmt.Fprintf(w, "%s %s %q\n", field.Name, field.Type, field.Tag.Get("gorm"))
 	}
+}
 
-	if err := db.AutoMigrate(&models.Album{}); err != nil {
-		return err
+// applied 返回已执行的迁移，按版本号索引
+func applied(db *gorm.DB) (map[uint]models.SchemaMigration, error) {
+	if err := db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("create schema_migrations table: %w", err)
 	}
+	var records []models.SchemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]models.SchemaMigration, len(records))
+	for _, record := range records {
+		result[record.Version] = record
+	}
+	return result, nil
+}
 
-	if err := db.AutoMigrate(&models.Image{}); err != nil {
-		return err
+// GetStatus 返回所有迁移的执行状态，包括数据库中有记录但当前版本没有的迁移
+func GetStatus(db *gorm.DB) ([]Status, error) {
+	records, err := applied(db)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := db.AutoMigrate(&models.ImageAlbum{}); err != nil {
-		return err
+	statuses := make([]Status, 0, len(all))
+	for _, m := range all {
+		status := Status{Version: m.Version, Name: m.Name, State: StatePending}
+		if record, ok := records[m.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+			status.State = StateApplied
+			if record.Checksum != m.checksum() {
+				status.State = StateModified
+			}
+			delete(records, m.Version)
+		}
+		statuses = append(statuses, status)
 	}
+	for _, version := range slices.Sorted(maps.Keys(records)) {
+		record := records[version]
+		appliedAt := record.AppliedAt
+		statuses = append(statuses, Status{Version: record.Version, Name: record.Name, State: StateUnknown, AppliedAt: &appliedAt})
+	}
+	return statuses, nil
+}
 
-	if err := db.AutoMigrate(&models.PasswordResetCode{}); err != nil {
+// Check 检查数据库能否由当前版本使用：没有未知的迁移，已执行的迁移没有被修改
+func Check(db *gorm.DB) error {
+	statuses, err := GetStatus(db)
+	if err != nil {
 		return err
 	}
+	for _, status := range statuses {
+		switch status.State {
+		case StateUnknown:
+			return fmt.Errorf("%w: migration %d (%s) is applied but unknown, latest known version is %d", ErrSchemaTooNew, status.Version, status.Name, Latest())
+		case StateModified:
+			return fmt.Errorf("%w: %04d_%s", ErrChecksumMismatch, status.Version, status.Name)
+		}
+	}
+	return nil
+}
 
-	if err := db.AutoMigrate(&models.SystemSetting{}); err != nil {
+// Migrate 执行所有未执行的迁移
+func Migrate(db *gorm.DB) error {
+	return To(db, Latest())
+}
+
+// Down 回滚最近执行的 steps 个迁移
+func Down(db *gorm.DB, steps int) error {
+	records, err := applied(db)
+	if err != nil {
 		return err
 	}
+	version := uint(0)
+	for i := len(all) - 1; i >= 0; i-- {
+		if _, ok := records[all[i].Version]; !ok {
+			continue
+		}
+		if steps == 0 {
+			version = all[i].Version
+			break
+		}
+		steps--
+	}
+	return To(db, version)
+}
 
-	if err := db.AutoMigrate(&models.RefreshTokenBlacklist{}); err != nil {
+// To 执行或回滚迁移，使数据库处于指定版本，版本为 0 时回滚所有迁移
+func To(db *gorm.DB, version uint) error {
+	if version > Latest() {
+		return fmt.Errorf("unknown migration version %d, latest version is %d", version, Latest())
+	}
+	if err := Check(db); err != nil {
 		return err
 	}
-
-	if err := db.AutoMigrate(&models.BackupTask{}); err != nil {
+	records, err := applied(db)
+	if err != nil {
 		return err
 	}
 
-	if err := db.AutoMigrate(&models.RestoreTask{}); err != nil {
-		return err
+	// 先按版本号从大到小回滚，再按从小到大执行
+	for i := len(all) - 1; i >= 0; i-- {
+		m := all[i]
+		if _, ok := records[m.Version]; !ok || m.Version <= version {
+			continue
+		}
+		if err := rollback(db, m); err != nil {
+			return err
+		}
+	}
+	for _, m := range all {
+		if _, ok := records[m.Version]; ok || m.Version > version {
+			continue
+		}
+		if err := apply(db, m); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	if err := db.AutoMigrate(&models.Storage{}); err != nil {
-		return err
+// apply 在事务中执行迁移并记录
+// MySQL 的 DDL 会隐式提交，迁移失败时已执行的表结构修改不会回滚
+func apply(db *gorm.DB, m Migration) error {
+	log.Infof("Applying migration %04d_%s", m.Version, m.Name)
+	start := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := m.Up(tx); err != nil {
+			return err
+		}
+		return tx.Create(&models.SchemaMigration{Version: m.Version, Name: m.Name, Checksum: m.checksum(), AppliedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
 	}
+	log.Infof("Applied migration %04d_%s in %s", m.Version, m.Name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
 
-	log.Infof("Database migration completed successfully")
+// rollback 在事务中回滚迁移并删除记录
+func rollback(db *gorm.DB, m Migration) error {
+	if m.Down == nil {
+		return fmt.Errorf("%w: %04d_%s", ErrIrreversible, m.Version, m.Name)
+	}
+	log.Infof("Rolling back migration %04d_%s", m.Version, m.Name)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := m.Down(tx); err != nil {
+			return err
+		}
+		return tx.Delete(&models.SchemaMigration{}, m.Version).Error
+	})
+	if err != nil {
+		return fmt.Errorf("rollback of migration %04d_%s failed: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+// Version 返回数据库当前的迁移版本，没有执行过迁移时为 0
+func Version(db *gorm.DB) (uint, error) {
+	records, err := applied(db)
+	if err != nil {
+		return 0, err
+	}
+	var version uint
+	for v := range records {
+		version = max(version, v)
+	}
+	return version, nil
+}
+
+// SetVersion 将迁移记录设置为指定版本而不执行迁移，用于恢复按该版本导出的表结构和数据之后
+func SetVersion(db *gorm.DB, version uint) error {
+	if version > Latest() {
+		return fmt.Errorf("%w: version %d, latest known version is %d", ErrSchemaTooNew, version, Latest())
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&models.SchemaMigration{}); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM schema_migrations").Error; err != nil {
+			return err
+		}
+		for _, m := range all {
+			if m.Version > version {
+				break
+			}
+			if err := tx.Create(&models.SchemaMigration{Version: m.Version, Name: m.Name, Checksum: m.checksum(), AppliedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigrateData 重新执行版本号大于 since 的数据迁移，用于将旧版本导出的数据导入到当前表结构之后
+func MigrateData(db *gorm.DB, since uint) error {
+	for _, m := range all {
+		if !m.Data || m.Version <= since {
+			continue
+		}
+		log.Infof("Re-running data migration %04d_%s", m.Version, m.Name)
+		if err := db.Transaction(m.Up); err != nil {
+			return fmt.Errorf("data migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,161 @@
+package migrations
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+func openDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	return db
+}
+
+func TestMigrationSources(t *testing.T) {
+	for i, m := range all {
+		if m.Version != uint(i+1) {
+			t.Errorf("migration %s has version %d, want %d", m.Name, m.Version, i+1)
+		}
+		fileName := fmt.Sprintf("%04d_%s.go", m.Version, m.Name)
+		source, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Errorf("source of migration %d: %v", m.Version, err)
+		}
+		if bytes.Contains(source, []byte(`"github.com/leleo886/lopic/models"`)) {
+			t.Errorf("migration %s imports models, use a schema snapshot instead", fileName)
+		}
+	}
+}
+
+func TestMigrationChecksums(t *testing.T) {
+	// 已发布迁移的校验和，改变时已执行该迁移的数据库将无法启动
+	released := map[uint]string{
+		1: "4efa88ae3e9c758ac9d55d89c14e00f1e011b4d7da5f6ccdcc25b348cfdfa22b",
+		2: "2396bdbcd17f868a8c75b6b2ba84758e2bf799ed9b28bb9627862bc27a2db971",
+	}
+	for _, m := range all {
+		if want, ok := released[m.Version]; ok && m.checksum() != want {
+			t.Errorf("checksum of migration %d = %s, want %s", m.Version, m.checksum(), want)
+		}
+	}
+
+	snapshot := Migration{Version: 1, Name: "test", Schema: []interface{}{&v2Tag{}}}
+	changed := snapshot
+	changed.Schema = []interface{}{&v2ImageTag{}}
+	if snapshot.checksum() == changed.checksum() {
+		t.Error("checksum does not change with the schema snapshot")
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	db := openDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if version, err := Version(db); err != nil || version != Latest() {
+		t.Fatalf("Version() = %d, %v, want %d", version, err, Latest())
+	}
+	// 重复执行不会重新迁移
+	if err := Migrate(db); err != nil {
+		t.Fatalf("second Migrate() error = %v", err)
+	}
+
+	if err := Down(db, 1); err != nil {
+		t.Fatalf("Down() error = %v", err)
+	}
+	statuses, err := GetStatus(db)
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if statuses[0].State != StateApplied || statuses[len(statuses)-1].State != StatePending {
+		t.Errorf("GetStatus() after Down = %+v", statuses)
+	}
+
+	if err := To(db, 0); err != nil {
+		t.Fatalf("To(0) error = %v", err)
+	}
+	if db.Migrator().HasTable(&models.Image{}) {
+		t.Error("images table still exists after rolling back all migrations")
+	}
+	if err := To(db, Latest()+1); err == nil {
+		t.Error("To() with unknown version expected error")
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() after rollback error = %v", err)
+	}
+}
+
+func TestMigrateExistingSchema(t *testing.T) {
+	// 引入版本化迁移前由 AutoMigrate 创建的数据库
+	db := openDB(t)
+	if err := db.AutoMigrate(initialSchemaModels()...); err != nil {
+		t.Fatal(err)
+	}
+	image := models.Image{FileName: "a.png", OriginalName: "a.png", UserID: 1, Tags: []string{"sea"}}
+	if err := db.Create(&image).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	var tags int64
+	db.Model(&models.ImageTag{}).Count(&tags)
+	if tags != 1 {
+		t.Errorf("image tags = %d, want 1", tags)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	db := openDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	if err := db.Create(&models.SchemaMigration{Version: Latest() + 1, Name: "future", Checksum: "x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Migrate() error = %v, want ErrSchemaTooNew", err)
+	}
+	statuses, _ := GetStatus(db)
+	if last := statuses[len(statuses)-1]; last.State != StateUnknown || last.Name != "future" {
+		t.Errorf("GetStatus() last = %+v", last)
+	}
+	db.Delete(&models.SchemaMigration{}, Latest()+1)
+
+	db.Model(&models.SchemaMigration{}).Where("version = ?", 1).Update("checksum", "modified")
+	if err := Migrate(db); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("Migrate() error = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestSetVersion(t *testing.T) {
+	db := openDB(t)
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	if err := SetVersion(db, 1); err != nil {
+		t.Fatalf("SetVersion() error = %v", err)
+	}
+	if version, _ := Version(db); version != 1 {
+		t.Errorf("Version() = %d, want 1", version)
+	}
+	if err := SetVersion(db, Latest()+1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("SetVersion() error = %v, want ErrSchemaTooNew", err)
+	}
+	if err := MigrateData(db, 0); err != nil {
+		t.Errorf("MigrateData() error = %v", err)
+	}
+}
@@ -166,6 +166,19 @@ func InitializeSystemSettings(db *gorm.DB) error {
 			Title:           "LOPIC",
 			BackgroundImage: "",
 		},
+		Trash: models.TrashConfig{
+			RetentionDays: 30,
+			CountInQuota:  false,
+		},
+		Backup: models.BackupConfig{
+			Enabled:         false,
+			Schedule:        "0 3 * * *",
+			KeepLast:        3,
+			KeepDaily:       7,
+			KeepWeekly:      4,
+			NotifyOnFailure: true,
+			FullEvery:       7,
+		},
 	}
 
 	systemSetting := models.SystemSetting{
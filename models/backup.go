@@ -6,12 +6,18 @@ import (
 
 type BackupTask struct {
 	BaseModel
-	Status      string     `gorm:"size:20;not null" json:"status"`
-	StartTime   time.Time  `json:"start_time"`
-	EndTime     *time.Time `json:"end_time"`
-	Size        int64      `json:"size"`
-	StoragePath string     `gorm:"size:255" json:"storage_path"`
-	Error       string     `gorm:"type:text" json:"error"`
+	Status       string     `gorm:"size:20;not null" json:"status"`
+	StartTime    time.Time  `json:"start_time"`
+	EndTime      *time.Time `json:"end_time"`
+	Size         int64      `json:"size"`
+	StoragePath  string     `gorm:"size:255" json:"storage_path"`
+	Error        string     `gorm:"type:text" json:"error"`
+	Scheduled    bool       `gorm:"not null;default:false" json:"scheduled"` // 是否为自动备份，只有自动备份会按保留策略清理
+	Location     string     `gorm:"size:50" json:"location"`                 // 备份所在的存储名称，为空时 StoragePath 为本地备份目录中的路径
+	BaseBackupID *uint      `gorm:"index" json:"base_backup_id"`             // 增量备份的基础备份，为空时为完整备份
+	DataSize     int64      `json:"data_size"`                               // 备份包含的文件总大小（包括引用自备份链的文件），Size 为备份文件实际占用的大小
+	Chain        []uint     `gorm:"-" json:"chain,omitempty"`                // 恢复该备份需要的备份链，从完整备份开始
+	Encrypted    bool       `gorm:"not null;default:false" json:"encrypted"` // 备份文件是否加密
 }
 
 type RestoreTask struct {
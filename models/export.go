@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// ExportTask 用户数据导出任务，导出文件在过期后删除
+type ExportTask struct {
+	BaseModel
+	UserID      uint       `gorm:"not null;index" json:"user_id"`  // 被导出数据的用户
+	RequestedBy uint       `gorm:"not null" json:"requested_by"`   // 发起导出的用户，管理员可为其他用户导出
+	Status      string     `gorm:"size:20;not null" json:"status"` // pending、running、completed、failed 或 expired
+	Total       int        `json:"total"`                          // 需要导出的图片数
+	Processed   int        `json:"processed"`                      // 已导出的图片数
+	Size        int64      `json:"size"`                           // 导出文件的大小
+	FilePath    string     `gorm:"size:255" json:"-"`              // 导出文件的本地路径
+	Error       string     `gorm:"type:text" json:"error"`         // 失败原因，或无法读取的文件数
+	StartTime   time.Time  `json:"start_time"`
+	EndTime     *time.Time `json:"end_time"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expires_at"`         // 下载链接的过期时间
+	DownloadURL string     `gorm:"-" json:"download_url,omitempty"` // 带签名的下载链接，只在导出完成且未过期时返回
+}
+
+func (ExportTask) TableName() string {
+	return "export_tasks"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Job 后台任务队列中的任务，Payload 为任务参数的 JSON
+type Job struct {
+	BaseModel
+	Type        string     `gorm:"size:50;not null;index" json:"type"`
+	Payload     string     `gorm:"type:text" json:"payload"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"` // pending、running、completed、failed 或 canceled
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`   // 已执行的次数
+	MaxAttempts int        `gorm:"not null;default:1" json:"max_attempts"`
+	RunAt       time.Time  `gorm:"index" json:"run_at"` // 最早可以执行的时间，重试时按退避时间推后
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	Error       string     `gorm:"type:text" json:"error"` // 最近一次执行失败的原因
+	// TraceContext 添加任务时的追踪上下文，任务执行的 span 关联到添加任务的请求
+	TraceContext string `gorm:"type:text" json:"-"`
+}
+
+func (Job) TableName() string {
+	return "jobs"
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// SchemaMigration 已执行的数据库迁移
+type SchemaMigration struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Checksum  string    `gorm:"size:64;not null" json:"checksum"` // 按迁移的名称和表结构快照计算的 SHA-256，迁移执行后不应再修改
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// SearchDocument 图片的全文检索文档，由图片名称、标签和所在相册的名称与描述组成
+type SearchDocument struct {
+	ImageID   uint      `gorm:"primaryKey;autoIncrement:false" json:"image_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Name      string    `gorm:"size:255;not null" json:"name"`
+	Tags      string    `gorm:"type:text" json:"tags"`
+	Albums    string    `gorm:"type:text" json:"albums"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (SearchDocument) TableName() string {
+	return "search_documents"
+}
@@ -30,11 +30,31 @@ type GalleryConfig struct {
 	CustomContent   string `mapstructure:"custom_content"`
 }
 
+// TrashConfig 回收站配置结构体
+type TrashConfig struct {
+	RetentionDays int  `mapstructure:"retention_days"` // 回收站保留天数，<=0 时使用默认值
+	CountInQuota  bool `mapstructure:"count_in_quota"` // 回收站中的图片是否计入存储配额
+}
+
+// BackupConfig 备份配置结构体
+type BackupConfig struct {
+	Destination     string `mapstructure:"destination"`       // 备份目标存储名称，为空时保存在本地备份目录
+	Enabled         bool   `mapstructure:"enabled"`           // 是否启用自动备份
+	Schedule        string `mapstructure:"schedule"`          // cron 表达式（分 时 日 月 周），如 "0 3 * * *" 表示每天 03:00
+	KeepLast        int    `mapstructure:"keep_last"`         // 保留最近的 N 个自动备份
+	KeepDaily       int    `mapstructure:"keep_daily"`        // 保留最近 N 天中每天最新的自动备份
+	KeepWeekly      int    `mapstructure:"keep_weekly"`       // 保留最近 N 周中每周最新的自动备份
+	NotifyOnFailure bool   `mapstructure:"notify_on_failure"` // 自动备份失败时通知管理员
+	FullEvery       int    `mapstructure:"full_every"`        // 每 N 个自动备份做一次完整备份，其余为增量备份，<=1 时每次都做完整备份
+}
+
 // SystemSettings 系统设置结构体
 type SystemSettings struct {
 	General GeneralConfig `mapstructure:"general"`
 	Mail    MailConfig    `mapstructure:"mail"`
 	Gallery GalleryConfig `mapstructure:"gallery"`
+	Trash   TrashConfig   `mapstructure:"trash"`
+	Backup  BackupConfig  `mapstructure:"backup"`
 }
 
 // SystemSetting 系统设置模型
@@ -0,0 +1,22 @@
+package models
+
+// Tag 用户标签，同一用户下名称唯一
+type Tag struct {
+	BaseModel
+	UserID uint   `gorm:"not null;uniqueIndex:idx_tags_user_name" json:"user_id"`
+	Name   string `gorm:"size:100;not null;uniqueIndex:idx_tags_user_name;index" json:"name"`
+}
+
+func (Tag) TableName() string {
+	return "tags"
+}
+
+// ImageTag 图片与标签的关联
+type ImageTag struct {
+	ImageID uint `gorm:"primaryKey" json:"image_id"`
+	TagID   uint `gorm:"primaryKey;index" json:"tag_id"`
+}
+
+func (ImageTag) TableName() string {
+	return "image_tags"
+}
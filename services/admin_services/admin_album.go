@@ -1,8 +1,10 @@
 package admin_services
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/leleo886/lopic/internal/database"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/models"
@@ -18,20 +20,20 @@ func NewAlbumService(db *gorm.DB) *AlbumService {
 	return &AlbumService{db: db}
 }
 
-func (s *AlbumService) GetAllAlbums(page, pageSize, offset int, searchkey, orderby, order string) (*services.GetAlbumsResponse, error) {
+func (s *AlbumService) GetAllAlbums(ctx context.Context, page, pageSize, offset int, searchkey, orderby, order string) (*services.GetAlbumsResponse, error) {
 	var albums []services.AlbumResponse
 	var total int64
 
 	query := s.db.Model(&models.Album{})
 	if searchkey != "" {
 		sk := fmt.Sprintf("%%%s%%", searchkey)
-		query = query.Where("name LIKE ? OR description LIKE ?", sk, sk)
+		query = query.Where(fmt.Sprintf("name %[1]s ? OR description %[1]s ?", database.Like(s.db)), sk, sk)
 	}
 	query.Count(&total)
 	res := query.Offset(offset).Limit(pageSize).
 		Order(fmt.Sprintf("%s %s", orderby, order)).Find(&albums)
 	if res.Error != nil {
-		log.Errorf("failed to get albums: error=%v", res.Error)
+		log.Ctx(ctx).Errorf("failed to get albums: error=%v", res.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -52,7 +54,7 @@ func (s *AlbumService) GetAlbum(id uint) (*services.AlbumResponse, error) {
 	return &album, nil
 }
 
-func (s *AlbumService) DeleteAlbum(id uint) error {
+func (s *AlbumService) DeleteAlbum(ctx context.Context, id uint) error {
 	// 使用事务处理删除操作
 	tx := s.db.Begin()
 	defer func() {
@@ -69,18 +71,15 @@ func (s *AlbumService) DeleteAlbum(id uint) error {
 		return cerrors.ErrAlbumNotFound
 	}
 
-	tx.Model(&album).Association("Images").Clear()
-
-	res = tx.Delete(&album)
-	if res.Error != nil {
+	// 移入所属用户的回收站，保留图片关联以便恢复
+	if err := services.TrashAlbum(tx, &album); err != nil {
 		tx.Rollback()
-		log.Errorf("failed to delete album: id=%d, error=%v", id, res.Error)
-		return cerrors.ErrInternalServer
+		return err
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("failed to commit transaction: %v", err)
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
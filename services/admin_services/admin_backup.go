@@ -2,22 +2,27 @@ package admin_services
 
 import (
 	"archive/zip"
-	"bytes"
-	"database/sql"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/encrypt"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/queue"
 	"github.com/leleo886/lopic/internal/storage"
+	"github.com/leleo886/lopic/migrations"
 	"github.com/leleo886/lopic/models"
+	"github.com/leleo886/lopic/services"
 	"golang.org/x/text/encoding/simplifiedchinese"
 	"gorm.io/gorm"
 )
@@ -27,14 +32,24 @@ type BackupService struct {
 	storageService *storage.StorageService
 	dbConfig       *config.DatabaseConfig
 	serverConfig   *config.ServerConfig
+	backupConfig   *config.BackupConfig
+	queue          *queue.Queue
+	// scheduledFailed 自动备份最终失败或被取消时调用，可以为空
+	scheduledFailed func(task *models.BackupTask, errorMsg string)
+
+	// passphrases 任务使用的加密口令，只保存在内存中，不写入任务参数
+	passphraseMu sync.Mutex
+	passphrases  map[string]string
 }
 
-func NewBackupService(db *gorm.DB, storageService *storage.StorageService, dbConfig *config.DatabaseConfig, serverConfig *config.ServerConfig) *BackupService {
+func NewBackupService(db *gorm.DB, storageService *storage.StorageService, dbConfig *config.DatabaseConfig, serverConfig *config.ServerConfig, backupConfig *config.BackupConfig) *BackupService {
 	return &BackupService{
 		db:             db,
 		storageService: storageService,
 		dbConfig:       dbConfig,
 		serverConfig:   serverConfig,
+		backupConfig:   backupConfig,
+		passphrases:    make(map[string]string),
 	}
 }
 
@@ -45,7 +60,20 @@ func (s *BackupService) getDatabaseDriver() string {
 	return "unknown"
 }
 
-func (s *BackupService) CreateBackup() (*models.BackupTask, error) {
+// BackupOptions 备份选项
+type BackupOptions struct {
+	// Incremental 只保存最近一次备份之后新增或变化的文件
+	Incremental bool
+	// MaxChain 增量备份链的最大长度，<=0 时不限制
+	MaxChain int
+	// Portable 数据库导出为与数据库类型无关的格式，可以恢复到其他类型的数据库
+	Portable bool
+	// Passphrase 加密口令，为空时使用配置的密钥加密，都没有时不加密
+	Passphrase string
+}
+
+// CreateBackup 创建备份任务
+func (s *BackupService) CreateBackup(opts BackupOptions) (*models.BackupTask, error) {
 	task := &models.BackupTask{
 		Status:    "pending",
 		StartTime: time.Now(),
@@ -55,18 +83,169 @@ func (s *BackupService) CreateBackup() (*models.BackupTask, error) {
 		return nil, cerrors.ErrInternalServer
 	}
 
-	// 启动异步备份任务
-	go func(taskID uint) {
-		if err := s.executeBackup(taskID); err != nil {
-			s.updateTaskStatus(taskID, "failed", err.Error())
-			log.Errorf("BackupTask %d failed: %v", taskID, err)
-		}
-	}(task.ID)
+	s.setPassphrase(backupJobType, task.ID, opts.Passphrase)
+	payload := backupJob{
+		TaskID:        task.ID,
+		Incremental:   opts.Incremental,
+		MaxChain:      opts.MaxChain,
+		Portable:      opts.Portable,
+		HasPassphrase: opts.Passphrase != "",
+	}
+	if err := s.enqueue(backupJobType, payload); err != nil {
+		s.dropPassphrase(backupJobType, task.ID)
+		s.updateTaskStatus(task.ID, "failed", err.Error())
+		return nil, err
+	}
 
 	return task, nil
 }
 
-func (s *BackupService) executeBackup(taskID uint) error {
+// ScheduleBackup 添加一次自动备份任务，上一次自动备份尚未完成时不重复添加，返回 nil
+// cfg.FullEvery 大于 1 时，每 FullEvery 个备份做一次完整备份，其余为增量备份；备份完成后按保留策略清理过期的自动备份
+func (s *BackupService) ScheduleBackup(cfg models.BackupConfig) (*models.BackupTask, error) {
+	var unfinished int64
+	if err := s.db.Model(&models.BackupTask{}).Where("scheduled = ? AND status IN ?", true, []string{"pending", "running"}).
+		Count(&unfinished).Error; err != nil {
+		return nil, cerrors.ErrInternalServer
+	}
+	if unfinished > 0 {
+		return nil, nil
+	}
+
+	task := &models.BackupTask{
+		Status:    "pending",
+		StartTime: time.Now(),
+		Scheduled: true,
+	}
+
+	if err := s.db.Create(task).Error; err != nil {
+		return nil, cerrors.ErrInternalServer
+	}
+
+	payload := backupJob{
+		TaskID:      task.ID,
+		Incremental: cfg.FullEvery > 1,
+		MaxChain:    cfg.FullEvery,
+		Scheduled:   true,
+	}
+	if err := s.enqueue(backupJobType, payload); err != nil {
+		s.updateTaskStatus(task.ID, "failed", err.Error())
+		return task, err
+	}
+
+	return task, nil
+}
+
+// OnScheduledBackupFailed 设置自动备份最终失败或被取消时的回调
+func (s *BackupService) OnScheduledBackupFailed(fn func(task *models.BackupTask, errorMsg string)) {
+	s.scheduledFailed = fn
+}
+
+// PruneBackups 按保留策略删除过期的自动备份，返回删除的数量，手动和上传的备份不受影响
+func (s *BackupService) PruneBackups(ctx context.Context, cfg models.BackupConfig) (int, error) {
+	if cfg.KeepLast <= 0 && cfg.KeepDaily <= 0 && cfg.KeepWeekly <= 0 {
+		return 0, nil
+	}
+
+	var tasks []models.BackupTask
+	if err := s.db.Where("scheduled = ? AND status = ?", true, "completed").
+		Order("start_time DESC").Find(&tasks).Error; err != nil {
+		log.Ctx(ctx).Errorf("Get scheduled backups failed: %v", err)
+		return 0, cerrors.ErrInternalServer
+	}
+
+	// 保留的备份所在备份链中的备份不能删除
+	var allTasks []models.BackupTask
+	if err := s.db.Find(&allTasks).Error; err != nil {
+		log.Ctx(ctx).Errorf("Get backups failed: %v", err)
+		return 0, cerrors.ErrInternalServer
+	}
+	expired := expiredBackups(tasks, cfg, time.Now())
+	needed := chainDependencies(allTasks, expired)
+
+	deleted := 0
+	for _, task := range expired {
+		if needed[task.ID] {
+			continue
+		}
+		if err := s.DeleteBackup(ctx, task.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// expiredBackups 返回不在保留策略内的备份，tasks 需按开始时间倒序排列
+// 保留最近 KeepLast 个，以及最近 KeepDaily 天每天、最近 KeepWeekly 周每周最新的一个
+func expiredBackups(tasks []models.BackupTask, cfg models.BackupConfig, now time.Time) []models.BackupTask {
+	keep := make(map[uint]bool)
+	for i := 0; i < len(tasks) && i < cfg.KeepLast; i++ {
+		keep[tasks[i].ID] = true
+	}
+
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	if cfg.KeepDaily > 0 {
+		since := today.AddDate(0, 0, 1-cfg.KeepDaily)
+		keepNewestPerPeriod(tasks, keep, since, func(t time.Time) string {
+			return t.Format("2006-01-02")
+		})
+	}
+	if cfg.KeepWeekly > 0 {
+		// 每周从周一开始
+		monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+		since := monday.AddDate(0, 0, -7*(cfg.KeepWeekly-1))
+		keepNewestPerPeriod(tasks, keep, since, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		})
+	}
+
+	var expired []models.BackupTask
+	for _, task := range tasks {
+		if !keep[task.ID] {
+			expired = append(expired, task)
+		}
+	}
+	return expired
+}
+
+// chainDependencies 返回未过期的备份所在备份链中的所有备份
+func chainDependencies(tasks []models.BackupTask, expired []models.BackupTask) map[uint]bool {
+	isExpired := make(map[uint]bool, len(expired))
+	for _, task := range expired {
+		isExpired[task.ID] = true
+	}
+	needed := make(map[uint]bool)
+	for _, task := range tasks {
+		if isExpired[task.ID] {
+			continue
+		}
+		for _, id := range backupChain(tasks, task.ID) {
+			needed[id] = true
+		}
+	}
+	return needed
+}
+
+func keepNewestPerPeriod(tasks []models.BackupTask, keep map[uint]bool, since time.Time, period func(time.Time) string) {
+	seen := make(map[string]bool)
+	for _, task := range tasks {
+		start := task.StartTime.In(since.Location())
+		if start.Before(since) {
+			continue
+		}
+		if key := period(start); !seen[key] {
+			seen[key] = true
+			keep[task.ID] = true
+		}
+	}
+}
+
+// executeBackup 执行备份，增量备份基于最近的备份
+// ctx 被取消时在当前阶段结束后停止，并删除未完成的备份文件
+func (s *BackupService) executeBackup(ctx context.Context, taskID uint, opts BackupOptions) error {
 	// 更新任务状态为运行中
 	var task models.BackupTask
 	if err := s.db.First(&task, taskID).Error; err != nil {
@@ -80,68 +259,281 @@ func (s *BackupService) executeBackup(taskID uint) error {
 
 	backupDir := "data/backup"
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		log.Errorf("Create backup directory failed: %v", err)
+		log.Ctx(ctx).Errorf("Create backup directory failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
+	key, err := s.encryptionKey(ctx, opts.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	// 增量备份只保存基础备份之后新增或变化的文件
+	var baseManifest *BackupManifest
+	if opts.Incremental {
+		baseTask, manifest, err := s.incrementalBase(ctx, opts.MaxChain, key)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Find incremental base failed: %v", err)
+			return cerrors.ErrInternalServer
+		}
+		if baseTask != nil {
+			task.BaseBackupID = &baseTask.ID
+			baseManifest = manifest
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 文件名带上任务 ID，避免同一秒内的备份互相覆盖
 	timestamp := time.Now().Format("20060102_150405")
-	backupFilename := fmt.Sprintf("backup_%s.zip", timestamp)
+	backupFilename := fmt.Sprintf("backup_%s_%d.zip", timestamp, task.ID)
+	if key != "" {
+		backupFilename += ".enc"
+	}
 	backupPath := filepath.Join(backupDir, backupFilename)
 
 	backupFile, err := os.Create(backupPath)
 	if err != nil {
-		log.Errorf("Create backup file failed: %v", err)
+		log.Ctx(ctx).Errorf("Create backup file failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
+	// 备份失败、被取消或未能保存记录时删除不完整的备份文件，避免重试时在备份目录中留下无主的文件
+	saved := false
+	defer func() {
+		if !saved {
+			os.Remove(backupPath)
+		}
+	}()
 	defer backupFile.Close()
 
-	zipWriter := zip.NewWriter(backupFile)
+	var archiveFile io.Writer = backupFile
+	var encryptWriter io.WriteCloser
+	if key != "" {
+		encryptWriter, err = encrypt.NewWriter(backupFile, key)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Create encrypted writer failed: %v", err)
+			return cerrors.ErrInternalServer
+		}
+		archiveFile = encryptWriter
+		task.Encrypted = true
+	}
+
+	zipWriter := zip.NewWriter(archiveFile)
 	defer zipWriter.Close()
 
-	if err := s.backupDatabase(zipWriter); err != nil {
-		log.Errorf("Backup database failed: %v", err)
+	// 恢复时按备份的迁移版本升级表结构
+	databaseVersion, err := migrations.Version(s.db)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Get migration version failed: %v", err)
+		return cerrors.ErrBackupDatabase
+	}
+	databaseFile, tableCounts, err := s.backupDatabase(ctx, zipWriter, opts.Portable)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Backup database failed: %v", err)
 		return cerrors.ErrBackupDatabase
 	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	archive := newArchiveWriter(zipWriter, task.ID, baseManifest)
+	archive.manifest.DBType = s.getDatabaseDriver()
+	if databaseFile.Path == portableDumpFile {
+		archive.manifest.DBType = portableDBType
+	}
+	archive.manifest.Database = &databaseFile
+	archive.manifest.DatabaseVersion = databaseVersion
+	archive.manifest.Tables = tableCounts
+
+	if err := s.backupFiles(ctx, archive); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Ctx(ctx).Errorf("Backup files failed: %v", err)
+		return cerrors.ErrBackupFiles
+	}
+
+	// 非本地存储中的图片通过各自的存储读取，并记录图片与存储的对应关系
+	storageMap, err := s.backupStorageFiles(ctx, archive)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.Ctx(ctx).Errorf("Backup storage files failed: %v", err)
+		return cerrors.ErrBackupFiles
+	}
+	if len(storageMap.Missing) > 0 {
+		task.Error = fmt.Sprintf("%d files could not be read from storage and are missing from this backup", len(storageMap.Missing))
+	}
 
-	if err := s.backupFiles(zipWriter); err != nil {
-		log.Errorf("Backup files failed: %v", err)
+	if err := archive.close(); err != nil {
+		log.Ctx(ctx).Errorf("Write backup manifest failed: %v", err)
 		return cerrors.ErrBackupFiles
 	}
+	task.DataSize = archive.dataSize
 
 	if err := zipWriter.Close(); err != nil {
-		log.Errorf("Close zip writer failed: %v", err)
+		log.Ctx(ctx).Errorf("Close zip writer failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
+	if encryptWriter != nil {
+		if err := encryptWriter.Close(); err != nil {
+			log.Ctx(ctx).Errorf("Close encrypted writer failed: %v", err)
+			return cerrors.ErrInternalServer
+		}
+	}
+
 	if err := backupFile.Close(); err != nil {
-		log.Errorf("Close backup file failed: %v", err)
+		log.Ctx(ctx).Errorf("Close backup file failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
 	fileInfo, err := os.Stat(backupPath)
 	if err != nil {
-		log.Errorf("Get backup file info failed: %v", err)
+		log.Ctx(ctx).Errorf("Get backup file info failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
+	task.Size = fileInfo.Size()
+	task.StoragePath = backupPath
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// 配置了备份目标存储时上传到远程，并删除本地文件
+	settings, err := config.LoadSystemSettingsFromDatabase(s.db)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Load system settings failed: %v", err)
+		return cerrors.ErrInternalServer
+	}
+	if destination := settings.Backup.Destination; destination != "" {
+		objectName, err := s.uploadBackup(destination, backupPath)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Upload backup to %s failed: %v", destination, err)
+			return cerrors.ErrBackupUpload
+		}
+		if err := os.Remove(backupPath); err != nil {
+			log.Ctx(ctx).Errorf("Remove local backup file failed: %v", err)
+		}
+		task.Location = destination
+		task.StoragePath = objectName
+	}
+
 	endTime := time.Now()
 	task.Status = "completed"
 	task.EndTime = &endTime
-	task.Size = fileInfo.Size()
-	task.StoragePath = backupPath
 
 	if err := s.db.Save(&task).Error; err != nil {
 		return cerrors.ErrInternalServer
 	}
+	saved = true
 
 	return nil
 }
 
+// offsiteBackupDir 远程存储中存放备份的目录，位于存储根目录下，与图片目录分开
+const offsiteBackupDir = "lopic-backups"
+
+// objectStorage 获取名称对应的远程存储，存储不存在或不支持存放备份时返回 ErrInvalidBackupDestination
+func (s *BackupService) objectStorage(name string) (storage.ObjectStorage, error) {
+	var storageModel models.Storage
+	if err := s.db.Where("name = ?", name).First(&storageModel).Error; err != nil {
+		return nil, cerrors.ErrInvalidBackupDestination
+	}
+	objectStorage, ok := s.storageService.GetStorageByStorage(&storageModel).(storage.ObjectStorage)
+	if !ok {
+		return nil, cerrors.ErrInvalidBackupDestination
+	}
+	return objectStorage, nil
+}
+
+// uploadBackup 将本地备份文件上传到远程存储，返回远程路径
+func (s *BackupService) uploadBackup(destination, backupPath string) (string, error) {
+	objectStorage, err := s.objectStorage(destination)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	objectName := offsiteBackupDir + "/" + filepath.Base(backupPath)
+	if err := objectStorage.PutObject(objectName, file); err != nil {
+		return "", err
+	}
+	return objectName, nil
+}
+
+// OpenBackupArchive 打开远程存储中的备份文件，调用方负责关闭
+func (s *BackupService) OpenBackupArchive(task models.BackupTask) (io.ReadCloser, error) {
+	if task.Location == "" || task.StoragePath == "" {
+		return nil, cerrors.ErrBackupNotFound
+	}
+	objectStorage, err := s.objectStorage(task.Location)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := objectStorage.GetObject(task.StoragePath)
+	if err != nil {
+		return nil, cerrors.ErrBackupNotFound
+	}
+	return reader, nil
+}
+
+// fetchBackup 返回备份文件的本地路径，远程备份会先下载到临时目录，使用完毕后需调用 cleanup
+func (s *BackupService) fetchBackup(ctx context.Context, task models.BackupTask) (string, func(), error) {
+	if task.Location == "" {
+		if _, err := os.Stat(task.StoragePath); err != nil {
+			return "", nil, cerrors.ErrBackupNotFound
+		}
+		return task.StoragePath, func() {}, nil
+	}
+
+	reader, err := s.OpenBackupArchive(task)
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+
+	tempDir := "data/temp"
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Ctx(ctx).Errorf("Create temp directory failed: %v", err)
+		return "", nil, cerrors.ErrInternalServer
+	}
+	tempFile, err := os.CreateTemp(tempDir, fmt.Sprintf("restore_%d_*.zip", task.ID))
+	if err != nil {
+		log.Ctx(ctx).Errorf("Create temp file failed: %v", err)
+		return "", nil, cerrors.ErrInternalServer
+	}
+	cleanup := func() { os.Remove(tempFile.Name()) }
+
+	if _, err := io.Copy(tempFile, reader); err != nil {
+		tempFile.Close()
+		cleanup()
+		log.Ctx(ctx).Errorf("Download backup from %s failed: %v", task.Location, err)
+		return "", nil, cerrors.ErrBackupNotFound
+	}
+	if err := tempFile.Close(); err != nil {
+		cleanup()
+		log.Ctx(ctx).Errorf("Close temp file failed: %v", err)
+		return "", nil, cerrors.ErrInternalServer
+	}
+	return tempFile.Name(), cleanup, nil
+}
+
 func (s *BackupService) GetBackupList() ([]models.BackupTask, error) {
 	var tasks []models.BackupTask
 	if err := s.db.Order("created_at DESC").Find(&tasks).Error; err != nil {
 		return nil, cerrors.ErrInternalServer
 	}
+	for i := range tasks {
+		tasks[i].Chain = backupChain(tasks, tasks[i].ID)
+	}
 	return tasks, nil
 }
 
@@ -162,8 +554,8 @@ func (s *BackupService) GetBackupTaskByID(id uint) (models.BackupTask, error) {
 	return task, nil
 }
 
-// CreateUploadBackupTask 创建上传备份任务
-func (s *BackupService) CreateUploadBackupTask(startTime time.Time, file *multipart.FileHeader) (*models.BackupTask, error) {
+// CreateUploadBackupTask 创建上传备份任务，上传加密的备份时可指定 passphrase 以校验能否解密
+func (s *BackupService) CreateUploadBackupTask(ctx context.Context, startTime time.Time, file *multipart.FileHeader, passphrase string) (*models.BackupTask, error) {
 	task := &models.BackupTask{
 		Status:    "pending",
 		StartTime: startTime,
@@ -177,7 +569,7 @@ func (s *BackupService) CreateUploadBackupTask(startTime time.Time, file *multip
 	tempDir := "data/temp"
 	if err := os.MkdirAll(tempDir, 0755); err != nil {
 		s.db.Delete(task)
-		log.Errorf("Create temp directory failed: %v", err)
+		log.Ctx(ctx).Errorf("Create temp directory failed: %v", err)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -185,7 +577,7 @@ func (s *BackupService) CreateUploadBackupTask(startTime time.Time, file *multip
 	src, err := file.Open()
 	if err != nil {
 		s.db.Delete(task)
-		log.Errorf("Open uploaded file failed: %v", err)
+		log.Ctx(ctx).Errorf("Open uploaded file failed: %v", err)
 		return nil, cerrors.ErrInternalServer
 	}
 	defer src.Close()
@@ -194,7 +586,7 @@ func (s *BackupService) CreateUploadBackupTask(startTime time.Time, file *multip
 	if err != nil {
 		s.db.Delete(task)
 		src.Close()
-		log.Errorf("Create temp file failed: %v", err)
+		log.Ctx(ctx).Errorf("Create temp file failed: %v", err)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -202,25 +594,25 @@ func (s *BackupService) CreateUploadBackupTask(startTime time.Time, file *multip
 		s.db.Delete(task)
 		dst.Close()
 		os.Remove(tempFilePath)
-		log.Errorf("Copy uploaded file to temp failed: %v", err)
+		log.Ctx(ctx).Errorf("Copy uploaded file to temp failed: %v", err)
 		return nil, cerrors.ErrInternalServer
 	}
 	dst.Close()
 
-	// 启动异步上传任务
-	go func(taskID uint, tempFilePath string) {
-		defer os.Remove(tempFilePath) // 处理完成后删除临时文件
-		if err := s.executeUploadBackup(taskID, tempFilePath); err != nil {
-			s.updateTaskStatus(taskID, "failed", err.Error())
-			log.Errorf("UploadBackupTask %d failed: %v", taskID, err)
-		}
-	}(task.ID, tempFilePath)
+	s.setPassphrase(backupUploadJobType, task.ID, passphrase)
+	payload := backupUploadJob{TaskID: task.ID, TempFile: tempFilePath, HasPassphrase: passphrase != ""}
+	if err := s.enqueue(backupUploadJobType, payload); err != nil {
+		s.dropPassphrase(backupUploadJobType, task.ID)
+		os.Remove(tempFilePath)
+		s.updateTaskStatus(task.ID, "failed", err.Error())
+		return nil, err
+	}
 
 	return task, nil
 }
 
 // executeUploadBackup 执行上传备份任务
-func (s *BackupService) executeUploadBackup(taskID uint, tempFilePath string) error {
+func (s *BackupService) executeUploadBackup(ctx context.Context, taskID uint, tempFilePath string, passphrase string) error {
 	// 更新任务状态为运行中
 	var task models.BackupTask
 	if err := s.db.First(&task, taskID).Error; err != nil {
@@ -234,13 +626,28 @@ func (s *BackupService) executeUploadBackup(taskID uint, tempFilePath string) er
 
 	backupDir := "data/backup"
 	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		log.Errorf("Create backup directory failed: %v", err)
+		log.Ctx(ctx).Errorf("Create backup directory failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
+	encrypted, err := isEncryptedFile(tempFilePath)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Read uploaded backup failed: %v", err)
+		return cerrors.ErrInternalServer
+	}
+	if encrypted && passphrase != "" {
+		if err := verifyEncryptedFile(tempFilePath, passphrase); err != nil {
+			log.Ctx(ctx).Errorf("Decrypt uploaded backup failed: %v", err)
+			return cerrors.ErrBackupDecrypt
+		}
+	}
+
 	// 生成备份文件路径
 	timestamp := time.Now().Format("20060102_150405")
 	backupFilename := fmt.Sprintf("backup_%s.zip", timestamp)
+	if encrypted {
+		backupFilename += ".enc"
+	}
 	backupPath := filepath.Join(backupDir, backupFilename)
 
 	// 移动临时文件到备份目录
@@ -248,20 +655,20 @@ func (s *BackupService) executeUploadBackup(taskID uint, tempFilePath string) er
 		// 如果跨设备移动失败，使用复制+删除
 		src, err := os.Open(tempFilePath)
 		if err != nil {
-			log.Errorf("Open temp file failed: %v", err)
+			log.Ctx(ctx).Errorf("Open temp file failed: %v", err)
 			return cerrors.ErrInternalServer
 		}
 		defer src.Close()
 
 		dst, err := os.Create(backupPath)
 		if err != nil {
-			log.Errorf("Create backup file failed: %v", err)
+			log.Ctx(ctx).Errorf("Create backup file failed: %v", err)
 			return cerrors.ErrInternalServer
 		}
 		defer dst.Close()
 
 		if _, err = io.Copy(dst, src); err != nil {
-			log.Errorf("Copy backup file failed: %v", err)
+			log.Ctx(ctx).Errorf("Copy backup file failed: %v", err)
 			return cerrors.ErrInternalServer
 		}
 	}
@@ -269,7 +676,7 @@ func (s *BackupService) executeUploadBackup(taskID uint, tempFilePath string) er
 	// 获取文件大小
 	fileInfo, err := os.Stat(backupPath)
 	if err != nil {
-		log.Errorf("Get backup file info failed: %v", err)
+		log.Ctx(ctx).Errorf("Get backup file info failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
@@ -279,6 +686,7 @@ func (s *BackupService) executeUploadBackup(taskID uint, tempFilePath string) er
 	task.EndTime = &endTime
 	task.Size = fileInfo.Size()
 	task.StoragePath = backupPath
+	task.Encrypted = encrypted
 
 	if err := s.db.Save(&task).Error; err != nil {
 		return cerrors.ErrInternalServer
@@ -300,22 +708,41 @@ func (s *BackupService) DeleteRestoreTask(restoreID uint) error {
 	return nil
 }
 
-func (s *BackupService) DeleteBackup(backupID uint) error {
+func (s *BackupService) DeleteBackup(ctx context.Context, backupID uint) error {
 	var task models.BackupTask
 	if err := s.db.First(&task, backupID).Error; err != nil {
 		return cerrors.ErrInternalServer
 	}
 
+	// 增量备份依赖基础备份中的文件，需先删除依赖它的增量备份
+	var dependents int64
+	if err := s.db.Model(&models.BackupTask{}).Where("base_backup_id = ?", backupID).Count(&dependents).Error; err != nil {
+		return cerrors.ErrInternalServer
+	}
+	if dependents > 0 {
+		return cerrors.ErrBackupHasDependents
+	}
+
 	// 先删除引用该备份的所有恢复任务
 	if err := s.db.Where("backup_task_id = ?", backupID).Delete(&models.RestoreTask{}).Error; err != nil {
-		log.Errorf("Delete restore tasks failed: %v", err)
+		log.Ctx(ctx).Errorf("Delete restore tasks failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
 	// 删除备份文件
-	if task.StoragePath != "" {
+	if task.StoragePath != "" && task.Location != "" {
+		objectStorage, err := s.objectStorage(task.Location)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Get backup storage %s failed: %v", task.Location, err)
+			return err
+		}
+		if err := objectStorage.RemoveObject(task.StoragePath); err != nil {
+			log.Ctx(ctx).Errorf("Delete remote backup file failed: %v", err)
+			return cerrors.ErrInternalServer
+		}
+	} else if task.StoragePath != "" {
 		if err := os.Remove(task.StoragePath); err != nil && !os.IsNotExist(err) {
-			log.Errorf("Delete backup file failed: %v", err)
+			log.Ctx(ctx).Errorf("Delete backup file failed: %v", err)
 			return cerrors.ErrInternalServer
 		}
 	}
@@ -328,7 +755,23 @@ func (s *BackupService) DeleteBackup(backupID uint) error {
 	return nil
 }
 
-func (s *BackupService) RestoreBackup(backupID uint) (*models.RestoreTask, error) {
+// RestoreBackup 创建恢复任务，storageMap 可将某个存储中的图片恢复到其他存储（原存储名称 -> 目标存储名称），为空时恢复到原存储
+// 加密的备份需要 passphrase，未指定时使用配置的密钥
+func (s *BackupService) RestoreBackup(ctx context.Context, backupID uint, storageMap map[string]string, passphrase string) (*models.RestoreTask, error) {
+	backupTask, err := s.GetBackupTaskByID(backupID)
+	if err != nil {
+		return nil, err
+	}
+	if backupTask.Encrypted {
+		key, err := s.encryptionKey(ctx, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, cerrors.ErrBackupPassphraseRequired
+		}
+	}
+
 	restoreTask := &models.RestoreTask{
 		BackupTaskID: backupID,
 		Status:       "pending",
@@ -339,18 +782,20 @@ func (s *BackupService) RestoreBackup(backupID uint) (*models.RestoreTask, error
 		return nil, cerrors.ErrInternalServer
 	}
 
-	// 启动异步恢复任务
-	go func(taskID uint) {
-		if err := s.executeRestore(taskID); err != nil {
-			log.Errorf("RestoreTask %d failed: %v", taskID, err)
-			s.updateRestoreTaskStatus(taskID, "failed", err.Error())
-		}
-	}(restoreTask.ID)
+	s.setPassphrase(restoreJobType, restoreTask.ID, passphrase)
+	payload := restoreJob{TaskID: restoreTask.ID, StorageMap: storageMap, HasPassphrase: passphrase != ""}
+	if err := s.enqueue(restoreJobType, payload); err != nil {
+		s.dropPassphrase(restoreJobType, restoreTask.ID)
+		s.updateRestoreTaskStatus(restoreTask.ID, "failed", err.Error())
+		return nil, err
+	}
 
 	return restoreTask, nil
 }
 
-func (s *BackupService) executeRestore(taskID uint) error {
+// executeRestore 执行恢复，ctx 被取消时在开始修改数据之前停止
+// 数据库开始恢复后不再响应取消，避免数据库和文件处于不一致的状态
+func (s *BackupService) executeRestore(ctx context.Context, taskID uint, storageMap map[string]string, passphrase string) error {
 	// 更新任务状态为运行中
 	var restoreTask models.RestoreTask
 	if err := s.db.First(&restoreTask, taskID).Error; err != nil {
@@ -369,56 +814,149 @@ func (s *BackupService) executeRestore(taskID uint) error {
 	}
 
 	if backupTask.Status != "completed" {
-		log.Errorf("Backup task status is not completed: %s", backupTask.Status)
+		log.Ctx(ctx).Errorf("Backup task status is not completed: %s", backupTask.Status)
 		return cerrors.ErrBackupTaskNotCompleted
 	}
 
-	if _, err := os.Stat(backupTask.StoragePath); os.IsNotExist(err) {
-		log.Errorf("Backup file does not exist: %s", backupTask.StoragePath)
+	backupPath, cleanup, err := s.openArchive(ctx, backupTask, passphrase)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Backup file is not available: location=%s, path=%s, error=%v", backupTask.Location, backupTask.StoragePath, err)
+		if err == cerrors.ErrBackupDecrypt || err == cerrors.ErrBackupPassphraseRequired {
+			return err
+		}
 		return cerrors.ErrBackupFiles
 	}
+	defer cleanup()
 
-	extractDir, err := s.extractBackup(backupTask.StoragePath)
+	// 先按清单校验归档，校验不通过时不修改任何数据
+	zipFile, err := zip.OpenReader(backupPath)
 	if err != nil {
-		log.Errorf("Extract backup file failed: %v", err)
+		log.Ctx(ctx).Errorf("Open backup file failed: %v", err)
+		return cerrors.ErrBackupCorrupted
+	}
+	verification, manifest := s.verifyArchive(backupTask, &zipFile.Reader)
+	zipFile.Close()
+	if !verification.Valid {
+		log.Ctx(ctx).Errorf("Backup %d verification failed: %s", backupTask.ID, strings.Join(verification.Problems, "; "))
+		return cerrors.ErrBackupCorrupted
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	extractDir, err := s.extractBackup(ctx, backupPath)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Extract backup file failed: %v", err)
 		return cerrors.ErrExtractBackup
 	}
 	defer os.RemoveAll(extractDir)
 
+	// 增量备份从备份链中补齐文件
+	if err := s.materializeManifest(ctx, extractDir, backupTask.ID, passphrase); err != nil {
+		log.Ctx(ctx).Errorf("Rebuild files from backup chain failed: %v", err)
+		if err == cerrors.ErrBackupChainBroken || err == cerrors.ErrBackupDecrypt || err == cerrors.ErrBackupPassphraseRequired {
+			return err
+		}
+		return cerrors.ErrExtractBackup
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	mysqlFile := filepath.Join(extractDir, "database_mysql.sql")
 	sqliteFile := filepath.Join(extractDir, "database_sqlite.sql")
 
+	portableFile := filepath.Join(extractDir, portableDumpFile)
+
 	var dbType string
 	if _, err := os.Stat(mysqlFile); err == nil {
 		dbType = "mysql"
 	} else if _, err := os.Stat(sqliteFile); err == nil {
 		dbType = "sqlite"
+	} else if _, err := os.Stat(portableFile); err == nil {
+		dbType = portableDBType
 	} else {
-		log.Errorf("No valid database backup file found in archive")
+		log.Ctx(ctx).Errorf("No valid database backup file found in archive")
 		return cerrors.ErrNoValidDBBackup
 	}
 
+	// 可移植格式的备份可以恢复到任意支持的数据库
 	currentDriver := s.getDatabaseDriver()
-	if currentDriver != dbType {
-		log.Errorf("Database type mismatch: backup is %s but current is %s", dbType, currentDriver)
+	if dbType != portableDBType && currentDriver != dbType {
+		log.Ctx(ctx).Errorf("Database type mismatch: backup is %s but current is %s", dbType, currentDriver)
 		return cerrors.ErrDBTypeMismatch
 	}
 
+	// 上传文件先复制到临时目录，数据库恢复完成后再整体替换
+	stagingDir, err := s.stageFiles(ctx, extractDir)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Stage files failed: %v", err)
+		return cerrors.ErrRestoreFiles
+	}
+	if stagingDir != "" {
+		defer os.RemoveAll(stagingDir)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	switch dbType {
 	case "mysql":
-		if err := s.restoreMySQL(extractDir); err != nil {
-			log.Errorf("MySQL restore failed: %v", err)
+		if err := s.restoreMySQL(ctx, extractDir); err != nil {
+			log.Ctx(ctx).Errorf("MySQL restore failed: %v", err)
 			return cerrors.ErrMySQLRestore
 		}
 	case "sqlite":
-		if err := s.restoreSQLite(extractDir); err != nil {
-			log.Errorf("SQLite restore failed: %v", err)
+		if err := s.restoreSQLite(ctx, extractDir); err != nil {
+			log.Ctx(ctx).Errorf("SQLite restore failed: %v", err)
 			return cerrors.ErrSQLiteRestore
 		}
+	case portableDBType:
+		if err := s.restorePortable(ctx, portableFile); err != nil {
+			log.Ctx(ctx).Errorf("Portable restore failed: %v", err)
+			return cerrors.ErrPortableRestore
+		}
 	}
 
-	if err := s.restoreFiles(extractDir); err != nil {
-		log.Errorf("Restore files failed: %v", err)
+	// 备份导出时数据库的迁移版本，没有清单或清单中没有版本的旧备份为 0
+	var databaseVersion uint
+	if manifest != nil {
+		databaseVersion = manifest.DatabaseVersion
+	}
+	if dbType == portableDBType {
+		// 可移植格式导入到当前的表结构，重新执行备份之后新增的数据迁移
+		if err := migrations.MigrateData(s.db, databaseVersion); err != nil {
+			log.Ctx(ctx).Errorf("Migrate restored data failed: %v", err)
+			return cerrors.ErrInternalServer
+		}
+	} else if err := migrations.SetVersion(s.db, databaseVersion); err != nil {
+		// 恢复的表结构为备份时的版本，按该版本重新迁移
+		log.Ctx(ctx).Errorf("Reset migration version failed: %v", err)
+		return cerrors.ErrInternalServer
+	}
+	if err := migrations.Migrate(s.db); err != nil {
+		log.Ctx(ctx).Errorf("Migrate restored database failed: %v", err)
+		return cerrors.ErrInternalServer
+	}
+
+	// 检索文档不在备份中，按恢复后的数据重建
+	if err := services.SetupSearchIndex(s.db); err != nil {
+		log.Ctx(ctx).Errorf("Setup search index failed, falling back to LIKE search: %v", err)
+	}
+	if _, err := services.RebuildSearchIndex(s.db); err != nil {
+		log.Ctx(ctx).Errorf("Rebuild search index failed: %v", err)
+		return cerrors.ErrInternalServer
+	}
+
+	if stagingDir != "" {
+		if err := s.swapUploadDir(ctx, stagingDir); err != nil {
+			log.Ctx(ctx).Errorf("Restore files failed: %v", err)
+			return cerrors.ErrRestoreFiles
+		}
+	}
+
+	if err := s.restoreStorageFiles(ctx, extractDir, storageMap); err != nil {
+		log.Ctx(ctx).Errorf("Restore storage files failed: %v", err)
 		return cerrors.ErrRestoreFiles
 	}
 
@@ -444,23 +982,23 @@ func decodeFilename(name string, nonUTF8 bool) string {
 	return name
 }
 
-func (s *BackupService) extractBackup(backupPath string) (string, error) {
+func (s *BackupService) extractBackup(ctx context.Context, backupPath string) (string, error) {
 	extractDir, err := os.MkdirTemp("", "restore_*")
 	if err != nil {
-		log.Errorf("Create temp dir failed: %v", err)
+		log.Ctx(ctx).Errorf("Create temp dir failed: %v", err)
 		return "", cerrors.ErrInternalServer
 	}
 
 	// 获取解压目录的绝对路径，用于后续的安全检查
 	extractDirAbs, err := filepath.Abs(extractDir)
 	if err != nil {
-		log.Errorf("Get absolute path failed: %v", err)
+		log.Ctx(ctx).Errorf("Get absolute path failed: %v", err)
 		return "", cerrors.ErrInternalServer
 	}
 
 	zipFile, err := zip.OpenReader(backupPath)
 	if err != nil {
-		log.Errorf("Open backup file failed: %v", err)
+		log.Ctx(ctx).Errorf("Open backup file failed: %v", err)
 		return "", cerrors.ErrInternalServer
 	}
 	defer zipFile.Close()
@@ -478,7 +1016,7 @@ func (s *BackupService) extractBackup(backupPath string) (string, error) {
 
 		// 拒绝绝对路径和包含 .. 的路径
 		if filepath.IsAbs(cleanName) || strings.Contains(cleanName, "..") {
-			log.Errorf("Zip Slip attack detected: invalid file name %s", fileName)
+			log.Ctx(ctx).Errorf("Zip Slip attack detected: invalid file name %s", fileName)
 			return "", cerrors.ErrForbidden
 		}
 
@@ -488,45 +1026,45 @@ func (s *BackupService) extractBackup(backupPath string) (string, error) {
 		// 安全检查：确保目标路径在解压目录内
 		pathAbs, err := filepath.Abs(path)
 		if err != nil {
-			log.Errorf("Get absolute path failed: %v", err)
+			log.Ctx(ctx).Errorf("Get absolute path failed: %v", err)
 			return "", cerrors.ErrInternalServer
 		}
 
 		// 验证路径前缀，防止路径遍历
 		if !strings.HasPrefix(pathAbs, extractDirAbs+string(filepath.Separator)) {
-			log.Errorf("Zip Slip attack detected: %s is outside of %s", pathAbs, extractDirAbs)
+			log.Ctx(ctx).Errorf("Zip Slip attack detected: %s is outside of %s", pathAbs, extractDirAbs)
 			return "", cerrors.ErrForbidden
 		}
 
 		if file.FileInfo().IsDir() {
 			if err := os.MkdirAll(pathAbs, 0755); err != nil {
-				log.Errorf("Create dir failed: %v", err)
+				log.Ctx(ctx).Errorf("Create dir failed: %v", err)
 				return "", cerrors.ErrInternalServer
 			}
 			continue
 		}
 
 		if err := os.MkdirAll(filepath.Dir(pathAbs), 0755); err != nil {
-			log.Errorf("Create dir failed: %v", err)
+			log.Ctx(ctx).Errorf("Create dir failed: %v", err)
 			return "", cerrors.ErrInternalServer
 		}
 
 		dstFile, err := os.OpenFile(pathAbs, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 		if err != nil {
-			log.Errorf("Open file failed: %v", err)
+			log.Ctx(ctx).Errorf("Open file failed: %v", err)
 			return "", cerrors.ErrInternalServer
 		}
 		defer dstFile.Close()
 
 		srcFile, err := file.Open()
 		if err != nil {
-			log.Errorf("Open file failed: %v", err)
+			log.Ctx(ctx).Errorf("Open file failed: %v", err)
 			return "", cerrors.ErrInternalServer
 		}
 		defer srcFile.Close()
 
 		if _, err := io.Copy(dstFile, srcFile); err != nil {
-			log.Errorf("Copy file failed: %v", err)
+			log.Ctx(ctx).Errorf("Copy file failed: %v", err)
 			return "", cerrors.ErrInternalServer
 		}
 	}
@@ -534,72 +1072,52 @@ func (s *BackupService) extractBackup(backupPath string) (string, error) {
 	return extractDir, nil
 }
 
-func (s *BackupService) restoreMySQL(extractDir string) error {
+// restoreMySQL 通过当前数据库连接执行导出文件，兼容旧版本 mysqldump 生成的备份
+// MySQL 的 DDL 会隐式提交，恢复无法整体回滚，语句在同一连接上执行以保持会话设置
+func (s *BackupService) restoreMySQL(ctx context.Context, extractDir string) error {
 	sqlFile := filepath.Join(extractDir, "database_mysql.sql")
-	if _, err := os.Stat(sqlFile); os.IsNotExist(err) {
-		log.Errorf("SQL file does not exist: %s", sqlFile)
-		return fmt.Errorf("SQL file does not exist: %s", sqlFile)
-	}
-
-	if s.dbConfig == nil {
-		log.Errorf("Database config is nil")
-		return fmt.Errorf("database config is nil")
-	}
-
-	cmd := exec.Command(
-		"mysql",
-		fmt.Sprintf("--user=%s", s.dbConfig.User),
-		fmt.Sprintf("--password=%s", s.dbConfig.Password),
-		fmt.Sprintf("--host=%s", s.dbConfig.Host),
-		fmt.Sprintf("--port=%d", s.dbConfig.Port),
-	)
-
-	sqlContent, err := os.ReadFile(sqlFile)
+	file, err := os.Open(sqlFile)
 	if err != nil {
-		log.Errorf("Read SQL file failed: %v", err)
-		return cerrors.ErrInternalServer
+		log.Ctx(ctx).Errorf("Open SQL file failed: %v", err)
+		return fmt.Errorf("open SQL file failed: %v", err)
 	}
+	defer file.Close()
 
-	cmd.Stdin = bytes.NewReader(sqlContent)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		if stderr.Len() > 0 {
-			log.Errorf("MySQL restore failed: %s", stderr.String())
-			return fmt.Errorf("mysql restore failed: %s", stderr.String())
+	return s.db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec(mysqlDialect.foreignKeysOff).Error; err != nil {
+			log.Ctx(ctx).Errorf("Disable foreign key checks failed: %v", err)
+			return fmt.Errorf("disable foreign key checks failed: %v", err)
 		}
-		log.Errorf("MySQL restore failed: %v", err)
-		return fmt.Errorf("mysql restore failed: %v", err)
-	}
+		defer conn.Exec(mysqlDialect.foreignKeysOn)
 
-	return nil
+		// mysqldump 生成的备份包含切换数据库的语句，恢复到当前连接的数据库
+		skip := func(statement string) bool {
+			upper := strings.ToUpper(statement)
+			return strings.HasPrefix(upper, "USE ") || strings.HasPrefix(upper, "CREATE DATABASE")
+		}
+		if err := restoreDump(conn, file, mysqlDialect, skip); err != nil {
+			log.Ctx(ctx).Errorf("MySQL restore failed: %v", err)
+			return err
+		}
+		return nil
+	})
 }
 
-func (s *BackupService) restoreSQLite(extractDir string) error {
+func (s *BackupService) restoreSQLite(ctx context.Context, extractDir string) error {
 	sqlFile := filepath.Join(extractDir, "database_sqlite.sql")
 	if _, err := os.Stat(sqlFile); os.IsNotExist(err) {
-		log.Errorf("SQL file does not exist: %s", sqlFile)
+		log.Ctx(ctx).Errorf("SQL file does not exist: %s", sqlFile)
 		return fmt.Errorf("SQL file does not exist: %s", sqlFile)
 	}
 
-	sqlContent, err := os.ReadFile(sqlFile)
+	file, err := os.Open(sqlFile)
 	if err != nil {
-		log.Errorf("Read SQL file failed: %v", err)
+		log.Ctx(ctx).Errorf("Open SQL file failed: %v", err)
 		return cerrors.ErrInternalServer
 	}
+	defer file.Close()
 
-	tables := []string{
-		"users",
-		"roles",
-		"albums",
-		"images",
-		"system_settings",
-		"refresh_token_blacklist",
-		"image_albums",
-		"storages",
-		"password_reset_codes",
-	}
+	tables := backupDatabaseTables
 
 	tx := s.db.Begin()
 	defer func() {
@@ -610,68 +1128,73 @@ func (s *BackupService) restoreSQLite(extractDir string) error {
 
 	if err := tx.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
 		tx.Rollback()
-		log.Errorf("Disable foreign keys failed: %v", err)
+		log.Ctx(ctx).Errorf("Disable foreign keys failed: %v", err)
 		return fmt.Errorf("disable foreign keys failed: %v", err)
 	}
 
 	for _, table := range tables {
 		if err := tx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s", table)).Error; err != nil {
 			tx.Rollback()
-			log.Errorf("Drop table %s failed: %v", table, err)
+			log.Ctx(ctx).Errorf("Drop table %s failed: %v", table, err)
 			return fmt.Errorf("drop table %s failed: %v", table, err)
 		}
 	}
 
-	statements := strings.Split(string(sqlContent), ";")
-	for _, statement := range statements {
-		statement = strings.TrimSpace(statement)
-		if statement == "" || strings.HasPrefix(statement, "--") {
-			continue
-		}
-		if err := tx.Exec(statement).Error; err != nil {
-			tx.Rollback()
-			log.Errorf("Execute SQL failed: %v", err)
-			return fmt.Errorf("execute SQL failed: %v", err)
-		}
+	if err := restoreDump(tx, file, sqliteDialect, nil); err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("Execute SQL failed: %v", err)
+		return err
 	}
 
 	if err := tx.Exec("PRAGMA foreign_keys = ON").Error; err != nil {
 		tx.Rollback()
-		log.Errorf("Enable foreign keys failed: %v", err)
+		log.Ctx(ctx).Errorf("Enable foreign keys failed: %v", err)
 		return fmt.Errorf("enable foreign keys failed: %v", err)
 	}
 
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("Commit transaction failed: %v", err)
+		log.Ctx(ctx).Errorf("Commit transaction failed: %v", err)
 		return fmt.Errorf("commit transaction failed: %v", err)
 	}
 
 	return nil
 }
 
-func (s *BackupService) restoreFiles(extractDir string) error {
-	uploadsDir := filepath.Join(extractDir, "uploads")
-	if _, err := os.Stat(uploadsDir); os.IsNotExist(err) {
-		log.Errorf("Uploads dir does not exist: %s", uploadsDir)
-		return nil
+// restorePortable 导入可移植格式的导出文件，当前数据库的表结构保持不变
+func (s *BackupService) restorePortable(ctx context.Context, portableFile string) error {
+	file, err := os.Open(portableFile)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	targetUploadsDir := strings.Trim(s.serverConfig.UploadDir, "/")
-	if _, err := os.Stat(targetUploadsDir); err == nil {
-		if err := os.RemoveAll(targetUploadsDir); err != nil {
-			log.Errorf("Remove existing uploads dir failed: %v", err)
-			return fmt.Errorf("remove existing uploads dir failed: %v", err)
-		}
+	counts, err := ImportPortable(s.db, file)
+	if err != nil {
+		return err
 	}
+	log.Ctx(ctx).Infof("Imported portable backup: %v", counts)
+	return nil
+}
 
-	if err := os.MkdirAll(targetUploadsDir, 0755); err != nil {
-		log.Errorf("Create uploads dir failed: %v", err)
-		return fmt.Errorf("create uploads dir failed: %v", err)
+// stageFiles 将备份中的上传文件复制到上传目录旁的临时目录，返回临时目录路径，备份中没有上传目录时返回空字符串
+// 临时目录与上传目录位于同一文件系统，可以通过重命名原子替换
+func (s *BackupService) stageFiles(ctx context.Context, extractDir string) (string, error) {
+	uploadsDir := filepath.Join(extractDir, "uploads")
+	if _, err := os.Stat(uploadsDir); os.IsNotExist(err) {
+		log.Ctx(ctx).Errorf("Uploads dir does not exist: %s", uploadsDir)
+		return "", nil
+	}
+
+	targetUploadsDir := filepath.Clean(strings.Trim(s.serverConfig.UploadDir, "/"))
+	stagingDir := fmt.Sprintf("%s.restore_%d", targetUploadsDir, time.Now().UnixNano())
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		log.Ctx(ctx).Errorf("Create staging dir failed: %v", err)
+		return "", fmt.Errorf("create staging dir failed: %v", err)
 	}
 
-	return filepath.Walk(uploadsDir, func(path string, info os.FileInfo, err error) error {
+	err := filepath.Walk(uploadsDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			log.Errorf("Walk uploads dir failed: %v", err)
+			log.Ctx(ctx).Errorf("Walk uploads dir failed: %v", err)
 			return err
 		}
 
@@ -681,19 +1204,56 @@ func (s *BackupService) restoreFiles(extractDir string) error {
 
 		relPath, err := filepath.Rel(uploadsDir, path)
 		if err != nil {
-			log.Errorf("Get relative path failed: %v", err)
+			log.Ctx(ctx).Errorf("Get relative path failed: %v", err)
 			return err
 		}
 
-		targetPath := filepath.Join(targetUploadsDir, relPath)
+		targetPath := filepath.Join(stagingDir, relPath)
 
 		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-			log.Errorf("Create dir failed: %v", err)
+			log.Ctx(ctx).Errorf("Create dir failed: %v", err)
 			return err
 		}
 
 		return copyFile(path, targetPath)
 	})
+	if err != nil {
+		os.RemoveAll(stagingDir)
+		return "", err
+	}
+	return stagingDir, nil
+}
+
+// swapUploadDir 用临时目录替换上传目录，替换失败时还原原上传目录
+func (s *BackupService) swapUploadDir(ctx context.Context, stagingDir string) error {
+	targetUploadsDir := filepath.Clean(strings.Trim(s.serverConfig.UploadDir, "/"))
+	oldDir := fmt.Sprintf("%s.old_%d", targetUploadsDir, time.Now().UnixNano())
+
+	hasOld := true
+	if err := os.Rename(targetUploadsDir, oldDir); err != nil {
+		if !os.IsNotExist(err) {
+			log.Ctx(ctx).Errorf("Move existing uploads dir failed: %v", err)
+			return fmt.Errorf("move existing uploads dir failed: %v", err)
+		}
+		hasOld = false
+	}
+
+	if err := os.Rename(stagingDir, targetUploadsDir); err != nil {
+		log.Ctx(ctx).Errorf("Move staging dir into place failed: %v", err)
+		if hasOld {
+			if rollbackErr := os.Rename(oldDir, targetUploadsDir); rollbackErr != nil {
+				log.Ctx(ctx).Errorf("Roll back uploads dir failed, old files are kept in %s: %v", oldDir, rollbackErr)
+			}
+		}
+		return fmt.Errorf("move staging dir into place failed: %v", err)
+	}
+
+	if hasOld {
+		if err := os.RemoveAll(oldDir); err != nil {
+			log.Ctx(ctx).Errorf("Remove old uploads dir %s failed: %v", oldDir, err)
+		}
+	}
+	return nil
 }
 
 func copyFile(src, dst string) error {
@@ -715,161 +1275,109 @@ func copyFile(src, dst string) error {
 	return err
 }
 
-func (s *BackupService) backupDatabase(zipWriter *zip.Writer) error {
+// backupDatabaseTables 备份和恢复的数据表，按依赖顺序排列，被引用的表在前；检索文档在恢复后重建，备份和恢复记录不在备份中
+var backupDatabaseTables = []string{
+	"roles",
+	"users",
+	"storages",
+	"albums",
+	"images",
+	"image_albums",
+	"tags",
+	"image_tags",
+	"system_settings",
+	"refresh_token_blacklist",
+	"password_reset_codes",
+}
+
+// backupDatabase 导出数据库到归档，返回导出文件的清单记录和各表的行数
+// portable 为 true 时导出为与数据库类型无关的 JSON Lines，可以恢复到其他类型的数据库
+func (s *BackupService) backupDatabase(ctx context.Context, zipWriter *zip.Writer, portable bool) (ManifestFile, map[string]int64, error) {
 	driver := s.getDatabaseDriver()
 
-	switch driver {
-	case "mysql":
-		return s.backupMySQL(zipWriter)
-	case "sqlite":
-		return s.backupSQLite(zipWriter)
+	var name string
+	var dump func(io.Writer) (map[string]int64, error)
+	switch {
+	// PostgreSQL 只支持可移植格式
+	case portable && (driver == "mysql" || driver == "sqlite"), driver == "postgres":
+		name = portableDumpFile
+		dump = func(w io.Writer) (map[string]int64, error) { return ExportPortable(s.db, w) }
+	case driver == "mysql":
+		name = "database_mysql.sql"
+		dump = func(w io.Writer) (map[string]int64, error) { return s.backupMySQL(ctx, w) }
+	case driver == "sqlite":
+		name = "database_sqlite.sql"
+		dump = func(w io.Writer) (map[string]int64, error) { return s.backupSQLite(ctx, w) }
 	default:
-		return fmt.Errorf("unsupported database driver: %s, only sqlite and mysql are supported", driver)
+		return ManifestFile{}, nil, fmt.Errorf("unsupported database driver: %s, only sqlite, mysql and postgres are supported", driver)
 	}
-}
 
-func (s *BackupService) backupMySQL(zipWriter *zip.Writer) error {
-	if s.dbConfig == nil {
-		log.Errorf("Database configuration is required for MySQL backup")
-		return fmt.Errorf("database configuration is required for MySQL backup")
+	sqlFile, err := zipWriter.Create(name)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Create SQL file failed: %v", err)
+		return ManifestFile{}, nil, err
+	}
+	hash := sha256.New()
+	counter := &countingWriter{}
+	tables, err := dump(io.MultiWriter(sqlFile, hash, counter))
+	if err != nil {
+		return ManifestFile{}, nil, err
 	}
+	return ManifestFile{Path: name, Size: counter.n, SHA256: hex.EncodeToString(hash.Sum(nil))}, tables, nil
+}
 
-	cmd := exec.Command(
-		"mysqldump",
-		fmt.Sprintf("--user=%s", s.dbConfig.User),
-		fmt.Sprintf("--password=%s", s.dbConfig.Password),
-		fmt.Sprintf("--host=%s", s.dbConfig.Host),
-		fmt.Sprintf("--port=%d", s.dbConfig.Port),
-		"--databases",
-		"--single-transaction",
-		"--routines",
-		"--triggers",
-		"--events",
-		"--master-data=2",
-		"--flush-logs",
-		fmt.Sprintf("--ignore-table=%s.backup_tasks", s.dbConfig.DBName),
-		fmt.Sprintf("--ignore-table=%s.restore_tasks", s.dbConfig.DBName),
-		s.dbConfig.DBName,
-	)
+type countingWriter struct {
+	n int64
+}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
 
-	if err := cmd.Run(); err != nil {
-		if stderr.Len() > 0 {
-			log.Errorf("mysqldump failed: %s", stderr.String())
-			return fmt.Errorf("mysqldump failed: %s", stderr.String())
-		}
-		log.Errorf("mysqldump failed: %v", err)
-		return fmt.Errorf("mysqldump failed: %v", err)
+// backupMySQL 通过当前数据库连接导出，不依赖 mysqldump
+func (s *BackupService) backupMySQL(ctx context.Context, w io.Writer) (map[string]int64, error) {
+	if s.db == nil {
+		log.Ctx(ctx).Errorf("Database connection is required for MySQL backup")
+		return nil, fmt.Errorf("database connection is required for MySQL backup")
 	}
 
-	sqlFile, err := zipWriter.Create("database_mysql.sql")
+	counts, err := dumpDatabase(s.db, w, mysqlDialect, backupDatabaseTables)
 	if err != nil {
-		log.Errorf("Create SQL file failed: %v", err)
-		return err
+		log.Ctx(ctx).Errorf("MySQL dump failed: %v", err)
+		return nil, err
 	}
-
-	if _, err := sqlFile.Write(stdout.Bytes()); err != nil {
-		return err
-	}
-
-	return nil
+	return counts, nil
 }
 
-func (s *BackupService) backupSQLite(zipWriter *zip.Writer) error {
+func (s *BackupService) backupSQLite(ctx context.Context, w io.Writer) (map[string]int64, error) {
 	if s.dbConfig == nil || s.dbConfig.GetDSN() == "" {
-		log.Errorf("Database configuration is required for SQLite backup")
-		return fmt.Errorf("database configuration is required for SQLite backup")
+		log.Ctx(ctx).Errorf("Database configuration is required for SQLite backup")
+		return nil, fmt.Errorf("database configuration is required for SQLite backup")
 	}
 
 	dbPath := s.dbConfig.GetDSN()
 	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
-		log.Errorf("SQLite database file not found: %s", dbPath)
-		return fmt.Errorf("SQLite database file not found: %s", dbPath)
+		log.Ctx(ctx).Errorf("SQLite database file not found: %s", dbPath)
+		return nil, fmt.Errorf("SQLite database file not found: %s", dbPath)
 	}
 
-	sqlFile, err := zipWriter.Create("database_sqlite.sql")
+	counts, err := dumpDatabase(s.db, w, sqliteDialect, backupDatabaseTables)
 	if err != nil {
-		return err
-	}
-
-	tables := []string{
-		"users",
-		"roles",
-		"albums",
-		"images",
-		"system_settings",
-		"refresh_token_blacklist",
-		"image_albums",
-		"storages",
-		"password_reset_codes",
-	}
-
-	for _, table := range tables {
-		var tableName, createTableSQL string
-		if err := s.db.Raw(fmt.Sprintf("SELECT name, sql FROM sqlite_master WHERE type='table' AND name='%s'", table)).Row().Scan(&tableName, &createTableSQL); err != nil {
-			log.Errorf("Failed to get table schema for %s: %v", table, err)
-			continue
-		}
-
-		if _, err := sqlFile.Write([]byte(createTableSQL + ";\n\n")); err != nil {
-			log.Errorf("Write create table SQL failed for %s: %v", table, err)
-			return err
-		}
-
-		rows, err := s.db.Raw(fmt.Sprintf("SELECT * FROM %s", table)).Rows()
-		if err != nil {
-			log.Errorf("Failed to query table %s: %v", table, err)
-			continue
-		}
-		defer rows.Close()
-
-		columns, err := rows.Columns()
-		if err != nil {
-			log.Errorf("Failed to get columns for table %s: %v", table, err)
-			continue
-		}
-
-		values := make([]sql.RawBytes, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-
-		for i := range columns {
-			valuePtrs[i] = &values[i]
-		}
-
-		for rows.Next() {
-			if err := rows.Scan(valuePtrs...); err != nil {
-				continue
-			}
-
-			var vals []string
-			for _, v := range values {
-				if v == nil {
-					vals = append(vals, "NULL")
-				} else {
-					escapedValue := strings.ReplaceAll(string(v), "'", "''")
-					vals = append(vals, fmt.Sprintf("'%s'", escapedValue))
-				}
-			}
-
-			if _, err := sqlFile.Write([]byte(fmt.Sprintf("INSERT INTO %s VALUES (%s);\n", table, strings.Join(vals, ", ")))); err != nil {
-				return err
-			}
-		}
-
-		rows.Close()
+		log.Ctx(ctx).Errorf("SQLite dump failed: %v", err)
+		return nil, err
 	}
-
-	return nil
+	return counts, nil
 }
 
-func (s *BackupService) backupFiles(zipWriter *zip.Writer) error {
+func (s *BackupService) backupFiles(ctx context.Context, w *archiveWriter) error {
 	uploadDir := s.serverConfig.UploadDir
 	return filepath.Walk(uploadDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			log.Errorf("Walk local storage failed: %v", err)
+			log.Ctx(ctx).Errorf("Walk local storage failed: %v", err)
+			return err
+		}
+		if err := ctx.Err(); err != nil {
 			return err
 		}
 
@@ -879,35 +1387,15 @@ func (s *BackupService) backupFiles(zipWriter *zip.Writer) error {
 
 		zipPath, err := filepath.Rel(uploadDir, path)
 		if err != nil {
-			log.Errorf("Get relative path failed: %v", err)
-			return err
-		}
-
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			log.Errorf("Create zip file header failed: %v", err)
-			return err
-		}
-
-		header.Name = "uploads/" + strings.ReplaceAll(zipPath, "\\", "/")
-		header.Method = zip.Deflate
-		header.Flags |= 0x800
-
-		zipFile, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			log.Errorf("Create zip file failed: %v", err)
-			return err
-		}
-
-		localFile, err := os.Open(path)
-		if err != nil {
-			log.Errorf("Open local file failed: %v", err)
+			log.Ctx(ctx).Errorf("Get relative path failed: %v", err)
 			return err
 		}
-		defer localFile.Close()
 
-		if _, err := io.Copy(zipFile, localFile); err != nil {
-			log.Errorf("Copy local file to zip file failed: %v", err)
+		name := "uploads/" + strings.ReplaceAll(zipPath, "\\", "/")
+		if err := w.addFile(name, info.Size(), info.ModTime(), func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}); err != nil {
+			log.Ctx(ctx).Errorf("Copy local file to zip file failed: %v", err)
 			return err
 		}
 
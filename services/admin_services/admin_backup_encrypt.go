@@ -0,0 +1,104 @@
+package admin_services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/leleo886/lopic/internal/encrypt"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/models"
+)
+
+// encryptionKey 返回加密使用的口令，未指定口令时使用配置的密钥，都没有时返回空字符串
+func (s *BackupService) encryptionKey(ctx context.Context, passphrase string) (string, error) {
+	if passphrase != "" {
+		return passphrase, nil
+	}
+	key, err := s.backupConfig.EncryptionKey()
+	if err != nil {
+		log.Ctx(ctx).Errorf("Load backup encryption key failed: %v", err)
+		return "", cerrors.ErrInternalServer
+	}
+	return key, nil
+}
+
+// isEncryptedFile 判断文件是否为加密的备份
+func isEncryptedFile(filePath string) (bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, encrypt.HeaderSize)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return encrypt.IsEncrypted(header[:n]), nil
+}
+
+func verifyEncryptedFile(filePath, passphrase string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return encrypt.Verify(file, passphrase)
+}
+
+// openArchive 返回可直接读取的 zip 文件路径，加密的备份会解密到临时目录，使用完毕后需调用 cleanup
+// 解密会校验全部数据，口令错误或数据损坏时返回 ErrBackupDecrypt
+func (s *BackupService) openArchive(ctx context.Context, task models.BackupTask, passphrase string) (string, func(), error) {
+	backupPath, cleanup, err := s.fetchBackup(ctx, task)
+	if err != nil {
+		return "", nil, err
+	}
+	if !task.Encrypted {
+		return backupPath, cleanup, nil
+	}
+	defer cleanup()
+
+	key, err := s.encryptionKey(ctx, passphrase)
+	if err != nil {
+		return "", nil, err
+	}
+	if key == "" {
+		return "", nil, cerrors.ErrBackupPassphraseRequired
+	}
+
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return "", nil, cerrors.ErrBackupNotFound
+	}
+	defer src.Close()
+
+	tempDir := "data/temp"
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		log.Ctx(ctx).Errorf("Create temp directory failed: %v", err)
+		return "", nil, cerrors.ErrInternalServer
+	}
+	tempFile, err := os.CreateTemp(tempDir, fmt.Sprintf("decrypt_%d_*.zip", task.ID))
+	if err != nil {
+		log.Ctx(ctx).Errorf("Create temp file failed: %v", err)
+		return "", nil, cerrors.ErrInternalServer
+	}
+	removeTemp := func() { os.Remove(tempFile.Name()) }
+
+	reader, err := encrypt.NewReader(src, key)
+	if err == nil {
+		_, err = io.Copy(tempFile, reader)
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeTemp()
+		log.Ctx(ctx).Errorf("Decrypt backup %d failed: %v", task.ID, err)
+		return "", nil, cerrors.ErrBackupDecrypt
+	}
+	return tempFile.Name(), removeTemp, nil
+}
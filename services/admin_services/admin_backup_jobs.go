@@ -0,0 +1,304 @@
+package admin_services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/metrics"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/models"
+)
+
+const (
+	backupJobType       = "backup"
+	backupUploadJobType = "backup_upload"
+	restoreJobType      = "restore"
+
+	// interruptedError 重启时未完成的备份和恢复任务的错误信息
+	interruptedError = "interrupted by restart"
+)
+
+// backupJob 备份任务参数，口令不写入数据库
+type backupJob struct {
+	TaskID        uint `json:"task_id"`
+	Incremental   bool `json:"incremental"`
+	MaxChain      int  `json:"max_chain"`
+	Portable      bool `json:"portable"`
+	HasPassphrase bool `json:"has_passphrase"`
+	// Scheduled 自动备份，完成后按保留策略清理过期的自动备份
+	Scheduled bool `json:"scheduled"`
+}
+
+// backupUploadJob 处理上传的备份文件的任务参数
+type backupUploadJob struct {
+	TaskID        uint   `json:"task_id"`
+	TempFile      string `json:"temp_file"`
+	HasPassphrase bool   `json:"has_passphrase"`
+}
+
+// restoreJob 恢复任务参数
+type restoreJob struct {
+	TaskID        uint              `json:"task_id"`
+	StorageMap    map[string]string `json:"storage_map"`
+	HasPassphrase bool              `json:"has_passphrase"`
+}
+
+// RegisterJobs 注册备份、上传备份和恢复任务，同类任务同时只执行一个
+// 恢复会替换数据库和文件，失败后不自动重试
+func (s *BackupService) RegisterJobs(q *queue.Queue) {
+	s.queue = q
+	q.Register(queue.JobType{
+		Name:        backupJobType,
+		Handle:      s.runBackupJob,
+		MaxAttempts: 3,
+		OnAbort: func(job *models.Job) {
+			var payload backupJob
+			if queue.Decode(job, &payload) == nil {
+				s.dropPassphrase(backupJobType, payload.TaskID)
+				s.failTask(payload.TaskID, job.Error)
+				if payload.Scheduled {
+					s.scheduledBackupFailed(payload.TaskID, job.Error)
+				}
+			}
+		},
+	})
+	q.Register(queue.JobType{
+		Name:        backupUploadJobType,
+		Handle:      s.runBackupUploadJob,
+		MaxAttempts: 3,
+		OnAbort: func(job *models.Job) {
+			var payload backupUploadJob
+			if queue.Decode(job, &payload) == nil {
+				s.dropPassphrase(backupUploadJobType, payload.TaskID)
+				os.Remove(payload.TempFile)
+				s.failTask(payload.TaskID, job.Error)
+			}
+		},
+	})
+	q.Register(queue.JobType{
+		Name:        restoreJobType,
+		Handle:      s.runRestoreJob,
+		MaxAttempts: 1,
+		OnAbort: func(job *models.Job) {
+			var payload restoreJob
+			if queue.Decode(job, &payload) == nil {
+				s.dropPassphrase(restoreJobType, payload.TaskID)
+				s.updateRestoreTaskStatus(payload.TaskID, "failed", job.Error)
+			}
+		},
+	})
+}
+
+// RecoverTasks 将没有对应任务的待执行和执行中的备份、恢复记录标记为失败，需在任务队列 Recover 之后调用，返回标记的数量
+func (s *BackupService) RecoverTasks() (int, error) {
+	var jobs []models.Job
+	if err := s.db.Where("type IN ? AND status IN ?", []string{backupJobType, backupUploadJobType, restoreJobType},
+		[]string{queue.StatusPending, queue.StatusRunning}).Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+	queuedBackups := make(map[uint]bool)
+	queuedRestores := make(map[uint]bool)
+	for i := range jobs {
+		var payload struct {
+			TaskID uint `json:"task_id"`
+		}
+		if queue.Decode(&jobs[i], &payload) != nil {
+			continue
+		}
+		if jobs[i].Type == restoreJobType {
+			queuedRestores[payload.TaskID] = true
+		} else {
+			queuedBackups[payload.TaskID] = true
+		}
+	}
+
+	failed := 0
+	var backupTasks []models.BackupTask
+	if err := s.db.Where("status IN ?", []string{"pending", "running"}).Find(&backupTasks).Error; err != nil {
+		return failed, err
+	}
+	for _, task := range backupTasks {
+		if !queuedBackups[task.ID] {
+			s.updateTaskStatus(task.ID, "failed", interruptedError)
+			failed++
+		}
+	}
+
+	var restoreTasks []models.RestoreTask
+	if err := s.db.Where("status IN ?", []string{"pending", "running"}).Find(&restoreTasks).Error; err != nil {
+		return failed, err
+	}
+	for _, task := range restoreTasks {
+		if !queuedRestores[task.ID] {
+			s.updateRestoreTaskStatus(task.ID, "failed", interruptedError)
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+func (s *BackupService) runBackupJob(ctx context.Context, job *models.Job) error {
+	var payload backupJob
+	if err := queue.Decode(job, &payload); err != nil {
+		return err
+	}
+	passphrase, err := s.jobPassphrase(backupJobType, payload.TaskID, payload.HasPassphrase)
+	if err != nil {
+		return err
+	}
+
+	opts := BackupOptions{
+		Incremental: payload.Incremental,
+		MaxChain:    payload.MaxChain,
+		Portable:    payload.Portable,
+		Passphrase:  passphrase,
+	}
+	start := time.Now()
+	err = s.executeBackup(ctx, payload.TaskID, opts)
+	metrics.ObserveBackup("backup", start, err)
+	if err != nil {
+		log.Ctx(ctx).Errorf("BackupTask %d failed: %v", payload.TaskID, err)
+		return jobError(err)
+	}
+	s.dropPassphrase(backupJobType, payload.TaskID)
+	if payload.Scheduled {
+		s.pruneScheduledBackups(ctx)
+	}
+	return nil
+}
+
+// pruneScheduledBackups 自动备份完成后按系统设置中的保留策略清理过期的自动备份，清理失败不影响备份任务
+func (s *BackupService) pruneScheduledBackups(ctx context.Context) {
+	settings, err := config.LoadSystemSettingsFromDatabase(s.db)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Load system settings failed: %v", err)
+		return
+	}
+	deleted, err := s.PruneBackups(ctx, settings.Backup)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Prune expired backups failed: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Ctx(ctx).Infof("Pruned %d expired backups", deleted)
+	}
+}
+
+// scheduledBackupFailed 通知自动备份最终失败
+func (s *BackupService) scheduledBackupFailed(taskID uint, errorMsg string) {
+	if s.scheduledFailed == nil {
+		return
+	}
+	var task models.BackupTask
+	if err := s.db.First(&task, taskID).Error; err != nil {
+		log.Errorf("Find BackupTask %d failed: %v", taskID, err)
+		return
+	}
+	s.scheduledFailed(&task, errorMsg)
+}
+
+func (s *BackupService) runBackupUploadJob(ctx context.Context, job *models.Job) error {
+	var payload backupUploadJob
+	if err := queue.Decode(job, &payload); err != nil {
+		return err
+	}
+	if _, err := os.Stat(payload.TempFile); err != nil {
+		return queue.Permanent(fmt.Errorf("uploaded backup file is missing: %w", err))
+	}
+	passphrase, err := s.jobPassphrase(backupUploadJobType, payload.TaskID, payload.HasPassphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := s.executeUploadBackup(ctx, payload.TaskID, payload.TempFile, passphrase); err != nil {
+		log.Ctx(ctx).Errorf("UploadBackupTask %d failed: %v", payload.TaskID, err)
+		return jobError(err)
+	}
+	// 处理完成后删除临时文件
+	os.Remove(payload.TempFile)
+	s.dropPassphrase(backupUploadJobType, payload.TaskID)
+	return nil
+}
+
+func (s *BackupService) runRestoreJob(ctx context.Context, job *models.Job) error {
+	var payload restoreJob
+	if err := queue.Decode(job, &payload); err != nil {
+		return err
+	}
+	passphrase, err := s.jobPassphrase(restoreJobType, payload.TaskID, payload.HasPassphrase)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = s.executeRestore(ctx, payload.TaskID, payload.StorageMap, passphrase)
+	metrics.ObserveBackup("restore", start, err)
+	if err != nil {
+		log.Ctx(ctx).Errorf("RestoreTask %d failed: %v", payload.TaskID, err)
+		return jobError(err)
+	}
+	s.dropPassphrase(restoreJobType, payload.TaskID)
+	return nil
+}
+
+func (s *BackupService) enqueue(jobType string, payload interface{}) error {
+	if s.queue == nil {
+		return cerrors.ErrInternalServer
+	}
+	_, err := s.queue.Enqueue(jobType, payload)
+	return err
+}
+
+// jobError 客户端错误（如口令错误）重试也不会成功，不再重试
+func jobError(err error) error {
+	var appErr *cerrors.AppError
+	if errors.As(err, &appErr) && appErr.StatusCode < 500 {
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+// failTask 将未完成的备份记录标记为失败
+func (s *BackupService) failTask(taskID uint, errorMsg string) {
+	var task models.BackupTask
+	if err := s.db.First(&task, taskID).Error; err != nil || task.Status == "completed" {
+		return
+	}
+	s.updateTaskStatus(taskID, "failed", errorMsg)
+}
+
+func (s *BackupService) setPassphrase(jobType string, taskID uint, passphrase string) {
+	if passphrase == "" {
+		return
+	}
+	s.passphraseMu.Lock()
+	defer s.passphraseMu.Unlock()
+	s.passphrases[fmt.Sprintf("%s:%d", jobType, taskID)] = passphrase
+}
+
+// dropPassphrase 任务结束后删除任务的口令
+func (s *BackupService) dropPassphrase(jobType string, taskID uint) {
+	s.passphraseMu.Lock()
+	defer s.passphraseMu.Unlock()
+	delete(s.passphrases, fmt.Sprintf("%s:%d", jobType, taskID))
+}
+
+// jobPassphrase 获取任务的口令，口令只保存在内存中，重启后需要口令的任务无法继续
+func (s *BackupService) jobPassphrase(jobType string, taskID uint, required bool) (string, error) {
+	if !required {
+		return "", nil
+	}
+	s.passphraseMu.Lock()
+	defer s.passphraseMu.Unlock()
+	passphrase, ok := s.passphrases[fmt.Sprintf("%s:%d", jobType, taskID)]
+	if !ok {
+		return "", queue.Permanent(cerrors.ErrBackupPassphraseRequired)
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,400 @@
+package admin_services
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/version"
+	"github.com/leleo886/lopic/models"
+)
+
+// manifestFile 归档中记录文件清单的文件
+const manifestFile = "manifest.json"
+
+// manifestSchemaVersion 清单结构版本，清单结构或归档格式不兼容地变化时递增
+// 版本 3 起 MySQL 也使用内置导出，导出文件可按行统计数据
+const manifestSchemaVersion = 3
+
+// BackupManifest 备份的文件清单，列出恢复该备份需要的全部文件
+// 增量备份只在归档中保存新增或变化的文件，其余文件引用基础备份链中的归档
+type BackupManifest struct {
+	SchemaVersion int              `json:"schema_version"` // 清单结构版本，没有该字段的旧清单为 1
+	AppVersion    string           `json:"app_version"`    // 创建备份的应用版本
+	DBType        string           `json:"db_type"`
+	CreatedAt     time.Time        `json:"created_at"`
+	BackupID      uint             `json:"backup_id"`
+	BaseBackupID  uint             `json:"base_backup_id,omitempty"`
+	Database      *ManifestFile    `json:"database,omitempty"` // 数据库导出文件
+	Tables        map[string]int64 `json:"tables,omitempty"`   // 导出时各表的行数
+	Files         []ManifestFile   `json:"files"`
+
+	// DatabaseVersion 导出时数据库的迁移版本，旧版本的备份没有该字段
+	DatabaseVersion uint `json:"database_version,omitempty"`
+}
+
+// ManifestFile 清单中的单个文件
+type ManifestFile struct {
+	Path        string    `json:"path"` // 恢复时文件在归档中的路径，如 uploads/2024/01/a.jpg
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time,omitempty"`
+	SHA256      string    `json:"sha256"`
+	BackupID    uint      `json:"backup_id"`              // 保存文件内容的备份
+	ArchivePath string    `json:"archive_path,omitempty"` // 内容在该备份归档中的路径，为空时与 Path 相同
+}
+
+func (f ManifestFile) archivePath() string {
+	if f.ArchivePath != "" {
+		return f.ArchivePath
+	}
+	return f.Path
+}
+
+// archiveWriter 写入备份文件并生成清单，内容相同的文件只保存一次
+type archiveWriter struct {
+	zipWriter *zip.Writer
+	manifest  BackupManifest
+	base      map[string]ManifestFile // 基础备份中的文件，按路径索引
+	stored    map[string]ManifestFile // 已有内容的文件，按哈希索引
+	dataSize  int64
+}
+
+func newArchiveWriter(zipWriter *zip.Writer, backupID uint, base *BackupManifest) *archiveWriter {
+	w := &archiveWriter{
+		zipWriter: zipWriter,
+		manifest: BackupManifest{
+			SchemaVersion: manifestSchemaVersion,
+			AppVersion:    version.Version,
+			CreatedAt:     time.Now(),
+			BackupID:      backupID,
+		},
+		base:   make(map[string]ManifestFile),
+		stored: make(map[string]ManifestFile),
+	}
+	if base != nil {
+		w.manifest.BaseBackupID = base.BackupID
+		for _, file := range base.Files {
+			w.base[file.Path] = file
+			w.stored[file.SHA256] = file
+		}
+	}
+	return w
+}
+
+// addFile 写入一个文件，size 为 -1 表示大小未知（远程存储）
+// 基础备份中路径相同且大小和修改时间未变的文件直接引用，大小未知时只比较路径（远程存储中的图片上传后不会被修改）
+func (w *archiveWriter) addFile(name string, size int64, modTime time.Time, open func() (io.ReadCloser, error)) error {
+	if file, ok := w.base[name]; ok {
+		if size < 0 || (file.Size == size && !modTime.IsZero() && file.ModTime.Equal(modTime)) {
+			w.appendFile(file)
+			return nil
+		}
+	}
+
+	reader, err := open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// 先写入临时文件计算哈希，只读取一次源文件
+	tempFile, err := os.CreateTemp("", "backup_file_*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tempFile, hash), reader)
+	if err != nil {
+		return err
+	}
+	file := ManifestFile{
+		Path:     name,
+		Size:     written,
+		ModTime:  modTime,
+		SHA256:   hex.EncodeToString(hash.Sum(nil)),
+		BackupID: w.manifest.BackupID,
+	}
+
+	if existing, ok := w.stored[file.SHA256]; ok {
+		file.BackupID = existing.BackupID
+		file.ArchivePath = existing.archivePath()
+		w.appendFile(file)
+		return nil
+	}
+
+	if _, err := tempFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+		Flags:  0x800,
+	}
+	if !modTime.IsZero() {
+		header.Modified = modTime
+	}
+	zipFile, err := w.zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zipFile, tempFile); err != nil {
+		return err
+	}
+
+	w.stored[file.SHA256] = file
+	w.appendFile(file)
+	return nil
+}
+
+func (w *archiveWriter) appendFile(file ManifestFile) {
+	w.manifest.Files = append(w.manifest.Files, file)
+	w.dataSize += file.Size
+}
+
+// close 写入清单
+func (w *archiveWriter) close() error {
+	content, err := json.Marshal(w.manifest)
+	if err != nil {
+		return err
+	}
+	writer, err := w.zipWriter.Create(manifestFile)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(content)
+	return err
+}
+
+// readManifest 读取备份归档中的清单，旧版本的备份没有清单时返回 nil
+func readManifest(zipReader *zip.Reader) (*BackupManifest, error) {
+	for _, file := range zipReader.File {
+		if file.Name != manifestFile {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		var manifest BackupManifest
+		if err := json.NewDecoder(reader).Decode(&manifest); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", manifestFile, err)
+		}
+		return &manifest, nil
+	}
+	return nil, nil
+}
+
+// loadManifest 读取备份的清单，备份不是由本系统创建时（如上传的备份）返回 nil
+func (s *BackupService) loadManifest(ctx context.Context, task models.BackupTask, passphrase string) (*BackupManifest, error) {
+	backupPath, cleanup, err := s.openArchive(ctx, task, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	zipFile, err := zip.OpenReader(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	defer zipFile.Close()
+
+	manifest, err := readManifest(&zipFile.Reader)
+	if err != nil || manifest == nil || manifest.BackupID != task.ID {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// incrementalBase 返回最近一个可作为增量基础的已完成备份及其清单，没有时返回 nil
+// maxChain 大于 0 时，基础备份的备份链达到该长度后返回 nil，以便重新做完整备份
+// 加密的基础备份使用 passphrase 解密，无法解密时返回 nil
+func (s *BackupService) incrementalBase(ctx context.Context, maxChain int, passphrase string) (*models.BackupTask, *BackupManifest, error) {
+	var tasks []models.BackupTask
+	if err := s.db.Where("status = ?", "completed").Order("start_time DESC, id DESC").Find(&tasks).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, nil, nil
+	}
+
+	base := tasks[0]
+	if maxChain > 0 && len(backupChain(tasks, base.ID)) >= maxChain {
+		return nil, nil, nil
+	}
+	manifest, err := s.loadManifest(ctx, base, passphrase)
+	if err != nil || manifest == nil {
+		// 最近的备份没有清单（旧版本或上传的备份）或无法解密时做完整备份
+		if err != nil {
+			log.Ctx(ctx).Errorf("Load manifest of backup %d failed: %v", base.ID, err)
+		}
+		return nil, nil, nil
+	}
+	return &base, manifest, nil
+}
+
+// backupChain 返回恢复备份需要的备份链，从完整备份开始到该备份为止
+func backupChain(tasks []models.BackupTask, backupID uint) []uint {
+	byID := make(map[uint]models.BackupTask, len(tasks))
+	for _, task := range tasks {
+		byID[task.ID] = task
+	}
+
+	var chain []uint
+	seen := make(map[uint]bool)
+	for id := backupID; id != 0 && !seen[id]; {
+		seen[id] = true
+		chain = append([]uint{id}, chain...)
+		task, ok := byID[id]
+		if !ok || task.BaseBackupID == nil {
+			break
+		}
+		id = *task.BaseBackupID
+	}
+	return chain
+}
+
+// materializeManifest 按清单将引用自其他归档的文件复制到解压目录，使解压目录包含完整的文件
+// 需在恢复数据库之前调用，此时备份记录仍是当前系统中的记录；备份链中加密的备份使用 passphrase 解密
+func (s *BackupService) materializeManifest(ctx context.Context, extractDir string, backupID uint, passphrase string) error {
+	content, err := os.ReadFile(filepath.Join(extractDir, manifestFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var manifest BackupManifest
+	if err := json.Unmarshal(content, &manifest); err != nil {
+		return fmt.Errorf("invalid %s: %w", manifestFile, err)
+	}
+
+	// 按保存内容的备份分组
+	external := make(map[uint][]ManifestFile)
+	for _, file := range manifest.Files {
+		if err := validateArchivePath(file.Path); err != nil {
+			return err
+		}
+		if err := validateArchivePath(file.archivePath()); err != nil {
+			return err
+		}
+		if file.BackupID == manifest.BackupID {
+			if file.archivePath() != file.Path {
+				if err := copyFileToDir(filepath.Join(extractDir, filepath.FromSlash(file.archivePath())), extractDir, file.Path); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		// 上传的增量备份引用的是其他系统中的备份记录，无法恢复
+		if manifest.BackupID != backupID {
+			log.Ctx(ctx).Errorf("Backup %d references backup %d from another system", backupID, file.BackupID)
+			return cerrors.ErrBackupChainBroken
+		}
+		external[file.BackupID] = append(external[file.BackupID], file)
+	}
+
+	for sourceID, files := range external {
+		var task models.BackupTask
+		if err := s.db.First(&task, sourceID).Error; err != nil || task.Status != "completed" {
+			log.Ctx(ctx).Errorf("Backup %d in chain of backup %d is not available", sourceID, backupID)
+			return cerrors.ErrBackupChainBroken
+		}
+		if err := s.copyFromBackup(ctx, task, extractDir, files, passphrase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BackupService) copyFromBackup(ctx context.Context, task models.BackupTask, extractDir string, files []ManifestFile, passphrase string) error {
+	backupPath, cleanup, err := s.openArchive(ctx, task, passphrase)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Backup %d file is not available: %v", task.ID, err)
+		if err == cerrors.ErrBackupDecrypt || err == cerrors.ErrBackupPassphraseRequired {
+			return err
+		}
+		return cerrors.ErrBackupChainBroken
+	}
+	defer cleanup()
+
+	zipFile, err := zip.OpenReader(backupPath)
+	if err != nil {
+		return err
+	}
+	defer zipFile.Close()
+
+	entries := make(map[string]*zip.File, len(zipFile.File))
+	for _, file := range zipFile.File {
+		entries[file.Name] = file
+	}
+
+	for _, file := range files {
+		entry, ok := entries[file.archivePath()]
+		if !ok {
+			log.Ctx(ctx).Errorf("File %s is missing in backup %d", file.archivePath(), task.ID)
+			return cerrors.ErrBackupChainBroken
+		}
+		if err := extractZipFile(entry, extractDir, file.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractZipFile(entry *zip.File, extractDir, name string) error {
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return writeToDir(reader, extractDir, name)
+}
+
+func copyFileToDir(src, extractDir, name string) error {
+	reader, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return writeToDir(reader, extractDir, name)
+}
+
+func writeToDir(reader io.Reader, extractDir, name string) error {
+	target := filepath.Join(extractDir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	dstFile, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+	_, err = io.Copy(dstFile, reader)
+	return err
+}
+
+// validateArchivePath 拒绝绝对路径和路径遍历
+func validateArchivePath(name string) error {
+	cleanName := path.Clean(name)
+	if name == "" || path.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, "../") {
+		log.Errorf("invalid archive path in %s: %s", manifestFile, name)
+		return cerrors.ErrForbidden
+	}
+	return nil
+}
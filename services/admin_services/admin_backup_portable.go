@@ -0,0 +1,309 @@
+package admin_services
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// portableDumpFile 归档中可移植格式的数据库导出文件
+const portableDumpFile = "database_portable.jsonl"
+
+// portableDBType 可移植格式在清单中的数据库类型，可以恢复到任意支持的数据库
+const portableDBType = "portable"
+
+// PortableRow 可移植导出文件中的一行，对应一条数据
+// 时间为 RFC 3339 格式的字符串，二进制列为 base64 编码的字符串
+type PortableRow struct {
+	Table string                 `json:"table"`
+	Row   map[string]interface{} `json:"row"`
+}
+
+// importBatchRows 导入时每次插入的行数
+const importBatchRows = 100
+
+// dialectFor 返回数据库对应的导出方言
+func dialectFor(db *gorm.DB) (sqlDialect, error) {
+	switch db.Dialector.Name() {
+	case "mysql":
+		return mysqlDialect, nil
+	case "sqlite":
+		return sqliteDialect, nil
+	case "postgres":
+		return postgresDialect, nil
+	default:
+		return sqlDialect{}, fmt.Errorf("unsupported database driver: %s", db.Dialector.Name())
+	}
+}
+
+// ExportPortable 将数据库导出为与数据库类型无关的 JSON Lines，按表的依赖顺序排列，每行一条数据，返回各表导出的行数
+func ExportPortable(db *gorm.DB, w io.Writer) (map[string]int64, error) {
+	dialect, err := dialectFor(db)
+	if err != nil {
+		return nil, err
+	}
+	tx := db.Begin(dialect.txOptions)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	bw := bufio.NewWriter(w)
+	encoder := json.NewEncoder(bw)
+	encoder.SetEscapeHTML(false)
+
+	counts := make(map[string]int64, len(backupDatabaseTables))
+	for _, table := range backupDatabaseTables {
+		if !tx.Migrator().HasTable(table) {
+			continue
+		}
+		count, err := exportPortableTable(tx, encoder, table)
+		if err != nil {
+			return nil, fmt.Errorf("export table %s failed: %w", table, err)
+		}
+		counts[table] = count
+	}
+
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func exportPortableTable(tx *gorm.DB, encoder *json.Encoder, table string) (int64, error) {
+	rows, err := tx.Table(table).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]interface{}, len(columnTypes))
+	valuePtrs := make([]interface{}, len(columnTypes))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return count, err
+		}
+		row := make(map[string]interface{}, len(columnTypes))
+		for i, columnType := range columnTypes {
+			switch v := values[i].(type) {
+			case []byte:
+				if isBinaryColumn(columnType) {
+					row[columnType.Name()] = base64.StdEncoding.EncodeToString(v)
+				} else {
+					row[columnType.Name()] = string(v)
+				}
+			case time.Time:
+				row[columnType.Name()] = v.Format(time.RFC3339Nano)
+			default:
+				row[columnType.Name()] = v
+			}
+		}
+		if err := encoder.Encode(PortableRow{Table: table, Row: row}); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, rows.Err()
+}
+
+// portableColumn 导入目标表中列的类型
+type portableColumn struct {
+	time   bool
+	binary bool
+	// boolean PostgreSQL 的布尔列不接受 MySQL 和 SQLite 导出的 0 和 1
+	boolean bool
+}
+
+// portableTimeFormats 导入时可识别的时间格式，没有时区的时间按本地时间解析
+var portableTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// ImportPortable 将 ExportPortable 导出的数据导入当前数据库，保留原有的 ID，返回各表导入的行数
+// 数据库需已完成迁移；导入前会清空所有备份的数据表，目标表中不存在的列会被忽略，整个导入在一个事务中进行
+func ImportPortable(db *gorm.DB, r io.Reader) (map[string]int64, error) {
+	dialect, err := dialectFor(db)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(backupDatabaseTables))
+	err = db.Connection(func(conn *gorm.DB) error {
+		// SQLite 不能在事务中修改外键设置，需在开始事务前关闭
+		if dialect.foreignKeysOff != "" {
+			if err := conn.Exec(dialect.foreignKeysOff).Error; err != nil {
+				return fmt.Errorf("disable foreign keys failed: %w", err)
+			}
+			defer conn.Exec(dialect.foreignKeysOn)
+		}
+
+		return conn.Transaction(func(tx *gorm.DB) error {
+			columns := make(map[string]map[string]portableColumn, len(backupDatabaseTables))
+			for _, table := range backupDatabaseTables {
+				columnTypes, err := tx.Migrator().ColumnTypes(table)
+				if err != nil {
+					return fmt.Errorf("get columns of table %s failed: %w", table, err)
+				}
+				columns[table] = make(map[string]portableColumn, len(columnTypes))
+				for _, columnType := range columnTypes {
+					typeName := strings.ToUpper(columnType.DatabaseTypeName())
+					columns[table][columnType.Name()] = portableColumn{
+						time:    strings.Contains(typeName, "DATE") || strings.Contains(typeName, "TIME"),
+						binary:  isBinaryType(typeName),
+						boolean: typeName == "BOOL" || typeName == "BOOLEAN",
+					}
+				}
+			}
+
+			for i := len(backupDatabaseTables) - 1; i >= 0; i-- {
+				if err := tx.Exec("DELETE FROM " + tx.Statement.Quote(backupDatabaseTables[i])).Error; err != nil {
+					return fmt.Errorf("clear table %s failed: %w", backupDatabaseTables[i], err)
+				}
+			}
+
+			var batch []map[string]interface{}
+			batchTable := ""
+			flush := func() error {
+				if len(batch) == 0 {
+					return nil
+				}
+				if err := tx.Table(batchTable).Create(&batch).Error; err != nil {
+					return fmt.Errorf("insert into table %s failed: %w", batchTable, err)
+				}
+				counts[batchTable] += int64(len(batch))
+				batch = nil
+				return nil
+			}
+
+			decoder := json.NewDecoder(bufio.NewReader(r))
+			decoder.UseNumber()
+			for line := 1; ; line++ {
+				var portableRow PortableRow
+				if err := decoder.Decode(&portableRow); err == io.EOF {
+					break
+				} else if err != nil {
+					return fmt.Errorf("invalid data at line %d: %w", line, err)
+				}
+				tableColumns, ok := columns[portableRow.Table]
+				if !ok {
+					return fmt.Errorf("unknown table %q at line %d", portableRow.Table, line)
+				}
+				row, err := portableValues(portableRow.Row, tableColumns)
+				if err != nil {
+					return fmt.Errorf("invalid data at line %d: %w", line, err)
+				}
+
+				if portableRow.Table != batchTable || len(batch) >= importBatchRows {
+					if err := flush(); err != nil {
+						return err
+					}
+					batchTable = portableRow.Table
+				}
+				batch = append(batch, row)
+			}
+			if err := flush(); err != nil {
+				return err
+			}
+
+			if dialect.resetSequence != nil {
+				for _, table := range backupDatabaseTables {
+					if _, ok := columns[table]["id"]; !ok {
+						continue
+					}
+					if err := dialect.resetSequence(tx, table); err != nil {
+						return fmt.Errorf("reset sequence of table %s failed: %w", table, err)
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// portableValues 按目标列的类型转换导入的值，目标表中不存在的列会被忽略
+func portableValues(row map[string]interface{}, columns map[string]portableColumn) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(row))
+	for name, value := range row {
+		column, ok := columns[name]
+		if !ok {
+			continue
+		}
+		switch v := value.(type) {
+		case json.Number:
+			if column.boolean {
+				values[name] = v.String() != "0"
+			} else if i, err := v.Int64(); err == nil {
+				values[name] = i
+			} else if f, err := v.Float64(); err == nil {
+				values[name] = f
+			} else {
+				return nil, fmt.Errorf("invalid number %q in column %s", v, name)
+			}
+		case string:
+			switch {
+			case column.binary:
+				data, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return nil, fmt.Errorf("invalid binary value in column %s: %w", name, err)
+				}
+				values[name] = data
+			case column.time:
+				values[name] = parsePortableTime(v)
+			default:
+				values[name] = v
+			}
+		default:
+			values[name] = v
+		}
+	}
+	return values, nil
+}
+
+// parsePortableTime 解析时间，无法识别时原样返回由数据库解析
+func parsePortableTime(value string) interface{} {
+	for _, layout := range portableTimeFormats {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t
+		}
+	}
+	return value
+}
+
+// countPortableRows 统计可移植导出文件中每个表的行数
+func countPortableRows(r io.Reader) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	decoder := json.NewDecoder(r)
+	for {
+		var row struct {
+			Table string `json:"table"`
+		}
+		if err := decoder.Decode(&row); err == io.EOF {
+			return counts, nil
+		} else if err != nil {
+			return nil, err
+		}
+		counts[row.Table]++
+	}
+}
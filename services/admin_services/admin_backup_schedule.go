@@ -0,0 +1,132 @@
+package admin_services
+
+import (
+	"context"
+	"time"
+
+	"github.com/leleo886/lopic/internal/cron"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/mail"
+	"github.com/leleo886/lopic/internal/websocket"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// BackupScheduler 按系统设置中的 cron 表达式执行自动备份，并在备份完成后清理过期备份
+type BackupScheduler struct {
+	db            *gorm.DB
+	backupService *BackupService
+	cfg           *models.BackupConfig
+	mailService   *mail.MailService
+	hub           *websocket.Hub
+}
+
+// NewBackupScheduler 创建自动备份调度器，自动备份最终失败时按设置通知管理员
+func NewBackupScheduler(db *gorm.DB, backupService *BackupService, cfg *models.BackupConfig, mailService *mail.MailService, hub *websocket.Hub) *BackupScheduler {
+	s := &BackupScheduler{
+		db:            db,
+		backupService: backupService,
+		cfg:           cfg,
+		mailService:   mailService,
+		hub:           hub,
+	}
+	backupService.OnScheduledBackupFailed(func(task *models.BackupTask, errorMsg string) {
+		if s.cfg.NotifyOnFailure {
+			s.notifyFailure(task, errorMsg)
+		}
+	})
+	return s
+}
+
+// Run 每分钟检查一次是否到达备份时间，修改系统设置后无需重启即可生效
+// 备份作为后台任务执行，上一次自动备份尚未完成时跳过本次备份
+// ctx 被取消后返回
+func (s *BackupScheduler) Run(ctx context.Context) {
+	// 对齐到整分钟
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute))):
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var last time.Time
+	now := time.Now()
+	for {
+		minute := now.Truncate(time.Minute)
+		if minute.After(last) {
+			last = minute
+			s.check(minute)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+	}
+}
+
+// check 到达备份时间时添加备份任务
+func (s *BackupScheduler) check(minute time.Time) {
+	cfg := *s.cfg
+	if !cfg.Enabled {
+		return
+	}
+	schedule, err := cron.Parse(cfg.Schedule)
+	if err != nil {
+		log.Errorf("Invalid backup schedule %q: %v", cfg.Schedule, err)
+		return
+	}
+	if schedule.Matches(minute) {
+		s.runBackup(cfg)
+	}
+}
+
+func (s *BackupScheduler) runBackup(cfg models.BackupConfig) {
+	task, err := s.backupService.ScheduleBackup(cfg)
+	if err != nil {
+		log.Errorf("Schedule backup failed: %v", err)
+		if cfg.NotifyOnFailure {
+			s.notifyFailure(task, err.Error())
+		}
+		return
+	}
+	if task == nil {
+		log.Warn("Previous scheduled backup has not finished, skipping")
+		return
+	}
+	log.Infof("Scheduled backup %d queued", task.ID)
+}
+
+// notifyFailure 通过 WebSocket 和邮件通知所有管理员
+func (s *BackupScheduler) notifyFailure(task *models.BackupTask, errorMsg string) {
+	var admins []models.User
+	if err := s.db.Joins("Role").Where("Role.name = ? AND users.active = ?", "admin", true).Find(&admins).Error; err != nil {
+		log.Errorf("Find admin users failed: %v", err)
+		return
+	}
+
+	var taskID uint
+	startTime := time.Now()
+	if task != nil {
+		taskID = task.ID
+		startTime = task.StartTime
+	}
+
+	for _, admin := range admins {
+		if s.hub != nil {
+			s.hub.BroadcastToUser(admin.ID, "scheduled_backup_failed", map[string]interface{}{
+				"task_id": taskID,
+				"error":   errorMsg,
+			})
+		}
+		if s.mailService != nil && s.mailService.IsEnabled() {
+			if err := s.mailService.SendBackupFailed(admin.Email, taskID, startTime, errorMsg); err != nil {
+				log.Errorf("Send backup failure notification failed: to=%s, error=%v", admin.Email, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package admin_services
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// dumpBatchRows 每条 INSERT 语句最多包含的行数
+	dumpBatchRows = 100
+	// dumpBatchBytes 每条 INSERT 语句的大致长度上限，需小于 MySQL 的 max_allowed_packet
+	dumpBatchBytes = 1 << 20
+)
+
+// sqlDialect 逻辑导出和恢复中与数据库相关的部分
+type sqlDialect struct {
+	name string
+	// backslashEscape 字符串中的反斜杠是否为转义符
+	backslashEscape bool
+	timeFormat      string
+	// txOptions 导出时使用的事务选项，保证各表数据来自同一快照
+	txOptions *sql.TxOptions
+	// foreignKeysOff 和 foreignKeysOn 在恢复和导入时关闭和重新开启外键检查
+	foreignKeysOff string
+	foreignKeysOn  string
+	// header 和 footer 写在导出文件的开头和结尾
+	header []string
+	footer []string
+	// schema 返回建表和建索引语句，表不存在时返回 nil
+	schema func(tx *gorm.DB, table string) ([]string, error)
+	// resetSequence 导入保留原有 ID 的数据后重置表的自增序列，为 nil 时不需要重置
+	resetSequence func(tx *gorm.DB, table string) error
+}
+
+var mysqlDialect = sqlDialect{
+	name:            "mysql",
+	backslashEscape: true,
+	timeFormat:      "2006-01-02 15:04:05.999999",
+	txOptions:       &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true},
+	foreignKeysOff:  "SET FOREIGN_KEY_CHECKS = 0",
+	foreignKeysOn:   "SET FOREIGN_KEY_CHECKS = 1",
+	header: []string{
+		"SET NAMES utf8mb4",
+		"SET FOREIGN_KEY_CHECKS = 0",
+		"SET SQL_MODE = 'NO_AUTO_VALUE_ON_ZERO'",
+	},
+	footer: []string{
+		"SET FOREIGN_KEY_CHECKS = 1",
+	},
+	schema: func(tx *gorm.DB, table string) ([]string, error) {
+		var exists int64
+		if err := tx.Raw("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", table).Scan(&exists).Error; err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			return nil, nil
+		}
+		var name, createTableSQL string
+		if err := tx.Raw("SHOW CREATE TABLE "+quoteIdent(table)).Row().Scan(&name, &createTableSQL); err != nil {
+			return nil, err
+		}
+		return []string{createTableSQL}, nil
+	},
+}
+
+var sqliteDialect = sqlDialect{
+	name:           "sqlite",
+	timeFormat:     "2006-01-02 15:04:05.999999999-07:00",
+	foreignKeysOff: "PRAGMA foreign_keys = OFF",
+	foreignKeysOn:  "PRAGMA foreign_keys = ON",
+	schema: func(tx *gorm.DB, table string) ([]string, error) {
+		var statements []string
+		if err := tx.Raw("SELECT sql FROM sqlite_master WHERE tbl_name = ? AND sql IS NOT NULL ORDER BY CASE type WHEN 'table' THEN 0 ELSE 1 END, name", table).Scan(&statements).Error; err != nil {
+			return nil, err
+		}
+		return statements, nil
+	},
+}
+
+// postgresDialect PostgreSQL 只支持可移植格式的导出和导入，没有 schema
+// 外键无法在会话中关闭，导入时按依赖顺序清空和写入数据表
+var postgresDialect = sqlDialect{
+	name:       "postgres",
+	timeFormat: "2006-01-02 15:04:05.999999999-07:00",
+	txOptions:  &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true},
+	resetSequence: func(tx *gorm.DB, table string) error {
+		// 空表时序列从 1 开始
+		return tx.Exec("SELECT setval(pg_get_serial_sequence(?, 'id'), COALESCE(MAX(id), 1), MAX(id) IS NOT NULL) FROM "+tx.Statement.Quote(table), table).Error
+	},
+}
+
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// quoteString 返回字符串字面量，换行符也会被转义，保证导出文件中每行最多一条数据
+func (d sqlDialect) quoteString(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' && d.backslashEscape:
+			b.WriteString(`\'`)
+		case c == '\'':
+			b.WriteString("''")
+		case !d.backslashEscape && (c == '\n' || c == '\r'):
+			// SQLite 不支持反斜杠转义，用 char() 拼接
+			fmt.Fprintf(&b, "'||char(%d)||'", c)
+		case !d.backslashEscape:
+			b.WriteByte(c)
+		case c == '\\':
+			b.WriteString(`\\`)
+		case c == 0:
+			b.WriteString(`\0`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == 0x1a:
+			b.WriteString(`\Z`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// literal 返回值的 SQL 字面量，二进制列使用十六进制
+func (d sqlDialect) literal(value interface{}, binary bool) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return "'" + v.Format(d.timeFormat) + "'"
+	case []byte:
+		if binary {
+			return "X'" + hex.EncodeToString(v) + "'"
+		}
+		return d.quoteString(string(v))
+	case string:
+		return d.quoteString(v)
+	default:
+		return d.quoteString(fmt.Sprint(v))
+	}
+}
+
+func isBinaryColumn(columnType *sql.ColumnType) bool {
+	typeName := strings.ToUpper(columnType.DatabaseTypeName())
+	return isBinaryType(typeName)
+}
+
+// isBinaryType 返回数据库类型名（大写）是否为二进制类型
+func isBinaryType(typeName string) bool {
+	return strings.Contains(typeName, "BLOB") || strings.Contains(typeName, "BINARY") || typeName == "BYTEA"
+}
+
+// dumpDatabase 在一个只读事务中导出各表的结构和数据，返回各表导出的行数
+// 数据使用多行 INSERT，每行一条数据，便于校验时按行统计
+func dumpDatabase(db *gorm.DB, w io.Writer, dialect sqlDialect, tables []string) (map[string]int64, error) {
+	tx := db.Begin(dialect.txOptions)
+	if tx.Error != nil {
+		return nil, fmt.Errorf("begin transaction failed: %w", tx.Error)
+	}
+	defer tx.Rollback()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "-- lopic %s dump, created at %s\n\n", dialect.name, time.Now().Format(time.RFC3339))
+	for _, statement := range dialect.header {
+		fmt.Fprintf(bw, "%s;\n", statement)
+	}
+	bw.WriteString("\n")
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		schema, err := dialect.schema(tx, table)
+		if err != nil {
+			return nil, fmt.Errorf("get schema of table %s failed: %w", table, err)
+		}
+		if len(schema) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(bw, "DROP TABLE IF EXISTS %s;\n", quoteIdent(table))
+		for _, statement := range schema {
+			fmt.Fprintf(bw, "%s;\n", statement)
+		}
+		bw.WriteString("\n")
+
+		count, err := dumpTable(tx, bw, dialect, table)
+		if err != nil {
+			return nil, fmt.Errorf("dump table %s failed: %w", table, err)
+		}
+		counts[table] = count
+		bw.WriteString("\n")
+	}
+
+	for _, statement := range dialect.footer {
+		fmt.Fprintf(bw, "%s;\n", statement)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func dumpTable(tx *gorm.DB, w *bufio.Writer, dialect sqlDialect, table string) (int64, error) {
+	rows, err := tx.Raw("SELECT * FROM " + quoteIdent(table)).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	binary := make([]bool, len(columnTypes))
+	for i, columnType := range columnTypes {
+		binary[i] = isBinaryColumn(columnType)
+	}
+
+	values := make([]interface{}, len(columnTypes))
+	valuePtrs := make([]interface{}, len(columnTypes))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	var count int64
+	batchRows, batchBytes := 0, 0
+	literals := make([]string, len(columnTypes))
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return count, err
+		}
+		for i, value := range values {
+			literals[i] = dialect.literal(value, binary[i])
+		}
+		row := "(" + strings.Join(literals, ", ") + ")"
+
+		if batchRows == 0 {
+			fmt.Fprintf(w, "INSERT INTO %s VALUES\n", quoteIdent(table))
+		} else {
+			w.WriteString(",\n")
+		}
+		w.WriteString(row)
+		batchRows++
+		batchBytes += len(row)
+		count++
+
+		if batchRows >= dumpBatchRows || batchBytes >= dumpBatchBytes {
+			w.WriteString(";\n")
+			batchRows, batchBytes = 0, 0
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if batchRows > 0 {
+		w.WriteString(";\n")
+	}
+	return count, nil
+}
+
+// sqlStatementReader 按分号拆分 SQL 语句，忽略字符串、标识符和注释中的分号
+type sqlStatementReader struct {
+	r               *bufio.Reader
+	backslashEscape bool
+}
+
+func newSQLStatementReader(r io.Reader, backslashEscape bool) *sqlStatementReader {
+	return &sqlStatementReader{r: bufio.NewReaderSize(r, 64*1024), backslashEscape: backslashEscape}
+}
+
+// next 返回下一条语句，没有更多语句时返回 io.EOF
+func (s *sqlStatementReader) next() (string, error) {
+	var b strings.Builder
+	for {
+		statement, err := s.scan(&b)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		statement = stripLeadingComments(statement)
+		if statement != "" {
+			return statement, nil
+		}
+		if err == io.EOF {
+			return "", io.EOF
+		}
+		b.Reset()
+	}
+}
+
+func (s *sqlStatementReader) scan(b *strings.Builder) (string, error) {
+	// quote 为当前所在的字符串或标识符的引号，0 表示不在其中
+	var quote byte
+	lineComment, blockComment := false, false
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return b.String(), err
+		}
+
+		switch {
+		case lineComment:
+			b.WriteByte(c)
+			lineComment = c != '\n'
+		case blockComment:
+			b.WriteByte(c)
+			if c == '*' && s.peek() == '/' {
+				next, _ := s.r.ReadByte()
+				b.WriteByte(next)
+				blockComment = false
+			}
+		case quote != 0:
+			b.WriteByte(c)
+			if c == '\\' && s.backslashEscape && quote != '`' {
+				if next, err := s.r.ReadByte(); err == nil {
+					b.WriteByte(next)
+				}
+			} else if c == quote {
+				// 连续两个引号表示引号本身
+				if s.peek() == quote {
+					next, _ := s.r.ReadByte()
+					b.WriteByte(next)
+				} else {
+					quote = 0
+				}
+			}
+		case c == '\'' || c == '"' || c == '`':
+			b.WriteByte(c)
+			quote = c
+		case c == '-' && s.peek() == '-':
+			b.WriteByte(c)
+			lineComment = true
+		case c == '/' && s.peek() == '*':
+			b.WriteByte(c)
+			next, _ := s.r.ReadByte()
+			b.WriteByte(next)
+			blockComment = true
+		case c == ';':
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+func (s *sqlStatementReader) peek() byte {
+	next, err := s.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+	return next[0]
+}
+
+// stripLeadingComments 去掉语句开头的空白和注释，MySQL 的条件注释 /*! ... */ 需要执行，不去掉
+func stripLeadingComments(statement string) string {
+	for {
+		statement = strings.TrimSpace(statement)
+		switch {
+		case strings.HasPrefix(statement, "--"):
+			end := strings.IndexByte(statement, '\n')
+			if end < 0 {
+				return ""
+			}
+			statement = statement[end+1:]
+		case strings.HasPrefix(statement, "/*") && !strings.HasPrefix(statement, "/*!"):
+			end := strings.Index(statement, "*/")
+			if end < 0 {
+				return ""
+			}
+			statement = statement[end+2:]
+		default:
+			return statement
+		}
+	}
+}
+
+// restoreDump 依次执行导出文件中的语句，skip 返回 true 的语句不执行
+func restoreDump(db *gorm.DB, r io.Reader, dialect sqlDialect, skip func(statement string) bool) error {
+	reader := newSQLStatementReader(r, dialect.backslashEscape)
+	for {
+		statement, err := reader.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if skip != nil && skip(statement) {
+			continue
+		}
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("execute SQL failed: %w", err)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package admin_services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/storage"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// storageMapFile 归档中记录图片所在存储的文件
+const storageMapFile = "storage_map.json"
+
+// StorageMap 备份中图片文件与存储的对应关系
+type StorageMap struct {
+	Storages map[string]string `json:"storages"`          // 存储名称 -> 存储类型
+	Files    []StorageMapEntry `json:"files"`             // 每张图片的原图和缩略图
+	Missing  []string          `json:"missing,omitempty"` // 备份时无法读取的文件 URL
+}
+
+// StorageMapEntry 单张图片的文件记录，路径为归档中的路径
+type StorageMapEntry struct {
+	ImageID       uint   `json:"image_id"`
+	Storage       string `json:"storage"`
+	FileURL       string `json:"file_url"`
+	FilePath      string `json:"file_path"`
+	ThumbnailURL  string `json:"thumbnail_url,omitempty"`
+	ThumbnailPath string `json:"thumbnail_path,omitempty"`
+}
+
+// storageInstances 按名称缓存存储实例，存储配置不存在时使用本地存储
+type storageInstances struct {
+	ctx       context.Context
+	s         *BackupService
+	storages  map[string]models.Storage
+	instances map[string]storage.Storage
+}
+
+func (s *BackupService) newStorageInstances(ctx context.Context) (*storageInstances, error) {
+	var storageModels []models.Storage
+	if err := s.db.Find(&storageModels).Error; err != nil {
+		return nil, err
+	}
+	storages := make(map[string]models.Storage, len(storageModels))
+	for _, storageModel := range storageModels {
+		storages[storageModel.Name] = storageModel
+	}
+	return &storageInstances{ctx: ctx, s: s, storages: storages, instances: make(map[string]storage.Storage)}, nil
+}
+
+// isLocal 本地存储的文件通过上传目录整体备份和恢复
+func (c *storageInstances) isLocal(name string) bool {
+	storageModel, ok := c.storages[name]
+	return !ok || storageModel.Type == "local"
+}
+
+func (c *storageInstances) get(name string) storage.Storage {
+	if instance, ok := c.instances[name]; ok {
+		return instance
+	}
+	var instance storage.Storage
+	if storageModel, ok := c.storages[name]; ok {
+		instance = storage.NewStorageByStorageName(&storageModel, c.s.serverConfig)
+	} else {
+		instance = storage.NewStorageByStorageName(nil, c.s.serverConfig)
+	}
+	instance = storage.WithTracing(c.ctx, instance, name)
+	c.instances[name] = instance
+	return instance
+}
+
+// archivePath 返回文件在归档中的路径，本地存储的文件位于 uploads/ 下，与上传目录的备份一致
+func (c *storageInstances) archivePath(storageName, fileURL string) string {
+	relativePath := c.get(storageName).RelativePath(fileURL)
+	if c.isLocal(storageName) {
+		return "uploads/" + relativePath
+	}
+	return "storages/" + storageName + "/" + relativePath
+}
+
+// backupStorageFiles 按存储读取所有图片（包括回收站中的）的原图和缩略图写入归档，并写入 storage_map.json
+// 本地存储的文件已由 backupFiles 写入，这里只记录对应关系；无法读取的文件记录在 Missing 中，不中断备份
+// ctx 被取消时在下一批图片之前停止
+func (s *BackupService) backupStorageFiles(ctx context.Context, w *archiveWriter) (*StorageMap, error) {
+	instances, err := s.newStorageInstances(ctx)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Get storages failed: %v", err)
+		return nil, err
+	}
+
+	storageMap := &StorageMap{Storages: make(map[string]string)}
+	for name, storageModel := range instances.storages {
+		storageMap.Storages[name] = storageModel.Type
+	}
+
+	written := make(map[string]bool)
+	backupFile := func(storageName, fileURL string) string {
+		if fileURL == "" {
+			return ""
+		}
+		archivePath := instances.archivePath(storageName, fileURL)
+		if instances.isLocal(storageName) || written[archivePath] {
+			return archivePath
+		}
+		instance := instances.get(storageName)
+		if err := w.addFile(archivePath, -1, time.Time{}, func() (io.ReadCloser, error) {
+			return instance.OpenFile(fileURL)
+		}); err != nil {
+			log.Ctx(ctx).Errorf("Backup file %s from storage %s failed: %v", fileURL, storageName, err)
+			storageMap.Missing = append(storageMap.Missing, fileURL)
+			return ""
+		}
+		written[archivePath] = true
+		return archivePath
+	}
+
+	var images []models.Image
+	result := s.db.Unscoped().Order("storage_name, id").FindInBatches(&images, 200, func(tx *gorm.DB, batch int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, image := range images {
+			storageMap.Files = append(storageMap.Files, StorageMapEntry{
+				ImageID:       image.ID,
+				Storage:       image.StorageName,
+				FileURL:       image.FileURL,
+				FilePath:      backupFile(image.StorageName, image.FileURL),
+				ThumbnailURL:  image.ThumbnailURL,
+				ThumbnailPath: backupFile(image.StorageName, image.ThumbnailURL),
+			})
+		}
+		return nil
+	})
+	if result.Error != nil {
+		log.Ctx(ctx).Errorf("Get images failed: %v", result.Error)
+		return nil, result.Error
+	}
+
+	content, err := json.MarshalIndent(storageMap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	writer, err := w.zipWriter.Create(storageMapFile)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	return storageMap, nil
+}
+
+// restoreStorageFiles 按 storage_map.json 将非本地存储的文件写回原存储
+// storageOverrides 可将某个存储的文件恢复到其他存储（原存储名称 -> 目标存储名称），此时会更新图片记录中的存储和 URL
+// 旧版本的备份没有 storage_map.json，直接跳过
+func (s *BackupService) restoreStorageFiles(ctx context.Context, extractDir string, storageOverrides map[string]string) error {
+	content, err := os.ReadFile(filepath.Join(extractDir, storageMapFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var storageMap StorageMap
+	if err := json.Unmarshal(content, &storageMap); err != nil {
+		return fmt.Errorf("invalid %s: %w", storageMapFile, err)
+	}
+
+	// 存储配置使用恢复后的数据库中的配置
+	instances, err := s.newStorageInstances(ctx)
+	if err != nil {
+		return err
+	}
+	for source, target := range storageOverrides {
+		if _, ok := instances.storages[target]; !ok {
+			return fmt.Errorf("target storage %q for %q does not exist", target, source)
+		}
+	}
+
+	for _, entry := range storageMap.Files {
+		target := entry.Storage
+		if override, ok := storageOverrides[entry.Storage]; ok {
+			target = override
+		}
+
+		if target == entry.Storage {
+			// 本地存储的文件已随上传目录恢复
+			if instances.isLocal(target) {
+				continue
+			}
+			instance := instances.get(target)
+			if err := restoreStorageFile(instance, extractDir, entry.FilePath, entry.FileURL); err != nil {
+				return err
+			}
+			if err := restoreStorageFile(instance, extractDir, entry.ThumbnailPath, entry.ThumbnailURL); err != nil {
+				return err
+			}
+			continue
+		}
+
+		instance := instances.get(target)
+		fileURL, err := uploadStorageFile(instance, extractDir, entry.FilePath)
+		if err != nil {
+			return err
+		}
+		thumbnailURL, err := uploadStorageFile(instance, extractDir, entry.ThumbnailPath)
+		if err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"storage_name": target}
+		if fileURL != "" {
+			updates["file_url"] = fileURL
+		}
+		if thumbnailURL != "" {
+			updates["thumbnail_url"] = thumbnailURL
+		}
+		if err := s.db.Unscoped().Model(&models.Image{}).Where("id = ?", entry.ImageID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(storageMap.Missing) > 0 {
+		log.Ctx(ctx).Warn(fmt.Sprintf("%d files were missing when the backup was created", len(storageMap.Missing)))
+	}
+	return nil
+}
+
+// archiveFile 返回归档中的文件在解压目录中的路径，路径为空或文件不存在时返回空字符串
+func archiveFile(extractDir, archivePath string) (string, error) {
+	if archivePath == "" {
+		return "", nil
+	}
+	cleanPath := path.Clean(archivePath)
+	if path.IsAbs(cleanPath) || cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+		log.Errorf("invalid archive path in %s: %s", storageMapFile, archivePath)
+		return "", cerrors.ErrForbidden
+	}
+	localPath := filepath.Join(extractDir, filepath.FromSlash(cleanPath))
+	if _, err := os.Stat(localPath); err != nil {
+		log.Errorf("File %s is missing in backup", archivePath)
+		return "", nil
+	}
+	return localPath, nil
+}
+
+func restoreStorageFile(instance storage.Storage, extractDir, archivePath, fileURL string) error {
+	localPath, err := archiveFile(extractDir, archivePath)
+	if err != nil || localPath == "" || fileURL == "" {
+		return err
+	}
+
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return instance.WriteFile(fileURL, file)
+}
+
+// uploadStorageFile 将文件上传到目标存储的相同相对路径，返回新的文件 URL
+func uploadStorageFile(instance storage.Storage, extractDir, archivePath string) (string, error) {
+	localPath, err := archiveFile(extractDir, archivePath)
+	if err != nil || localPath == "" {
+		return "", err
+	}
+
+	// 去掉 uploads/ 或 storages/<name>/ 前缀得到相对路径
+	relativePath := strings.TrimPrefix(archivePath, "uploads/")
+	if strings.HasPrefix(archivePath, "storages/") {
+		parts := strings.SplitN(archivePath, "/", 3)
+		if len(parts) == 3 {
+			relativePath = parts[2]
+		}
+	}
+	return instance.UploadFile(nil, localPath, path.Dir(relativePath), path.Base(relativePath))
+}
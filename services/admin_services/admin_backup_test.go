@@ -3,14 +3,22 @@ package admin_services
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"github.com/leleo886/lopic/internal/config"
 	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/migrations"
 	"github.com/leleo886/lopic/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
 )
 
 func TestNewBackupService(t *testing.T) {
@@ -36,7 +44,7 @@ func TestNewBackupService(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := NewBackupService(nil, nil, tt.dbConfig, tt.serverConfig)
+			service := NewBackupService(nil, nil, tt.dbConfig, tt.serverConfig, nil)
 			if (service == nil) != tt.expectNil {
 				t.Errorf("NewBackupService() returned nil = %v, want nil = %v", service == nil, tt.expectNil)
 			}
@@ -74,7 +82,7 @@ func TestGetDatabaseDriver(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			service := NewBackupService(nil, nil, tt.dbConfig, nil)
+			service := NewBackupService(nil, nil, tt.dbConfig, nil, nil)
 			driver := service.getDatabaseDriver()
 			if driver != tt.expectedType {
 				t.Errorf("getDatabaseDriver() = %v, want %v", driver, tt.expectedType)
@@ -172,8 +180,8 @@ func TestExtractBackup(t *testing.T) {
 		t.Fatalf("failed to close zip file: %v", err)
 	}
 
-	service := NewBackupService(nil, nil, nil, nil)
-	extractDir, err := service.extractBackup(backupPath)
+	service := NewBackupService(nil, nil, nil, nil, nil)
+	extractDir, err := service.extractBackup(context.Background(), backupPath)
 	if err != nil {
 		t.Errorf("extractBackup() error = %v", err)
 		return
@@ -205,16 +213,16 @@ func TestExtractBackupInvalidZip(t *testing.T) {
 		t.Fatalf("failed to create invalid zip file: %v", err)
 	}
 
-	service := NewBackupService(nil, nil, nil, nil)
-	_, err = service.extractBackup(invalidZipPath)
+	service := NewBackupService(nil, nil, nil, nil, nil)
+	_, err = service.extractBackup(context.Background(), invalidZipPath)
 	if err == nil {
 		t.Error("extractBackup() expected error for invalid zip, got nil")
 	}
 }
 
 func TestExtractBackupNonExistent(t *testing.T) {
-	service := NewBackupService(nil, nil, nil, nil)
-	_, err := service.extractBackup("/nonexistent/path/backup.zip")
+	service := NewBackupService(nil, nil, nil, nil, nil)
+	_, err := service.extractBackup(context.Background(), "/nonexistent/path/backup.zip")
 	if err == nil {
 		t.Error("extractBackup() expected error for non-existent file, got nil")
 	}
@@ -276,7 +284,7 @@ func TestBackupTaskWithEndTime(t *testing.T) {
 }
 
 func TestBackupServiceWithNilDependencies(t *testing.T) {
-	service := NewBackupService(nil, nil, nil, nil)
+	service := NewBackupService(nil, nil, nil, nil, nil)
 
 	if service.db != nil {
 		t.Error("expected db to be nil")
@@ -296,13 +304,13 @@ func TestBackupServiceWithNilDependencies(t *testing.T) {
 }
 
 func TestBackupDatabaseUnsupportedDriver(t *testing.T) {
-	service := NewBackupService(nil, nil, &config.DatabaseConfig{Type: "postgres"}, nil)
+	service := NewBackupService(nil, nil, &config.DatabaseConfig{Type: "oracle"}, nil, nil)
 
 	buf := new(bytes.Buffer)
 	zipWriter := zip.NewWriter(buf)
 	defer zipWriter.Close()
 
-	err := service.backupDatabase(zipWriter)
+	_, _, err := service.backupDatabase(context.Background(), zipWriter, false)
 	if err == nil {
 		t.Error("backupDatabase() expected error for unsupported driver, got nil")
 	}
@@ -375,7 +383,540 @@ func TestErrorTypes(t *testing.T) {
 	}
 }
 
+func TestExpiredBackups(t *testing.T) {
+	// 2024-05-15 为周三
+	now := parseTime("2024-05-15T12:00:00Z")
+	hoursAgo := func(id uint, hours int) models.BackupTask {
+		task := models.BackupTask{StartTime: now.Add(-time.Duration(hours) * time.Hour)}
+		task.ID = id
+		return task
+	}
+	// 每 12 小时一个备份，共 40 天
+	var tasks []models.BackupTask
+	for i := 0; i < 80; i++ {
+		tasks = append(tasks, hoursAgo(uint(i+1), i*12))
+	}
+
+	tests := []struct {
+		name string
+		cfg  models.BackupConfig
+		kept []uint
+	}{
+		{
+			name: "keep last",
+			cfg:  models.BackupConfig{KeepLast: 3},
+			kept: []uint{1, 2, 3},
+		},
+		{
+			name: "keep daily",
+			cfg:  models.BackupConfig{KeepDaily: 3},
+			// 今天 12:00、00:00 为同一天，取最新的
+			kept: []uint{1, 3, 5},
+		},
+		{
+			name: "keep weekly",
+			cfg:  models.BackupConfig{KeepWeekly: 2},
+			// 本周（周一 05-13 起）最新为 1，上周（05-06 起）最新为 05-12 12:00
+			kept: []uint{1, 7},
+		},
+		{
+			name: "combined",
+			cfg:  models.BackupConfig{KeepLast: 2, KeepDaily: 2, KeepWeekly: 2},
+			kept: []uint{1, 2, 3, 7},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expired := expiredBackups(tasks, tt.cfg, now)
+			expiredIDs := make(map[uint]bool)
+			for _, task := range expired {
+				expiredIDs[task.ID] = true
+			}
+			var kept []uint
+			for _, task := range tasks {
+				if !expiredIDs[task.ID] {
+					kept = append(kept, task.ID)
+				}
+			}
+			if len(kept) != len(tt.kept) {
+				t.Fatalf("kept = %v, want %v", kept, tt.kept)
+			}
+			for i := range kept {
+				if kept[i] != tt.kept[i] {
+					t.Fatalf("kept = %v, want %v", kept, tt.kept)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupChain(t *testing.T) {
+	task := func(id uint, base uint) models.BackupTask {
+		task := models.BackupTask{}
+		task.ID = id
+		if base != 0 {
+			task.BaseBackupID = &base
+		}
+		return task
+	}
+	// 1 <- 2 <- 3，4 为独立的完整备份，5 的基础备份已删除
+	tasks := []models.BackupTask{task(1, 0), task(2, 1), task(3, 2), task(4, 0), task(5, 9)}
+
+	chains := map[uint][]uint{1: {1}, 2: {1, 2}, 3: {1, 2, 3}, 4: {4}, 5: {9, 5}}
+	for id, want := range chains {
+		if got := backupChain(tasks, id); !equalIDs(got, want) {
+			t.Errorf("backupChain(%d) = %v, want %v", id, got, want)
+		}
+	}
+
+	// 3 过期但 2 未过期时，只有 3 可以删除；1 是 2 的基础备份
+	needed := chainDependencies(tasks, []models.BackupTask{task(1, 0), task(3, 2)})
+	if !needed[1] || needed[3] {
+		t.Errorf("chainDependencies = %v, want 1 needed and 3 not needed", needed)
+	}
+}
+
+func equalIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 func parseTime(s string) time.Time {
 	t, _ := time.Parse(time.RFC3339, s)
 	return t
 }
+
+func TestStageAndSwapUploadDir(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Chdir(tempDir)
+
+	extractDir := filepath.Join(tempDir, "extract")
+	if err := os.MkdirAll(filepath.Join(extractDir, "uploads", "2024"), 0755); err != nil {
+		t.Fatalf("failed to create extract dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(extractDir, "uploads", "2024", "a.png"), []byte("restored"), 0644); err != nil {
+		t.Fatalf("failed to create backup file: %v", err)
+	}
+	if err := os.MkdirAll("uploads", 0755); err != nil {
+		t.Fatalf("failed to create uploads dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join("uploads", "old.png"), []byte("old"), 0644); err != nil {
+		t.Fatalf("failed to create existing file: %v", err)
+	}
+
+	service := NewBackupService(nil, nil, nil, &config.ServerConfig{UploadDir: "uploads"}, nil)
+	stagingDir, err := service.stageFiles(context.Background(), extractDir)
+	if err != nil {
+		t.Fatalf("stageFiles() error = %v", err)
+	}
+	// 替换前上传目录保持不变
+	if _, err := os.Stat(filepath.Join("uploads", "old.png")); err != nil {
+		t.Errorf("uploads dir changed before swap: %v", err)
+	}
+
+	if err := service.swapUploadDir(context.Background(), stagingDir); err != nil {
+		t.Fatalf("swapUploadDir() error = %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join("uploads", "2024", "a.png"))
+	if err != nil || string(content) != "restored" {
+		t.Errorf("restored file = %q, %v, want %q", content, err, "restored")
+	}
+	if _, err := os.Stat(filepath.Join("uploads", "old.png")); !os.IsNotExist(err) {
+		t.Errorf("old file still exists after swap")
+	}
+	entries, _ := os.ReadDir(tempDir)
+	if len(entries) != 2 {
+		t.Errorf("temp dir has %d entries after swap, want 2 (extract, uploads)", len(entries))
+	}
+}
+
+func TestDumpDatabaseRoundTrip(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	statements := []string{
+		"CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT, score REAL, data BLOB, created_at DATETIME)",
+		"CREATE INDEX idx_notes_score ON notes(score)",
+		"INSERT INTO notes VALUES (1, 'it''s; a \"test\"' || char(10) || 'line -- two', 1.5, X'00ff', '2024-01-02 03:04:05')",
+		"INSERT INTO notes VALUES (2, NULL, NULL, NULL, NULL)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+
+	var dump bytes.Buffer
+	counts, err := dumpDatabase(db, &dump, sqliteDialect, []string{"notes", "missing"})
+	if err != nil {
+		t.Fatalf("dumpDatabase() error = %v", err)
+	}
+	if counts["notes"] != 2 || len(counts) != 1 {
+		t.Errorf("dumpDatabase() counts = %v, want map[notes:2]", counts)
+	}
+
+	type note struct {
+		ID        int
+		Body      *string
+		Score     *float64
+		Data      []byte
+		CreatedAt *time.Time
+	}
+	var before []note
+	db.Raw("SELECT * FROM notes ORDER BY id").Scan(&before)
+
+	if err := db.Exec("DELETE FROM notes").Error; err != nil {
+		t.Fatalf("failed to clear data: %v", err)
+	}
+	if err := restoreDump(db, bytes.NewReader(dump.Bytes()), sqliteDialect, nil); err != nil {
+		t.Fatalf("restoreDump() error = %v\n%s", err, dump.String())
+	}
+
+	var after []note
+	db.Raw("SELECT * FROM notes ORDER BY id").Scan(&after)
+	if len(after) != 2 || *after[0].Body != *before[0].Body || *after[0].Score != 1.5 ||
+		!bytes.Equal(after[0].Data, []byte{0, 0xff}) || !after[0].CreatedAt.Equal(*before[0].CreatedAt) || after[1].Body != nil {
+		t.Errorf("restored rows = %+v, want %+v", after, before)
+	}
+	var indexes int64
+	db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_notes_score'").Scan(&indexes)
+	if indexes != 1 {
+		t.Errorf("index was not restored")
+	}
+}
+
+func TestSQLStatementReader(t *testing.T) {
+	dump := "-- comment; here\n/*!40101 SET NAMES utf8 */;\n" +
+		"INSERT INTO `t` VALUES\n('a\\'b;c', 'x''y'),\n(\"q;\", `col;`);\n" +
+		"/* block; comment */\nUSE db"
+	reader := newSQLStatementReader(bytes.NewReader([]byte(dump)), true)
+
+	var statements []string
+	for {
+		statement, err := reader.next()
+		if err != nil {
+			break
+		}
+		statements = append(statements, statement)
+	}
+	want := []string{
+		"/*!40101 SET NAMES utf8 */",
+		"INSERT INTO `t` VALUES\n('a\\'b;c', 'x''y'),\n(\"q;\", `col;`)",
+		"USE db",
+	}
+	if len(statements) != len(want) {
+		t.Fatalf("statements = %q, want %q", statements, want)
+	}
+	for i := range want {
+		if statements[i] != want[i] {
+			t.Errorf("statement %d = %q, want %q", i, statements[i], want[i])
+		}
+	}
+
+	if got := mysqlDialect.quoteString("a'b\\c\nd"); got != `'a\'b\\c\nd'` {
+		t.Errorf("mysql quoteString() = %s", got)
+	}
+}
+
+func TestPortableRoundTrip(t *testing.T) {
+	openDB := func(name string) *gorm.DB {
+		db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name)), &gorm.Config{})
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		if err := migrations.Migrate(db); err != nil {
+			t.Fatalf("failed to migrate database: %v", err)
+		}
+		return db
+	}
+
+	source := openDB("source.db")
+	role := models.Role{BaseModel: models.BaseModel{ID: 3}, Name: "editor"}
+	user := models.User{BaseModel: models.BaseModel{ID: 7}, Username: "alice", Password: "x", Email: "a@example.com", RoleID: 3, Active: true}
+	album := models.Album{BaseModel: models.BaseModel{ID: 11}, Name: "trip\n2024", UserID: 7}
+	image := models.Image{BaseModel: models.BaseModel{ID: 42}, FileName: "a.png", OriginalName: "a.png", FileURL: "/uploads/a.png",
+		MimeType: "image/png", UserID: 7, Tags: []string{"sea", "sun"}}
+	for _, value := range []interface{}{&role, &user, &album, &image, &models.ImageAlbum{ImageID: 42, AlbumID: 11}} {
+		if err := source.Create(value).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+
+	var export bytes.Buffer
+	exported, err := ExportPortable(source, &export)
+	if err != nil {
+		t.Fatalf("ExportPortable() error = %v", err)
+	}
+
+	target := openDB("target.db")
+	if err := target.Create(&models.Role{Name: "existing"}).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	imported, err := ImportPortable(target, bytes.NewReader(export.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportPortable() error = %v", err)
+	}
+	for table, count := range exported {
+		if imported[table] != count {
+			t.Errorf("table %s imported %d rows, exported %d", table, imported[table], count)
+		}
+	}
+
+	var restored models.Image
+	if err := target.Preload("Albums").Preload("User").First(&restored, 42).Error; err != nil {
+		t.Fatalf("image was not imported: %v", err)
+	}
+	if restored.User.ID != 7 || !restored.User.Active || len(restored.Albums) != 1 || restored.Albums[0].ID != 11 ||
+		restored.Albums[0].Name != "trip\n2024" || len(restored.Tags) != 2 || !restored.CreatedAt.Equal(image.CreatedAt) {
+		t.Errorf("imported image = %+v", restored)
+	}
+	var roles int64
+	target.Model(&models.Role{}).Where("name = ?", "existing").Count(&roles)
+	if roles != 0 {
+		t.Errorf("existing data was not replaced")
+	}
+
+	counts, err := countPortableRows(bytes.NewReader(export.Bytes()))
+	if err != nil || counts["image_albums"] != 1 || counts["images"] != 1 {
+		t.Errorf("countPortableRows() = %v, %v", counts, err)
+	}
+}
+
+func TestPortableValuesBoolean(t *testing.T) {
+	columns := map[string]portableColumn{"active": {boolean: true}, "role_id": {}}
+	values, err := portableValues(map[string]interface{}{"active": json.Number("1"), "role_id": json.Number("2")}, columns)
+	if err != nil {
+		t.Fatalf("portableValues() error = %v", err)
+	}
+	if values["active"] != true || values["role_id"] != int64(2) {
+		t.Errorf("portableValues() = %v", values)
+	}
+}
+
+// openPostgres 连接 POSTGRES_TEST_DSN 指定的测试数据库并清空 public schema，未设置时跳过测试
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		t.Skip("POSTGRES_TEST_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect postgres: %v", err)
+	}
+	if err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public").Error; err != nil {
+		t.Fatalf("failed to reset schema: %v", err)
+	}
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+func TestPortableRoundTripPostgres(t *testing.T) {
+	target := openPostgres(t)
+
+	source, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "source.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := migrations.Migrate(source); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	user := models.User{BaseModel: models.BaseModel{ID: 7}, Username: "alice", Password: "x", Email: "a@example.com", RoleID: 3, Active: true}
+	for _, value := range []interface{}{
+		&models.Role{BaseModel: models.BaseModel{ID: 3}, Name: "editor", AllowedExtensions: []string{".png"}},
+		&user,
+		&models.Album{BaseModel: models.BaseModel{ID: 11}, Name: "trip", UserID: 7, GalleryEnabled: true},
+		&models.Image{BaseModel: models.BaseModel{ID: 42}, FileName: "a.png", OriginalName: "a.png", FileURL: "/uploads/a.png",
+			MimeType: "image/png", UserID: 7, Tags: []string{"sea", "sun"}},
+		&models.ImageAlbum{ImageID: 42, AlbumID: 11},
+	} {
+		if err := source.Create(value).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+
+	var export bytes.Buffer
+	if _, err := ExportPortable(source, &export); err != nil {
+		t.Fatalf("ExportPortable() error = %v", err)
+	}
+	if _, err := ImportPortable(target, bytes.NewReader(export.Bytes())); err != nil {
+		t.Fatalf("ImportPortable() error = %v", err)
+	}
+
+	var restored models.Image
+	if err := target.Preload("Albums").Preload("User").First(&restored, 42).Error; err != nil {
+		t.Fatalf("image was not imported: %v", err)
+	}
+	if !restored.User.Active || len(restored.Albums) != 1 || !restored.Albums[0].GalleryEnabled || len(restored.Tags) != 2 {
+		t.Errorf("imported image = %+v", restored)
+	}
+	// 导入后自增序列从已有的最大 ID 之后开始
+	role := models.Role{Name: "viewer"}
+	if err := target.Create(&role).Error; err != nil || role.ID != 4 {
+		t.Errorf("create role after import: id = %d, error = %v", role.ID, err)
+	}
+
+	// PostgreSQL 导出的数据可以导入 SQLite
+	export.Reset()
+	if _, err := ExportPortable(target, &export); err != nil {
+		t.Fatalf("ExportPortable() from postgres error = %v", err)
+	}
+	if _, err := ImportPortable(source, bytes.NewReader(export.Bytes())); err != nil {
+		t.Fatalf("ImportPortable() into sqlite error = %v", err)
+	}
+	var imported models.User
+	if err := source.First(&imported, 7).Error; err != nil || !imported.Active {
+		t.Errorf("user imported from postgres = %+v, error = %v", imported, err)
+	}
+}
+
+func TestBackupAndRestoreCanceled(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	if err := os.MkdirAll("uploads", 0755); err != nil {
+		t.Fatalf("failed to create uploads dir: %v", err)
+	}
+	service := NewBackupService(db, nil, &config.DatabaseConfig{Type: "sqlite", DBName: "test.db"}, &config.ServerConfig{UploadDir: "uploads"}, &config.BackupConfig{})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// 取消的备份不留下备份文件
+	task := models.BackupTask{Status: "pending", StartTime: time.Now()}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := service.executeBackup(canceled, task.ID, BackupOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("executeBackup() error = %v, want context.Canceled", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join("data", "backup")); len(entries) != 0 {
+		t.Errorf("backup dir has %d files after cancel, want 0", len(entries))
+	}
+
+	// 失败的备份同样删除不完整的备份文件
+	broken := NewBackupService(db, nil, &config.DatabaseConfig{Type: "sqlite", DBName: "missing.db"}, &config.ServerConfig{UploadDir: "uploads"}, &config.BackupConfig{})
+	task = models.BackupTask{Status: "pending", StartTime: time.Now()}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := broken.executeBackup(context.Background(), task.ID, BackupOptions{}); !errors.Is(err, cerrors.ErrBackupDatabase) {
+		t.Fatalf("executeBackup() error = %v, want ErrBackupDatabase", err)
+	}
+	if entries, _ := os.ReadDir(filepath.Join("data", "backup")); len(entries) != 0 {
+		t.Errorf("backup dir has %d files after failure, want 0", len(entries))
+	}
+
+	// 取消的恢复不修改数据
+	task = models.BackupTask{Status: "pending", StartTime: time.Now()}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := service.executeBackup(context.Background(), task.ID, BackupOptions{}); err != nil {
+		t.Fatalf("executeBackup() error = %v", err)
+	}
+	if err := db.Create(&models.Role{Name: "after_backup"}).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	restoreTask := models.RestoreTask{BackupTaskID: task.ID, Status: "pending", StartTime: time.Now()}
+	if err := db.Create(&restoreTask).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := service.executeRestore(canceled, restoreTask.ID, nil, ""); !errors.Is(err, context.Canceled) {
+		t.Fatalf("executeRestore() error = %v, want context.Canceled", err)
+	}
+	var roles int64
+	db.Model(&models.Role{}).Where("name = ?", "after_backup").Count(&roles)
+	if roles != 1 {
+		t.Errorf("data was restored after cancel")
+	}
+}
+
+func TestScheduleBackup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	if err := os.MkdirAll("uploads", 0755); err != nil {
+		t.Fatalf("failed to create uploads dir: %v", err)
+	}
+	settings := models.SystemSetting{Value: models.SystemSettings{Backup: models.BackupConfig{KeepLast: 1}}}
+	if err := db.Create(&settings).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	service := NewBackupService(db, nil, &config.DatabaseConfig{Type: "sqlite", DBName: "test.db"}, &config.ServerConfig{UploadDir: "uploads"}, &config.BackupConfig{})
+
+	if _, err := service.ScheduleBackup(settings.Value.Backup); !errors.Is(err, cerrors.ErrInternalServer) {
+		t.Errorf("ScheduleBackup() without queue error = %v, want ErrInternalServer", err)
+	}
+	db.Where("scheduled = ?", true).Delete(&models.BackupTask{})
+
+	q := queue.New(db)
+	service.RegisterJobs(q)
+	old := models.BackupTask{Status: "completed", StartTime: time.Now().Add(-time.Hour), Scheduled: true}
+	if err := db.Create(&old).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+
+	// 自动备份通过任务队列执行，上一次未完成时不重复添加
+	task, err := service.ScheduleBackup(settings.Value.Backup)
+	if err != nil || task == nil {
+		t.Fatalf("ScheduleBackup() = %v, %v", task, err)
+	}
+	if skipped, err := service.ScheduleBackup(settings.Value.Backup); err != nil || skipped != nil {
+		t.Errorf("ScheduleBackup() with unfinished backup = %v, %v, want nil", skipped, err)
+	}
+	var job models.Job
+	if err := db.Where("type = ?", backupJobType).First(&job).Error; err != nil {
+		t.Fatalf("backup job not enqueued: %v", err)
+	}
+
+	// 完成后按保留策略清理过期的自动备份
+	if err := service.runBackupJob(context.Background(), &job); err != nil {
+		t.Fatalf("runBackupJob() error = %v", err)
+	}
+	if err := db.First(task, task.ID).Error; err != nil || task.Status != "completed" {
+		t.Errorf("scheduled backup = %+v, %v, want completed", task, err)
+	}
+	if err := db.First(&models.BackupTask{}, old.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("expired scheduled backup not pruned: %v", err)
+	}
+
+	// 取消的自动备份通知管理员
+	var notified uint
+	service.OnScheduledBackupFailed(func(task *models.BackupTask, errorMsg string) { notified = task.ID })
+	task, err = service.ScheduleBackup(settings.Value.Backup)
+	if err != nil || task == nil {
+		t.Fatalf("ScheduleBackup() = %v, %v", task, err)
+	}
+	var pending models.Job
+	if err := db.Where("type = ?", backupJobType).Last(&pending).Error; err != nil {
+		t.Fatalf("backup job not enqueued: %v", err)
+	}
+	if _, err := q.Cancel(pending.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if notified != task.ID {
+		t.Errorf("notified task = %d, want %d", notified, task.ID)
+	}
+}
@@ -0,0 +1,482 @@
+package admin_services
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/migrations"
+	"github.com/leleo886/lopic/models"
+)
+
+// BackupVerification 备份校验结果，Problems 不为空时备份无法恢复
+type BackupVerification struct {
+	BackupID        uint             `json:"backup_id"`
+	Valid           bool             `json:"valid"`
+	Encrypted       bool             `json:"encrypted"`
+	HasManifest     bool             `json:"has_manifest"`
+	SchemaVersion   int              `json:"schema_version,omitempty"`
+	AppVersion      string           `json:"app_version,omitempty"`
+	DBType          string           `json:"db_type"`
+	Tables          map[string]int64 `json:"tables,omitempty"` // 各表的行数
+	Files           int              `json:"files"`            // 归档中的文件数
+	CheckedFiles    int              `json:"checked_files"`    // 按清单校验了哈希的文件数
+	ReferencedFiles int              `json:"referenced_files"` // 引用自备份链中其他备份的文件数
+	Problems        []string         `json:"problems,omitempty"`
+	Warnings        []string         `json:"warnings,omitempty"`
+}
+
+func (v *BackupVerification) problem(format string, args ...interface{}) {
+	v.Problems = append(v.Problems, fmt.Sprintf(format, args...))
+}
+
+// archiveEntry 归档中文件的哈希和大小
+type archiveEntry struct {
+	file   *zip.File
+	size   int64
+	sha256 string
+}
+
+// VerifyBackup 校验备份能否解密、归档是否完整以及是否与清单一致，加密的备份需要口令（未指定时使用配置的密钥）
+func (s *BackupService) VerifyBackup(ctx context.Context, backupID uint, passphrase string) (*BackupVerification, error) {
+	task, err := s.GetBackupTaskByID(backupID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != "completed" {
+		return nil, cerrors.ErrBackupTaskNotCompleted
+	}
+
+	archivePath, cleanup, err := s.openArchive(ctx, task, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	zipFile, err := zip.OpenReader(archivePath)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Open backup %d failed: %v", backupID, err)
+		return nil, cerrors.ErrBackupCorrupted
+	}
+	defer zipFile.Close()
+
+	verification, _ := s.verifyArchive(task, &zipFile.Reader)
+	return verification, nil
+}
+
+// verifyArchive 读取归档中的每个文件校验 CRC，并按清单校验哈希、数据库类型、表行数和备份链，同时返回读取到的清单
+func (s *BackupService) verifyArchive(task models.BackupTask, zipReader *zip.Reader) (*BackupVerification, *BackupManifest) {
+	verification := &BackupVerification{
+		BackupID:  task.ID,
+		Encrypted: task.Encrypted,
+		Files:     len(zipReader.File),
+	}
+
+	entries := make(map[string]archiveEntry, len(zipReader.File))
+	for _, file := range zipReader.File {
+		size, sum, err := hashZipFile(file)
+		if err != nil {
+			verification.problem("file %s is corrupted: %v", file.Name, err)
+			continue
+		}
+		entries[file.Name] = archiveEntry{file: file, size: size, sha256: sum}
+	}
+
+	manifest, err := readManifest(zipReader)
+	if err != nil {
+		verification.problem("%v", err)
+	}
+
+	currentDriver := s.getDatabaseDriver()
+	if manifest == nil {
+		verification.Warnings = append(verification.Warnings, "backup has no manifest, only archive integrity is checked")
+		for _, dbType := range []string{"mysql", "sqlite", portableDBType} {
+			if _, ok := entries[databaseDumpFile(dbType)]; ok {
+				verification.DBType = dbType
+				break
+			}
+		}
+		if verification.DBType == "" {
+			verification.problem("no database dump found in archive")
+		} else if verification.DBType != portableDBType && verification.DBType != currentDriver {
+			verification.problem("backup database is %s but current database is %s", verification.DBType, currentDriver)
+		}
+		if verification.DBType == "sqlite" || verification.DBType == portableDBType {
+			if counts, err := countDumpRows(entries[databaseDumpFile(verification.DBType)].file); err == nil {
+				verification.Tables = counts
+			}
+		}
+		verification.Valid = len(verification.Problems) == 0
+		return verification, nil
+	}
+
+	verification.HasManifest = true
+	verification.SchemaVersion = manifest.SchemaVersion
+	if verification.SchemaVersion == 0 {
+		verification.SchemaVersion = 1
+	}
+	verification.AppVersion = manifest.AppVersion
+	verification.DBType = manifest.DBType
+	verification.Tables = manifest.Tables
+
+	if manifest.SchemaVersion > manifestSchemaVersion {
+		verification.problem("manifest schema version %d is newer than supported version %d", manifest.SchemaVersion, manifestSchemaVersion)
+	}
+	if manifest.DatabaseVersion > migrations.Latest() {
+		verification.problem("database schema version %d is newer than supported version %d", manifest.DatabaseVersion, migrations.Latest())
+	}
+	if manifest.DBType != "" && manifest.DBType != portableDBType && manifest.DBType != currentDriver {
+		verification.problem("backup database is %s but current database is %s", manifest.DBType, currentDriver)
+	}
+
+	if manifest.Database != nil {
+		entry, ok := entries[manifest.Database.Path]
+		switch {
+		case !ok:
+			verification.problem("database dump %s is missing", manifest.Database.Path)
+		case entry.size != manifest.Database.Size || entry.sha256 != manifest.Database.SHA256:
+			verification.problem("database dump %s checksum mismatch", manifest.Database.Path)
+		case manifest.Tables != nil && (manifest.DBType == "sqlite" || manifest.SchemaVersion >= 3):
+			// 内置导出每行一条数据，可以核对行数；旧版本的 MySQL 备份由 mysqldump 导出，无法按行统计
+			counts, err := countDumpRows(entry.file)
+			if err != nil {
+				verification.problem("read database dump failed: %v", err)
+				break
+			}
+			for table, want := range manifest.Tables {
+				if counts[table] != want {
+					verification.problem("table %s has %d rows in dump, manifest records %d", table, counts[table], want)
+				}
+			}
+		}
+	}
+
+	referenced := make(map[uint]bool)
+	for _, file := range manifest.Files {
+		if file.BackupID != manifest.BackupID {
+			verification.ReferencedFiles++
+			referenced[file.BackupID] = true
+			continue
+		}
+		entry, ok := entries[file.archivePath()]
+		if !ok {
+			verification.problem("file %s is missing", file.archivePath())
+			continue
+		}
+		if entry.size != file.Size || entry.sha256 != file.SHA256 {
+			verification.problem("file %s checksum mismatch", file.archivePath())
+			continue
+		}
+		verification.CheckedFiles++
+	}
+
+	if len(referenced) > 0 {
+		if manifest.BackupID != task.ID {
+			verification.problem("backup references backups from another system and cannot be restored here")
+		} else {
+			ids := make([]uint, 0, len(referenced))
+			for id := range referenced {
+				ids = append(ids, id)
+			}
+			var count int64
+			if err := s.db.Model(&models.BackupTask{}).Where("id IN ? AND status = ?", ids, "completed").Count(&count).Error; err != nil {
+				verification.problem("check backup chain failed: %v", err)
+			} else if int(count) != len(ids) {
+				verification.problem("%d backups in the backup chain are missing", len(ids)-int(count))
+			}
+		}
+	}
+
+	verification.Valid = len(verification.Problems) == 0
+	return verification, manifest
+}
+
+func databaseDumpFile(dbType string) string {
+	if dbType == portableDBType {
+		return portableDumpFile
+	}
+	return fmt.Sprintf("database_%s.sql", dbType)
+}
+
+func hashZipFile(file *zip.File) (int64, string, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return 0, "", err
+	}
+	defer reader.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, reader)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// countDumpRows 统计导出文件中每个表的数据行数
+// 支持每行一条的 INSERT 语句、每行一条数据的多行 INSERT 语句和可移植格式
+func countDumpRows(file *zip.File) (map[string]int64, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if file.Name == portableDumpFile {
+		return countPortableRows(reader)
+	}
+
+	counts := make(map[string]int64)
+	// table 为当前多行 INSERT 语句的表名
+	table := ""
+	bufReader := bufio.NewReader(reader)
+	for {
+		line, err := bufReader.ReadString('\n')
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "INSERT INTO "):
+			rest := strings.TrimPrefix(trimmed, "INSERT INTO ")
+			if end := strings.IndexByte(rest, ' '); end > 0 {
+				name := strings.Trim(rest[:end], "`\"")
+				if strings.HasSuffix(trimmed, " VALUES") {
+					table = name
+				} else {
+					counts[name]++
+				}
+			}
+		case table != "" && strings.HasPrefix(trimmed, "("):
+			counts[table]++
+			if strings.HasSuffix(trimmed, ";") {
+				table = ""
+			}
+		}
+		if err == io.EOF {
+			return counts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RestorePlan 恢复预演结果，列出恢复后会发生的变化，不会修改任何数据
+type RestorePlan struct {
+	BackupID     uint                `json:"backup_id"`
+	Verification *BackupVerification `json:"verification"`
+	Tables       []TableChange       `json:"tables"`
+	Files        FileChanges         `json:"files"`         // 上传目录中文件的变化
+	StorageFiles map[string]int      `json:"storage_files"` // 需要写入远程存储的文件数，按目标存储名称统计
+}
+
+// TableChange 数据表在恢复前后的行数
+type TableChange struct {
+	Table   string `json:"table"`
+	Current int64  `json:"current"`
+	Backup  int64  `json:"backup"`
+}
+
+// FileChanges 上传目录的文件变化，路径列表最多列出 restorePlanSampleSize 个
+type FileChanges struct {
+	Added        int      `json:"added"`
+	Changed      int      `json:"changed"`
+	Removed      int      `json:"removed"`
+	Unchanged    int      `json:"unchanged"`
+	AddedFiles   []string `json:"added_files,omitempty"`
+	ChangedFiles []string `json:"changed_files,omitempty"`
+	RemovedFiles []string `json:"removed_files,omitempty"`
+}
+
+const restorePlanSampleSize = 100
+
+func appendSample(samples []string, name string) []string {
+	if len(samples) < restorePlanSampleSize {
+		samples = append(samples, name)
+	}
+	return samples
+}
+
+// PlanRestore 预演恢复：校验备份，并与当前的数据库和上传目录比较，报告恢复会带来的变化
+func (s *BackupService) PlanRestore(ctx context.Context, backupID uint, storageMap map[string]string, passphrase string) (*RestorePlan, error) {
+	task, err := s.GetBackupTaskByID(backupID)
+	if err != nil {
+		return nil, err
+	}
+	if task.Status != "completed" {
+		return nil, cerrors.ErrBackupTaskNotCompleted
+	}
+
+	archivePath, cleanup, err := s.openArchive(ctx, task, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	zipFile, err := zip.OpenReader(archivePath)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Open backup %d failed: %v", backupID, err)
+		return nil, cerrors.ErrBackupCorrupted
+	}
+	defer zipFile.Close()
+
+	verification, manifest := s.verifyArchive(task, &zipFile.Reader)
+	plan := &RestorePlan{
+		BackupID:     backupID,
+		Verification: verification,
+		StorageFiles: make(map[string]int),
+	}
+
+	for _, table := range backupDatabaseTables {
+		change := TableChange{Table: table, Backup: verification.Tables[table]}
+		if err := s.db.Table(table).Count(&change.Current).Error; err != nil {
+			log.Ctx(ctx).Errorf("Count rows of table %s failed: %v", table, err)
+		}
+		plan.Tables = append(plan.Tables, change)
+	}
+
+	// 备份中的上传文件，没有清单时按归档中的文件统计
+	backupFiles := make(map[string]ManifestFile)
+	if manifest != nil {
+		for _, file := range manifest.Files {
+			if strings.HasPrefix(file.Path, "uploads/") {
+				backupFiles[strings.TrimPrefix(file.Path, "uploads/")] = file
+			}
+		}
+	} else {
+		for _, file := range zipFile.File {
+			if strings.HasPrefix(file.Name, "uploads/") && !file.FileInfo().IsDir() {
+				backupFiles[strings.TrimPrefix(file.Name, "uploads/")] = ManifestFile{Size: int64(file.UncompressedSize64)}
+			}
+		}
+	}
+	if err := s.compareUploadDir(backupFiles, &plan.Files); err != nil {
+		log.Ctx(ctx).Errorf("Compare upload dir failed: %v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+
+	if err := planStorageFiles(&zipFile.Reader, storageMap, plan.StorageFiles); err != nil {
+		plan.Verification.problem("%v", err)
+		plan.Verification.Valid = false
+	}
+
+	return plan, nil
+}
+
+// compareUploadDir 比较备份中的文件与当前上传目录，大小相同且备份记录了哈希时比较哈希
+func (s *BackupService) compareUploadDir(backupFiles map[string]ManifestFile, changes *FileChanges) error {
+	uploadDir := filepath.Clean(strings.Trim(s.serverConfig.UploadDir, "/"))
+	current := make(map[string]int64)
+	err := filepath.Walk(uploadDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == uploadDir {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(uploadDir, path)
+		if err != nil {
+			return err
+		}
+		current[filepath.ToSlash(relPath)] = info.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(backupFiles))
+	for name := range backupFiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := backupFiles[name]
+		size, ok := current[name]
+		switch {
+		case !ok:
+			changes.Added++
+			changes.AddedFiles = appendSample(changes.AddedFiles, name)
+		case size != file.Size || (file.SHA256 != "" && !fileHashEquals(filepath.Join(uploadDir, filepath.FromSlash(name)), file.SHA256)):
+			changes.Changed++
+			changes.ChangedFiles = appendSample(changes.ChangedFiles, name)
+		default:
+			changes.Unchanged++
+		}
+	}
+
+	removed := make([]string, 0)
+	for name := range current {
+		if _, ok := backupFiles[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	changes.Removed = len(removed)
+	for _, name := range removed {
+		changes.RemovedFiles = appendSample(changes.RemovedFiles, name)
+	}
+	return nil
+}
+
+func fileHashEquals(filePath, sum string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return false
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == sum
+}
+
+// planStorageFiles 按 storage_map.json 统计需要写入各远程存储的文件数
+func planStorageFiles(zipReader *zip.Reader, storageOverrides map[string]string, counts map[string]int) error {
+	for _, file := range zipReader.File {
+		if file.Name != storageMapFile {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		var storageMap StorageMap
+		if err := json.NewDecoder(reader).Decode(&storageMap); err != nil {
+			return fmt.Errorf("invalid %s: %w", storageMapFile, err)
+		}
+		for _, entry := range storageMap.Files {
+			target := entry.Storage
+			if override, ok := storageOverrides[entry.Storage]; ok {
+				target = override
+			}
+			// 原存储为本地存储且不迁移时，文件随上传目录恢复
+			if target == entry.Storage && strings.HasPrefix(entry.FilePath, "uploads/") {
+				continue
+			}
+			for _, archivePath := range []string{entry.FilePath, entry.ThumbnailPath} {
+				if archivePath != "" {
+					counts[target]++
+				}
+			}
+		}
+		return nil
+	}
+	return nil
+}
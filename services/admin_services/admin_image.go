@@ -1,6 +1,7 @@
 package admin_services
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/leleo886/lopic/internal/config"
@@ -21,14 +22,14 @@ func NewImageService(db *gorm.DB, cfg *config.Config) *ImageService {
 	return &ImageService{db: db, cfg: cfg}
 }
 
-func (s *ImageService) GetAllImages(page, pageSize, offset int, searchkey, field, value, orderby, order string) (*services.GetImagesResponse, error) {
+func (s *ImageService) GetAllImages(ctx context.Context, page, pageSize, offset int, searchkey, field, value, orderby, order string) (*services.GetImagesResponse, error) {
 	var imageModels []models.Image
 	var total int64
 
 	db := s.db.Model(&imageModels)
-	if searchkey != "" {
-		sk := fmt.Sprintf("%%%s%%", searchkey)
-		db = db.Where("original_name LIKE ? OR tags LIKE ?", sk, sk)
+	db, err := services.ApplySearchQuery(db, searchkey)
+	if err != nil {
+		return nil, err
 	}
 	// 按字段值过滤
 	if field != "" && value != "" {
@@ -50,11 +51,12 @@ func (s *ImageService) GetAllImages(page, pageSize, offset int, searchkey, field
 	res := db.Preload("Albums").Offset(offset).Limit(pageSize).
 		Order(fmt.Sprintf("%s %s", orderby, order)).Find(&imageModels)
 	if res.Error != nil {
-		log.Errorf("failed to get images: error=%v", res.Error)
+		log.Ctx(ctx).Errorf("failed to get images: error=%v", res.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
 	images := services.MakeImagesWithAlbum(imageModels)
+	services.HighlightImages(searchkey, images)
 
 	return &services.GetImagesResponse{
 		Images:   images,
@@ -73,7 +75,8 @@ func (s *ImageService) GetImage(id uint) (*services.ImageResponse, error) {
 	return &imageResponse, nil
 }
 
-func (s *ImageService) DeleteImage(id uint) error {
+// DeleteImage 将图片移入所属用户的回收站
+func (s *ImageService) DeleteImage(ctx context.Context, id uint) error {
 	// 使用事务处理删除操作
 	tx := s.db.Begin()
 	defer func() {
@@ -89,62 +92,14 @@ func (s *ImageService) DeleteImage(id uint) error {
 		return cerrors.ErrImageNotFound
 	}
 
-	// Get all albums that the image belongs to
-	var albums []models.Album
-	tx.Model(&imageModel).Association("Albums").Find(&albums)
-
-	// Remove the image from each album
-	tx.Model(&imageModel).Association("Albums").Clear()
-
-	// Update image_count for each album
-	for _, album := range albums {
-		if err := tx.Model(&album).Update("image_count", album.ImageCount-1).Error; err != nil {
-			tx.Rollback()
-			log.Errorf("failed to update album image count: error=%v", err)
-			return cerrors.ErrInternalServer
-		}
-	}
-
-	// 更新用户的存储空间使用情况
-	result := tx.Model(&models.User{}).Where("id = ?", imageModel.UserID).
-		Updates(map[string]interface{}{
-			"total_size":  gorm.Expr("total_size - ?", imageModel.FileSize+imageModel.ThumbnailSize),
-			"image_count": gorm.Expr("image_count - ?", 1),
-		})
-	if result.Error != nil {
-		tx.Rollback()
-		log.Errorf("failed to update user storage usage: id=%d, error=%v", imageModel.UserID, result.Error)
-		return cerrors.ErrInternalServer
-	}
-
-	// 删除数据库中的图片记录
-	res := tx.Delete(&imageModel)
-	if res.Error != nil {
+	if err := services.TrashImage(tx, &imageModel); err != nil {
 		tx.Rollback()
-		log.Errorf("failed to delete image: id=%d, error=%v", id, res.Error)
-		return cerrors.ErrInternalServer
+		return err
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("failed to commit transaction: %v", err)
-		return cerrors.ErrInternalServer
-	}
-
-	// 获取用户对应的存储实例
-	storageInstance, err := s.getStorageByStorageName(imageModel.StorageName)
-	if err != nil {
-		return err
-	}
-
-	// Delete the image from storage
-	if err := storageInstance.DeleteFile(imageModel.FileURL); err != nil {
-		log.Errorf("failed to delete image file: id=%d, error=%v", id, err)
-		return cerrors.ErrInternalServer
-	}
-
-	if err := storageInstance.DeleteFile(imageModel.ThumbnailURL); err != nil {
-		log.Errorf("failed to delete image thumbnail: id=%d, error=%v", id, err)
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
@@ -164,7 +119,7 @@ func (s *ImageService) getStorageByStorageName(storageName string) (storage.Stor
 }
 
 // UpdateImageStorage 更新图片存储名称
-func (s *ImageService) UpdateImageStorage(id uint, storageName string) error {
+func (s *ImageService) UpdateImageStorage(ctx context.Context, id uint, storageName string) error {
 	var imageModel models.Image
 	if err := s.db.First(&imageModel, id).Error; err != nil {
 		return cerrors.ErrImageNotFound
@@ -179,7 +134,7 @@ func (s *ImageService) UpdateImageStorage(id uint, storageName string) error {
 	// 更新存储名称
 	imageModel.StorageName = storageName
 	if err := s.db.Save(&imageModel).Error; err != nil {
-		log.Errorf("failed to update image storage: id=%d, error=%v", id, err)
+		log.Ctx(ctx).Errorf("failed to update image storage: id=%d, error=%v", id, err)
 		return cerrors.ErrInternalServer
 	}
 
@@ -0,0 +1,65 @@
+package admin_services
+
+import (
+	"context"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+type JobService struct {
+	db    *gorm.DB
+	queue *queue.Queue
+}
+
+func NewJobService(db *gorm.DB, q *queue.Queue) *JobService {
+	return &JobService{db: db, queue: q}
+}
+
+type GetJobsResponse struct {
+	Jobs     []models.Job `json:"jobs"`
+	Page     int          `json:"page"`
+	PageSize int          `json:"page_size"`
+	Total    int64        `json:"total"`
+}
+
+// GetJobs 获取后台任务列表，按创建时间倒序，status 和 jobType 为空时不过滤
+func (s *JobService) GetJobs(ctx context.Context, page, pageSize int, status, jobType string) (*GetJobsResponse, error) {
+	query := s.db.Model(&models.Job{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to count jobs: error=%v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+	var jobs []models.Job
+	if err := query.Order("id desc").Limit(pageSize).Offset((page - 1) * pageSize).Find(&jobs).Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to get jobs: error=%v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+	return &GetJobsResponse{
+		Jobs:     jobs,
+		Page:     page,
+		PageSize: pageSize,
+		Total:    total,
+	}, nil
+}
+
+// CancelJob 取消等待中或执行中的任务
+func (s *JobService) CancelJob(id uint) (*models.Job, error) {
+	return s.queue.Cancel(id)
+}
+
+// RetryJob 重新执行失败或已取消的任务
+func (s *JobService) RetryJob(id uint) (*models.Job, error) {
+	return s.queue.Retry(id)
+}
@@ -1,7 +1,9 @@
 package admin_services
 
 import (
+	"context"
 	"fmt"
+	"github.com/leleo886/lopic/internal/database"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/models"
@@ -28,17 +30,17 @@ type RoleRequest struct {
 	StorageName       string                     `json:"storage_name"`
 }
 
-func (s *RoleService) GetRoles(page, pageSize, offset int, searchkey, orderby, order string) (*[]models.Role, error) {
+func (s *RoleService) GetRoles(ctx context.Context, page, pageSize, offset int, searchkey, orderby, order string) (*[]models.Role, error) {
 	var roles []models.Role
 	query := s.db
 	if searchkey != "" {
 		sk := fmt.Sprintf("%%%s%%", searchkey)
-		query = query.Where("name LIKE ? OR description LIKE ? OR allowed_extensions LIKE ?", sk, sk, sk)
+		query = query.Where(fmt.Sprintf("name %[1]s ? OR description %[1]s ? OR %[2]s %[1]s ?", database.Like(s.db), database.Text(s.db, "allowed_extensions")), sk, sk, sk)
 	}
 	result := query.Limit(pageSize).Offset(offset).
 		Order(fmt.Sprintf("%s %s", orderby, order)).Find(&roles)
 	if result.Error != nil {
-		log.Errorf("failed to get roles: error=%v", result.Error)
+		log.Ctx(ctx).Errorf("failed to get roles: error=%v", result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 	return &roles, nil
@@ -53,7 +55,7 @@ func (s *RoleService) GetRole(id int) (*models.Role, error) {
 	return &role, nil
 }
 
-func (s *RoleService) CreateRole(role *models.Role) error {
+func (s *RoleService) CreateRole(ctx context.Context, role *models.Role) error {
 	// 先检查 name 是否已存在
 	var existingRole models.Role
 	result := s.db.Where("name = ?", role.Name).First(&existingRole)
@@ -70,13 +72,13 @@ func (s *RoleService) CreateRole(role *models.Role) error {
 
 	result = s.db.Create(role)
 	if result.Error != nil {
-		log.Errorf("failed to create role: error=%v", result.Error)
+		log.Ctx(ctx).Errorf("failed to create role: error=%v", result.Error)
 		return cerrors.ErrInternalServer
 	}
 	return nil
 }
 
-func (s *RoleService) UpdateRole(id uint, role *RoleRequest) error {
+func (s *RoleService) UpdateRole(ctx context.Context, id uint, role *RoleRequest) error {
 	var existingRole models.Role
 	result := s.db.Where("id = ?", id).First(&existingRole)
 	if result.Error != nil {
@@ -108,13 +110,13 @@ func (s *RoleService) UpdateRole(id uint, role *RoleRequest) error {
 
 	result = s.db.Save(&existingRole)
 	if result.Error != nil {
-		log.Errorf("failed to update role: id=%d, error=%v", id, result.Error)
+		log.Ctx(ctx).Errorf("failed to update role: id=%d, error=%v", id, result.Error)
 		return cerrors.ErrInternalServer
 	}
 	return nil
 }
 
-func (s *RoleService) DeleteRole(id uint) error {
+func (s *RoleService) DeleteRole(ctx context.Context, id uint) error {
 	var existingRole models.Role
 	result := s.db.Where("id = ?", id).First(&existingRole)
 	if result.Error != nil {
@@ -135,17 +137,17 @@ func (s *RoleService) DeleteRole(id uint) error {
 	// 删除角色
 	result = s.db.Delete(&existingRole)
 	if result.Error != nil {
-		log.Errorf("failed to delete role: id=%d, error=%v", id, result.Error)
+		log.Ctx(ctx).Errorf("failed to delete role: id=%d, error=%v", id, result.Error)
 		return cerrors.ErrInternalServer
 	}
 	return nil
 }
 
-func (s *RoleService) GetUsersCountByRole() (map[string]int, error) {
+func (s *RoleService) GetUsersCountByRole(ctx context.Context) (map[string]int, error) {
 	var users []models.User
 	result := s.db.Model(&models.User{}).Preload("Role").Find(&users)
 	if result.Error != nil {
-		log.Errorf("failed to get users count by role: error=%v", result.Error)
+		log.Ctx(ctx).Errorf("failed to get users count by role: error=%v", result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
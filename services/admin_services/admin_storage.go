@@ -1,8 +1,11 @@
 package admin_services
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/database"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/internal/storage"
@@ -24,17 +27,17 @@ type StorageRequest struct {
 	Config models.StorageConfig `json:"config"`
 }
 
-func (s *StorageService) GetStorages(page, pageSize, offset int, searchkey, orderby, order string) (*[]models.Storage, error) {
+func (s *StorageService) GetStorages(ctx context.Context, page, pageSize, offset int, searchkey, orderby, order string) (*[]models.Storage, error) {
 	var storages []models.Storage
 	query := s.db
 	if searchkey != "" {
 		sk := fmt.Sprintf("%%%s%%", searchkey)
-		query = query.Where("name LIKE ? OR type LIKE ?", sk, sk)
+		query = query.Where(fmt.Sprintf("name %[1]s ? OR type %[1]s ?", database.Like(s.db)), sk, sk)
 	}
 	result := query.Limit(pageSize).Offset(offset).
 		Order(fmt.Sprintf("%s %s", orderby, order)).Find(&storages)
 	if result.Error != nil {
-		log.Errorf("failed to get storages: error=%v", result.Error)
+		log.Ctx(ctx).Errorf("failed to get storages: error=%v", result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 	return &storages, nil
@@ -58,7 +61,7 @@ func (s *StorageService) GetStorageByName(name string) (*models.Storage, error)
 	return &storage, nil
 }
 
-func (s *StorageService) CreateStorage(storageReq *StorageRequest) error {
+func (s *StorageService) CreateStorage(ctx context.Context, storageReq *StorageRequest) error {
 	// 检查 name 是否已存在
 	var existingStorage models.Storage
 	result := s.db.Where("name = ?", storageReq.Name).First(&existingStorage)
@@ -85,13 +88,13 @@ func (s *StorageService) CreateStorage(storageReq *StorageRequest) error {
 
 	result = s.db.Create(storage)
 	if result.Error != nil {
-		log.Errorf("failed to create storage: error=%v", result.Error)
+		log.Ctx(ctx).Errorf("failed to create storage: error=%v", result.Error)
 		return cerrors.ErrInternalServer
 	}
 	return nil
 }
 
-func (s *StorageService) UpdateStorage(id uint, storageReq *StorageRequest) error {
+func (s *StorageService) UpdateStorage(ctx context.Context, id uint, storageReq *StorageRequest) error {
 	var existingStorage models.Storage
 	result := s.db.Where("id = ?", id).First(&existingStorage)
 	if result.Error != nil {
@@ -138,7 +141,7 @@ func (s *StorageService) UpdateStorage(id uint, storageReq *StorageRequest) erro
 
 	result = s.db.Save(&existingStorage)
 	if result.Error != nil {
-		log.Errorf("failed to update storage: id=%d, error=%v", id, result.Error)
+		log.Ctx(ctx).Errorf("failed to update storage: id=%d, error=%v", id, result.Error)
 		return cerrors.ErrInternalServer
 	}
 	return nil
@@ -176,7 +179,7 @@ func (s *StorageService) TestStorageConnection(storageReq *StorageRequest) error
 	return storageInstance.TestConnection()
 }
 
-func (s *StorageService) DeleteStorage(id uint) error {
+func (s *StorageService) DeleteStorage(ctx context.Context, id uint) error {
 	var existingStorage models.Storage
 	result := s.db.Where("id = ?", id).First(&existingStorage)
 	if result.Error != nil {
@@ -202,10 +205,25 @@ func (s *StorageService) DeleteStorage(id uint) error {
 		return cerrors.ErrStorageAssociatedWithImages
 	}
 
+	// 检查是否作为备份目标或存有备份
+	settings, err := config.LoadSystemSettingsFromDatabase(s.db)
+	if err != nil {
+		log.Ctx(ctx).Errorf("failed to load system settings: error=%v", err)
+		return cerrors.ErrInternalServer
+	}
+	if settings.Backup.Destination == existingStorage.Name {
+		return cerrors.ErrStorageAssociatedWithBackups
+	}
+	var backupCount int64
+	s.db.Model(&models.BackupTask{}).Where("location = ?", existingStorage.Name).Count(&backupCount)
+	if backupCount > 0 {
+		return cerrors.ErrStorageAssociatedWithBackups
+	}
+
 	// 删除存储
 	result = s.db.Delete(&existingStorage)
 	if result.Error != nil {
-		log.Errorf("failed to delete storage: id=%d, error=%v", id, result.Error)
+		log.Ctx(ctx).Errorf("failed to delete storage: id=%d, error=%v", id, result.Error)
 		return cerrors.ErrInternalServer
 	}
 	return nil
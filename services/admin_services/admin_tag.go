@@ -0,0 +1,76 @@
+package admin_services
+
+import (
+	"context"
+	"strings"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/models"
+	"github.com/leleo886/lopic/services"
+	"gorm.io/gorm"
+)
+
+type TagService struct {
+	db *gorm.DB
+}
+
+func NewTagService(db *gorm.DB) *TagService {
+	return &TagService{db: db}
+}
+
+// GetAllTags 按前缀获取所有用户的标签，同名标签合并计数
+func (s *TagService) GetAllTags(ctx context.Context, prefix string, limit int) ([]services.TagCloudItem, error) {
+	items, err := services.TagCloud(s.db, 0, prefix, limit)
+	if err != nil {
+		log.Ctx(ctx).Errorf("failed to get tags: error=%v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+	return items, nil
+}
+
+// RenameTag 重命名所有用户的同名标签
+func (s *TagService) RenameTag(ctx context.Context, oldName, newName string) (*services.MergeTagsResult, error) {
+	return s.MergeTags(ctx, []string{oldName}, newName)
+}
+
+// MergeTags 将所有用户的源标签合并到目标标签，每个用户的标签分别合并
+func (s *TagService) MergeTags(ctx context.Context, sources []string, target string) (*services.MergeTagsResult, error) {
+	var userIDs []uint
+	result := s.db.Model(&models.Tag{}).
+		Where("name IN ?", sources).
+		Distinct("user_id").
+		Pluck("user_id", &userIDs)
+	if result.Error != nil {
+		log.Ctx(ctx).Errorf("failed to find tag users: error=%v", result.Error)
+		return nil, cerrors.ErrInternalServer
+	}
+	if len(userIDs) == 0 {
+		return nil, cerrors.ErrTagNotFound
+	}
+
+	tx := s.db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	total := 0
+	for _, userID := range userIDs {
+		images, err := services.MergeUserTags(tx, userID, sources, target)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		total += images
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+
+	return &services.MergeTagsResult{Target: strings.TrimSpace(target), Images: total}, nil
+}
@@ -1,16 +1,16 @@
 package admin_services
 
 import (
+	"context"
 	"fmt"
-	"sort"
 
 	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/database"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/internal/storage"
 	"github.com/leleo886/lopic/models"
 	"github.com/leleo886/lopic/services"
-	"github.com/leleo886/lopic/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -40,17 +40,17 @@ type GetUsersResponse struct {
 	Total    int64         `json:"total"`
 }
 
-func (s *UserService) GetUsers(page, pageSize, offset int, searchkey, orderby, order string) (*GetUsersResponse, error) {
+func (s *UserService) GetUsers(ctx context.Context, page, pageSize, offset int, searchkey, orderby, order string) (*GetUsersResponse, error) {
 	var users []models.User
 	query := s.db.Preload("Role")
 	if searchkey != "" {
 		sk := fmt.Sprintf("%%%s%%", searchkey)
-		query = query.Where("username LIKE ? OR email LIKE ?", sk, sk)
+		query = query.Where(fmt.Sprintf("username %[1]s ? OR email %[1]s ?", database.Like(s.db)), sk, sk)
 	}
 	result := query.Limit(pageSize).Offset(offset).
 		Order(fmt.Sprintf("%s %s", orderby, order)).Find(&users)
 	if result.Error != nil {
-		log.Errorf("failed to get users: error=%v", result.Error)
+		log.Ctx(ctx).Errorf("failed to get users: error=%v", result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 	return &GetUsersResponse{
@@ -132,7 +132,7 @@ func (s *UserService) CreateUser(req UserRequest) error {
 	return nil
 }
 
-func (s *UserService) UpdateUser(id int, currentUserID uint, req UserRequest) (*models.User, error) {
+func (s *UserService) UpdateUser(ctx context.Context, id int, currentUserID uint, req UserRequest) (*models.User, error) {
 	tx := s.db.Begin() // 开启事务
 	defer func() {
 		if r := recover(); r != nil {
@@ -195,7 +195,7 @@ func (s *UserService) UpdateUser(id int, currentUserID uint, req UserRequest) (*
 	result = tx.Save(&user)
 	if result.Error != nil {
 		tx.Rollback()
-		log.Errorf("failed to update user: id=%d, error=%v", id, result.Error)
+		log.Ctx(ctx).Errorf("failed to update user: id=%d, error=%v", id, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -204,7 +204,7 @@ func (s *UserService) UpdateUser(id int, currentUserID uint, req UserRequest) (*
 	return &user, nil
 }
 
-func (s *UserService) DeleteUser(id int) error {
+func (s *UserService) DeleteUser(ctx context.Context, id int) error {
 	// 使用事务处理删除操作
 	tx := s.db.Begin()
 	defer func() {
@@ -226,10 +226,10 @@ func (s *UserService) DeleteUser(id int) error {
 		return cerrors.ErrCannotDeleteAdminUser
 	}
 
-	// 查询用户所有关联的相册
+	// 查询用户所有关联的相册（包括回收站中的相册和图片）
 	var albums []models.Album
 	var images []models.Image
-	result = tx.Where("user_id = ?", id).Find(&albums)
+	result = tx.Unscoped().Where("user_id = ?", id).Find(&albums)
 	if result.Error != nil {
 		tx.Rollback()
 		return cerrors.ErrFailedToDeleteUser
@@ -239,27 +239,44 @@ func (s *UserService) DeleteUser(id int) error {
 	for _, album := range albums {
 		if err := tx.Model(&album).Association("Images").Clear(); err != nil {
 			tx.Rollback()
-			log.Errorf("failed to clear album images association: album_id=%d, error=%v", album.ID, err)
+			log.Ctx(ctx).Errorf("failed to clear album images association: album_id=%d, error=%v", album.ID, err)
 			return cerrors.ErrFailedToDeleteUser
 		}
 	}
 
 	// 删除用户所有关联的相册
-	result = tx.Where("user_id = ?", id).Delete(&models.Album{})
+	result = tx.Unscoped().Where("user_id = ?", id).Delete(&models.Album{})
 	if result.Error != nil {
 		tx.Rollback()
 		return cerrors.ErrFailedToDeleteUser
 	}
 
 	// 查询用户的所有图片（在事务内查询，确保一致性）
-	result = tx.Where("user_id = ?", id).Find(&images)
+	result = tx.Unscoped().Where("user_id = ?", id).Find(&images)
+	if result.Error != nil {
+		tx.Rollback()
+		return cerrors.ErrFailedToDeleteUser
+	}
+
+	// 删除用户的标签及图片标签关联
+	result = tx.Where("tag_id IN (?)", tx.Model(&models.Tag{}).Select("id").Where("user_id = ?", id)).Delete(&models.ImageTag{})
+	if result.Error != nil {
+		tx.Rollback()
+		return cerrors.ErrFailedToDeleteUser
+	}
+	result = tx.Where("user_id = ?", id).Delete(&models.Tag{})
+	if result.Error != nil {
+		tx.Rollback()
+		return cerrors.ErrFailedToDeleteUser
+	}
+	result = tx.Where("user_id = ?", id).Delete(&models.SearchDocument{})
 	if result.Error != nil {
 		tx.Rollback()
 		return cerrors.ErrFailedToDeleteUser
 	}
 
 	// 删除用户的所有图片记录（在事务内删除，防止并发问题）
-	result = tx.Where("user_id = ?", id).Delete(&models.Image{})
+	result = tx.Unscoped().Where("user_id = ?", id).Delete(&models.Image{})
 	if result.Error != nil {
 		tx.Rollback()
 		return cerrors.ErrFailedToDeleteUser
@@ -274,7 +291,7 @@ func (s *UserService) DeleteUser(id int) error {
 
 	// 提交事务（所有数据库操作完成）
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("failed to commit transaction: %v", err)
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
 		return cerrors.ErrFailedToDeleteUser
 	}
 
@@ -285,16 +302,17 @@ func (s *UserService) DeleteUser(id int) error {
 		for _, image := range images {
 			storageInstance, err := s.getStorageByStorageName(image.StorageName)
 			if err != nil {
-				log.Errorf("failed to get storage instance: storage_name=%s, error=%v", image.StorageName, err)
+				log.Ctx(ctx).Errorf("failed to get storage instance: storage_name=%s, error=%v", image.StorageName, err)
 				continue
 			}
+			storageInstance = storage.WithTracing(ctx, storageInstance, image.StorageName)
 
 			if err := storageInstance.DeleteFile(image.FileURL); err != nil {
-				log.Errorf("failed to delete image file: user_id=%d, image_id=%d, error=%v", image.UserID, image.ID, err)
+				log.Ctx(ctx).Errorf("failed to delete image file: user_id=%d, image_id=%d, error=%v", image.UserID, image.ID, err)
 			}
 
 			if err := storageInstance.DeleteFile(image.ThumbnailURL); err != nil {
-				log.Errorf("failed to delete thumbnail file: user_id=%d, image_id=%d, error=%v", image.UserID, image.ID, err)
+				log.Ctx(ctx).Errorf("failed to delete thumbnail file: user_id=%d, image_id=%d, error=%v", image.UserID, image.ID, err)
 			}
 		}
 	}(images)
@@ -314,33 +332,12 @@ func (s *UserService) getStorageByStorageName(storageName string) (storage.Stora
 	return storage.NewStorageByStorageName(&storageConfig, &s.cfg.Server), nil
 }
 
-func (s *UserService) GetAllImagesTagsCloud() ([]services.TagCloudItem, error) {
-	// 1. 找到所有用户上传的图片的标签数组
-	var images []models.Image
-	result := s.db.Model(&models.Image{}).
-		Where("tags IS NOT NULL AND tags != ''").
-		Find(&images)
-
-	if result.Error != nil {
-		return nil, result.Error
-	}
-
-	// 2. 统计标签出现次数
-	tagsCount := utils.WordCount(images)
-
-	// 3. 转换为 TagCloudItem 切片
-	var tagCloudItems []services.TagCloudItem
-	for tag, count := range tagsCount {
-		tagCloudItems = append(tagCloudItems, services.TagCloudItem{
-			Tag:   tag,
-			Count: count,
-		})
+func (s *UserService) GetAllImagesTagsCloud(ctx context.Context) ([]services.TagCloudItem, error) {
+	tagCloudItems, err := services.TagCloud(s.db, 0, "", 0)
+	if err != nil {
+		log.Ctx(ctx).Errorf("failed to get tags cloud: error=%v", err)
+		return nil, cerrors.ErrInternalServer
 	}
 
-	// 按数量降序排序
-	sort.Slice(tagCloudItems, func(i, j int) bool {
-		return tagCloudItems[i].Count > tagCloudItems[j].Count
-	})
-
 	return tagCloudItems, nil
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"time"
 
 	cerrors "github.com/leleo886/lopic/internal/error"
@@ -18,16 +19,17 @@ func NewAlbumService(db *gorm.DB) *AlbumService {
 }
 
 type AlbumResponse struct {
-	ID             uint      `json:"id"`
-	UserID         uint      `json:"user_id"`
-	Name           string    `json:"name"`
-	Description    string    `json:"description"`
-	CoverImage     string    `json:"cover_image"`
-	ImageCount     int       `json:"image_count"`
-	GalleryEnabled bool      `json:"gallery_enabled"`
-	SerialNumber   int       `json:"serial_number"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	ID             uint       `json:"id"`
+	UserID         uint       `json:"user_id"`
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	CoverImage     string     `json:"cover_image"`
+	ImageCount     int        `json:"image_count"`
+	GalleryEnabled bool       `json:"gallery_enabled"`
+	SerialNumber   int        `json:"serial_number"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
 }
 
 type GetAlbumsResponse struct {
@@ -44,12 +46,12 @@ type GetAlbumImagesResponse struct {
 	PageSize int             `json:"page_size"`
 }
 
-func (s *AlbumService) CreateAlbum(name string, description string, galleryEnabled bool, userID uint, serialNumber int) (*AlbumResponse, error) {
+func (s *AlbumService) CreateAlbum(ctx context.Context, name string, description string, galleryEnabled bool, userID uint, serialNumber int) (*AlbumResponse, error) {
 	// 获取用户角色
 	var user models.User
 	result := s.db.Preload("Role").First(&user, userID)
 	if result.Error != nil {
-		log.Errorf("failed to get user: id=%d, error=%v", userID, result.Error)
+		log.Ctx(ctx).Errorf("failed to get user: id=%d, error=%v", userID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -61,7 +63,7 @@ func (s *AlbumService) CreateAlbum(name string, description string, galleryEnabl
 	var count int64
 	result = s.db.Model(&models.Album{}).Where("user_id = ?", userID).Count(&count)
 	if result.Error != nil {
-		log.Errorf("failed to count albums: user_id=%d, error=%v", userID, result.Error)
+		log.Ctx(ctx).Errorf("failed to count albums: user_id=%d, error=%v", userID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -83,7 +85,7 @@ func (s *AlbumService) CreateAlbum(name string, description string, galleryEnabl
 
 	result = s.db.Create(&album)
 	if result.Error != nil {
-		log.Errorf("failed to create album: user_id=%d, error=%v", userID, result.Error)
+		log.Ctx(ctx).Errorf("failed to create album: user_id=%d, error=%v", userID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -100,7 +102,7 @@ func (s *AlbumService) CreateAlbum(name string, description string, galleryEnabl
 	}, nil
 }
 
-func (s *AlbumService) GetAlbums(userID uint, page, pageSize, offset int) (*GetAlbumsResponse, error) {
+func (s *AlbumService) GetAlbums(ctx context.Context, userID uint, page, pageSize, offset int) (*GetAlbumsResponse, error) {
 	var albums []AlbumResponse
 	var total int64
 
@@ -108,7 +110,7 @@ func (s *AlbumService) GetAlbums(userID uint, page, pageSize, offset int) (*GetA
 	result.Count(&total)
 	result.Offset(offset).Order("serial_number ASC").Find(&albums)
 	if result.Error != nil {
-		log.Errorf("failed to get albums: user_id=%d, error=%v", userID, result.Error)
+		log.Ctx(ctx).Errorf("failed to get albums: user_id=%d, error=%v", userID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -141,12 +143,12 @@ func (s *AlbumService) GetAlbum(id uint, userID uint) (*AlbumResponse, error) {
 	}, nil
 }
 
-func (s *AlbumService) UpdateAlbum(id uint, userID uint, name string, description string, galleryEnabled bool, serialNumber int) (*AlbumResponse, error) {
+func (s *AlbumService) UpdateAlbum(ctx context.Context, id uint, userID uint, name string, description string, galleryEnabled bool, serialNumber int) (*AlbumResponse, error) {
 	// 获取用户角色
 	var user models.User
 	result := s.db.Preload("Role").First(&user, userID)
 	if result.Error != nil {
-		log.Errorf("failed to get user: id=%d, error=%v", userID, result.Error)
+		log.Ctx(ctx).Errorf("failed to get user: id=%d, error=%v", userID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -167,10 +169,14 @@ func (s *AlbumService) UpdateAlbum(id uint, userID uint, name string, descriptio
 
 	result = s.db.Save(&album)
 	if result.Error != nil {
-		log.Errorf("failed to update album: id=%d, user_id=%d, error=%v", id, userID, result.Error)
+		log.Ctx(ctx).Errorf("failed to update album: id=%d, user_id=%d, error=%v", id, userID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
+	if err := IndexAlbumImages(s.db, album.ID); err != nil {
+		log.Ctx(ctx).Errorf("failed to update search index: album_id=%d, error=%v", album.ID, err)
+	}
+
 	return &AlbumResponse{
 		ID:             album.ID,
 		UserID:         album.UserID,
@@ -185,9 +191,10 @@ func (s *AlbumService) UpdateAlbum(id uint, userID uint, name string, descriptio
 	}, nil
 }
 
-func (s *AlbumService) DeleteAlbum(id uint, userID uint) error {
+// DeleteAlbum 将相册移入回收站，相册中的图片不受影响
+func (s *AlbumService) DeleteAlbum(ctx context.Context, id uint, userID uint) error {
 	// 使用事务处理删除操作
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -202,18 +209,15 @@ func (s *AlbumService) DeleteAlbum(id uint, userID uint) error {
 		return cerrors.ErrAlbumNotFound
 	}
 
-	tx.Model(&album).Association("Images").Clear()
-
-	result = tx.Delete(&album)
-	if result.Error != nil {
+	// 移入回收站，保留图片关联以便恢复
+	if err := TrashAlbum(tx, &album); err != nil {
 		tx.Rollback()
-		log.Errorf("failed to delete album: id=%d, user_id=%d, error=%v", id, userID, result.Error)
-		return cerrors.ErrInternalServer
+		return err
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("failed to commit transaction: %v", err)
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
@@ -253,7 +257,7 @@ func (s *AlbumService) GetNotInAnyAlbum(userID uint, page, pageSize, offset int)
 	var total int64
 
 	db := s.db.Model(&models.Image{}).
-		Joins("LEFT JOIN image_albums ON image_albums.image_id = images.id").
+		Joins("LEFT JOIN image_albums ON image_albums.image_id = images.id AND image_albums.album_id IN (SELECT id FROM albums WHERE deleted_at IS NULL)").
 		Where("image_albums.album_id IS NULL AND images.user_id = ?", userID)
 	db.Count(&total)
 	db.Offset(offset).Limit(pageSize).Order("images.id DESC").Find(&imageModels)
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -40,7 +41,7 @@ func NewAuthService(db *gorm.DB, mailService *mail.MailService, cfg *config.Conf
 	return &AuthService{db: db, mailService: mailService, cfg: cfg}
 }
 
-func (s *AuthService) Register(username, password, email, locale string) (string, error) {
+func (s *AuthService) Register(ctx context.Context, username, password, email, locale string) (string, error) {
 	// 检查用户名是否已存在
 	var existingUser models.User
 	result := s.db.Where("username = ?", username).First(&existingUser)
@@ -86,7 +87,7 @@ func (s *AuthService) Register(username, password, email, locale string) (string
 		verifyLink := fmt.Sprintf("%s/api/auth/verify-email?token=%s", s.mailService.GetServerAddress(), verifyToken)
 		go func() {
 			if err := s.mailService.SendEmailVerification(email, username, verifyLink, locale); err != nil {
-				log.Errorf("failed to send email verification: email=%s, error=%v", email, err)
+				log.Ctx(ctx).Errorf("failed to send email verification: email=%s, error=%v", email, err)
 			}
 		}()
 		return "Register_EmailSent", nil
@@ -137,7 +138,7 @@ func (s *AuthService) Login(username, password string, jwtCfg *config.JWTConfig)
 	}, nil
 }
 
-func (s *AuthService) RequestPasswordReset(email, locale string) error {
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email, locale string) error {
 	if !s.mailService.IsEnabled() {
 		return cerrors.ErrMailServiceDisabled
 	}
@@ -171,7 +172,7 @@ func (s *AuthService) RequestPasswordReset(email, locale string) error {
 	// 异步发送验证码邮件，不阻塞主流程
 	go func() {
 		if err := s.mailService.SendResetPasswordCode(email, code, locale); err != nil {
-			log.Errorf("failed to send reset password code: email=%s, error=%v", email, err)
+			log.Ctx(ctx).Errorf("failed to send reset password code: email=%s, error=%v", email, err)
 		}
 	}()
 
@@ -194,7 +195,7 @@ func (s *AuthService) VerifyPasswordResetCode(email, code string) error {
 	return nil
 }
 
-func (s *AuthService) ResetPassword(email, code, newPassword string) error {
+func (s *AuthService) ResetPassword(ctx context.Context, email, code, newPassword string) error {
 	if !s.mailService.IsEnabled() {
 		return cerrors.ErrMailServiceDisabled
 	}
@@ -209,21 +210,21 @@ func (s *AuthService) ResetPassword(email, code, newPassword string) error {
 	// 验证验证码
 	err := s.VerifyPasswordResetCode(email, code)
 	if err != nil {
-		log.Errorf("failed to verify reset password code: email=%s, error=%v", email, err)
+		log.Ctx(ctx).Errorf("failed to verify reset password code: email=%s, error=%v", email, err)
 		return cerrors.ErrInvalidResetCode
 	}
 
 	// 加密新密码
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
-		log.Errorf("failed to encrypt new password: email=%s, error=%v", email, err)
+		log.Ctx(ctx).Errorf("failed to encrypt new password: email=%s, error=%v", email, err)
 		return cerrors.ErrPwdEncFailed
 	}
 
 	// 更新用户密码
 	result = result.Update("password", string(hashedPassword))
 	if result.Error != nil {
-		log.Errorf("failed to update user password: email=%s, error=%v", email, result.Error)
+		log.Ctx(ctx).Errorf("failed to update user password: email=%s, error=%v", email, result.Error)
 		return cerrors.ErrCreateUserFailed
 	}
 
@@ -238,7 +239,7 @@ func generateVerificationCode() string {
 	return fmt.Sprintf("%03x", code)
 }
 
-func (s *AuthService) VerifyEmail(token string) error {
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
 	if !s.mailService.IsEnabled() {
 		return cerrors.ErrMailServiceDisabled
 	}
@@ -261,7 +262,7 @@ func (s *AuthService) VerifyEmail(token string) error {
 	// 使用明确的数据库操作更新用户状态
 	updateResult := s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("active", true)
 	if updateResult.Error != nil {
-		log.Errorf("failed to activate user: user_id=%d, email=%s, error=%v", user.ID, email, updateResult.Error)
+		log.Ctx(ctx).Errorf("failed to activate user: user_id=%d, email=%s, error=%v", user.ID, email, updateResult.Error)
 		return cerrors.ErrCreateUserFailed
 	}
 
@@ -285,7 +286,7 @@ func (s *AuthService) validateVerifyToken(token string) (string, error) {
 	return email, nil
 }
 
-func (s *AuthService) RefreshToken(refreshToken string, jwtCfg *config.JWTConfig) (*TokenResponse, error) {
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, jwtCfg *config.JWTConfig) (*TokenResponse, error) {
 	// 检查令牌是否在黑名单中
 	inBlacklist, err := IsInBlacklist(s.db, refreshToken)
 	if err != nil {
@@ -321,7 +322,7 @@ func (s *AuthService) RefreshToken(refreshToken string, jwtCfg *config.JWTConfig
 	// 将旧的刷新令牌添加到黑名单
 	if err := AddToBlacklist(s.db, refreshToken, refreshTokenClaims.ExpiresAt.Time); err != nil {
 		// 记录错误但不影响主要流程
-		log.Errorf("failed to add token to blacklist: %v", err)
+		log.Ctx(ctx).Errorf("failed to add token to blacklist: %v", err)
 	}
 
 	return &TokenResponse{
@@ -333,7 +334,7 @@ func (s *AuthService) RefreshToken(refreshToken string, jwtCfg *config.JWTConfig
 }
 
 // Logout 用户登出
-func (s *AuthService) Logout(refreshToken string, jwtCfg *config.JWTConfig) error {
+func (s *AuthService) Logout(ctx context.Context, refreshToken string, jwtCfg *config.JWTConfig) error {
 	// 检查令牌是否在黑名单中
 	inBlacklist, err := IsInBlacklist(s.db, refreshToken)
 	if err != nil {
@@ -351,7 +352,7 @@ func (s *AuthService) Logout(refreshToken string, jwtCfg *config.JWTConfig) erro
 
 	// 将刷新令牌添加到黑名单
 	if err := AddToBlacklist(s.db, refreshToken, refreshTokenClaims.ExpiresAt.Time); err != nil {
-		log.Errorf("failed to add token to blacklist during logout: %v", err)
+		log.Ctx(ctx).Errorf("failed to add token to blacklist during logout: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
@@ -0,0 +1,603 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/internal/storage"
+	"github.com/leleo886/lopic/internal/websocket"
+	"github.com/leleo886/lopic/models"
+	"github.com/leleo886/lopic/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// exportDir 导出文件所在的目录
+	exportDir = "data/exports"
+	// exportLinkTTL 导出完成后下载链接的有效期，过期后导出文件会被删除
+	exportLinkTTL = 24 * time.Hour
+	// exportTokenPrefix 下载链接签名令牌的前缀
+	exportTokenPrefix = "export"
+	// exportUnsortedDir 不属于任何相册的图片所在的目录
+	exportUnsortedDir = "unsorted"
+	// exportJobType 导出任务
+	exportJobType = "export"
+)
+
+// ExportService 用户数据导出服务
+type ExportService struct {
+	db    *gorm.DB
+	cfg   *config.Config
+	hub   *websocket.Hub
+	queue *queue.Queue
+}
+
+// exportJob 导出任务参数
+type exportJob struct {
+	TaskID uint `json:"task_id"`
+}
+
+func NewExportService(db *gorm.DB, cfg *config.Config, hub *websocket.Hub) *ExportService {
+	return &ExportService{db: db, cfg: cfg, hub: hub}
+}
+
+// ExportManifest 导出归档中的 manifest.json
+type ExportManifest struct {
+	User       ExportUser        `json:"user"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Albums     []ExportAlbum     `json:"albums"`
+	Images     []ExportImage     `json:"images"`
+	Tags       []string          `json:"tags"`
+	Missing    []ExportImageFile `json:"missing,omitempty"` // 无法读取原图的图片
+}
+
+// ExportUser 导出的用户信息
+type ExportUser struct {
+	ID       uint   `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// ExportAlbum 导出的相册，Path 为相册在归档中的目录
+type ExportAlbum struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Path        string    `json:"path"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ExportImage 导出的图片，Paths 为原图在归档中的路径，图片属于多个相册时每个相册目录中各有一份
+type ExportImage struct {
+	ID           uint      `json:"id"`
+	OriginalName string    `json:"original_name"`
+	MimeType     string    `json:"mime_type"`
+	FileSize     int64     `json:"file_size"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	Tags         []string  `json:"tags"`
+	Albums       []uint    `json:"albums"`
+	Paths        []string  `json:"paths"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ExportImageFile 无法导出的图片文件
+type ExportImageFile struct {
+	ID      uint   `json:"id"`
+	FileURL string `json:"file_url"`
+}
+
+// CreateExport 创建导出任务，在后台导出 userID 的图片、标签和相册，requestedBy 为发起导出的用户
+// 同一用户同时只能有一个进行中的导出任务
+func (s *ExportService) CreateExport(ctx context.Context, userID, requestedBy uint) (*models.ExportTask, error) {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, cerrors.ErrUserNotFound
+	}
+
+	var running int64
+	if err := s.db.Model(&models.ExportTask{}).Where("user_id = ? AND status IN ?", userID, []string{"pending", "running"}).Count(&running).Error; err != nil {
+		return nil, cerrors.ErrInternalServer
+	}
+	if running > 0 {
+		return nil, cerrors.ErrExportInProgress
+	}
+	if s.queue == nil {
+		return nil, cerrors.ErrInternalServer
+	}
+
+	task := &models.ExportTask{
+		UserID:      userID,
+		RequestedBy: requestedBy,
+		Status:      "pending",
+		StartTime:   time.Now(),
+	}
+	if err := s.db.Create(task).Error; err != nil {
+		return nil, cerrors.ErrInternalServer
+	}
+
+	if _, err := s.queue.EnqueueContext(ctx, exportJobType, exportJob{TaskID: task.ID}); err != nil {
+		s.db.Delete(task)
+		return nil, err
+	}
+	return task, nil
+}
+
+// RegisterJobs 注册导出任务，任务最终失败或被取消时将导出记录标记为失败
+func (s *ExportService) RegisterJobs(q *queue.Queue) {
+	s.queue = q
+	q.Register(queue.JobType{
+		Name:        exportJobType,
+		Handle:      s.runExportJob,
+		MaxAttempts: 3,
+		OnAbort: func(job *models.Job) {
+			var payload exportJob
+			if queue.Decode(job, &payload) == nil {
+				s.failExport(payload.TaskID, job.Error)
+			}
+		},
+	})
+}
+
+// RecoverTasks 将没有对应任务的待执行和执行中的导出记录标记为失败，需在任务队列 Recover 之后调用，返回标记的数量
+func (s *ExportService) RecoverTasks() (int, error) {
+	var jobs []models.Job
+	if err := s.db.Where("type = ? AND status IN ?", exportJobType, []string{queue.StatusPending, queue.StatusRunning}).Find(&jobs).Error; err != nil {
+		return 0, err
+	}
+	queued := make(map[uint]bool, len(jobs))
+	for i := range jobs {
+		var payload exportJob
+		if queue.Decode(&jobs[i], &payload) == nil {
+			queued[payload.TaskID] = true
+		}
+	}
+
+	var tasks []models.ExportTask
+	if err := s.db.Where("status IN ?", []string{"pending", "running"}).Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+	failed := 0
+	for _, task := range tasks {
+		if !queued[task.ID] {
+			s.failExport(task.ID, "interrupted by restart")
+			failed++
+		}
+	}
+	return failed, nil
+}
+
+func (s *ExportService) runExportJob(ctx context.Context, job *models.Job) error {
+	var payload exportJob
+	if err := queue.Decode(job, &payload); err != nil {
+		return err
+	}
+	if err := s.executeExport(ctx, payload.TaskID); err != nil {
+		log.Ctx(ctx).Errorf("ExportTask %d failed: %v", payload.TaskID, err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 导出记录或用户已被删除，重试也不会成功
+			return queue.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// failExport 将未完成的导出记录标记为失败并通知用户
+func (s *ExportService) failExport(taskID uint, errorMsg string) {
+	var task models.ExportTask
+	if err := s.db.First(&task, taskID).Error; err != nil || (task.Status != "pending" && task.Status != "running") {
+		return
+	}
+	err := s.db.Model(&task).Updates(map[string]interface{}{
+		"status":   "failed",
+		"error":    errorMsg,
+		"end_time": time.Now(),
+	}).Error
+	if err != nil {
+		log.Errorf("Failed to mark ExportTask %d as failed: %v", taskID, err)
+		return
+	}
+	s.notify(&task, "export_failed", map[string]interface{}{
+		"task_id": taskID,
+		"error":   errorMsg,
+	})
+}
+
+// GetExports 获取用户的导出任务，已完成且未过期的任务带有下载链接
+func (s *ExportService) GetExports(userID uint) ([]models.ExportTask, error) {
+	var tasks []models.ExportTask
+	if err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&tasks).Error; err != nil {
+		return nil, cerrors.ErrInternalServer
+	}
+	for i := range tasks {
+		s.fillDownloadURL(&tasks[i])
+	}
+	return tasks, nil
+}
+
+// OpenDownload 校验下载令牌，返回导出文件的路径和下载文件名
+func (s *ExportService) OpenDownload(token string) (string, string, error) {
+	subject, expiresAt, err := utils.ValidateSignedToken(token, exportTokenPrefix, &s.cfg.JWT)
+	if err != nil {
+		return "", "", err
+	}
+	taskID, err := strconv.ParseUint(subject, 10, 64)
+	if err != nil {
+		return "", "", cerrors.ErrForbidden
+	}
+	if time.Now().After(time.Unix(expiresAt, 0)) {
+		return "", "", cerrors.ErrExportExpired
+	}
+
+	var task models.ExportTask
+	if err := s.db.First(&task, taskID).Error; err != nil {
+		return "", "", cerrors.ErrExportNotFound
+	}
+	if task.Status != "completed" || task.FilePath == "" {
+		return "", "", cerrors.ErrExportExpired
+	}
+	if _, err := os.Stat(task.FilePath); err != nil {
+		return "", "", cerrors.ErrExportNotFound
+	}
+
+	var user models.User
+	if err := s.db.Select("username").First(&user, task.UserID).Error; err != nil {
+		return "", "", cerrors.ErrExportNotFound
+	}
+	filename := fmt.Sprintf("lopic_export_%s_%s.zip", sanitizePathName(user.Username), task.EndTime.Format("20060102"))
+	return task.FilePath, filename, nil
+}
+
+// PurgeExpired 删除过期的导出文件，返回删除的数量
+func (s *ExportService) PurgeExpired() (int, error) {
+	var tasks []models.ExportTask
+	if err := s.db.Where("status = ? AND expires_at < ?", "completed", time.Now()).Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, task := range tasks {
+		if err := os.Remove(task.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Errorf("Remove expired export %s failed: %v", task.FilePath, err)
+			continue
+		}
+		if err := s.db.Model(&task).Updates(map[string]interface{}{"status": "expired", "file_path": ""}).Error; err != nil {
+			log.Errorf("Mark ExportTask %d as expired failed: %v", task.ID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+func (s *ExportService) fillDownloadURL(task *models.ExportTask) {
+	if task.Status != "completed" || task.ExpiresAt == nil || time.Now().After(*task.ExpiresAt) {
+		return
+	}
+	token := utils.GenerateSignedToken(strconv.FormatUint(uint64(task.ID), 10), task.ExpiresAt.Unix(), exportTokenPrefix, &s.cfg.JWT)
+	task.DownloadURL = "/api/exports/download?token=" + url.QueryEscape(token)
+}
+
+// notify 向被导出的用户和发起导出的用户推送消息
+func (s *ExportService) notify(task *models.ExportTask, msgType string, payload map[string]interface{}) {
+	if s.hub == nil {
+		return
+	}
+	s.hub.BroadcastToUser(task.UserID, msgType, payload)
+	if task.RequestedBy != task.UserID {
+		s.hub.BroadcastToUser(task.RequestedBy, msgType, payload)
+	}
+}
+
+func (s *ExportService) executeExport(ctx context.Context, taskID uint) error {
+	var task models.ExportTask
+	if err := s.db.First(&task, taskID).Error; err != nil {
+		return err
+	}
+	var user models.User
+	if err := s.db.First(&user, task.UserID).Error; err != nil {
+		return err
+	}
+
+	// 回收站中的图片和相册不导出
+	var images []models.Image
+	if err := s.db.Where("user_id = ?", task.UserID).Order("id").Find(&images).Error; err != nil {
+		return err
+	}
+	var albums []models.Album
+	if err := s.db.Where("user_id = ?", task.UserID).Order("id").Find(&albums).Error; err != nil {
+		return err
+	}
+	var links []models.ImageAlbum
+	if err := s.db.Joins("JOIN images ON images.id = image_albums.image_id").
+		Where("images.user_id = ? AND images.deleted_at IS NULL", task.UserID).Find(&links).Error; err != nil {
+		return err
+	}
+	var tags []string
+	if err := s.db.Model(&models.Tag{}).Where("user_id = ?", task.UserID).Order("name").Pluck("name", &tags).Error; err != nil {
+		return err
+	}
+
+	task.Status = "running"
+	task.Total = len(images)
+	if err := s.db.Model(&task).Updates(map[string]interface{}{"status": task.Status, "total": task.Total}).Error; err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		return err
+	}
+	filePath := filepath.Join(exportDir, fmt.Sprintf("export_%d_%d_%s.zip", task.UserID, task.ID, time.Now().Format("20060102_150405")))
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	success := false
+	defer func() {
+		file.Close()
+		if !success {
+			os.Remove(filePath)
+		}
+	}()
+
+	manifest := ExportManifest{
+		User:       ExportUser{ID: user.ID, Username: user.Username, Email: user.Email},
+		ExportedAt: time.Now(),
+		Tags:       tags,
+	}
+
+	// 每个相册一个目录，同名相册加上 ID 区分
+	albumPaths := make(map[uint]string, len(albums))
+	usedAlbumPaths := map[string]bool{exportUnsortedDir: true}
+	for _, album := range albums {
+		albumPath := "albums/" + sanitizePathName(album.Name)
+		if usedAlbumPaths[albumPath] {
+			albumPath = fmt.Sprintf("%s_%d", albumPath, album.ID)
+		}
+		usedAlbumPaths[albumPath] = true
+		albumPaths[album.ID] = albumPath
+		manifest.Albums = append(manifest.Albums, ExportAlbum{
+			ID:          album.ID,
+			Name:        album.Name,
+			Description: album.Description,
+			Path:        albumPath,
+			CreatedAt:   album.CreatedAt,
+		})
+	}
+	imageAlbums := make(map[uint][]uint)
+	for _, link := range links {
+		if _, ok := albumPaths[link.AlbumID]; ok {
+			imageAlbums[link.ImageID] = append(imageAlbums[link.ImageID], link.AlbumID)
+		}
+	}
+
+	zipWriter := zip.NewWriter(file)
+	storages := make(map[string]storage.Storage)
+	usedPaths := make(map[string]bool)
+	lastPercent := -1
+	for i, image := range images {
+		dirs := []string{exportUnsortedDir}
+		if albumIDs := imageAlbums[image.ID]; len(albumIDs) > 0 {
+			dirs = dirs[:0]
+			for _, albumID := range albumIDs {
+				dirs = append(dirs, albumPaths[albumID])
+			}
+		}
+
+		exportImage := ExportImage{
+			ID:           image.ID,
+			OriginalName: image.OriginalName,
+			MimeType:     image.MimeType,
+			FileSize:     image.FileSize,
+			Width:        image.Width,
+			Height:       image.Height,
+			Tags:         image.Tags,
+			Albums:       imageAlbums[image.ID],
+			CreatedAt:    image.CreatedAt,
+		}
+		for _, dir := range dirs {
+			exportImage.Paths = append(exportImage.Paths, uniqueExportPath(usedPaths, dir, image.OriginalName, image.FileName))
+		}
+
+		instance, ok := storages[image.StorageName]
+		if !ok {
+			instance = storage.WithTracing(ctx, s.getStorageByStorageName(image.StorageName), image.StorageName)
+			storages[image.StorageName] = instance
+		}
+		if err := writeExportImage(zipWriter, instance, image.FileURL, exportImage.Paths); err != nil {
+			log.Ctx(ctx).Errorf("Export image %d failed: %v", image.ID, err)
+			manifest.Missing = append(manifest.Missing, ExportImageFile{ID: image.ID, FileURL: image.FileURL})
+			exportImage.Paths = nil
+		}
+		manifest.Images = append(manifest.Images, exportImage)
+
+		task.Processed = i + 1
+		if percent := task.Processed * 100 / task.Total; percent != lastPercent {
+			lastPercent = percent
+			s.db.Model(&task).Update("processed", task.Processed)
+			s.notify(&task, "export_progress", map[string]interface{}{
+				"task_id":   task.ID,
+				"processed": task.Processed,
+				"total":     task.Total,
+				"progress":  percent,
+			})
+		}
+	}
+
+	if err := writeExportManifest(zipWriter, &manifest); err != nil {
+		return err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	endTime := time.Now()
+	expiresAt := endTime.Add(exportLinkTTL)
+	task.Status = "completed"
+	task.Size = info.Size()
+	task.FilePath = filePath
+	task.EndTime = &endTime
+	task.ExpiresAt = &expiresAt
+	if len(manifest.Missing) > 0 {
+		task.Error = fmt.Sprintf("%d images could not be read and are missing from this export", len(manifest.Missing))
+	}
+	if err := s.db.Save(&task).Error; err != nil {
+		return err
+	}
+	success = true
+
+	s.fillDownloadURL(&task)
+	s.notify(&task, "export_complete", map[string]interface{}{
+		"task_id":      task.ID,
+		"download_url": task.DownloadURL,
+		"expires_at":   expiresAt,
+		"size":         task.Size,
+	})
+	return nil
+}
+
+// writeExportImage 读取原图并写入归档中的每个路径，图片已经压缩过，不再压缩
+func writeExportImage(zipWriter *zip.Writer, instance storage.Storage, fileURL string, paths []string) error {
+	reader, err := instance.OpenFile(fileURL)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if len(paths) == 1 {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: paths[0], Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, reader)
+		return err
+	}
+
+	// 图片属于多个相册时先读到内存，再写入各相册目录
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	for _, name := range paths {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeExportManifest 写入 manifest.json 和便于表格软件打开的 images.csv
+func writeExportManifest(zipWriter *zip.Writer, manifest *ExportManifest) error {
+	writer, err := zipWriter.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	albumNames := make(map[uint]string, len(manifest.Albums))
+	for _, album := range manifest.Albums {
+		albumNames[album.ID] = album.Name
+	}
+
+	writer, err = zipWriter.Create("images.csv")
+	if err != nil {
+		return err
+	}
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Write([]string{"id", "original_name", "mime_type", "file_size", "width", "height", "tags", "albums", "paths", "created_at"})
+	for _, image := range manifest.Images {
+		albums := make([]string, 0, len(image.Albums))
+		for _, albumID := range image.Albums {
+			albums = append(albums, albumNames[albumID])
+		}
+		csvWriter.Write([]string{
+			strconv.FormatUint(uint64(image.ID), 10),
+			image.OriginalName,
+			image.MimeType,
+			strconv.FormatInt(image.FileSize, 10),
+			strconv.Itoa(image.Width),
+			strconv.Itoa(image.Height),
+			strings.Join(image.Tags, ";"),
+			strings.Join(albums, ";"),
+			strings.Join(image.Paths, ";"),
+			image.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// uniqueExportPath 返回目录中不重复的文件路径，重名时在文件名后加序号
+func uniqueExportPath(usedPaths map[string]bool, dir, originalName, fileName string) string {
+	name := sanitizePathName(originalName)
+	if name == "_" {
+		name = sanitizePathName(fileName)
+	}
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	candidate := dir + "/" + name
+	for i := 1; usedPaths[candidate]; i++ {
+		candidate = fmt.Sprintf("%s/%s (%d)%s", dir, base, i, ext)
+	}
+	usedPaths[candidate] = true
+	return candidate
+}
+
+// sanitizePathName 将名称转换为可用作归档中单级路径的名称
+func sanitizePathName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return name
+}
+
+// 根据存储名称获取存储实例
+func (s *ExportService) getStorageByStorageName(storageName string) storage.Storage {
+	var storageConfig models.Storage
+	result := s.db.Where("name = ?", storageName).First(&storageConfig)
+	if result.Error != nil {
+		// 存储配置不存在，使用默认本地存储
+		return storage.NewStorageByStorageName(nil, &s.cfg.Server)
+	}
+
+	return storage.NewStorageByStorageName(&storageConfig, &s.cfg.Server)
+}
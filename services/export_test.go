@@ -0,0 +1,232 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/models"
+)
+
+func TestExecuteExport(t *testing.T) {
+	db := openTestDB(t)
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{UploadDir: "uploads", StaticPath: "/uploads"},
+		JWT:    config.JWTConfig{TokenSecret: "secret"},
+	}
+	if err := os.MkdirAll("uploads", 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.png": "image a", "b.png": "image b", "c.png": "image c"} {
+		if err := os.WriteFile(filepath.Join("uploads", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := models.User{Username: "alice", Password: "x", Email: "a@example.com", RoleID: 1, Active: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	trip := models.Album{Name: "trip/2024", UserID: user.ID}
+	home := models.Album{Name: "home", UserID: user.ID}
+	images := []models.Image{
+		{FileName: "a.png", OriginalName: "photo.png", FileURL: "/uploads/a.png", MimeType: "image/png", UserID: user.ID, Tags: []string{"sea"}},
+		{FileName: "b.png", OriginalName: "photo.png", FileURL: "/uploads/b.png", MimeType: "image/png", UserID: user.ID},
+		{FileName: "c.png", OriginalName: "c.png", FileURL: "/uploads/c.png", MimeType: "image/png", UserID: user.ID},
+		{FileName: "d.png", OriginalName: "missing.png", FileURL: "/uploads/d.png", MimeType: "image/png", UserID: user.ID},
+	}
+	for _, value := range []interface{}{&trip, &home, &images} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+	links := []models.ImageAlbum{
+		{ImageID: images[0].ID, AlbumID: trip.ID},
+		{ImageID: images[0].ID, AlbumID: home.ID},
+		{ImageID: images[1].ID, AlbumID: trip.ID},
+	}
+	if err := db.Create(&links).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+
+	service := NewExportService(db, cfg, nil)
+	task := models.ExportTask{UserID: user.ID, RequestedBy: user.ID, Status: "pending"}
+	if err := db.Create(&task).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := service.executeExport(context.Background(), task.ID); err != nil {
+		t.Fatalf("executeExport() error = %v", err)
+	}
+	if err := db.Create(&models.ExportTask{UserID: user.ID, RequestedBy: user.ID, Status: "running"}).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if _, err := service.CreateExport(context.Background(), user.ID, user.ID); !errors.Is(err, cerrors.ErrExportInProgress) {
+		t.Errorf("CreateExport() with running export error = %v, want ErrExportInProgress", err)
+	}
+
+	tasks, err := service.GetExports(user.ID)
+	if err != nil {
+		t.Fatalf("GetExports() error = %v", err)
+	}
+	var completed *models.ExportTask
+	for i := range tasks {
+		if tasks[i].ID == task.ID {
+			completed = &tasks[i]
+		}
+	}
+	if completed == nil || completed.Status != "completed" || completed.Processed != 4 || completed.DownloadURL == "" {
+		t.Fatalf("export task = %+v, want completed with download url", completed)
+	}
+
+	link, err := url.Parse(completed.DownloadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath, filename, err := service.OpenDownload(link.Query().Get("token"))
+	if err != nil {
+		t.Fatalf("OpenDownload() error = %v", err)
+	}
+	if !strings.HasPrefix(filename, "lopic_export_alice_") {
+		t.Errorf("download filename = %q", filename)
+	}
+	if _, _, err := service.OpenDownload(strings.Replace(link.Query().Get("token"), "export", "verify", 1)); !errors.Is(err, cerrors.ErrForbidden) {
+		t.Errorf("OpenDownload() with tampered token error = %v, want ErrForbidden", err)
+	}
+
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		t.Fatalf("failed to open export: %v", err)
+	}
+	defer reader.Close()
+	files := make(map[string]*zip.File)
+	for _, file := range reader.File {
+		files[file.Name] = file
+	}
+	for _, name := range []string{
+		"albums/trip_2024/photo.png",
+		"albums/trip_2024/photo (1).png",
+		"albums/home/photo.png",
+		"unsorted/c.png",
+		"manifest.json",
+		"images.csv",
+	} {
+		if files[name] == nil {
+			t.Errorf("export is missing %s", name)
+		}
+	}
+	if len(files) != 6 {
+		t.Errorf("export has %d files, want 6", len(files))
+	}
+
+	manifestFile, err := files["manifest.json"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manifestFile.Close()
+	var manifest ExportManifest
+	if err := json.NewDecoder(manifestFile).Decode(&manifest); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if len(manifest.Images) != 4 || len(manifest.Albums) != 2 || len(manifest.Missing) != 1 || manifest.Missing[0].ID != images[3].ID {
+		t.Errorf("manifest = %+v", manifest)
+	}
+}
+
+func TestExportJob(t *testing.T) {
+	db := openTestDB(t)
+	cfg := &config.Config{JWT: config.JWTConfig{TokenSecret: "secret"}}
+	user := models.User{Username: "alice", Password: "x", Email: "a@example.com", RoleID: 1, Active: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+
+	service := NewExportService(db, cfg, nil)
+	if _, err := service.CreateExport(context.Background(), user.ID, user.ID); !errors.Is(err, cerrors.ErrInternalServer) {
+		t.Errorf("CreateExport() without queue error = %v, want ErrInternalServer", err)
+	}
+
+	q := queue.New(db)
+	service.RegisterJobs(q)
+	task, err := service.CreateExport(context.Background(), user.ID, user.ID)
+	if err != nil {
+		t.Fatalf("CreateExport() error = %v", err)
+	}
+	var job models.Job
+	if err := db.Where("type = ?", exportJobType).First(&job).Error; err != nil {
+		t.Fatalf("export job not enqueued: %v", err)
+	}
+
+	// 取消任务后导出记录标记为失败，用户可以重新导出
+	if _, err := q.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel() error = %v", err)
+	}
+	if err := db.First(task, task.ID).Error; err != nil || task.Status != "failed" || task.EndTime == nil {
+		t.Errorf("export task after cancel = %+v, %v, want failed", task, err)
+	}
+
+	// 没有对应任务的导出记录在启动时标记为失败
+	stale := models.ExportTask{UserID: user.ID, RequestedBy: user.ID, Status: "running"}
+	if err := db.Create(&stale).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	queued, err := service.CreateExport(context.Background(), 2, user.ID)
+	if !errors.Is(err, cerrors.ErrUserNotFound) || queued != nil {
+		t.Errorf("CreateExport() for unknown user = %v, %v", queued, err)
+	}
+	failed, err := service.RecoverTasks()
+	if err != nil || failed != 1 {
+		t.Fatalf("RecoverTasks() = %d, %v, want 1", failed, err)
+	}
+	if err := db.First(&stale, stale.ID).Error; err != nil || stale.Status != "failed" || stale.Error != "interrupted by restart" {
+		t.Errorf("stale export task = %+v, %v, want failed", stale, err)
+	}
+	if _, err := service.CreateExport(context.Background(), user.ID, user.ID); err != nil {
+		t.Errorf("CreateExport() after recovery error = %v", err)
+	}
+	if failed, err := service.RecoverTasks(); err != nil || failed != 0 {
+		t.Errorf("RecoverTasks() with queued export = %d, %v, want 0", failed, err)
+	}
+}
+
+func TestPurgeExpiredExports(t *testing.T) {
+	db := openTestDB(t)
+	service := NewExportService(db, &config.Config{}, nil)
+
+	// 删除失败的导出文件（非空目录）不计入删除数量，记录保持不变
+	if err := os.MkdirAll(filepath.Join("exports", "busy", "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("exports", "old.zip"), []byte("zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expiresAt := time.Now().Add(-time.Hour)
+	expired := models.ExportTask{UserID: 1, RequestedBy: 1, Status: "completed", FilePath: filepath.Join("exports", "old.zip"), ExpiresAt: &expiresAt}
+	busy := models.ExportTask{UserID: 1, RequestedBy: 1, Status: "completed", FilePath: filepath.Join("exports", "busy"), ExpiresAt: &expiresAt}
+	for _, task := range []*models.ExportTask{&expired, &busy} {
+		if err := db.Create(task).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+
+	count, err := service.PurgeExpired()
+	if err != nil || count != 1 {
+		t.Fatalf("PurgeExpired() = %d, %v, want 1", count, err)
+	}
+	if err := db.First(&expired, expired.ID).Error; err != nil || expired.Status != "expired" || expired.FilePath != "" {
+		t.Errorf("purged export = %+v, %v, want expired", expired, err)
+	}
+	if err := db.First(&busy, busy.ID).Error; err != nil || busy.Status != "completed" {
+		t.Errorf("export whose file could not be removed = %+v, %v, want completed", busy, err)
+	}
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/models"
@@ -16,18 +18,19 @@ func NewGalleryService(db *gorm.DB) *GalleryService {
 }
 
 type GalleryImageResponse struct {
-	FileName        string   `json:"file_name"`
-	OriginalName    string   `json:"original_name"`
-	Tags            []string `json:"tags" gorm:"serializer:json"`
-	FileURL         string   `json:"file_url"`
-	FileSize        int64    `json:"file_size"`
-	Width           int      `json:"width"`
-	Height          int      `json:"height"`
-	ThumbnailURL    string   `json:"thumbnail_url"`
-	ThumbnailSize   int64    `json:"thumbnail_size"`
-	ThumbnailWidth  int      `json:"thumbnail_width"`
-	ThumbnailHeight int      `json:"thumbnail_height"`
-	MimeType        string   `json:"mime_type"`
+	FileName        string           `json:"file_name"`
+	OriginalName    string           `json:"original_name"`
+	Tags            []string         `json:"tags" gorm:"serializer:json"`
+	FileURL         string           `json:"file_url"`
+	FileSize        int64            `json:"file_size"`
+	Width           int              `json:"width"`
+	Height          int              `json:"height"`
+	ThumbnailURL    string           `json:"thumbnail_url"`
+	ThumbnailSize   int64            `json:"thumbnail_size"`
+	ThumbnailWidth  int              `json:"thumbnail_width"`
+	ThumbnailHeight int              `json:"thumbnail_height"`
+	MimeType        string           `json:"mime_type"`
+	Highlight       *SearchHighlight `json:"highlight,omitempty" gorm:"-"`
 }
 
 type GetGalleryImagesResponse struct {
@@ -37,7 +40,7 @@ type GetGalleryImagesResponse struct {
 	PageSize int                    `json:"page_size"`
 }
 
-func (s *GalleryService) GetGallery(currentUserID uint) (*GetAlbumsResponse, error) {
+func (s *GalleryService) GetGallery(ctx context.Context, currentUserID uint) (*GetAlbumsResponse, error) {
 	var albums []AlbumResponse
 	var total int64
 
@@ -46,7 +49,7 @@ func (s *GalleryService) GetGallery(currentUserID uint) (*GetAlbumsResponse, err
 		Find(&models.Album{})
 	result.Count(&total).Find(&albums)
 	if result.Error != nil {
-		log.Errorf("failed to get albums: user_id=%d, error=%v", currentUserID, result.Error)
+		log.Ctx(ctx).Errorf("failed to get albums: user_id=%d, error=%v", currentUserID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -68,7 +71,7 @@ func (s *GalleryService) GetGalleryImages(currentUserID uint, albumID uint, page
 
 	db := s.db.Model(&models.Image{}).
 		Joins("JOIN image_albums ON image_albums.image_id = images.id").
-		Where("image_albums.album_id = ?", albumID)
+		Where("image_albums.album_id = ? AND images.hidden = ?", albumID, false)
 	db.Count(&total)
 	db.Offset(offset).Limit(pageSize).Order("image_albums.image_id DESC").Find(&AlbumImagesResponse)
 
@@ -86,12 +89,14 @@ func (s *GalleryService) SearchGalleryImages(currentUserID uint, query string, p
 
 	db := s.db.Model(&models.Image{}).
 		Joins("JOIN image_albums ON image_albums.image_id = images.id").
-		Where("image_albums.album_id IN (SELECT id FROM albums WHERE user_id = ?)", currentUserID)
-	if query != "" {
-		db.Where("images.original_name LIKE ? OR images.tags LIKE ?", "%"+query+"%", "%"+query+"%")
+		Where("image_albums.album_id IN (SELECT id FROM albums WHERE user_id = ? AND deleted_at IS NULL) AND images.hidden = ?", currentUserID, false)
+	db, err := ApplySearchQuery(db, query)
+	if err != nil {
+		return nil, err
 	}
 	db.Count(&total)
-	db.Offset(offset).Limit(pageSize).Order("image_albums.image_id DESC").Find(&images)
+	OrderByRelevance(db.Offset(offset).Limit(pageSize), query, "image_albums.image_id DESC").Find(&images)
+	HighlightGalleryImages(query, images)
 
 	return &GetGalleryImagesResponse{
 		Images:   images,
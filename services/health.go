@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/health"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/mail"
+	"github.com/leleo886/lopic/internal/storage"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMinFreeDiskMB       = 100
+	defaultStorageCheckTimeout = 5 * time.Second
+	defaultStorageCacheTTL     = 30 * time.Second
+	// healthBackupDir 备份文件所在的目录
+	healthBackupDir = "data/backup"
+)
+
+type HealthService struct {
+	db          *gorm.DB
+	cfg         *config.Config
+	mailService *mail.MailService
+
+	mu            sync.Mutex
+	storageCaches map[string]*health.Cache
+}
+
+func NewHealthService(db *gorm.DB, cfg *config.Config, mailService *mail.MailService) *HealthService {
+	return &HealthService{db: db, cfg: cfg, mailService: mailService, storageCaches: make(map[string]*health.Cache)}
+}
+
+// Readiness 检查数据库、各存储的连接、上传和备份目录的可用空间以及邮件配置
+func (s *HealthService) Readiness(ctx context.Context) *health.Report {
+	minFreeMB := s.cfg.Health.MinFreeDiskMB
+	if minFreeMB == 0 {
+		minFreeMB = defaultMinFreeDiskMB
+	}
+	checks := []health.Check{
+		{Name: "database", Run: s.checkDatabase},
+		{Name: "disk:upload_dir", Run: health.DiskSpace(s.cfg.Server.UploadDir, minFreeMB)},
+		{Name: "disk:backup", Run: health.DiskSpace(healthBackupDir, minFreeMB)},
+		{Name: "mail", Run: s.checkMail},
+	}
+	checks = append(checks, s.storageChecks(ctx)...)
+
+	report := health.Run(ctx, checks)
+	if !report.Ready() {
+		for name, result := range report.Checks {
+			if result.Status == health.StatusFail {
+				log.Ctx(ctx).Errorf("Readiness check %s failed: %s", name, result.Error)
+			}
+		}
+	}
+	return report
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func (s *HealthService) checkMail(ctx context.Context) error {
+	if s.mailService == nil || !s.mailService.IsEnabled() {
+		return health.ErrSkipped
+	}
+	return s.mailService.Validate()
+}
+
+// storageChecks 为每个存储配置创建检查，本地存储都使用 upload_dir，只检查一次
+// 角色的存储不存在时使用默认的本地存储，因此总是检查本地存储
+// 存储不支持取消，检查结果会被缓存，超时的检查在后台完成后更新缓存
+func (s *HealthService) storageChecks(ctx context.Context) []health.Check {
+	var storages []models.Storage
+	if err := s.db.WithContext(ctx).Find(&storages).Error; err != nil {
+		// 数据库检查会报告错误
+		log.Ctx(ctx).Errorf("failed to list storages for readiness check: %v", err)
+	}
+
+	timeout := time.Duration(s.cfg.Health.StorageTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultStorageCheckTimeout
+	}
+	hasLocal := false
+	checks := make([]health.Check, 0, len(storages)+1)
+	for i := range storages {
+		if storages[i].Type != "webdav" {
+			if hasLocal {
+				continue
+			}
+			hasLocal = true
+		}
+		checks = append(checks, s.storageCheck(storages[i].Name, storage.NewStorageByStorageName(&storages[i], &s.cfg.Server), timeout))
+	}
+	if !hasLocal {
+		checks = append(checks, s.storageCheck("local", storage.NewStorageByStorageName(nil, &s.cfg.Server), timeout))
+	}
+	return checks
+}
+
+func (s *HealthService) storageCheck(name string, instance storage.Storage, timeout time.Duration) health.Check {
+	cache := s.storageCache(name)
+	return health.Check{
+		Name:    "storage:" + name,
+		Timeout: timeout,
+		Run: func(ctx context.Context) error {
+			return cache.Do(ctx, instance.TestConnection)
+		},
+	}
+}
+
+func (s *HealthService) storageCache(name string) *health.Cache {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cache, ok := s.storageCaches[name]
+	if !ok {
+		ttl := time.Duration(s.cfg.Health.StorageCacheSeconds) * time.Second
+		if ttl <= 0 {
+			ttl = defaultStorageCacheTTL
+		}
+		cache = health.NewCache(ttl)
+		s.storageCaches[name] = cache
+	}
+	return cache
+}
@@ -1,6 +1,9 @@
 package services
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"image"
 	"image/draw"
@@ -22,9 +25,15 @@ import (
 	"github.com/leleo886/lopic/internal/config"
 	cerrors "github.com/leleo886/lopic/internal/error"
 	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/metrics"
+	"github.com/leleo886/lopic/internal/queue"
 	"github.com/leleo886/lopic/internal/storage"
+	"github.com/leleo886/lopic/internal/tracing"
+	"github.com/leleo886/lopic/internal/websocket"
 	"github.com/leleo886/lopic/models"
 	"github.com/nfnt/resize"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/image/bmp"
 	"golang.org/x/image/tiff"
 	"golang.org/x/image/webp"
@@ -32,8 +41,10 @@ import (
 )
 
 type ImageService struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db    *gorm.DB
+	cfg   *config.Config
+	queue *queue.Queue
+	hub   *websocket.Hub
 }
 
 func NewImageService(db *gorm.DB, cfg *config.Config) *ImageService {
@@ -44,24 +55,27 @@ func NewImageService(db *gorm.DB, cfg *config.Config) *ImageService {
 }
 
 type ImageResponse struct {
-	ID              uint            `json:"id"`
-	FileName        string          `json:"file_name"`
-	OriginalName    string          `json:"original_name"`
-	Tags            []string        `json:"tags" gorm:"serializer:json"`
-	FileURL         string          `json:"file_url"`
-	FileSize        int64           `json:"file_size"`
-	Width           int             `json:"width"`
-	Height          int             `json:"height"`
-	ThumbnailURL    string          `json:"thumbnail_url"`
-	ThumbnailSize   int64           `json:"thumbnail_size"`
-	ThumbnailWidth  int             `json:"thumbnail_width"`
-	ThumbnailHeight int             `json:"thumbnail_height"`
-	CreatedAt       time.Time       `json:"created_at"`
-	UpdatedAt       time.Time       `json:"updated_at"`
-	MimeType        string          `json:"mime_type"`
-	UserID          uint            `json:"user_id"`
-	Albums          []AlbumResponse `json:"albums"`
-	StorageName     string          `json:"storage_name"`
+	ID              uint             `json:"id"`
+	FileName        string           `json:"file_name"`
+	OriginalName    string           `json:"original_name"`
+	Tags            []string         `json:"tags" gorm:"serializer:json"`
+	FileURL         string           `json:"file_url"`
+	FileSize        int64            `json:"file_size"`
+	Width           int              `json:"width"`
+	Height          int              `json:"height"`
+	ThumbnailURL    string           `json:"thumbnail_url"`
+	ThumbnailSize   int64            `json:"thumbnail_size"`
+	ThumbnailWidth  int              `json:"thumbnail_width"`
+	ThumbnailHeight int              `json:"thumbnail_height"`
+	CreatedAt       time.Time        `json:"created_at"`
+	UpdatedAt       time.Time        `json:"updated_at"`
+	MimeType        string           `json:"mime_type"`
+	UserID          uint             `json:"user_id"`
+	Albums          []AlbumResponse  `json:"albums"`
+	StorageName     string           `json:"storage_name"`
+	Hidden          bool             `json:"hidden"`
+	DeletedAt       *time.Time       `json:"deleted_at,omitempty"`
+	Highlight       *SearchHighlight `json:"highlight,omitempty" gorm:"-"`
 }
 
 type GetImagesResponse struct {
@@ -102,41 +116,42 @@ func (s *ImageService) getStorageByStorageName(storageName string) (storage.Stor
 	return storage.NewStorageByStorageName(&storageConfig, &s.cfg.Server), nil
 }
 
-func (s *ImageService) UploadImage(currentUserID uint, AlbumIDs []uint, tags []string, files []*multipart.FileHeader) error {
-	now := time.Now()
-	dateDir := now.Format("2006/01/02")
+// uploadFile 上传单个文件，返回图片的文件名
+func (s *ImageService) uploadFile(ctx context.Context, currentUserID uint, AlbumIDs []uint, tags []string, file *multipart.FileHeader) (string, error) {
+	dateDir := time.Now().Format("2006/01/02")
 	maxThumbSize := s.cfg.SystemSettings.General.MaxThumbSize
 
 	// 获取用户对应的存储实例
 	storageInstance, storageName, err := s.getStorageByUserID(currentUserID)
 	if err != nil {
-		return err
+		metrics.ObserveUpload("", 0, err)
+		return "", err
 	}
+	storageInstance = storage.WithTracing(ctx, storageInstance, storageName)
 
-	// 处理每个文件
-	for _, file := range files {
-		fileUUID := uuid.New().String()
-		fileExt := strings.ToLower(filepath.Ext(file.Filename))
-		fileOriginalName := file.Filename[:len(file.Filename)-len(fileExt)]
-		fileName := fmt.Sprintf("%s$-$%s%s", fileUUID, fileOriginalName, fileExt)
-		fileSize := file.Size
-
-		// 执行单个文件上传
-		if err := s.executeUpload(storageInstance, storageName, currentUserID, AlbumIDs, tags, file, fileName, fileSize, fileExt, dateDir, maxThumbSize, fileUUID); err != nil {
-			log.Errorf("Failed to upload file %s: %v,currentUserID:%d", file.Filename, err, currentUserID)
-			return err
-		}
+	fileUUID := uuid.New().String()
+	fileExt := strings.ToLower(filepath.Ext(file.Filename))
+	fileOriginalName := file.Filename[:len(file.Filename)-len(fileExt)]
+	fileName := fmt.Sprintf("%s$-$%s%s", fileUUID, fileOriginalName, fileExt)
+	fileSize := file.Size
+
+	// 执行单个文件上传
+	err = s.executeUpload(ctx, storageInstance, storageName, currentUserID, AlbumIDs, tags, file, fileName, fileSize, fileExt, dateDir, maxThumbSize, fileUUID)
+	metrics.ObserveUpload(storageName, fileSize, err)
+	if err != nil {
+		log.Ctx(ctx).Errorf("Failed to upload file %s: %v,currentUserID:%d", file.Filename, err, currentUserID)
+		return "", err
 	}
-	return nil
+	return fileName, nil
 }
 
-func (s *ImageService) executeUpload(storageInstance storage.Storage, storageName string, currentUserID uint, AlbumIDs []uint, tags []string, file *multipart.FileHeader, fileName string, fileSize int64, fileExt, dateDir string, maxThumbSize uint, fileUUID string) error {
+func (s *ImageService) executeUpload(ctx context.Context, storageInstance storage.Storage, storageName string, currentUserID uint, AlbumIDs []uint, tags []string, file *multipart.FileHeader, fileName string, fileSize int64, fileExt, dateDir string, maxThumbSize uint, fileUUID string) error {
 	// 验证所有相册是否存在且属于当前用户
 	var albums []models.Album
 	if len(AlbumIDs) > 0 {
-		result := s.db.Where("id IN ? AND user_id = ?", AlbumIDs, currentUserID).Find(&albums)
+		result := s.db.WithContext(ctx).Where("id IN ? AND user_id = ?", AlbumIDs, currentUserID).Find(&albums)
 		if result.Error != nil {
-			log.Errorf("failed to find albums: error=%v", result.Error)
+			log.Ctx(ctx).Errorf("failed to find albums: error=%v", result.Error)
 			return cerrors.ErrInternalServer
 		}
 		if len(albums) != len(AlbumIDs) {
@@ -149,6 +164,11 @@ func (s *ImageService) executeUpload(storageInstance storage.Storage, storageNam
 		return err
 	}
 
+	fileHash, err := GetFileHash(file)
+	if err != nil {
+		return err
+	}
+
 	// 使用普通上传方法
 	fileURL, err := storageInstance.UploadFile(file, "", dateDir, fileName)
 	if err != nil {
@@ -156,17 +176,19 @@ func (s *ImageService) executeUpload(storageInstance storage.Storage, storageNam
 	}
 
 	// 生成缩略图，如果失败则清理已上传的文件
-	thumbnailURL, thumbnailWidth, thumbnailHeight, thumbnailSize, err := GetThumbnails(dateDir, fileUUID, maxThumbSize, mimeType, file, storageInstance)
+	thumbnailStart := time.Now()
+	thumbnailURL, thumbnailWidth, thumbnailHeight, thumbnailSize, err := GetThumbnails(ctx, dateDir, fileUUID, maxThumbSize, mimeType, file, storageInstance)
+	metrics.ObserveThumbnail(thumbnailStart)
 	if err != nil {
 		// 清理已上传的原始文件
 		if deleteErr := storageInstance.DeleteFile(fileURL); deleteErr != nil {
-			log.Errorf("failed to delete uploaded file after thumbnail generation failed: %v", deleteErr)
+			log.Ctx(ctx).Errorf("failed to delete uploaded file after thumbnail generation failed: %v", deleteErr)
 		}
 		return err
 	}
 
 	// 使用事务处理数据库操作
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -180,6 +202,7 @@ func (s *ImageService) executeUpload(storageInstance storage.Storage, storageNam
 		Tags:            tags,
 		FileURL:         fileURL,
 		FileSize:        fileSize,
+		FileHash:        fileHash,
 		Width:           width,
 		Height:          height,
 		MimeType:        mimeType,
@@ -194,13 +217,13 @@ func (s *ImageService) executeUpload(storageInstance storage.Storage, storageNam
 	result := tx.Create(&imageModel)
 	if result.Error != nil {
 		tx.Rollback()
-		log.Errorf("failed to create image: error=%v", result.Error)
+		log.Ctx(ctx).Errorf("failed to create image: error=%v", result.Error)
 		// 清理已上传的文件和缩略图
 		if deleteErr := storageInstance.DeleteFile(fileURL); deleteErr != nil {
-			log.Errorf("failed to delete uploaded file after db error: %v", deleteErr)
+			log.Ctx(ctx).Errorf("failed to delete uploaded file after db error: %v", deleteErr)
 		}
 		if deleteErr := storageInstance.DeleteFile(thumbnailURL); deleteErr != nil {
-			log.Errorf("failed to delete thumbnail after db error: %v", deleteErr)
+			log.Ctx(ctx).Errorf("failed to delete thumbnail after db error: %v", deleteErr)
 		}
 		return cerrors.ErrInternalServer
 	}
@@ -209,13 +232,13 @@ func (s *ImageService) executeUpload(storageInstance storage.Storage, storageNam
 	if len(albums) > 0 {
 		if err := tx.Model(&imageModel).Association("Albums").Append(&albums); err != nil {
 			tx.Rollback()
-			log.Errorf("failed to associate albums: error=%v", err)
+			log.Ctx(ctx).Errorf("failed to associate albums: error=%v", err)
 			// 清理已上传的文件和缩略图
 			if deleteErr := storageInstance.DeleteFile(fileURL); deleteErr != nil {
-				log.Errorf("failed to delete uploaded file after album association error: %v", deleteErr)
+				log.Ctx(ctx).Errorf("failed to delete uploaded file after album association error: %v", deleteErr)
 			}
 			if deleteErr := storageInstance.DeleteFile(thumbnailURL); deleteErr != nil {
-				log.Errorf("failed to delete thumbnail after album association error: %v", deleteErr)
+				log.Ctx(ctx).Errorf("failed to delete thumbnail after album association error: %v", deleteErr)
 			}
 			return cerrors.ErrInternalServer
 		}
@@ -223,19 +246,36 @@ func (s *ImageService) executeUpload(storageInstance storage.Storage, storageNam
 		for _, album := range albums {
 			if err := tx.Model(&album).Update("image_count", album.ImageCount+1).Error; err != nil {
 				tx.Rollback()
-				log.Errorf("failed to update album image count: error=%v", err)
+				log.Ctx(ctx).Errorf("failed to update album image count: error=%v", err)
 				// 清理已上传的文件和缩略图
 				if deleteErr := storageInstance.DeleteFile(fileURL); deleteErr != nil {
-					log.Errorf("failed to delete uploaded file after album update error: %v", deleteErr)
+					log.Ctx(ctx).Errorf("failed to delete uploaded file after album update error: %v", deleteErr)
 				}
 				if deleteErr := storageInstance.DeleteFile(thumbnailURL); deleteErr != nil {
-					log.Errorf("failed to delete thumbnail after album update error: %v", deleteErr)
+					log.Ctx(ctx).Errorf("failed to delete thumbnail after album update error: %v", deleteErr)
 				}
 				return cerrors.ErrInternalServer
 			}
 		}
 	}
 
+	// 写入标签关联和检索文档
+	err = SyncImageTags(tx, imageModel)
+	if err == nil {
+		err = IndexImages(tx, imageModel.ID)
+	}
+	if err != nil {
+		tx.Rollback()
+		// 清理已上传的文件和缩略图
+		if deleteErr := storageInstance.DeleteFile(fileURL); deleteErr != nil {
+			log.Ctx(ctx).Errorf("failed to delete uploaded file after tag sync error: %v", deleteErr)
+		}
+		if deleteErr := storageInstance.DeleteFile(thumbnailURL); deleteErr != nil {
+			log.Ctx(ctx).Errorf("failed to delete thumbnail after tag sync error: %v", deleteErr)
+		}
+		return err
+	}
+
 	// 更新用户的存储空间使用情况
 	result = tx.Model(&models.User{}).Where("id = ?", currentUserID).
 		Updates(map[string]interface{}{
@@ -244,31 +284,31 @@ func (s *ImageService) executeUpload(storageInstance storage.Storage, storageNam
 		})
 	if result.Error != nil {
 		tx.Rollback()
-		log.Errorf("failed to update user storage usage: id=%d, error=%v", currentUserID, result.Error)
+		log.Ctx(ctx).Errorf("failed to update user storage usage: id=%d, error=%v", currentUserID, result.Error)
 		// 清理已上传的文件和缩略图
 		if deleteErr := storageInstance.DeleteFile(fileURL); deleteErr != nil {
-			log.Errorf("failed to delete uploaded file after user storage update error: %v", deleteErr)
+			log.Ctx(ctx).Errorf("failed to delete uploaded file after user storage update error: %v", deleteErr)
 		}
 		if deleteErr := storageInstance.DeleteFile(thumbnailURL); deleteErr != nil {
-			log.Errorf("failed to delete thumbnail after user storage update error: %v", deleteErr)
+			log.Ctx(ctx).Errorf("failed to delete thumbnail after user storage update error: %v", deleteErr)
 		}
 		return cerrors.ErrInternalServer
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("failed to commit transaction: %v", err)
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
 		// 清理已上传的文件和缩略图
 		if deleteErr := storageInstance.DeleteFile(fileURL); deleteErr != nil {
-			log.Errorf("failed to delete uploaded file after transaction commit error: %v", deleteErr)
+			log.Ctx(ctx).Errorf("failed to delete uploaded file after transaction commit error: %v", deleteErr)
 		}
 		if deleteErr := storageInstance.DeleteFile(thumbnailURL); deleteErr != nil {
-			log.Errorf("failed to delete thumbnail after transaction commit error: %v", deleteErr)
+			log.Ctx(ctx).Errorf("failed to delete thumbnail after transaction commit error: %v", deleteErr)
 		}
 		return cerrors.ErrInternalServer
 	}
 
-	s.db.Preload("Albums").First(&imageModel)
+	s.db.WithContext(ctx).Preload("Albums").First(&imageModel)
 
 	return nil
 }
@@ -313,7 +353,7 @@ func (s *ImageService) GetImage(currentUserID uint, imageID uint) (*ImageRespons
 	return &imageResponse, nil
 }
 
-func (s *ImageService) UpdateImage(currentUserID uint, imageID uint, originalName string, tags []string) (*ImageResponse, error) {
+func (s *ImageService) UpdateImage(ctx context.Context, currentUserID uint, imageID uint, originalName string, tags []string) (*ImageResponse, error) {
 	var imageModel models.Image
 	result := s.db.Preload("Albums").Where("id = ? AND user_id = ?", imageID, currentUserID).First(&imageModel)
 	if result.RowsAffected == 0 {
@@ -323,9 +363,33 @@ func (s *ImageService) UpdateImage(currentUserID uint, imageID uint, originalNam
 	imageModel.OriginalName = originalName
 	imageModel.Tags = tags
 
-	result = s.db.Save(&imageModel)
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := SyncImageTags(tx, &imageModel); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	result = tx.Save(&imageModel)
 	if result.Error != nil {
-		log.Errorf("failed to update image: id=%d, error=%v", imageID, result.Error)
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to update image: id=%d, error=%v", imageID, result.Error)
+		return nil, cerrors.ErrInternalServer
+	}
+
+	if err := IndexImages(tx, imageModel.ID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
 		return nil, cerrors.ErrInternalServer
 	}
 
@@ -334,9 +398,10 @@ func (s *ImageService) UpdateImage(currentUserID uint, imageID uint, originalNam
 	return &imageResponse, nil
 }
 
-func (s *ImageService) DeleteImage(currentUserID uint, imageID uint) error {
+// DeleteImage 将图片移入回收站，文件在回收站清理时才会删除
+func (s *ImageService) DeleteImage(ctx context.Context, currentUserID uint, imageID uint) error {
 	// 使用事务处理删除操作
-	tx := s.db.Begin()
+	tx := s.db.WithContext(ctx).Begin()
 	defer func() {
 		if r := recover(); r != nil {
 			tx.Rollback()
@@ -351,69 +416,21 @@ func (s *ImageService) DeleteImage(currentUserID uint, imageID uint) error {
 		return cerrors.ErrImageNotFound
 	}
 
-	// Get all albums that the image belongs to
-	var albums []models.Album
-	tx.Model(&image).Association("Albums").Find(&albums)
-
-	// Remove the image from each album
-	tx.Model(&image).Association("Albums").Clear()
-
-	// Update image_count for each album
-	for _, album := range albums {
-		if err := tx.Model(&album).Update("image_count", album.ImageCount-1).Error; err != nil {
-			tx.Rollback()
-			log.Errorf("failed to update album image count: error=%v", err)
-			return cerrors.ErrInternalServer
-		}
-	}
-
-	// 更新用户的存储空间使用情况
-	result = tx.Model(&models.User{}).Where("id = ?", currentUserID).
-		Updates(map[string]interface{}{
-			"total_size":  gorm.Expr("total_size - ?", image.FileSize+image.ThumbnailSize),
-			"image_count": gorm.Expr("image_count - ?", 1),
-		})
-	if result.Error != nil {
-		tx.Rollback()
-		log.Errorf("failed to update user storage usage: id=%d, error=%v", currentUserID, result.Error)
-		return cerrors.ErrInternalServer
-	}
-
-	// 删除数据库中的图片记录
-	result = tx.Delete(&image)
-	if result.Error != nil {
+	if err := TrashImage(tx, &image); err != nil {
 		tx.Rollback()
-		log.Errorf("failed to delete image: id=%d, error=%v", imageID, result.Error)
-		return cerrors.ErrInternalServer
+		return err
 	}
 
 	// 提交事务
 	if err := tx.Commit().Error; err != nil {
-		log.Errorf("failed to commit transaction: %v", err)
-		return cerrors.ErrInternalServer
-	}
-
-	// 获取图片对应的存储实例
-	storageInstance, err := s.getStorageByStorageName(image.StorageName)
-	if err != nil {
-		return err
-	}
-
-	// Delete the image from storage
-	if err := storageInstance.DeleteFile(image.FileURL); err != nil {
-		log.Errorf("failed to delete image file: id=%d, error=%v", imageID, err)
-		return cerrors.ErrInternalServer
-	}
-
-	if err := storageInstance.DeleteFile(image.ThumbnailURL); err != nil {
-		log.Errorf("failed to delete thumbnail image: id=%d, error=%v", imageID, err)
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
 		return cerrors.ErrInternalServer
 	}
 
 	return nil
 }
 
-func (s *ImageService) AddImageToAlbum(currentUserID uint, imageID uint, albumID uint) error {
+func (s *ImageService) AddImageToAlbum(ctx context.Context, currentUserID uint, imageID uint, albumID uint) error {
 	var album models.Album
 	result := s.db.Where("id = ? AND user_id = ?", albumID, currentUserID).First(&album)
 	if result.RowsAffected == 0 {
@@ -438,10 +455,14 @@ func (s *ImageService) AddImageToAlbum(currentUserID uint, imageID uint, albumID
 	s.db.Model(&image).Association("Albums").Append(&album)
 	s.db.Model(&album).Update("image_count", album.ImageCount+1)
 
+	if err := IndexImages(s.db, image.ID); err != nil {
+		log.Ctx(ctx).Errorf("failed to update search index: image_id=%d, error=%v", image.ID, err)
+	}
+
 	return nil
 }
 
-func (s *ImageService) RemoveImageFromAlbum(currentUserID uint, imageID uint, albumID uint) error {
+func (s *ImageService) RemoveImageFromAlbum(ctx context.Context, currentUserID uint, imageID uint, albumID uint) error {
 	var album models.Album
 	result := s.db.Where("id = ? AND user_id = ?", albumID, currentUserID).First(&album)
 	if result.RowsAffected == 0 {
@@ -466,6 +487,10 @@ func (s *ImageService) RemoveImageFromAlbum(currentUserID uint, imageID uint, al
 	s.db.Model(&image).Association("Albums").Delete(&album)
 	s.db.Model(&album).Update("image_count", album.ImageCount-1)
 
+	if err := IndexImages(s.db, image.ID); err != nil {
+		log.Ctx(ctx).Errorf("failed to update search index: image_id=%d, error=%v", image.ID, err)
+	}
+
 	return nil
 }
 
@@ -475,17 +500,17 @@ func (s *ImageService) SearchImagesByTagsOrTitle(currentUserID uint, searchKey s
 	var imageModels []models.Image
 	var images []ImageResponse
 	var total int64
-	var db *gorm.DB
 
-	if searchKey != "" {
-		sk := fmt.Sprintf("%%%s%%", searchKey)
-		db = s.db.Model(&imageModels).Where("user_id = ? AND (tags LIKE ? OR original_name LIKE ?)", currentUserID, sk, sk)
+	db, err := ApplySearchQuery(s.db.Model(&imageModels).Where("user_id = ?", currentUserID), searchKey)
+	if err != nil {
+		return nil, err
 	}
 
 	db.Count(&total)
-	db.Preload("Albums").Offset(offset).Limit(pageSize).Order("created_at DESC").Find(&imageModels)
+	OrderByRelevance(db.Preload("Albums").Offset(offset).Limit(pageSize), searchKey, "images.created_at DESC").Find(&imageModels)
 
 	images = MakeImagesWithAlbum(imageModels)
+	HighlightImages(searchKey, images)
 
 	return &GetImagesResponse{
 		Images:   images,
@@ -495,7 +520,7 @@ func (s *ImageService) SearchImagesByTagsOrTitle(currentUserID uint, searchKey s
 	}, nil
 }
 
-func (s *ImageService) UploadImageLimitCheck(currentUserID uint, files []*multipart.FileHeader) error {
+func (s *ImageService) UploadImageLimitCheck(ctx context.Context, currentUserID uint, files []*multipart.FileHeader) error {
 	var user models.User
 	result := s.db.Preload("Role").Where("id = ?", currentUserID).First(&user)
 	if result.RowsAffected == 0 {
@@ -530,6 +555,15 @@ func (s *ImageService) UploadImageLimitCheck(currentUserID uint, files []*multip
 
 	if user.Role.MaxStorageSizeMB != -1 {
 		StorageUsed := user.TotalSize
+		// 根据设置决定回收站中的图片是否计入配额
+		if s.cfg.SystemSettings.Trash.CountInQuota {
+			trashedSize, err := TrashedSize(s.db, currentUserID)
+			if err != nil {
+				log.Ctx(ctx).Errorf("failed to get trashed size: user_id=%d, error=%v", currentUserID, err)
+				return cerrors.ErrInternalServer
+			}
+			StorageUsed += trashedSize
+		}
 		if StorageUsed+int64(uploadFileSize) > int64(user.Role.MaxStorageSizeMB)*1024*1024 {
 			return cerrors.ErrMaxStorageSizeMB
 		}
@@ -538,7 +572,18 @@ func (s *ImageService) UploadImageLimitCheck(currentUserID uint, files []*multip
 	return nil
 }
 
-func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string, File *multipart.FileHeader, ostorage storage.Storage) (string, int, int, int64, error) {
+// GetThumbnails 生成缩略图并上传，返回缩略图的 URL、宽、高和大小
+func GetThumbnails(ctx context.Context, dateDir, fileUUID string, maxThumbSize uint, MimeType string, File *multipart.FileHeader, ostorage storage.Storage) (string, int, int, int64, error) {
+	ctx, span := tracing.Start(ctx, "image.thumbnail", trace.WithAttributes(
+		attribute.String("image.mime_type", MimeType),
+		attribute.Int64("image.size", File.Size),
+	))
+	thumbnailURL, thumbnailWidth, thumbnailHeight, thumbnailSize, err := getThumbnails(ctx, dateDir, fileUUID, maxThumbSize, MimeType, File, ostorage)
+	tracing.End(span, err)
+	return thumbnailURL, thumbnailWidth, thumbnailHeight, thumbnailSize, err
+}
+
+func getThumbnails(ctx context.Context, dateDir, fileUUID string, maxThumbSize uint, MimeType string, File *multipart.FileHeader, ostorage storage.Storage) (string, int, int, int64, error) {
 	// 根据 MimeType 确定缩略图扩展名
 	thumbnailExt := "jpg"
 	if MimeType == "image/gif" {
@@ -547,14 +592,14 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 	thumbnailName := fmt.Sprintf("%s_thumbnail.%s", fileUUID, thumbnailExt)
 	err := os.MkdirAll("tmp", 0755)
 	if err != nil {
-		log.Errorf("failed to create temporary directory: path=%s, error=%v", "tmp", err)
+		log.Ctx(ctx).Errorf("failed to create temporary directory: path=%s, error=%v", "tmp", err)
 		return "", 0, 0, 0, cerrors.ErrInternalServer
 	}
 	thumbnailPath := filepath.Join("tmp", thumbnailName)
 
 	file, err := File.Open()
 	if err != nil {
-		log.Errorf("failed to open file: path=%s, error=%v", File.Filename, err)
+		log.Ctx(ctx).Errorf("failed to open file: path=%s, error=%v", File.Filename, err)
 		return "", 0, 0, 0, cerrors.ErrInternalServer
 	}
 	defer file.Close()
@@ -563,18 +608,21 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 	if MimeType == "image/gif" {
 		// 重置文件指针到开头
 		if _, err := file.Seek(0, io.SeekStart); err != nil {
-			log.Errorf("failed to seek file: error=%v", err)
+			log.Ctx(ctx).Errorf("failed to seek file: error=%v", err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 
 		// 解码整个 GIF 动画
+		_, decodeSpan := tracing.Start(ctx, "image.decode")
 		gifImg, err := gif.DecodeAll(file)
+		tracing.End(decodeSpan, err)
 		if err != nil {
-			log.Errorf("failed to decode gif: error=%v", err)
+			log.Ctx(ctx).Errorf("failed to decode gif: error=%v", err)
 			return "", 0, 0, 0, cerrors.ErrDecodeImage
 		}
 
 		// 处理每一帧
+		_, resizeSpan := tracing.Start(ctx, "image.resize", trace.WithAttributes(attribute.Int("image.frames", len(gifImg.Image))))
 		for i, frame := range gifImg.Image {
 			// 缩放每一帧
 			resizedFrame := resize.Thumbnail(maxThumbSize, maxThumbSize, frame, resize.Lanczos3)
@@ -589,6 +637,7 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 				gifImg.Image[i] = palettedFrame
 			}
 		}
+		resizeSpan.End()
 
 		// 更新 GIF 配置的尺寸为第一帧的尺寸
 		if len(gifImg.Image) > 0 {
@@ -600,7 +649,7 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 		// 创建临时文件
 		tempFile, err := os.Create(thumbnailPath)
 		if err != nil {
-			log.Errorf("failed to create temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to create temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 
@@ -608,27 +657,27 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 		if err := gif.EncodeAll(tempFile, gifImg); err != nil {
 			tempFile.Close()
 			if err := os.Remove(thumbnailPath); err != nil {
-				log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+				log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 				return "", 0, 0, 0, cerrors.ErrInternalServer
 			}
-			log.Errorf("failed to encode gif thumbnail: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to encode gif thumbnail: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrEncodeImage
 		}
 
 		// 关闭文件
 		if err := tempFile.Close(); err != nil {
 			if err := os.Remove(thumbnailPath); err != nil {
-				log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+				log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 				return "", 0, 0, 0, cerrors.ErrInternalServer
 			}
-			log.Errorf("failed to close temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to close temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 
 		// 获取文件信息
 		fileInfo, err := os.Stat(thumbnailPath)
 		if err != nil {
-			log.Errorf("failed to get thumbnail file info: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to get thumbnail file info: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 
@@ -643,7 +692,7 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 			thumbnailURL, err := ostorage.UploadFile(nil, thumbnailPath, dateDir, thumbnailName)
 			if err != nil {
 				if err := os.Remove(thumbnailPath); err != nil {
-					log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+					log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 					return "", 0, 0, 0, cerrors.ErrInternalServer
 				}
 				return "", 0, 0, 0, err
@@ -651,7 +700,7 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 
 			// 清理临时文件
 			if err := os.Remove(thumbnailPath); err != nil {
-				log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+				log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 				return "", 0, 0, 0, cerrors.ErrInternalServer
 			}
 
@@ -660,12 +709,13 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 
 		// 如果没有帧，返回错误
 		if err := os.Remove(thumbnailPath); err != nil {
-			log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 		}
 		return "", 0, 0, 0, cerrors.ErrDecodeImage
 	} else {
 		// 处理其他文件类型
 		var img image.Image
+		_, decodeSpan := tracing.Start(ctx, "image.decode")
 		switch MimeType {
 		case "image/bmp":
 			img, err = bmp.Decode(file)
@@ -674,22 +724,25 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 		case "image/webp":
 			img, err = webp.Decode(file)
 		case "image/svg+xml":
-			return "", 0, 0, 0, cerrors.ErrDecodeImage
+			err = cerrors.ErrDecodeImage
 		default:
 			// 对于 jpeg, png，image.Decode 会自动处理
 			img, _, err = image.Decode(file)
 		}
+		tracing.End(decodeSpan, err)
 
 		if err != nil {
 			return "", 0, 0, 0, cerrors.ErrDecodeImage
 		}
 
+		_, resizeSpan := tracing.Start(ctx, "image.resize")
 		canvas := resize.Thumbnail(maxThumbSize, maxThumbSize, img, resize.Lanczos3)
+		resizeSpan.End()
 
 		// 创建临时文件
 		tempFile, err := os.Create(thumbnailPath)
 		if err != nil {
-			log.Errorf("failed to create temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to create temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 
@@ -697,27 +750,27 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 		if err := jpeg.Encode(tempFile, canvas, &jpeg.Options{Quality: 85}); err != nil {
 			tempFile.Close()
 			if err := os.Remove(thumbnailPath); err != nil {
-				log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+				log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 				return "", 0, 0, 0, cerrors.ErrInternalServer
 			}
-			log.Errorf("failed to encode thumbnail image: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to encode thumbnail image: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrEncodeImage
 		}
 
 		// 关闭文件
 		if err := tempFile.Close(); err != nil {
 			if err := os.Remove(thumbnailPath); err != nil {
-				log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+				log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 				return "", 0, 0, 0, cerrors.ErrInternalServer
 			}
-			log.Errorf("failed to close temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to close temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 
 		// 获取文件的实际大小
 		fileInfo, err := os.Stat(thumbnailPath)
 		if err != nil {
-			log.Errorf("failed to get thumbnail file info: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to get thumbnail file info: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 		thumbnailSize := fileInfo.Size()
@@ -727,7 +780,7 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 		thumbnailURL, err := ostorage.UploadFile(nil, thumbnailPath, dateDir, thumbnailName)
 		if err != nil {
 			if err := os.Remove(thumbnailPath); err != nil {
-				log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+				log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 				return "", 0, 0, 0, cerrors.ErrInternalServer
 			}
 			return "", 0, 0, 0, err
@@ -735,7 +788,7 @@ func GetThumbnails(dateDir, fileUUID string, maxThumbSize uint, MimeType string,
 
 		// 清理临时文件
 		if err := os.Remove(thumbnailPath); err != nil {
-			log.Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
+			log.Ctx(ctx).Errorf("failed to remove temporary thumbnail file: path=%s, error=%v", thumbnailPath, err)
 			return "", 0, 0, 0, cerrors.ErrInternalServer
 		}
 
@@ -802,6 +855,23 @@ func GetFileType(File *multipart.FileHeader) (string, string, error) {
 	return kind.Extension, kind.MIME.Value, nil
 }
 
+// GetFileHash 计算文件内容的 SHA-256
+func GetFileHash(File *multipart.FileHeader) (string, error) {
+	file, err := File.Open()
+	if err != nil {
+		log.Errorf("failed to open file: error=%v", err)
+		return "", cerrors.ErrInternalServer
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		log.Errorf("failed to read file: error=%v", err)
+		return "", cerrors.ErrInternalServer
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func MakeImagesWithAlbum(imageModels []models.Image) []ImageResponse {
 	images := make([]ImageResponse, 0) // 非 nil 空切片
 
@@ -840,6 +910,8 @@ func MakeImagesWithAlbum(imageModels []models.Image) []ImageResponse {
 			UserID:          imageModel.UserID,
 			Albums:          albumResponses,
 			StorageName:     imageModel.StorageName,
+			Hidden:          imageModel.Hidden,
+			DeletedAt:       deletedAtTime(imageModel.DeletedAt),
 		})
 	}
 
@@ -881,5 +953,15 @@ func MakeImageWithAlbum(imageModel models.Image) ImageResponse {
 		UserID:          imageModel.UserID,
 		Albums:          albumResponse,
 		StorageName:     imageModel.StorageName,
+		Hidden:          imageModel.Hidden,
+		DeletedAt:       deletedAtTime(imageModel.DeletedAt),
+	}
+}
+
+// deletedAtTime 将软删除时间转换为可选时间，未删除时返回 nil
+func deletedAtTime(deletedAt gorm.DeletedAt) *time.Time {
+	if !deletedAt.Valid {
+		return nil
 	}
+	return &deletedAt.Time
 }
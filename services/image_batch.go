@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// 批量操作类型
+const (
+	BatchAddTags         = "add_tags"
+	BatchRemoveTags      = "remove_tags"
+	BatchSetTags         = "set_tags"
+	BatchAddToAlbum      = "add_to_album"
+	BatchRemoveFromAlbum = "remove_from_album"
+	BatchMoveToAlbum     = "move_to_album"
+	BatchDelete          = "delete"
+	BatchSetVisibility   = "set_visibility"
+)
+
+// MaxBatchImages 单次批量操作允许的最大图片数量
+const MaxBatchImages = 1000
+
+// BatchImageRequest 批量操作请求，IDs 与 SearchKey（搜索语句）二选一，同时提供时以 IDs 为准
+type BatchImageRequest struct {
+	IDs         []uint   `json:"ids"`
+	SearchKey   string   `json:"search_key"`
+	Operation   string   `json:"operation" binding:"required"`
+	Tags        []string `json:"tags"`          // add_tags / remove_tags / set_tags
+	AlbumID     uint     `json:"album_id"`      // add_to_album / remove_from_album / move_to_album 的目标相册
+	FromAlbumID uint     `json:"from_album_id"` // move_to_album 的来源相册，为 0 时从所有相册移出
+	Hidden      *bool    `json:"hidden"`        // set_visibility
+}
+
+type BatchImageResponse struct {
+	Operation  string          `json:"operation"`
+	Total      int             `json:"total"`
+	SuccessIDs map[uint]string `json:"success_ids"`
+	ErrorIDs   map[uint]string `json:"error_ids"`
+}
+
+// BatchImages 在一个事务中对多张图片执行同一操作
+// 单张图片的业务错误（不存在、已在相册中等）记录在 ErrorIDs 中，不影响其他图片；数据库错误会回滚整个批次
+func (s *ImageService) BatchImages(ctx context.Context, currentUserID uint, req BatchImageRequest) (*BatchImageResponse, error) {
+	if err := checkBatchRequest(&req); err != nil {
+		return nil, err
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	ids, err := s.batchTargetIDs(tx, currentUserID, req)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// 相册操作需先校验相册归属
+	var album models.Album
+	switch req.Operation {
+	case BatchAddToAlbum, BatchRemoveFromAlbum, BatchMoveToAlbum:
+		if tx.Where("id = ? AND user_id = ?", req.AlbumID, currentUserID).Limit(1).Find(&album).RowsAffected == 0 {
+			tx.Rollback()
+			return nil, cerrors.ErrAlbumNotFound
+		}
+	}
+	if req.Operation == BatchMoveToAlbum && req.FromAlbumID != 0 {
+		var fromAlbum models.Album
+		if tx.Where("id = ? AND user_id = ?", req.FromAlbumID, currentUserID).Limit(1).Find(&fromAlbum).RowsAffected == 0 {
+			tx.Rollback()
+			return nil, cerrors.ErrAlbumNotFound
+		}
+	}
+
+	var images []models.Image
+	if len(ids) > 0 {
+		if err := tx.Where("id IN ? AND user_id = ?", ids, currentUserID).Find(&images).Error; err != nil {
+			tx.Rollback()
+			log.Ctx(ctx).Errorf("failed to find images for batch: user_id=%d, error=%v", currentUserID, err)
+			return nil, cerrors.ErrInternalServer
+		}
+	}
+	imageMap := make(map[uint]*models.Image, len(images))
+	for i := range images {
+		imageMap[images[i].ID] = &images[i]
+	}
+
+	response := &BatchImageResponse{
+		Operation:  req.Operation,
+		Total:      len(ids),
+		SuccessIDs: make(map[uint]string),
+		ErrorIDs:   make(map[uint]string),
+	}
+	// 相册图片数量的变化量，最后统一更新
+	albumDeltas := make(map[uint]int)
+
+	for _, id := range ids {
+		image, ok := imageMap[id]
+		if !ok {
+			response.ErrorIDs[id] = cerrors.ErrImageNotFound.Error()
+			continue
+		}
+
+		var itemErr error
+		switch req.Operation {
+		case BatchAddTags, BatchRemoveTags, BatchSetTags:
+			itemErr = batchUpdateTags(tx, image, req.Operation, req.Tags)
+		case BatchAddToAlbum:
+			itemErr = batchAddToAlbum(tx, image.ID, req.AlbumID, albumDeltas)
+		case BatchRemoveFromAlbum:
+			itemErr = batchRemoveFromAlbum(tx, image.ID, req.AlbumID, albumDeltas)
+		case BatchMoveToAlbum:
+			itemErr = batchMoveToAlbum(tx, image.ID, req.FromAlbumID, req.AlbumID, albumDeltas)
+		case BatchDelete:
+			itemErr = TrashImage(tx, image)
+		case BatchSetVisibility:
+			if err := tx.Model(image).Update("hidden", *req.Hidden).Error; err != nil {
+				log.Ctx(ctx).Errorf("failed to update image visibility: id=%d, error=%v", image.ID, err)
+				itemErr = cerrors.ErrInternalServer
+			}
+		}
+
+		if itemErr != nil {
+			if itemErr == cerrors.ErrInternalServer {
+				tx.Rollback()
+				return nil, itemErr
+			}
+			response.ErrorIDs[id] = itemErr.Error()
+			continue
+		}
+		response.SuccessIDs[id] = req.Operation + " success"
+	}
+
+	for albumID, delta := range albumDeltas {
+		if delta == 0 {
+			continue
+		}
+		result := tx.Model(&models.Album{}).Where("id = ?", albumID).
+			Update("image_count", gorm.Expr("image_count + ?", delta))
+		if result.Error != nil {
+			tx.Rollback()
+			log.Ctx(ctx).Errorf("failed to update album image count: id=%d, error=%v", albumID, result.Error)
+			return nil, cerrors.ErrInternalServer
+		}
+	}
+
+	// 标签和相册变化后更新检索文档
+	if req.Operation != BatchDelete && req.Operation != BatchSetVisibility {
+		indexIDs := make([]uint, 0, len(response.SuccessIDs))
+		for id := range response.SuccessIDs {
+			indexIDs = append(indexIDs, id)
+		}
+		if err := IndexImages(tx, indexIDs...); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+
+	return response, nil
+}
+
+// checkBatchRequest 校验操作类型及其所需参数，并规范化标签
+func checkBatchRequest(req *BatchImageRequest) error {
+	if len(req.IDs) == 0 && strings.TrimSpace(req.SearchKey) == "" {
+		return cerrors.ErrBadRequest
+	}
+	if len(req.IDs) > MaxBatchImages {
+		return cerrors.ErrBatchTooLarge
+	}
+
+	switch req.Operation {
+	case BatchAddTags, BatchRemoveTags, BatchSetTags:
+		req.Tags = normalizeTags(req.Tags)
+		// set_tags 允许设置为空以清除标签
+		if len(req.Tags) == 0 && req.Operation != BatchSetTags {
+			return cerrors.ErrBadRequest
+		}
+		for _, tag := range req.Tags {
+			if len(tag) > MaxTagNameLength {
+				return cerrors.ErrInvalidTagName
+			}
+		}
+	case BatchAddToAlbum, BatchRemoveFromAlbum, BatchMoveToAlbum:
+		if req.AlbumID == 0 {
+			return cerrors.ErrBadRequest
+		}
+		if req.Operation == BatchMoveToAlbum && req.FromAlbumID == req.AlbumID {
+			return cerrors.ErrBadRequest
+		}
+	case BatchDelete:
+	case BatchSetVisibility:
+		if req.Hidden == nil {
+			return cerrors.ErrBadRequest
+		}
+	default:
+		return cerrors.ErrInvalidBatchOperation
+	}
+	return nil
+}
+
+// batchTargetIDs 获取批量操作的目标图片ID，未指定ID时按搜索条件匹配
+func (s *ImageService) batchTargetIDs(tx *gorm.DB, currentUserID uint, req BatchImageRequest) ([]uint, error) {
+	if len(req.IDs) > 0 {
+		// remove duplicates
+		ids := make([]uint, 0, len(req.IDs))
+		seen := make(map[uint]bool, len(req.IDs))
+		for _, id := range req.IDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	var ids []uint
+	db, err := ApplySearchQuery(tx.Model(&models.Image{}).Where("user_id = ?", currentUserID), req.SearchKey)
+	if err != nil {
+		return nil, err
+	}
+	result := db.Order("created_at DESC").
+		Limit(MaxBatchImages+1).
+		Pluck("id", &ids)
+	if result.Error != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to search images for batch: user_id=%d, error=%v", currentUserID, result.Error)
+		return nil, cerrors.ErrInternalServer
+	}
+	if len(ids) > MaxBatchImages {
+		return nil, cerrors.ErrBatchTooLarge
+	}
+	return ids, nil
+}
+
+// normalizeTags 去除标签首尾空白、空标签和重复标签，保持原有顺序
+func normalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// applyTagOperation 计算标签操作后的新标签列表
+func applyTagOperation(current []string, operation string, tags []string) []string {
+	switch operation {
+	case BatchAddTags:
+		return normalizeTags(append(slices.Clone(current), tags...))
+	case BatchRemoveTags:
+		result := make([]string, 0, len(current))
+		for _, tag := range current {
+			if !slices.Contains(tags, tag) {
+				result = append(result, tag)
+			}
+		}
+		return result
+	default:
+		return slices.Clone(tags)
+	}
+}
+
+func batchUpdateTags(tx *gorm.DB, image *models.Image, operation string, tags []string) error {
+	image.Tags = applyTagOperation(image.Tags, operation, tags)
+	if err := tx.Model(image).Select("tags").Updates(&models.Image{Tags: image.Tags}).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to update image tags: id=%d, error=%v", image.ID, err)
+		return cerrors.ErrInternalServer
+	}
+	return SyncImageTags(tx, image)
+}
+
+func batchAddToAlbum(tx *gorm.DB, imageID, albumID uint, albumDeltas map[uint]int) error {
+	var count int64
+	if err := tx.Model(&models.ImageAlbum{}).
+		Where("image_id = ? AND album_id = ?", imageID, albumID).
+		Count(&count).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to check image album: image_id=%d, album_id=%d, error=%v", imageID, albumID, err)
+		return cerrors.ErrInternalServer
+	}
+	if count > 0 {
+		return cerrors.ErrImageAlreadyInAlbum
+	}
+
+	if err := tx.Create(&models.ImageAlbum{ImageID: imageID, AlbumID: albumID}).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to add image to album: image_id=%d, album_id=%d, error=%v", imageID, albumID, err)
+		return cerrors.ErrInternalServer
+	}
+	albumDeltas[albumID]++
+	return nil
+}
+
+func batchRemoveFromAlbum(tx *gorm.DB, imageID, albumID uint, albumDeltas map[uint]int) error {
+	result := tx.Where("image_id = ? AND album_id = ?", imageID, albumID).Delete(&models.ImageAlbum{})
+	if result.Error != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to remove image from album: image_id=%d, album_id=%d, error=%v", imageID, albumID, result.Error)
+		return cerrors.ErrInternalServer
+	}
+	if result.RowsAffected == 0 {
+		return cerrors.ErrImageNotInAlbum
+	}
+	albumDeltas[albumID]--
+	return nil
+}
+
+// batchMoveToAlbum 将图片从来源相册移到目标相册，fromAlbumID 为 0 时从所有未删除的相册移出
+func batchMoveToAlbum(tx *gorm.DB, imageID, fromAlbumID, toAlbumID uint, albumDeltas map[uint]int) error {
+	var fromAlbumIDs []uint
+	if fromAlbumID != 0 {
+		fromAlbumIDs = []uint{fromAlbumID}
+	} else {
+		err := tx.Model(&models.ImageAlbum{}).
+			Where("image_id = ? AND album_id <> ? AND album_id IN (SELECT id FROM albums WHERE deleted_at IS NULL)", imageID, toAlbumID).
+			Pluck("album_id", &fromAlbumIDs).Error
+		if err != nil {
+			log.Ctx(tx.Statement.Context).Errorf("failed to find image albums: image_id=%d, error=%v", imageID, err)
+			return cerrors.ErrInternalServer
+		}
+	}
+
+	for _, albumID := range fromAlbumIDs {
+		if err := batchRemoveFromAlbum(tx, imageID, albumID, albumDeltas); err != nil {
+			return err
+		}
+	}
+
+	// 已在目标相册中视为移动成功
+	if err := batchAddToAlbum(tx, imageID, toAlbumID, albumDeltas); err != nil && err != cerrors.ErrImageAlreadyInAlbum {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// createBatchTestImages 为用户创建 n 张图片，文件名以 prefix 开头
+func createBatchTestImages(t *testing.T, db *gorm.DB, userID uint, prefix string, n int) []models.Image {
+	t.Helper()
+	images := make([]models.Image, n)
+	for i := range images {
+		name := fmt.Sprintf("%s-%d.png", prefix, i)
+		images[i] = models.Image{FileName: name, OriginalName: name, FileURL: "/uploads/" + name, UserID: userID}
+	}
+	if err := db.CreateInBatches(&images, 200).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	return images
+}
+
+// albumImageIDs 返回相册中的图片 ID 和相册记录的图片数量
+func albumImageIDs(t *testing.T, db *gorm.DB, albumID uint) ([]uint, int) {
+	t.Helper()
+	var ids []uint
+	if err := db.Model(&models.ImageAlbum{}).Where("album_id = ?", albumID).Order("image_id").Pluck("image_id", &ids).Error; err != nil {
+		t.Fatalf("failed to find album images: %v", err)
+	}
+	var album models.Album
+	if err := db.First(&album, albumID).Error; err != nil {
+		t.Fatalf("album not found: %v", err)
+	}
+	return ids, album.ImageCount
+}
+
+func TestBatchImages(t *testing.T) {
+	db := openTestDB(t)
+	service := NewImageService(db, &config.Config{})
+	ctx := context.Background()
+
+	mine := createBatchTestImages(t, db, 1, "mine", 3)
+	others := createBatchTestImages(t, db, 2, "other", 1)
+	album := models.Album{Name: "trip", UserID: 1}
+	target := models.Album{Name: "best", UserID: 1}
+	foreignAlbum := models.Album{Name: "foreign", UserID: 2}
+	for _, a := range []*models.Album{&album, &target, &foreignAlbum} {
+		if err := db.Create(a).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+
+	// 重复的 ID 只处理一次，其他用户的图片和不存在的图片记录在 ErrorIDs 中
+	resp, err := service.BatchImages(ctx, 1, BatchImageRequest{
+		IDs:       []uint{mine[0].ID, others[0].ID, 9999, mine[0].ID, mine[1].ID},
+		Operation: BatchAddTags,
+		Tags:      []string{" sea ", "sky"},
+	})
+	if err != nil {
+		t.Fatalf("BatchImages(add_tags) error = %v", err)
+	}
+	if resp.Total != 4 || len(resp.SuccessIDs) != 2 || len(resp.ErrorIDs) != 2 {
+		t.Errorf("BatchImages(add_tags) = %+v, want 2 successes and 2 errors of 4", resp)
+	}
+	for _, id := range []uint{others[0].ID, 9999} {
+		if resp.ErrorIDs[id] != cerrors.ErrImageNotFound.Error() {
+			t.Errorf("ErrorIDs[%d] = %q, want image not found", id, resp.ErrorIDs[id])
+		}
+	}
+	if names := imageTagNames(t, db, mine[0].ID); !slices.Equal(names, []string{"sea", "sky"}) {
+		t.Errorf("tags of own image = %v, want [sea sky]", names)
+	}
+	if names := imageTagNames(t, db, others[0].ID); len(names) != 0 {
+		t.Errorf("tags of other user's image = %v, want none", names)
+	}
+
+	if _, err := service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[0].ID}, Operation: BatchRemoveTags, Tags: []string{"sea"}}); err != nil {
+		t.Fatalf("BatchImages(remove_tags) error = %v", err)
+	}
+	if names := imageTagNames(t, db, mine[0].ID); !slices.Equal(names, []string{"sky"}) {
+		t.Errorf("tags after remove_tags = %v, want [sky]", names)
+	}
+
+	// 已在相册中的图片单独报错，其他图片正常加入
+	if _, err := service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[0].ID}, Operation: BatchAddToAlbum, AlbumID: album.ID}); err != nil {
+		t.Fatalf("BatchImages(add_to_album) error = %v", err)
+	}
+	resp, err = service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[0].ID, mine[1].ID}, Operation: BatchAddToAlbum, AlbumID: album.ID})
+	if err != nil {
+		t.Fatalf("BatchImages(add_to_album) error = %v", err)
+	}
+	if resp.ErrorIDs[mine[0].ID] != cerrors.ErrImageAlreadyInAlbum.Error() || resp.SuccessIDs[mine[1].ID] == "" {
+		t.Errorf("BatchImages(add_to_album) = %+v, want first image already in album", resp)
+	}
+	if ids, count := albumImageIDs(t, db, album.ID); len(ids) != 2 || count != 2 {
+		t.Errorf("album images = %v, count %d, want 2 images", ids, count)
+	}
+
+	resp, err = service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[1].ID, mine[2].ID}, Operation: BatchMoveToAlbum, FromAlbumID: album.ID, AlbumID: target.ID})
+	if err != nil {
+		t.Fatalf("BatchImages(move_to_album) error = %v", err)
+	}
+	if resp.ErrorIDs[mine[2].ID] != cerrors.ErrImageNotInAlbum.Error() || resp.SuccessIDs[mine[1].ID] == "" {
+		t.Errorf("BatchImages(move_to_album) = %+v, want only the image in the source album moved", resp)
+	}
+	if ids, count := albumImageIDs(t, db, album.ID); !slices.Equal(ids, []uint{mine[0].ID}) || count != 1 {
+		t.Errorf("source album images = %v, count %d, want [%d]", ids, count, mine[0].ID)
+	}
+	if ids, count := albumImageIDs(t, db, target.ID); !slices.Equal(ids, []uint{mine[1].ID}) || count != 1 {
+		t.Errorf("target album images = %v, count %d, want [%d]", ids, count, mine[1].ID)
+	}
+
+	hidden := true
+	if _, err := service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[2].ID, others[0].ID}, Operation: BatchSetVisibility, Hidden: &hidden}); err != nil {
+		t.Fatalf("BatchImages(set_visibility) error = %v", err)
+	}
+	var hiddenIDs []uint
+	db.Model(&models.Image{}).Where("hidden = ?", true).Pluck("id", &hiddenIDs)
+	if !slices.Equal(hiddenIDs, []uint{mine[2].ID}) {
+		t.Errorf("hidden images = %v, want [%d]", hiddenIDs, mine[2].ID)
+	}
+
+	resp, err = service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[0].ID, others[0].ID}, Operation: BatchDelete})
+	if err != nil {
+		t.Fatalf("BatchImages(delete) error = %v", err)
+	}
+	if len(resp.SuccessIDs) != 1 || resp.SuccessIDs[mine[0].ID] == "" {
+		t.Errorf("BatchImages(delete) = %+v, want only own image deleted", resp)
+	}
+	var remaining int64
+	db.Model(&models.Image{}).Where("id IN ?", []uint{mine[0].ID, others[0].ID}).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("images left after delete = %d, want 1", remaining)
+	}
+	if _, count := albumImageIDs(t, db, album.ID); count != 0 {
+		t.Errorf("album image count after delete = %d, want 0", count)
+	}
+
+	// 相册必须属于当前用户
+	for _, operation := range []string{BatchAddToAlbum, BatchRemoveFromAlbum, BatchMoveToAlbum} {
+		_, err := service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[1].ID}, Operation: operation, AlbumID: foreignAlbum.ID})
+		if !errors.Is(err, cerrors.ErrAlbumNotFound) {
+			t.Errorf("BatchImages(%s) to other user's album error = %v, want ErrAlbumNotFound", operation, err)
+		}
+	}
+	_, err = service.BatchImages(ctx, 1, BatchImageRequest{IDs: []uint{mine[1].ID}, Operation: BatchMoveToAlbum, FromAlbumID: foreignAlbum.ID, AlbumID: album.ID})
+	if !errors.Is(err, cerrors.ErrAlbumNotFound) {
+		t.Errorf("BatchImages(move_to_album) from other user's album error = %v, want ErrAlbumNotFound", err)
+	}
+}
+
+func TestBatchImagesLimit(t *testing.T) {
+	db := openTestDB(t)
+	service := NewImageService(db, &config.Config{})
+	ctx := context.Background()
+
+	ids := make([]uint, MaxBatchImages+1)
+	for i := range ids {
+		ids[i] = uint(i + 1)
+	}
+	if _, err := service.BatchImages(ctx, 1, BatchImageRequest{IDs: ids, Operation: BatchDelete}); !errors.Is(err, cerrors.ErrBatchTooLarge) {
+		t.Errorf("BatchImages() with %d IDs error = %v, want ErrBatchTooLarge", len(ids), err)
+	}
+
+	// 按搜索条件匹配的图片超过上限时拒绝，不做部分处理
+	images := createBatchTestImages(t, db, 1, "bulk", MaxBatchImages+1)
+	if _, err := service.BatchImages(ctx, 1, BatchImageRequest{SearchKey: "bulk", Operation: BatchDelete}); !errors.Is(err, cerrors.ErrBatchTooLarge) {
+		t.Errorf("BatchImages() matching %d images error = %v, want ErrBatchTooLarge", len(images), err)
+	}
+	var count int64
+	db.Model(&models.Image{}).Count(&count)
+	if count != int64(len(images)) {
+		t.Errorf("images after rejected batch = %d, want %d", count, len(images))
+	}
+
+	// 上限以内按搜索条件处理
+	db.Delete(&images[0])
+	resp, err := service.BatchImages(ctx, 1, BatchImageRequest{SearchKey: "bulk", Operation: BatchAddTags, Tags: []string{"bulk"}})
+	if err != nil {
+		t.Fatalf("BatchImages() by search error = %v", err)
+	}
+	if resp.Total != MaxBatchImages || len(resp.SuccessIDs) != MaxBatchImages {
+		t.Errorf("BatchImages() by search total = %d, successes = %d, want %d", resp.Total, len(resp.SuccessIDs), MaxBatchImages)
+	}
+}
+
+func TestCheckBatchRequest(t *testing.T) {
+	hidden := false
+	tests := []struct {
+		name    string
+		req     BatchImageRequest
+		wantErr error
+	}{
+		{name: "no target", req: BatchImageRequest{Operation: BatchDelete}, wantErr: cerrors.ErrBadRequest},
+		{name: "unknown operation", req: BatchImageRequest{IDs: []uint{1}, Operation: "rotate"}, wantErr: cerrors.ErrInvalidBatchOperation},
+		{name: "add tags without tags", req: BatchImageRequest{IDs: []uint{1}, Operation: BatchAddTags, Tags: []string{" "}}, wantErr: cerrors.ErrBadRequest},
+		{name: "set tags to empty", req: BatchImageRequest{IDs: []uint{1}, Operation: BatchSetTags}},
+		{name: "tag too long", req: BatchImageRequest{IDs: []uint{1}, Operation: BatchAddTags, Tags: []string{strings.Repeat("x", MaxTagNameLength+1)}}, wantErr: cerrors.ErrInvalidTagName},
+		{name: "album operation without album", req: BatchImageRequest{IDs: []uint{1}, Operation: BatchAddToAlbum}, wantErr: cerrors.ErrBadRequest},
+		{name: "move to source album", req: BatchImageRequest{IDs: []uint{1}, Operation: BatchMoveToAlbum, AlbumID: 2, FromAlbumID: 2}, wantErr: cerrors.ErrBadRequest},
+		{name: "visibility without value", req: BatchImageRequest{IDs: []uint{1}, Operation: BatchSetVisibility}, wantErr: cerrors.ErrBadRequest},
+		{name: "visibility", req: BatchImageRequest{SearchKey: "sea", Operation: BatchSetVisibility, Hidden: &hidden}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkBatchRequest(&tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkBatchRequest() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
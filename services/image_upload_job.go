@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/internal/websocket"
+	"github.com/leleo886/lopic/models"
+	"go.uber.org/zap"
+)
+
+const (
+	// UploadJobType 上传处理任务
+	UploadJobType = "upload"
+	// uploadJobDir 上传任务暂存文件的目录
+	uploadJobDir = "data/jobs"
+)
+
+// uploadJob 上传任务参数，Files 为暂存文件相对 Dir 的路径
+type uploadJob struct {
+	UserID   uint     `json:"user_id"`
+	AlbumIDs []uint   `json:"album_ids"`
+	Tags     []string `json:"tags"`
+	Dir      string   `json:"dir"`
+	Files    []string `json:"files"`
+}
+
+// RegisterJobs 注册上传处理任务
+func (s *ImageService) RegisterJobs(q *queue.Queue, hub *websocket.Hub) {
+	s.queue = q
+	s.hub = hub
+	q.Register(queue.JobType{
+		Name:        UploadJobType,
+		Handle:      s.runUploadJob,
+		Concurrency: 2,
+		MaxAttempts: 3,
+		OnAbort: func(job *models.Job) {
+			var payload uploadJob
+			if err := queue.Decode(job, &payload); err == nil && payload.Dir != "" {
+				os.RemoveAll(payload.Dir)
+			}
+		},
+	})
+}
+
+// EnqueueUpload 将上传的文件暂存到磁盘并添加上传处理任务，请求结束后临时文件会被删除，因此需在请求处理中调用
+// ctx 中的追踪上下文随任务保存，后台处理的 span 关联到上传请求
+func (s *ImageService) EnqueueUpload(ctx context.Context, userID uint, albumIDs []uint, tags []string, files []*multipart.FileHeader) (*models.Job, error) {
+	if s.queue == nil {
+		return nil, cerrors.ErrInternalServer
+	}
+
+	dir := filepath.Join(uploadJobDir, "upload_"+uuid.New().String())
+	payload := uploadJob{UserID: userID, AlbumIDs: albumIDs, Tags: tags, Dir: dir}
+	for i, file := range files {
+		name := filepath.Join(fmt.Sprint(i), filepath.Base(file.Filename))
+		if err := stageUploadFile(file, filepath.Join(dir, name)); err != nil {
+			os.RemoveAll(dir)
+			log.Ctx(ctx).Errorf("failed to stage upload file %s: %v", file.Filename, err)
+			return nil, cerrors.ErrInternalServer
+		}
+		payload.Files = append(payload.Files, name)
+	}
+
+	job, err := s.queue.EnqueueContext(ctx, UploadJobType, payload)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return job, nil
+}
+
+// runUploadJob 处理暂存的文件，处理完成的文件会被删除，重试时只处理剩下的文件
+func (s *ImageService) runUploadJob(ctx context.Context, job *models.Job) error {
+	var payload uploadJob
+	if err := queue.Decode(job, &payload); err != nil {
+		return err
+	}
+	ctx = log.WithFields(ctx, zap.Uint("user_id", payload.UserID))
+
+	if job.Attempts == 1 {
+		s.notify(payload.UserID, "upload_processing_start", map[string]interface{}{
+			"message":    "Start processing images",
+			"file_count": len(payload.Files),
+		})
+	}
+
+	if err := s.processUploadJob(ctx, &payload); err != nil {
+		// 客户端错误重试也不会成功
+		var appErr *cerrors.AppError
+		permanent := errors.As(err, &appErr) && appErr.StatusCode < 500
+		if permanent || job.Attempts >= job.MaxAttempts || ctx.Err() != nil {
+			_, errorResponse := cerrors.NewErrorResponse(err)
+			s.notify(payload.UserID, "upload_processing_error", map[string]interface{}{
+				"message": "Image processing failed",
+				"error":   errorResponse.Message,
+				"code":    errorResponse.Code,
+			})
+		}
+		if permanent {
+			return queue.Permanent(err)
+		}
+		return err
+	}
+
+	os.RemoveAll(payload.Dir)
+	s.notify(payload.UserID, "upload_processing_complete", map[string]interface{}{
+		"message":    "Image processing completed",
+		"file_count": len(payload.Files),
+	})
+	return nil
+}
+
+func (s *ImageService) processUploadJob(ctx context.Context, payload *uploadJob) error {
+	for _, name := range payload.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(payload.Dir, name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			// 上一次执行已处理
+			continue
+		}
+
+		fileHeader, cleanup, err := localFileHeader(path)
+		if err != nil {
+			return err
+		}
+		_, err = s.uploadFile(ctx, payload.UserID, payload.AlbumIDs, payload.Tags, fileHeader)
+		cleanup()
+		if err != nil {
+			return err
+		}
+		os.Remove(path)
+	}
+	return nil
+}
+
+func (s *ImageService) notify(userID uint, msgType string, payload map[string]interface{}) {
+	if s.hub != nil {
+		s.hub.BroadcastToUser(userID, msgType, payload)
+	}
+}
+
+func stageUploadFile(file *multipart.FileHeader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"mime/multipart"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/models"
+)
+
+func TestUploadJob(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+
+	cfg := &config.Config{Server: config.ServerConfig{UploadDir: "uploads", StaticPath: "/uploads"}}
+	cfg.SystemSettings.General.MaxThumbSize = 16
+	service := NewImageService(db, cfg)
+	q := queue.New(db)
+	service.RegisterJobs(q, nil)
+
+	content, err := createTestImage(32, 32, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("photo.png", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileHeader, cleanup, err := localFileHeader("photo.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := service.EnqueueUpload(context.Background(), user.ID, nil, []string{"queued"}, []*multipart.FileHeader{fileHeader})
+	cleanup()
+	if err != nil {
+		t.Fatalf("EnqueueUpload() error = %v", err)
+	}
+	var payload uploadJob
+	if err := queue.Decode(job, &payload); err != nil || len(payload.Files) != 1 {
+		t.Fatalf("upload job payload = %+v, %v", payload, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.Run(ctx)
+	defer func() {
+		cancel()
+		q.Wait()
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for job.Status != queue.StatusCompleted {
+		if time.Now().After(deadline) {
+			t.Fatalf("upload job status = %s, error %q", job.Status, job.Error)
+		}
+		time.Sleep(20 * time.Millisecond)
+		db.First(job, job.ID)
+	}
+
+	var image models.Image
+	if err := db.Where("user_id = ?", user.ID).First(&image).Error; err != nil {
+		t.Fatalf("uploaded image not found: %v", err)
+	}
+	if image.OriginalName != "photo" || len(image.Tags) != 1 || image.Tags[0] != "queued" {
+		t.Errorf("uploaded image = %s, tags %v", image.OriginalName, image.Tags)
+	}
+	if _, err := os.Stat(payload.Dir); !os.IsNotExist(err) {
+		t.Errorf("staging dir %s not removed", payload.Dir)
+	}
+}
@@ -0,0 +1,442 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/internal/websocket"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultImportTagPattern 默认从文件名中提取 #标签
+	defaultImportTagPattern = `#([^\s#]+)`
+	// importMaxMemory 读取导入文件时使用的内存上限，更大的文件写入临时文件
+	importMaxMemory = 32 << 20
+	// importErrorLimit 导入结果中最多保留的错误数量
+	importErrorLimit = 100
+	// importJobType 目录导入任务
+	importJobType = "import"
+)
+
+// ImportOptions 目录导入选项
+type ImportOptions struct {
+	Tags       []string `json:"tags"`        // 所有导入的图片都添加的标签
+	TagPattern string   `json:"tag_pattern"` // 从文件名提取标签的正则表达式，有分组时每个分组为一个标签，否则整个匹配为一个标签，默认提取 #标签
+}
+
+// ImportResult 目录导入结果
+type ImportResult struct {
+	Total         int           `json:"total"`
+	Imported      int           `json:"imported"`
+	Skipped       int           `json:"skipped"` // 已存在相同内容的图片
+	Failed        int           `json:"failed"`
+	AlbumsCreated int           `json:"albums_created"`
+	Errors        []ImportError `json:"errors,omitempty"`
+}
+
+// ImportError 导入失败的文件
+type ImportError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// importJob 目录导入任务参数
+type importJob struct {
+	UserID      uint          `json:"user_id"`
+	RequestedBy uint          `json:"requested_by"`
+	Dir         string        `json:"dir"`
+	Options     ImportOptions `json:"options"`
+}
+
+// importSidecar 与图片同名的 JSON 文件，例如 photo.jpg.json 或 photo.json
+type importSidecar struct {
+	Tags     []string `json:"tags"`
+	Keywords []string `json:"keywords"`
+}
+
+// ImportService 服务器目录导入服务
+type ImportService struct {
+	db           *gorm.DB
+	cfg          *config.Config
+	hub          *websocket.Hub
+	imageService *ImageService
+	albumService *AlbumService
+	queue        *queue.Queue
+}
+
+func NewImportService(db *gorm.DB, cfg *config.Config, hub *websocket.Hub, imageService *ImageService) *ImportService {
+	return &ImportService{
+		db:           db,
+		cfg:          cfg,
+		hub:          hub,
+		imageService: imageService,
+		albumService: NewAlbumService(db),
+	}
+}
+
+// StartImport 添加将服务器目录导入 userID 的后台任务，目录需位于配置的 import.allowed_dirs 下
+// 进度和结果通过 WebSocket 推送给 requestedBy
+func (s *ImportService) StartImport(ctx context.Context, userID, requestedBy uint, dir string, opts ImportOptions) error {
+	dir, err := s.allowedImportDir(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := compileTagPattern(opts.TagPattern); err != nil {
+		return cerrors.ErrBadRequest
+	}
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return cerrors.ErrUserNotFound
+	}
+	if s.queue == nil {
+		return cerrors.ErrInternalServer
+	}
+
+	_, err = s.queue.EnqueueContext(ctx, importJobType, importJob{UserID: userID, RequestedBy: requestedBy, Dir: dir, Options: opts})
+	return err
+}
+
+// RegisterJobs 注册目录导入任务，任务最终失败或被取消时通知发起导入的用户
+// 导入会跳过已存在的图片，因此中断后重新执行是安全的
+func (s *ImportService) RegisterJobs(q *queue.Queue) {
+	s.queue = q
+	q.Register(queue.JobType{
+		Name:        importJobType,
+		Handle:      s.runImportJob,
+		MaxAttempts: 3,
+		OnAbort: func(job *models.Job) {
+			var payload importJob
+			if queue.Decode(job, &payload) == nil {
+				s.notify(payload.RequestedBy, "import_failed", map[string]interface{}{
+					"dir":   payload.Dir,
+					"error": job.Error,
+				})
+			}
+		},
+	})
+}
+
+func (s *ImportService) runImportJob(ctx context.Context, job *models.Job) error {
+	var payload importJob
+	if err := queue.Decode(job, &payload); err != nil {
+		return err
+	}
+	result, err := s.ImportDirectory(ctx, payload.UserID, payload.Dir, payload.Options, func(processed, total int) {
+		s.notify(payload.RequestedBy, "import_progress", map[string]interface{}{
+			"dir":       payload.Dir,
+			"processed": processed,
+			"total":     total,
+		})
+	})
+	if err != nil {
+		log.Ctx(ctx).Errorf("Import of %s for user %d failed: %v", payload.Dir, payload.UserID, err)
+		if errors.Is(err, cerrors.ErrImportDirNotFound) {
+			// 目录已被删除，重试也不会成功
+			return queue.Permanent(err)
+		}
+		return err
+	}
+	log.Ctx(ctx).Infof("Imported %s for user %d: imported=%d, skipped=%d, failed=%d", payload.Dir, payload.UserID, result.Imported, result.Skipped, result.Failed)
+	s.notify(payload.RequestedBy, "import_complete", map[string]interface{}{
+		"dir":    payload.Dir,
+		"result": result,
+	})
+	return nil
+}
+
+// ImportDirectory 将目录中的图片导入 userID，子目录对应同名相册（不存在时创建），根目录中的图片不加入相册
+// 标签来自 opts.Tags、同名的 JSON 文件和文件名；已存在相同内容的图片会被跳过，文件的修改时间作为图片的创建时间
+// progress 不为 nil 时在每个文件处理后调用，ctx 被取消时在处理下一个文件前返回
+func (s *ImportService) ImportDirectory(ctx context.Context, userID uint, dir string, opts ImportOptions, progress func(processed, total int)) (*ImportResult, error) {
+	tagPattern, err := compileTagPattern(opts.TagPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tag pattern: %w", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil, cerrors.ErrImportDirNotFound
+	}
+
+	files, err := importFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{Total: len(files)}
+	albumIDs := make(map[string]uint)
+	for i, path := range files {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		if err := s.importFile(ctx, userID, dir, path, opts.Tags, tagPattern, albumIDs, result); err == cerrors.ErrDuplicateImage {
+			result.Skipped++
+		} else if err != nil {
+			result.Failed++
+			if len(result.Errors) < importErrorLimit {
+				result.Errors = append(result.Errors, ImportError{Path: path, Error: err.Error()})
+			}
+			log.Ctx(ctx).Errorf("Failed to import %s: %v", path, err)
+		} else {
+			result.Imported++
+		}
+		if progress != nil {
+			progress(i+1, len(files))
+		}
+	}
+	return result, nil
+}
+
+func (s *ImportService) importFile(ctx context.Context, userID uint, dir, path string, defaultTags []string, tagPattern *regexp.Regexp, albumIDs map[string]uint, result *ImportResult) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	var albums []uint
+	if rel, err := filepath.Rel(dir, filepath.Dir(path)); err == nil && rel != "." {
+		albumID, err := s.importAlbum(ctx, userID, filepath.ToSlash(rel), albumIDs, result)
+		if err != nil {
+			return err
+		}
+		albums = append(albums, albumID)
+	}
+
+	tags := append([]string{}, defaultTags...)
+	tags = append(tags, sidecarTags(path)...)
+	tags = append(tags, filenameTags(tagPattern, filepath.Base(path))...)
+	valid := tags[:0]
+	for _, tag := range tags {
+		if len(strings.TrimSpace(tag)) <= MaxTagNameLength {
+			valid = append(valid, tag)
+		}
+	}
+
+	return s.imageService.ImportFile(ctx, userID, albums, valid, path, info.ModTime())
+}
+
+// importAlbum 返回用户名称为 name 的相册，不存在时创建
+func (s *ImportService) importAlbum(ctx context.Context, userID uint, name string, albumIDs map[string]uint, result *ImportResult) (uint, error) {
+	if albumID, ok := albumIDs[name]; ok {
+		return albumID, nil
+	}
+	albumID, created, err := s.findOrCreateAlbum(ctx, userID, name)
+	if err != nil {
+		return 0, err
+	}
+	if created {
+		result.AlbumsCreated++
+	}
+	albumIDs[name] = albumID
+	return albumID, nil
+}
+
+// findOrCreateAlbum 返回用户名称为 name 的相册 ID，不存在时按相册数量限制创建，名称超长时截断
+func (s *ImportService) findOrCreateAlbum(ctx context.Context, userID uint, name string) (uint, bool, error) {
+	if len([]rune(name)) > 100 {
+		name = string([]rune(name)[:100])
+	}
+	var album models.Album
+	if err := s.db.Where("user_id = ? AND name = ?", userID, name).First(&album).Error; err == nil {
+		return album.ID, false, nil
+	}
+	created, err := s.albumService.CreateAlbum(ctx, name, "", false, userID, 0)
+	if err != nil {
+		return 0, false, err
+	}
+	return created.ID, true, nil
+}
+
+func (s *ImportService) notify(userID uint, msgType string, payload map[string]interface{}) {
+	if s.hub != nil {
+		s.hub.BroadcastToUser(userID, msgType, payload)
+	}
+}
+
+// allowedImportDir 返回目录的绝对路径，目录不在 import.allowed_dirs 下时返回错误
+func (s *ImportService) allowedImportDir(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", cerrors.ErrImportDirNotFound
+	}
+	absDir, err = filepath.EvalSymlinks(absDir)
+	if err != nil {
+		return "", cerrors.ErrImportDirNotFound
+	}
+
+	for _, allowed := range s.cfg.Import.AllowedDirs {
+		absAllowed, err := filepath.Abs(allowed)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(absAllowed); err == nil {
+			absAllowed = resolved
+		}
+		if rel, err := filepath.Rel(absAllowed, absDir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return absDir, nil
+		}
+	}
+	return "", cerrors.ErrImportDirNotAllowed
+}
+
+// ImportFile 按普通上传的流程导入服务器上的文件，检查配额并生成缩略图，createdAt 不为零时作为图片的创建时间
+// 用户已有相同内容的图片（包括回收站中的）时返回 ErrDuplicateImage
+func (s *ImageService) ImportFile(ctx context.Context, userID uint, albumIDs []uint, tags []string, path string, createdAt time.Time) error {
+	fileHeader, cleanup, err := localFileHeader(path)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := s.UploadImageLimitCheck(ctx, userID, []*multipart.FileHeader{fileHeader}); err != nil {
+		return err
+	}
+
+	fileExt := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	fileOriginalName := fileHeader.Filename[:len(fileHeader.Filename)-len(fileExt)]
+	fileHash, err := GetFileHash(fileHeader)
+	if err != nil {
+		return err
+	}
+	// 没有记录哈希的图片按原始名称和大小判断
+	var count int64
+	if err := s.db.Unscoped().Model(&models.Image{}).
+		Where("user_id = ? AND (file_hash = ? OR ((file_hash IS NULL OR file_hash = '') AND original_name = ? AND file_size = ?))",
+			userID, fileHash, fileOriginalName, fileHeader.Size).
+		Count(&count).Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to check duplicate image: user_id=%d, error=%v", userID, err)
+		return cerrors.ErrInternalServer
+	}
+	if count > 0 {
+		return cerrors.ErrDuplicateImage
+	}
+
+	fileName, err := s.uploadFile(ctx, userID, albumIDs, normalizeTags(tags), fileHeader)
+	if err != nil {
+		return err
+	}
+
+	if !createdAt.IsZero() {
+		if err := s.db.Model(&models.Image{}).Where("file_name = ?", fileName).UpdateColumn("created_at", createdAt).Error; err != nil {
+			log.Ctx(ctx).Errorf("failed to set image created time: file_name=%s, error=%v", fileName, err)
+		}
+	}
+	return nil
+}
+
+// localFileHeader 将服务器上的文件包装为 multipart.FileHeader 以复用上传流程，cleanup 删除读取时产生的临时文件
+func localFileHeader(path string) (*multipart.FileHeader, func(), error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("file", filepath.Base(path))
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	form, err := multipart.NewReader(pr, writer.Boundary()).ReadForm(importMaxMemory)
+	pr.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		if err := form.RemoveAll(); err != nil {
+			log.Errorf("failed to remove temporary import file: path=%s, error=%v", path, err)
+		}
+	}
+	if len(form.File["file"]) == 0 {
+		cleanup()
+		return nil, nil, cerrors.ErrInternalServer
+	}
+	return form.File["file"][0], cleanup, nil
+}
+
+// importFiles 返回目录中待导入的文件，跳过隐藏文件、符号链接和 JSON 文件
+func importFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && !strings.EqualFold(filepath.Ext(path), ".json") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// sidecarTags 读取图片同名 JSON 文件中的 tags 和 keywords
+func sidecarTags(path string) []string {
+	ext := filepath.Ext(path)
+	for _, sidecar := range []string{path + ".json", strings.TrimSuffix(path, ext) + ".json"} {
+		content, err := os.ReadFile(sidecar)
+		if err != nil {
+			continue
+		}
+		var meta importSidecar
+		if err := json.Unmarshal(content, &meta); err != nil {
+			log.Errorf("Invalid sidecar file %s: %v", sidecar, err)
+			return nil
+		}
+		return append(meta.Tags, meta.Keywords...)
+	}
+	return nil
+}
+
+// filenameTags 从不含扩展名的文件名中提取标签
+func filenameTags(pattern *regexp.Regexp, filename string) []string {
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	var tags []string
+	for _, match := range pattern.FindAllStringSubmatch(name, -1) {
+		if len(match) == 1 {
+			tags = append(tags, match[0])
+			continue
+		}
+		for _, group := range match[1:] {
+			if group != "" {
+				tags = append(tags, group)
+			}
+		}
+	}
+	return tags
+}
+
+func compileTagPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = defaultImportTagPattern
+	}
+	return regexp.Compile(pattern)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/models"
+)
+
+func TestImportDirectory(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+
+	cfg := &config.Config{Server: config.ServerConfig{UploadDir: "uploads", StaticPath: "/uploads"}}
+	cfg.SystemSettings.General.MaxThumbSize = 16
+
+	red, err := createTestImage(32, 32, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blue, err := createTestImage(48, 32, "jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2019, 5, 1, 12, 0, 0, 0, time.Local)
+	files := map[string][]byte{
+		"import/root #sky.png":            red,
+		"import/trip/2024/beach.jpg":      blue,
+		"import/trip/2024/beach.jpg.json": []byte(`{"tags": ["sea"], "keywords": ["summer"]}`),
+		"import/trip/copy.png":            red,
+		"import/notes.txt":                []byte("not an image"),
+		"import/.hidden/skip.png":         red,
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	service := NewImportService(db, cfg, nil, NewImageService(db, cfg))
+	result, err := service.ImportDirectory(context.Background(), user.ID, "import", ImportOptions{Tags: []string{"imported"}}, nil)
+	if err != nil {
+		t.Fatalf("ImportDirectory() error = %v", err)
+	}
+	if result.Total != 4 || result.Imported != 2 || result.Skipped != 1 || result.Failed != 1 || result.AlbumsCreated != 2 {
+		t.Fatalf("ImportDirectory() result = %+v", result)
+	}
+
+	var images []models.Image
+	db.Preload("Albums").Where("user_id = ?", user.ID).Order("id").Find(&images)
+	if len(images) != 2 {
+		t.Fatalf("imported %d images, want 2", len(images))
+	}
+	for _, image := range images {
+		if !image.CreatedAt.Equal(mtime) {
+			t.Errorf("image %s created at %v, want %v", image.OriginalName, image.CreatedAt, mtime)
+		}
+		if image.FileHash == "" {
+			t.Errorf("image %s has no file hash", image.OriginalName)
+		}
+	}
+	root, beach := images[0], images[1]
+	if root.OriginalName != "root #sky" || len(root.Albums) != 0 || !slices.Equal(root.Tags, []string{"imported", "sky"}) {
+		t.Errorf("root image = %s, albums %d, tags %v", root.OriginalName, len(root.Albums), root.Tags)
+	}
+	if len(beach.Albums) != 1 || beach.Albums[0].Name != "trip/2024" || !slices.Equal(beach.Tags, []string{"imported", "sea", "summer"}) {
+		t.Errorf("beach image albums %v, tags %v", beach.Albums, beach.Tags)
+	}
+
+	again, err := service.ImportDirectory(context.Background(), user.ID, "import", ImportOptions{}, nil)
+	if err != nil {
+		t.Fatalf("ImportDirectory() again error = %v", err)
+	}
+	if again.Imported != 0 || again.Skipped != 3 {
+		t.Errorf("ImportDirectory() again result = %+v, want all images skipped", again)
+	}
+
+	if _, err := service.allowedImportDir("import"); err == nil {
+		t.Error("allowedImportDir() without allowed dirs succeeded")
+	}
+	cfg.Import.AllowedDirs = []string{"import/trip"}
+	if _, err := service.allowedImportDir("import/trip/2024"); err != nil {
+		t.Errorf("allowedImportDir() error = %v", err)
+	}
+	if _, err := service.allowedImportDir("import/trip/../.."); err == nil {
+		t.Error("allowedImportDir() outside allowed dirs succeeded")
+	}
+
+	// 导入作为后台任务执行
+	if err := service.StartImport(context.Background(), user.ID, user.ID, "import/trip", ImportOptions{}); !errors.Is(err, cerrors.ErrInternalServer) {
+		t.Errorf("StartImport() without queue error = %v, want ErrInternalServer", err)
+	}
+	service.RegisterJobs(queue.New(db))
+	if err := service.StartImport(context.Background(), user.ID, user.ID, "import/trip", ImportOptions{}); err != nil {
+		t.Fatalf("StartImport() error = %v", err)
+	}
+	var job models.Job
+	if err := db.Where("type = ?", importJobType).First(&job).Error; err != nil {
+		t.Fatalf("import job not enqueued: %v", err)
+	}
+	if err := service.runImportJob(context.Background(), &job); err != nil {
+		t.Errorf("runImportJob() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := service.ImportDirectory(ctx, user.ID, "import", ImportOptions{}, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("ImportDirectory() with canceled context error = %v, want context.Canceled", err)
+	}
+}
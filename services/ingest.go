@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/websocket"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultIngestStableSeconds 文件保持不变多少秒后导入
+	defaultIngestStableSeconds = 5
+	// ingestDoneDir 导入成功或重复的文件移动到的子目录
+	ingestDoneDir = "done"
+	// ingestFailedDir 导入失败的文件移动到的子目录
+	ingestFailedDir = "failed"
+)
+
+// ingestFolder 监视目录，path 为绝对路径
+type ingestFolder struct {
+	config.IngestFolder
+	path   string
+	userID uint
+}
+
+// pendingIngest 等待稳定的文件
+type pendingIngest struct {
+	folder  *ingestFolder
+	size    int64
+	modTime time.Time
+	since   time.Time // 文件最后一次变化的时间
+}
+
+// IngestWatcher 监视配置的目录，文件写入完成后按普通上传的流程导入对应用户，并移动到 done 或 failed 子目录
+type IngestWatcher struct {
+	db            *gorm.DB
+	cfg           *config.IngestConfig
+	hub           *websocket.Hub
+	imageService  *ImageService
+	importService *ImportService
+	folders       []*ingestFolder
+	pending       map[string]*pendingIngest
+}
+
+func NewIngestWatcher(db *gorm.DB, cfg *config.IngestConfig, hub *websocket.Hub, imageService *ImageService, importService *ImportService) *IngestWatcher {
+	return &IngestWatcher{
+		db:            db,
+		cfg:           cfg,
+		hub:           hub,
+		imageService:  imageService,
+		importService: importService,
+		pending:       make(map[string]*pendingIngest),
+	}
+}
+
+// Run 监视所有配置的目录，启动时目录中已有的文件也会被导入；没有配置目录时直接返回
+// 用户不存在或无法监视的目录会被跳过；ctx 被取消后返回，正在导入的文件会先完成
+func (w *IngestWatcher) Run(ctx context.Context) {
+	if len(w.cfg.Folders) == 0 {
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Ctx(ctx).Errorf("Failed to create ingest watcher: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	now := time.Now()
+	for _, folderConfig := range w.cfg.Folders {
+		folder, err := w.setupFolder(folderConfig)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Skip ingest folder %s: %v", folderConfig.Path, err)
+			continue
+		}
+		if err := watcher.Add(folder.path); err != nil {
+			log.Ctx(ctx).Errorf("Skip ingest folder %s: %v", folderConfig.Path, err)
+			continue
+		}
+		w.folders = append(w.folders, folder)
+		log.Ctx(ctx).Infof("Watching ingest folder %s for user %s", folder.path, folder.User)
+
+		entries, err := os.ReadDir(folder.path)
+		if err != nil {
+			log.Ctx(ctx).Errorf("Failed to read ingest folder %s: %v", folder.path, err)
+			continue
+		}
+		for _, entry := range entries {
+			w.track(filepath.Join(folder.path, entry.Name()), now)
+		}
+	}
+	if len(w.folders) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+				w.track(event.Name, time.Now())
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Ctx(ctx).Errorf("Ingest watcher error: %v", err)
+		case now := <-ticker.C:
+			w.processStable(now)
+		}
+	}
+}
+
+// setupFolder 检查目录对应的用户，并创建目录和 done、failed 子目录
+func (w *IngestWatcher) setupFolder(folderConfig config.IngestFolder) (*ingestFolder, error) {
+	path, err := filepath.Abs(folderConfig.Path)
+	if err != nil {
+		return nil, err
+	}
+	var user models.User
+	if err := w.db.Where("username = ?", folderConfig.User).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("user %q not found", folderConfig.User)
+	}
+	for _, dir := range []string{path, filepath.Join(path, ingestDoneDir), filepath.Join(path, ingestFailedDir)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &ingestFolder{IngestFolder: folderConfig, path: path, userID: user.ID}, nil
+}
+
+// track 记录监视目录中新建或修改的文件，子目录、隐藏文件和未下载完成的临时文件会被忽略
+func (w *IngestWatcher) track(path string, now time.Time) {
+	if ingestIgnored(filepath.Base(path)) {
+		return
+	}
+	var folder *ingestFolder
+	for _, f := range w.folders {
+		if filepath.Dir(path) == f.path {
+			folder = f
+			break
+		}
+	}
+	if folder == nil {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return
+	}
+	w.pending[path] = &pendingIngest{folder: folder, size: info.Size(), modTime: info.ModTime(), since: now}
+}
+
+// processStable 导入大小和修改时间在 stable_seconds 内没有变化的文件
+func (w *IngestWatcher) processStable(now time.Time) {
+	stable := time.Duration(w.cfg.StableSeconds) * time.Second
+	if stable <= 0 {
+		stable = defaultIngestStableSeconds * time.Second
+	}
+
+	for path, pending := range w.pending {
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(w.pending, path)
+			continue
+		}
+		if info.Size() != pending.size || !info.ModTime().Equal(pending.modTime) {
+			pending.size, pending.modTime, pending.since = info.Size(), info.ModTime(), now
+			continue
+		}
+		if now.Sub(pending.since) < stable {
+			continue
+		}
+		delete(w.pending, path)
+		w.ingest(pending.folder, path)
+	}
+}
+
+// ingest 导入文件并移动到 done 或 failed 子目录，结果通过 WebSocket 推送给目录对应的用户
+func (w *IngestWatcher) ingest(folder *ingestFolder, path string) {
+	name := filepath.Base(path)
+	err := w.importFile(folder, path)
+
+	targetDir := ingestDoneDir
+	if err != nil && err != cerrors.ErrDuplicateImage {
+		targetDir = ingestFailedDir
+	}
+	if moveErr := moveIngestedFile(path, filepath.Join(folder.path, targetDir)); moveErr != nil {
+		log.Errorf("Failed to move ingested file %s to %s: %v", path, targetDir, moveErr)
+	}
+
+	switch {
+	case err == nil:
+		log.Infof("Ingested %s for user %s", path, folder.User)
+		w.notify(folder.userID, "ingest_complete", map[string]interface{}{
+			"folder": folder.Path,
+			"file":   name,
+		})
+	case err == cerrors.ErrDuplicateImage:
+		log.Infof("Skipped duplicate %s for user %s", path, folder.User)
+		w.notify(folder.userID, "ingest_complete", map[string]interface{}{
+			"folder":    folder.Path,
+			"file":      name,
+			"duplicate": true,
+		})
+	default:
+		log.Errorf("Failed to ingest %s for user %s: %v", path, folder.User, err)
+		w.notify(folder.userID, "ingest_failed", map[string]interface{}{
+			"folder": folder.Path,
+			"file":   name,
+			"error":  err.Error(),
+		})
+	}
+}
+
+func (w *IngestWatcher) importFile(folder *ingestFolder, path string) error {
+	var albumIDs []uint
+	if folder.Album != "" {
+		albumID, _, err := w.importService.findOrCreateAlbum(context.Background(), folder.userID, folder.Album)
+		if err != nil {
+			return err
+		}
+		albumIDs = append(albumIDs, albumID)
+	}
+	return w.imageService.ImportFile(context.Background(), folder.userID, albumIDs, folder.Tags, path, time.Time{})
+}
+
+func (w *IngestWatcher) notify(userID uint, msgType string, payload map[string]interface{}) {
+	if w.hub != nil {
+		w.hub.BroadcastToUser(userID, msgType, payload)
+	}
+}
+
+// moveIngestedFile 将文件移动到 dir，已有同名文件时在文件名后加时间
+func moveIngestedFile(path, dir string) error {
+	name := filepath.Base(path)
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(name)
+		target = filepath.Join(dir, fmt.Sprintf("%s_%s%s", strings.TrimSuffix(name, ext), time.Now().Format("20060102_150405.000000000"), ext))
+	}
+	return os.Rename(path, target)
+}
+
+// ingestIgnored 判断是否忽略文件，隐藏文件和常见的未写完的临时文件不导入
+func ingestIgnored(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".tmp", ".part", ".crdownload", ".download":
+		return true
+	}
+	return false
+}
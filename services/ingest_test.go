@@ -0,0 +1,87 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/models"
+)
+
+func TestIngestWatcherProcessStable(t *testing.T) {
+	db := openTestDB(t)
+	user := createTestUser(t, db)
+
+	cfg := &config.Config{Server: config.ServerConfig{UploadDir: "uploads", StaticPath: "/uploads"}}
+	cfg.SystemSettings.General.MaxThumbSize = 16
+	cfg.Ingest = config.IngestConfig{
+		StableSeconds: 5,
+		Folders:       []config.IngestFolder{{Path: "ingest", User: "alice", Album: "Inbox", Tags: []string{"inbox"}}},
+	}
+	imageService := NewImageService(db, cfg)
+	watcher := NewIngestWatcher(db, &cfg.Ingest, nil, imageService, NewImportService(db, cfg, nil, imageService))
+	folder, err := watcher.setupFolder(cfg.Ingest.Folders[0])
+	if err != nil {
+		t.Fatalf("setupFolder() error = %v", err)
+	}
+	watcher.folders = append(watcher.folders, folder)
+
+	content, err := createTestImage(32, 32, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{"photo.png": content, "broken.png": []byte("not an image"), "upload.part": content}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(folder.path, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	start := time.Now()
+	for name := range files {
+		watcher.track(filepath.Join(folder.path, name), start)
+	}
+	if len(watcher.pending) != 2 {
+		t.Fatalf("tracked %d files, want 2", len(watcher.pending))
+	}
+
+	watcher.processStable(start.Add(2 * time.Second))
+	if len(watcher.pending) != 2 {
+		t.Fatalf("files were processed before they were stable")
+	}
+	watcher.processStable(start.Add(6 * time.Second))
+	if len(watcher.pending) != 0 {
+		t.Fatalf("%d files still pending after they were stable", len(watcher.pending))
+	}
+
+	for _, path := range []string{"ingest/done/photo.png", "ingest/failed/broken.png", "ingest/upload.part"} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected %s: %v", path, err)
+		}
+	}
+	var image models.Image
+	if err := db.Preload("Albums").Where("user_id = ?", user.ID).First(&image).Error; err != nil {
+		t.Fatalf("ingested image not found: %v", err)
+	}
+	if len(image.Albums) != 1 || image.Albums[0].Name != "Inbox" || len(image.Tags) != 1 || image.Tags[0] != "inbox" {
+		t.Errorf("ingested image albums %v, tags %v", image.Albums, image.Tags)
+	}
+
+	// 再次放入相同的图片时跳过并移动到 done 子目录
+	if err := os.WriteFile(filepath.Join(folder.path, "photo.png"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	watcher.track(filepath.Join(folder.path, "photo.png"), start)
+	watcher.processStable(start.Add(6 * time.Second))
+	entries, _ := os.ReadDir("ingest/done")
+	if len(entries) != 2 {
+		t.Errorf("done folder has %d files, want 2", len(entries))
+	}
+	var count int64
+	db.Model(&models.Image{}).Where("user_id = ?", user.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("user has %d images, want 1", count)
+	}
+}
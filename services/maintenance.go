@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/queue"
+	"github.com/leleo886/lopic/models"
+)
+
+// MaintenanceJob 周期性维护任务，通过任务队列执行，同一任务同时只有一个在排队或执行
+type MaintenanceJob struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// RegisterMaintenanceJobs 注册维护任务，失败时按队列的默认策略重试
+func RegisterMaintenanceJobs(q *queue.Queue, jobs []MaintenanceJob) {
+	for _, job := range jobs {
+		run := job.Run
+		q.Register(queue.JobType{
+			Name:   job.Name,
+			Handle: func(ctx context.Context, _ *models.Job) error { return run(ctx) },
+		})
+	}
+}
+
+// ScheduleMaintenance 启动时及每隔 Interval 添加一次维护任务，直到 ctx 被取消
+func ScheduleMaintenance(ctx context.Context, q *queue.Queue, jobs []MaintenanceJob) {
+	for _, job := range jobs {
+		go func(job MaintenanceJob) {
+			ticker := time.NewTicker(job.Interval)
+			defer ticker.Stop()
+			for {
+				if _, err := q.EnqueueOnce(job.Name, nil); err != nil {
+					log.Ctx(ctx).Errorf("Failed to enqueue %s job: %v", job.Name, err)
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+}
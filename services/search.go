@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+
+	"github.com/leleo886/lopic/internal/database"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/search"
+	"gorm.io/gorm"
+)
+
+// ApplySearchQuery 解析搜索语句并追加到查询条件，查询需以 images 表为主表
+// 启用全文检索时自由文本通过索引匹配标题、标签和相册
+// 语法错误返回 ErrInvalidSearchQuery，错误信息中包含出错位置
+func ApplySearchQuery(db *gorm.DB, query string) (*gorm.DB, error) {
+	opts := search.Options{Like: database.Like(db)}
+	if backend := currentSearchBackend(); backend != nil {
+		opts.FreeText = backend.Match
+	}
+	condition, args, err := search.CompileWith(query, opts)
+	if err != nil {
+		var syntaxErr *search.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, &cerrors.AppError{
+				Code:       cerrors.ErrInvalidSearchQuery.Code,
+				Message:    cerrors.ErrInvalidSearchQuery.Message + ": " + syntaxErr.Error(),
+				StatusCode: cerrors.ErrInvalidSearchQuery.StatusCode,
+			}
+		}
+		return nil, cerrors.ErrInvalidSearchQuery
+	}
+	if condition == "" {
+		return db, nil
+	}
+	return db.Where(condition, args...), nil
+}
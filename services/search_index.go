@@ -0,0 +1,414 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/search"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SearchBackend 全文检索后端，负责创建索引并生成匹配和排序条件
+// 检索文档统一存放在 search_documents 表中，各后端只负责在其上建立索引
+type SearchBackend interface {
+	// Name 后端名称
+	Name() string
+	// Setup 在 search_documents 表上创建全文索引
+	Setup(db *gorm.DB) error
+	// Match 返回匹配关键词的图片条件，查询需以 images 表为主表
+	Match(term string) (string, []interface{})
+	// Rank 返回相关度排序表达式，值越小越相关，不匹配的图片排在最后；无法排序时返回空字符串
+	Rank(terms []string) (string, []interface{})
+	// Refresh 检索文档重建后刷新索引
+	Refresh(db *gorm.DB) error
+}
+
+// searchBackend 当前使用的全文检索后端，恢复备份时会在处理请求的同时重新设置，需通过 currentSearchBackend 读取
+var searchBackend atomic.Pointer[SearchBackend]
+
+// currentSearchBackend 返回当前使用的全文检索后端，为 nil 时自由文本按标题模糊匹配或标签精确匹配
+func currentSearchBackend() SearchBackend {
+	if backend := searchBackend.Load(); backend != nil {
+		return *backend
+	}
+	return nil
+}
+
+type SearchHighlight struct {
+	Name string   `json:"name,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+// SetupSearchIndex 根据数据库类型选择全文检索后端并创建索引，失败时退回到 LIKE 查询
+func SetupSearchIndex(db *gorm.DB) error {
+	var backend SearchBackend
+	switch db.Dialector.Name() {
+	case "sqlite":
+		backend = sqliteSearchBackend{}
+	case "mysql":
+		backend = mysqlSearchBackend{}
+	case "postgres":
+		backend = postgresSearchBackend{}
+	default:
+		searchBackend.Store(nil)
+		return nil
+	}
+
+	if err := backend.Setup(db); err != nil {
+		searchBackend.Store(nil)
+		return fmt.Errorf("setup %s search index: %w", backend.Name(), err)
+	}
+	searchBackend.Store(&backend)
+	return nil
+}
+
+// InitSearchIndex 初始化全文检索，检索文档为空时为已有图片建立索引
+func InitSearchIndex(db *gorm.DB) error {
+	if err := SetupSearchIndex(db); err != nil {
+		return err
+	}
+
+	var documents, images int64
+	if err := db.Model(&models.SearchDocument{}).Count(&documents).Error; err != nil {
+		return err
+	}
+	if err := db.Model(&models.Image{}).Count(&images).Error; err != nil {
+		return err
+	}
+	if documents == 0 && images > 0 {
+		count, err := RebuildSearchIndex(db)
+		if err != nil {
+			return err
+		}
+		log.Infof("Search index built for %d images", count)
+	}
+	return nil
+}
+
+// RebuildSearchIndex 根据所有未删除的图片重建检索文档，返回建立索引的图片数量
+func RebuildSearchIndex(db *gorm.DB) (int, error) {
+	count := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM search_documents").Error; err != nil {
+			return err
+		}
+
+		var images []models.Image
+		result := tx.Preload("Albums").FindInBatches(&images, 200, func(batch *gorm.DB, _ int) error {
+			documents := make([]models.SearchDocument, 0, len(images))
+			for _, image := range images {
+				documents = append(documents, makeSearchDocument(image))
+			}
+			count += len(documents)
+			return tx.Create(&documents).Error
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if backend := currentSearchBackend(); backend != nil {
+			return backend.Refresh(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// IndexImages 根据图片当前数据更新检索文档，已删除或不存在的图片会移除文档，db 可为事务
+func IndexImages(db *gorm.DB, imageIDs ...uint) error {
+	for chunk := range slices.Chunk(imageIDs, 500) {
+		var images []models.Image
+		if err := db.Preload("Albums").Where("id IN ?", chunk).Find(&images).Error; err != nil {
+			log.Ctx(db.Statement.Context).Errorf("failed to find images for search index: error=%v", err)
+			return cerrors.ErrInternalServer
+		}
+
+		if err := db.Where("image_id IN ?", chunk).Delete(&models.SearchDocument{}).Error; err != nil {
+			log.Ctx(db.Statement.Context).Errorf("failed to delete search documents: error=%v", err)
+			return cerrors.ErrInternalServer
+		}
+		if len(images) == 0 {
+			continue
+		}
+
+		documents := make([]models.SearchDocument, 0, len(images))
+		for _, image := range images {
+			documents = append(documents, makeSearchDocument(image))
+		}
+		if err := db.Create(&documents).Error; err != nil {
+			log.Ctx(db.Statement.Context).Errorf("failed to create search documents: error=%v", err)
+			return cerrors.ErrInternalServer
+		}
+	}
+	return nil
+}
+
+// IndexAlbumImages 更新相册中所有图片的检索文档，用于相册名称、描述或状态变化后
+func IndexAlbumImages(db *gorm.DB, albumID uint) error {
+	var imageIDs []uint
+	if err := db.Model(&models.ImageAlbum{}).Where("album_id = ?", albumID).Pluck("image_id", &imageIDs).Error; err != nil {
+		log.Ctx(db.Statement.Context).Errorf("failed to find album images: album_id=%d, error=%v", albumID, err)
+		return cerrors.ErrInternalServer
+	}
+	return IndexImages(db, imageIDs...)
+}
+
+// OrderByRelevance 语句包含自由文本且启用了全文检索时先按相关度排序，再按 fallback 排序
+// fallback 必须是固定的排序语句，不能包含用户输入
+func OrderByRelevance(db *gorm.DB, query string, fallback string) *gorm.DB {
+	if backend := currentSearchBackend(); backend != nil {
+		if terms := search.FreeTextTerms(query); len(terms) > 0 {
+			if expr, args := backend.Rank(terms); expr != "" {
+				return db.Order(clause.OrderBy{Expression: clause.Expr{SQL: expr + " ASC, " + fallback, Vars: args}})
+			}
+		}
+	}
+	return db.Order(fallback)
+}
+
+// HighlightImages 标记搜索结果中名称和标签命中的自由文本
+func HighlightImages(query string, images []ImageResponse) {
+	highlighter := newSearchHighlighter(query)
+	if highlighter == nil {
+		return
+	}
+	for i := range images {
+		images[i].Highlight = highlighter.highlight(images[i].OriginalName, images[i].Tags)
+	}
+}
+
+// HighlightGalleryImages 标记画廊搜索结果中名称和标签命中的自由文本
+func HighlightGalleryImages(query string, images []GalleryImageResponse) {
+	highlighter := newSearchHighlighter(query)
+	if highlighter == nil {
+		return
+	}
+	for i := range images {
+		images[i].Highlight = highlighter.highlight(images[i].OriginalName, images[i].Tags)
+	}
+}
+
+func makeSearchDocument(image models.Image) models.SearchDocument {
+	albums := make([]string, 0, len(image.Albums))
+	for _, album := range image.Albums {
+		albums = append(albums, strings.TrimSpace(album.Name+" "+album.Description))
+	}
+	return models.SearchDocument{
+		ImageID: image.ID,
+		UserID:  image.UserID,
+		Name:    image.OriginalName,
+		Tags:    strings.Join(image.Tags, " "),
+		Albums:  strings.Join(albums, "\n"),
+	}
+}
+
+// searchDocumentLike 关键词太短无法使用全文索引时，直接在检索文档上模糊匹配
+func searchDocumentLike(term string) (string, []interface{}) {
+	pattern := "%" + escapeLike(term) + "%"
+	return "images.id IN (SELECT image_id FROM search_documents WHERE name LIKE ? ESCAPE '!' OR tags LIKE ? ESCAPE '!' OR albums LIKE ? ESCAPE '!')",
+		[]interface{}{pattern, pattern, pattern}
+}
+
+// sqliteSearchBackend 使用 FTS5 外部内容表，trigram 分词支持中文和子串匹配，关键词至少 3 个字符
+type sqliteSearchBackend struct{}
+
+func (sqliteSearchBackend) Name() string {
+	return "sqlite fts5"
+}
+
+func (sqliteSearchBackend) Setup(db *gorm.DB) error {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(name, tags, albums, content='search_documents', content_rowid='image_id', tokenize='trigram')`,
+		`CREATE TRIGGER IF NOT EXISTS search_documents_ai AFTER INSERT ON search_documents BEGIN
+			INSERT INTO search_index(rowid, name, tags, albums) VALUES (new.image_id, new.name, new.tags, new.albums);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS search_documents_ad AFTER DELETE ON search_documents BEGIN
+			INSERT INTO search_index(search_index, rowid, name, tags, albums) VALUES ('delete', old.image_id, old.name, old.tags, old.albums);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS search_documents_au AFTER UPDATE ON search_documents BEGIN
+			INSERT INTO search_index(search_index, rowid, name, tags, albums) VALUES ('delete', old.image_id, old.name, old.tags, old.albums);
+			INSERT INTO search_index(rowid, name, tags, albums) VALUES (new.image_id, new.name, new.tags, new.albums);
+		END`,
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sqliteSearchBackend) Match(term string) (string, []interface{}) {
+	if utf8.RuneCountInString(term) < 3 {
+		return searchDocumentLike(term)
+	}
+	return "images.id IN (SELECT rowid FROM search_index WHERE search_index MATCH ?)", []interface{}{ftsPhrase(term)}
+}
+
+func (sqliteSearchBackend) Rank(terms []string) (string, []interface{}) {
+	var phrases []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= 3 {
+			phrases = append(phrases, ftsPhrase(term))
+		}
+	}
+	if len(phrases) == 0 {
+		return "", nil
+	}
+	// bm25 越小越相关
+	return "COALESCE((SELECT bm25(search_index) FROM search_index WHERE search_index MATCH ? AND search_index.rowid = images.id), 0)",
+		[]interface{}{strings.Join(phrases, " OR ")}
+}
+
+func (sqliteSearchBackend) Refresh(db *gorm.DB) error {
+	return db.Exec("INSERT INTO search_index(search_index) VALUES ('rebuild')").Error
+}
+
+// ftsPhrase 将关键词转为 FTS5 短语，避免关键词被解析为查询语法
+func ftsPhrase(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+// mysqlSearchBackend 使用 ngram 分词的 FULLTEXT 索引，关键词至少 2 个字符
+type mysqlSearchBackend struct{}
+
+func (mysqlSearchBackend) Name() string {
+	return "mysql fulltext"
+}
+
+func (mysqlSearchBackend) Setup(db *gorm.DB) error {
+	var count int64
+	err := db.Raw("SELECT COUNT(*) FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = 'search_documents' AND index_name = 'idx_search_documents_fulltext'").
+		Scan(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return db.Exec("ALTER TABLE search_documents ADD FULLTEXT INDEX idx_search_documents_fulltext (name, tags, albums) WITH PARSER ngram").Error
+}
+
+func (mysqlSearchBackend) Match(term string) (string, []interface{}) {
+	if utf8.RuneCountInString(term) < 2 {
+		return searchDocumentLike(term)
+	}
+	return "images.id IN (SELECT image_id FROM search_documents WHERE MATCH(name, tags, albums) AGAINST (? IN BOOLEAN MODE))",
+		[]interface{}{`"` + strings.ReplaceAll(term, `"`, "") + `"`}
+}
+
+func (mysqlSearchBackend) Rank(terms []string) (string, []interface{}) {
+	// MATCH 的相关度越大越相关，取负数以便升序排列
+	return "-COALESCE((SELECT MATCH(name, tags, albums) AGAINST (? IN NATURAL LANGUAGE MODE) FROM search_documents WHERE search_documents.image_id = images.id), 0)",
+		[]interface{}{strings.Join(terms, " ")}
+}
+
+func (mysqlSearchBackend) Refresh(db *gorm.DB) error {
+	return nil
+}
+
+// postgresSearchDocument 建立 trigram 索引的表达式，查询时需使用相同的表达式才能用上索引
+const postgresSearchDocument = "(name || ' ' || tags || ' ' || albums)"
+
+// postgresSearchBackend 使用 pg_trgm 的 GIN 索引加速 ILIKE 子串匹配，按 word_similarity 排序
+// 创建扩展需要相应权限，失败时退回到 LIKE 查询
+type postgresSearchBackend struct{}
+
+func (postgresSearchBackend) Name() string {
+	return "postgres pg_trgm"
+}
+
+func (postgresSearchBackend) Setup(db *gorm.DB) error {
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+		"CREATE INDEX IF NOT EXISTS idx_search_documents_trgm ON search_documents USING gin (" + postgresSearchDocument + " gin_trgm_ops)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (postgresSearchBackend) Match(term string) (string, []interface{}) {
+	return "images.id IN (SELECT image_id FROM search_documents WHERE " + postgresSearchDocument + " ILIKE ? ESCAPE '!')",
+		[]interface{}{"%" + escapeLike(term) + "%"}
+}
+
+func (postgresSearchBackend) Rank(terms []string) (string, []interface{}) {
+	// word_similarity 越大越相关，取负数以便升序排列
+	return "-COALESCE((SELECT word_similarity(?, " + postgresSearchDocument + ") FROM search_documents WHERE search_documents.image_id = images.id), 0)",
+		[]interface{}{strings.Join(terms, " ")}
+}
+
+func (postgresSearchBackend) Refresh(db *gorm.DB) error {
+	return nil
+}
+
+type searchHighlighter struct {
+	pattern *regexp.Regexp
+}
+
+// newSearchHighlighter 根据语句中的自由文本创建高亮器，没有自由文本时返回 nil
+func newSearchHighlighter(query string) *searchHighlighter {
+	terms := search.FreeTextTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	// 优先匹配较长的关键词
+	sort.Slice(terms, func(i, j int) bool { return len(terms[i]) > len(terms[j]) })
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	return &searchHighlighter{pattern: regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))}
+}
+
+func (h *searchHighlighter) highlight(name string, tags []string) *SearchHighlight {
+	var result SearchHighlight
+	if marked, ok := h.mark(name); ok {
+		result.Name = marked
+	}
+	for _, tag := range tags {
+		if marked, ok := h.mark(tag); ok {
+			result.Tags = append(result.Tags, marked)
+		}
+	}
+	if result.Name == "" && len(result.Tags) == 0 {
+		return nil
+	}
+	return &result
+}
+
+// mark 用 <mark> 包裹命中的文本，其余部分做 HTML 转义
+func (h *searchHighlighter) mark(text string) (string, bool) {
+	matches := h.pattern.FindAllStringIndex(text, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+	var sb strings.Builder
+	last := 0
+	for _, m := range matches {
+		sb.WriteString(html.EscapeString(text[last:m[0]]))
+		sb.WriteString("<mark>")
+		sb.WriteString(html.EscapeString(text[m[0]:m[1]]))
+		sb.WriteString("</mark>")
+		last = m[1]
+	}
+	sb.WriteString(html.EscapeString(text[last:]))
+	return sb.String(), true
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/leleo886/lopic/internal/config"
+	"github.com/leleo886/lopic/migrations"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// searchImageIDs 返回用户的图片中匹配搜索语句的图片 ID
+func searchImageIDs(t *testing.T, db *gorm.DB, userID uint, query string) []uint {
+	t.Helper()
+	scoped, err := ApplySearchQuery(db.Model(&models.Image{}).Where("images.user_id = ?", userID), query)
+	if err != nil {
+		t.Fatalf("ApplySearchQuery(%q) error = %v", query, err)
+	}
+	var ids []uint
+	if err := scoped.Order("images.id").Pluck("images.id", &ids).Error; err != nil {
+		t.Fatalf("search %q failed: %v", query, err)
+	}
+	return ids
+}
+
+func TestSearchIndexSync(t *testing.T) {
+	db := openTestDB(t)
+	if err := migrations.InitializeRoles(db); err != nil {
+		t.Fatalf("failed to initialize roles: %v", err)
+	}
+	if err := SetupSearchIndex(db); err != nil {
+		t.Fatalf("SetupSearchIndex() error = %v", err)
+	}
+	t.Cleanup(func() { searchBackend.Store(nil) })
+	if currentSearchBackend() == nil {
+		t.Fatal("search backend not set up for sqlite")
+	}
+
+	var role models.Role
+	db.Where("name = ?", "user").First(&role)
+	user := models.User{Username: "alice", Password: "x", Email: "a@example.com", RoleID: role.ID, Active: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	album := models.Album{Name: "vacation", UserID: user.ID}
+	if err := db.Create(&album).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+
+	cfg := &config.Config{Server: config.ServerConfig{UploadDir: "uploads", StaticPath: "/uploads"}}
+	cfg.SystemSettings.General.MaxThumbSize = 16
+	imageService := NewImageService(db, cfg)
+	trashService := NewTrashService(db, cfg)
+	tagService := NewTagService(db)
+
+	expect := func(query string, want ...uint) {
+		t.Helper()
+		if got := searchImageIDs(t, db, user.ID, query); !slices.Equal(got, want) {
+			t.Errorf("search %q = %v, want %v", query, got, want)
+		}
+	}
+
+	// 创建
+	content, err := createTestImage(32, 32, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("harbor.png", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileHeader, cleanup, err := localFileHeader("harbor.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = imageService.uploadFile(context.Background(), user.ID, []uint{album.ID}, []string{"sunset"}, fileHeader)
+	cleanup()
+	if err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+	var image models.Image
+	if err := db.Where("user_id = ?", user.ID).First(&image).Error; err != nil {
+		t.Fatalf("uploaded image not found: %v", err)
+	}
+	expect("harbor", image.ID)
+	expect("sunset", image.ID)
+	expect("vacation", image.ID)
+
+	// 修改名称和标签
+	if _, err := imageService.UpdateImage(context.Background(), user.ID, image.ID, "lighthouse", []string{"night"}); err != nil {
+		t.Fatalf("UpdateImage() error = %v", err)
+	}
+	expect("harbor")
+	expect("sunset")
+	expect("lighthouse", image.ID)
+	expect("night", image.ID)
+
+	// 移入回收站后不再出现在检索文档中
+	if err := imageService.DeleteImage(context.Background(), user.ID, image.ID); err != nil {
+		t.Fatalf("DeleteImage() error = %v", err)
+	}
+	var documents int64
+	db.Model(&models.SearchDocument{}).Where("image_id = ?", image.ID).Count(&documents)
+	if documents != 0 {
+		t.Errorf("search documents of trashed image = %d, want 0", documents)
+	}
+	expect("lighthouse")
+
+	// 恢复后重新建立索引
+	if err := trashService.RestoreImage(context.Background(), user.ID, image.ID); err != nil {
+		t.Fatalf("RestoreImage() error = %v", err)
+	}
+	expect("lighthouse", image.ID)
+	expect("vacation", image.ID)
+
+	// 合并标签后按新标签检索
+	if _, err := tagService.MergeTags(context.Background(), user.ID, []string{"night"}, "evening"); err != nil {
+		t.Fatalf("MergeTags() error = %v", err)
+	}
+	expect("night")
+	expect("evening", image.ID)
+	var document models.SearchDocument
+	if err := db.First(&document, "image_id = ?", image.ID).Error; err != nil || document.Tags != "evening" {
+		t.Errorf("search document = %+v, %v, want tags evening", document, err)
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/leleo886/lopic/internal/database"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxTagNameLength 标签名称最大长度，与 models.Tag 的字段长度一致
+const MaxTagNameLength = 100
+
+type TagService struct {
+	db *gorm.DB
+}
+
+func NewTagService(db *gorm.DB) *TagService {
+	return &TagService{db: db}
+}
+
+type MergeTagsResult struct {
+	Target string `json:"target"`
+	Images int    `json:"images"` // 受影响的图片数量
+}
+
+// GetTags 按前缀获取当前用户的标签，按使用次数降序，用于输入补全
+func (s *TagService) GetTags(ctx context.Context, currentUserID uint, prefix string, limit int) ([]TagCloudItem, error) {
+	items, err := TagCloud(s.db, currentUserID, prefix, limit)
+	if err != nil {
+		log.Ctx(ctx).Errorf("failed to get tags: user_id=%d, error=%v", currentUserID, err)
+		return nil, cerrors.ErrInternalServer
+	}
+	return items, nil
+}
+
+// RenameTag 重命名当前用户的标签，新名称已存在时合并到该标签
+func (s *TagService) RenameTag(ctx context.Context, currentUserID uint, oldName, newName string) (*MergeTagsResult, error) {
+	return s.MergeTags(ctx, currentUserID, []string{oldName}, newName)
+}
+
+// MergeTags 将当前用户的多个标签合并到目标标签
+func (s *TagService) MergeTags(ctx context.Context, currentUserID uint, sources []string, target string) (*MergeTagsResult, error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	images, err := MergeUserTags(tx, currentUserID, sources, target)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+
+	return &MergeTagsResult{Target: strings.TrimSpace(target), Images: images}, nil
+}
+
+// TagCloud 在数据库中统计标签使用次数，userID 为 0 时统计所有用户，prefix 为空时不过滤
+// 回收站中的图片不参与统计
+func TagCloud(db *gorm.DB, userID uint, prefix string, limit int) ([]TagCloudItem, error) {
+	query := db.Table("tags").
+		Select("tags.name AS tag, COUNT(*) AS count").
+		Joins("JOIN image_tags ON image_tags.tag_id = tags.id").
+		Joins("JOIN images ON images.id = image_tags.image_id AND images.deleted_at IS NULL")
+	if userID != 0 {
+		query = query.Where("tags.user_id = ?", userID)
+	}
+	if prefix != "" {
+		query = query.Where("tags.name "+database.Like(db)+" ? ESCAPE '!'", escapeLike(prefix)+"%")
+	}
+	query = query.Group("tags.name").Order("count DESC").Order("tags.name ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	items := make([]TagCloudItem, 0)
+	if err := query.Scan(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// SyncImageTags 将图片的 Tags 字段同步到标签关联表，并清理不再使用的标签，tx 需由调用方管理
+func SyncImageTags(tx *gorm.DB, image *models.Image) error {
+	image.Tags = normalizeTags(image.Tags)
+	for _, name := range image.Tags {
+		if len(name) > MaxTagNameLength {
+			return cerrors.ErrInvalidTagName
+		}
+	}
+
+	var oldTagIDs []uint
+	if err := tx.Model(&models.ImageTag{}).Where("image_id = ?", image.ID).Pluck("tag_id", &oldTagIDs).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to find image tags: id=%d, error=%v", image.ID, err)
+		return cerrors.ErrInternalServer
+	}
+	if err := tx.Where("image_id = ?", image.ID).Delete(&models.ImageTag{}).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to delete image tags: id=%d, error=%v", image.ID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	for _, name := range image.Tags {
+		tag, err := findOrCreateTag(tx, image.UserID, name)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&models.ImageTag{ImageID: image.ID, TagID: tag.ID}).Error; err != nil {
+			log.Ctx(tx.Statement.Context).Errorf("failed to create image tag: image_id=%d, tag_id=%d, error=%v", image.ID, tag.ID, err)
+			return cerrors.ErrInternalServer
+		}
+	}
+
+	return deleteUnusedTags(tx, oldTagIDs)
+}
+
+// MergeUserTags 将用户的源标签合并到目标标签，同步更新图片的 Tags 字段，返回受影响的图片数量，tx 需由调用方管理
+func MergeUserTags(tx *gorm.DB, userID uint, sources []string, target string) (int, error) {
+	target = strings.TrimSpace(target)
+	if target == "" || len(target) > MaxTagNameLength {
+		return 0, cerrors.ErrInvalidTagName
+	}
+	sources = slices.DeleteFunc(normalizeTags(sources), func(name string) bool { return name == target })
+	if len(sources) == 0 {
+		return 0, cerrors.ErrBadRequest
+	}
+
+	var sourceTags []models.Tag
+	if err := tx.Where("user_id = ? AND name IN ?", userID, sources).Find(&sourceTags).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to find tags: user_id=%d, error=%v", userID, err)
+		return 0, cerrors.ErrInternalServer
+	}
+	if len(sourceTags) == 0 {
+		return 0, cerrors.ErrTagNotFound
+	}
+	sourceIDs := make([]uint, len(sourceTags))
+	for i, tag := range sourceTags {
+		sourceIDs[i] = tag.ID
+	}
+
+	targetTag, err := findOrCreateTag(tx, userID, target)
+	if err != nil {
+		return 0, err
+	}
+
+	// 包括回收站中的图片，保证恢复后标签一致
+	var images []models.Image
+	err = tx.Unscoped().
+		Where("id IN (?)", tx.Model(&models.ImageTag{}).Select("image_id").Where("tag_id IN ?", sourceIDs)).
+		Find(&images).Error
+	if err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to find tagged images: user_id=%d, error=%v", userID, err)
+		return 0, cerrors.ErrInternalServer
+	}
+
+	for _, image := range images {
+		tags := make([]string, 0, len(image.Tags))
+		for _, name := range image.Tags {
+			if slices.Contains(sources, name) {
+				name = target
+			}
+			tags = append(tags, name)
+		}
+		tags = normalizeTags(tags)
+		if err := tx.Unscoped().Model(&image).Select("tags").Updates(&models.Image{Tags: tags}).Error; err != nil {
+			log.Ctx(tx.Statement.Context).Errorf("failed to update image tags: id=%d, error=%v", image.ID, err)
+			return 0, cerrors.ErrInternalServer
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.ImageTag{ImageID: image.ID, TagID: targetTag.ID}).Error; err != nil {
+			log.Ctx(tx.Statement.Context).Errorf("failed to create image tag: image_id=%d, tag_id=%d, error=%v", image.ID, targetTag.ID, err)
+			return 0, cerrors.ErrInternalServer
+		}
+	}
+
+	if err := tx.Where("tag_id IN ?", sourceIDs).Delete(&models.ImageTag{}).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to delete image tags: user_id=%d, error=%v", userID, err)
+		return 0, cerrors.ErrInternalServer
+	}
+	if err := tx.Where("id IN ?", sourceIDs).Delete(&models.Tag{}).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to delete tags: user_id=%d, error=%v", userID, err)
+		return 0, cerrors.ErrInternalServer
+	}
+
+	imageIDs := make([]uint, len(images))
+	for i, image := range images {
+		imageIDs[i] = image.ID
+	}
+	if err := IndexImages(tx, imageIDs...); err != nil {
+		return 0, err
+	}
+
+	return len(images), nil
+}
+
+func findOrCreateTag(tx *gorm.DB, userID uint, name string) (*models.Tag, error) {
+	tag := models.Tag{UserID: userID, Name: name}
+	if err := tx.Where("user_id = ? AND name = ?", userID, name).FirstOrCreate(&tag).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to create tag: user_id=%d, name=%s, error=%v", userID, name, err)
+		return nil, cerrors.ErrInternalServer
+	}
+	return &tag, nil
+}
+
+// deleteUnusedTags 删除指定标签中已没有图片关联的标签
+func deleteUnusedTags(tx *gorm.DB, tagIDs []uint) error {
+	if len(tagIDs) == 0 {
+		return nil
+	}
+	result := tx.Where("id IN ? AND id NOT IN (?)", tagIDs, tx.Model(&models.ImageTag{}).Select("tag_id").Where("tag_id IN ?", tagIDs)).
+		Delete(&models.Tag{})
+	if result.Error != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to delete unused tags: error=%v", result.Error)
+		return cerrors.ErrInternalServer
+	}
+	return nil
+}
+
+// escapeLike 转义 LIKE 模式中的通配符，使用 '!' 作为转义符以兼容 MySQL 与 SQLite
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/migrations"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// openTestDB 在临时目录中创建已迁移的 SQLite 数据库
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	db, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := migrations.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	return db
+}
+
+// createTestUser 初始化角色并创建普通用户 alice
+func createTestUser(t *testing.T, db *gorm.DB) models.User {
+	t.Helper()
+	if err := migrations.InitializeRoles(db); err != nil {
+		t.Fatalf("failed to initialize roles: %v", err)
+	}
+	var role models.Role
+	if err := db.Where("name = ?", "user").First(&role).Error; err != nil {
+		t.Fatalf("user role not found: %v", err)
+	}
+	user := models.User{Username: "alice", Password: "x", Email: "a@example.com", RoleID: role.ID, Active: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	return user
+}
+
+// userTags 返回用户在标签表中的标签名称，按名称排序
+func userTags(t *testing.T, db *gorm.DB, userID uint) []string {
+	t.Helper()
+	var names []string
+	if err := db.Model(&models.Tag{}).Where("user_id = ?", userID).Order("name").Pluck("name", &names).Error; err != nil {
+		t.Fatalf("failed to find tags: %v", err)
+	}
+	return names
+}
+
+// imageTagNames 返回图片在关联表中的标签名称，按名称排序
+func imageTagNames(t *testing.T, db *gorm.DB, imageID uint) []string {
+	t.Helper()
+	var names []string
+	err := db.Model(&models.Tag{}).
+		Joins("JOIN image_tags ON image_tags.tag_id = tags.id").
+		Where("image_tags.image_id = ?", imageID).
+		Order("tags.name").
+		Pluck("tags.name", &names).Error
+	if err != nil {
+		t.Fatalf("failed to find image tags: %v", err)
+	}
+	return names
+}
+
+func TestSyncImageTags(t *testing.T) {
+	db := openTestDB(t)
+
+	image := models.Image{FileName: "a.png", OriginalName: "a.png", FileURL: "/uploads/a.png", UserID: 1, Tags: []string{" sea ", "sky", "sea", ""}}
+	if err := db.Create(&image).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := SyncImageTags(db, &image); err != nil {
+		t.Fatalf("SyncImageTags() error = %v", err)
+	}
+	if want := []string{"sea", "sky"}; !slices.Equal(image.Tags, want) {
+		t.Errorf("image.Tags = %v, want %v", image.Tags, want)
+	}
+	if got := imageTagNames(t, db, image.ID); !slices.Equal(got, []string{"sea", "sky"}) {
+		t.Errorf("image tags = %v, want [sea sky]", got)
+	}
+
+	// 另一张图片共用 sea，移除 sky 后 sky 不再被使用，应被清理
+	other := models.Image{FileName: "b.png", OriginalName: "b.png", FileURL: "/uploads/b.png", UserID: 1, Tags: []string{"sea"}}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := SyncImageTags(db, &other); err != nil {
+		t.Fatalf("SyncImageTags() error = %v", err)
+	}
+	image.Tags = []string{"sea", "beach"}
+	if err := SyncImageTags(db, &image); err != nil {
+		t.Fatalf("SyncImageTags() error = %v", err)
+	}
+	if got := userTags(t, db, 1); !slices.Equal(got, []string{"beach", "sea"}) {
+		t.Errorf("tags = %v, want [beach sea]", got)
+	}
+
+	// 其他用户的同名标签互不影响
+	foreign := models.Image{FileName: "c.png", OriginalName: "c.png", FileURL: "/uploads/c.png", UserID: 2, Tags: []string{"sea"}}
+	if err := db.Create(&foreign).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := SyncImageTags(db, &foreign); err != nil {
+		t.Fatalf("SyncImageTags() error = %v", err)
+	}
+	if got := userTags(t, db, 2); !slices.Equal(got, []string{"sea"}) {
+		t.Errorf("tags of user 2 = %v, want [sea]", got)
+	}
+
+	long := models.Image{FileName: "d.png", OriginalName: "d.png", FileURL: "/uploads/d.png", UserID: 1, Tags: []string{strings.Repeat("x", MaxTagNameLength+1)}}
+	if err := SyncImageTags(db, &long); !errors.Is(err, cerrors.ErrInvalidTagName) {
+		t.Errorf("SyncImageTags() with long tag error = %v, want ErrInvalidTagName", err)
+	}
+}
+
+func TestMergeUserTags(t *testing.T) {
+	db := openTestDB(t)
+
+	images := []models.Image{
+		{FileName: "a.png", OriginalName: "a.png", FileURL: "/uploads/a.png", UserID: 1, Tags: []string{"sea", "blue"}},
+		{FileName: "b.png", OriginalName: "b.png", FileURL: "/uploads/b.png", UserID: 1, Tags: []string{"ocean", "sea"}},
+		{FileName: "c.png", OriginalName: "c.png", FileURL: "/uploads/c.png", UserID: 1, Tags: []string{"sky"}},
+		{FileName: "d.png", OriginalName: "d.png", FileURL: "/uploads/d.png", UserID: 2, Tags: []string{"sea"}},
+	}
+	for i := range images {
+		if err := db.Create(&images[i]).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+		if err := SyncImageTags(db, &images[i]); err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+	// 回收站中的图片也参与合并
+	if err := db.Delete(&images[1]).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+
+	count, err := MergeUserTags(db, 1, []string{"sea", "ocean", "missing"}, " water ")
+	if err != nil {
+		t.Fatalf("MergeUserTags() error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("MergeUserTags() = %d, want 2", count)
+	}
+
+	var got []models.Image
+	if err := db.Unscoped().Order("id").Find(&got).Error; err != nil {
+		t.Fatalf("failed to find images: %v", err)
+	}
+	want := [][]string{{"water", "blue"}, {"water"}, {"sky"}, {"sea"}}
+	for i, image := range got {
+		if !slices.Equal(image.Tags, want[i]) {
+			t.Errorf("image %s tags = %v, want %v", image.FileName, image.Tags, want[i])
+		}
+	}
+	if names := imageTagNames(t, db, images[1].ID); !slices.Equal(names, []string{"water"}) {
+		t.Errorf("image tags of b.png = %v, want [water]", names)
+	}
+	if names := userTags(t, db, 1); !slices.Equal(names, []string{"blue", "sky", "water"}) {
+		t.Errorf("tags of user 1 = %v, want [blue sky water]", names)
+	}
+	if names := userTags(t, db, 2); !slices.Equal(names, []string{"sea"}) {
+		t.Errorf("tags of user 2 = %v, want [sea]", names)
+	}
+
+	// 合并到已存在的标签
+	if count, err := MergeUserTags(db, 1, []string{"sky"}, "blue"); err != nil || count != 1 {
+		t.Errorf("MergeUserTags() into existing tag = %d, %v, want 1", count, err)
+	}
+	if names := userTags(t, db, 1); !slices.Equal(names, []string{"blue", "water"}) {
+		t.Errorf("tags of user 1 = %v, want [blue water]", names)
+	}
+
+	tests := []struct {
+		name    string
+		sources []string
+		target  string
+		wantErr error
+	}{
+		{name: "empty target", sources: []string{"blue"}, target: " ", wantErr: cerrors.ErrInvalidTagName},
+		{name: "target too long", sources: []string{"blue"}, target: strings.Repeat("x", MaxTagNameLength+1), wantErr: cerrors.ErrInvalidTagName},
+		{name: "only target as source", sources: []string{"blue"}, target: "blue", wantErr: cerrors.ErrBadRequest},
+		{name: "unknown source", sources: []string{"missing"}, target: "blue", wantErr: cerrors.ErrTagNotFound},
+		{name: "other user's tag", sources: []string{"sea"}, target: "blue", wantErr: cerrors.ErrTagNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MergeUserTags(db, 1, tt.sources, tt.target); !errors.Is(err, tt.wantErr) {
+				t.Errorf("MergeUserTags() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "sea", want: "sea"},
+		{input: "100%", want: "100!%"},
+		{input: "a_b", want: "a!_b"},
+		{input: "wow!", want: "wow!!"},
+		{input: "!%_", want: "!!!%!_"},
+	}
+	for _, tt := range tests {
+		if got := escapeLike(tt.input); got != tt.want {
+			t.Errorf("escapeLike(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+
+	// 转义后的前缀只匹配字面量
+	db := openTestDB(t)
+	for _, tags := range [][]string{{"50%off"}, {"50 off"}, {"a_b"}, {"axb"}} {
+		image := models.Image{FileName: tags[0], OriginalName: tags[0], FileURL: "/uploads/" + tags[0], UserID: 1, Tags: tags}
+		if err := db.Create(&image).Error; err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+		if err := SyncImageTags(db, &image); err != nil {
+			t.Fatalf("failed to prepare data: %v", err)
+		}
+	}
+	for prefix, want := range map[string]string{"50%": "50%off", "a_": "a_b"} {
+		items, err := TagCloud(db, 1, prefix, 0)
+		if err != nil {
+			t.Fatalf("TagCloud() error = %v", err)
+		}
+		if len(items) != 1 || items[0].Tag != want {
+			t.Errorf("TagCloud(%q) = %+v, want only %s", prefix, items, want)
+		}
+	}
+}
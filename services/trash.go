@@ -0,0 +1,424 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/internal/log"
+	"github.com/leleo886/lopic/internal/storage"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// DefaultTrashRetentionDays 未配置保留天数时回收站的默认保留天数
+const DefaultTrashRetentionDays = 30
+
+type TrashService struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+func NewTrashService(db *gorm.DB, cfg *config.Config) *TrashService {
+	return &TrashService{db: db, cfg: cfg}
+}
+
+type PurgeResult struct {
+	Images int `json:"images"`
+	Albums int `json:"albums"`
+}
+
+// TrashImage 将图片移入回收站，保留文件和相册关联，tx 需由调用方管理
+func TrashImage(tx *gorm.DB, image *models.Image) error {
+	// 图片所在的相册（回收站中的相册不参与计数）
+	var albums []models.Album
+	if err := tx.Model(image).Association("Albums").Find(&albums); err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to find image albums: id=%d, error=%v", image.ID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	for _, album := range albums {
+		if err := tx.Model(&album).Update("image_count", gorm.Expr("image_count - ?", 1)).Error; err != nil {
+			log.Ctx(tx.Statement.Context).Errorf("failed to update album image count: error=%v", err)
+			return cerrors.ErrInternalServer
+		}
+	}
+
+	// 回收站中的图片不计入用户统计，是否计入配额在上传检查时决定
+	result := tx.Model(&models.User{}).Where("id = ?", image.UserID).
+		Updates(map[string]interface{}{
+			"total_size":  gorm.Expr("total_size - ?", image.FileSize+image.ThumbnailSize),
+			"image_count": gorm.Expr("image_count - ?", 1),
+		})
+	if result.Error != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to update user storage usage: id=%d, error=%v", image.UserID, result.Error)
+		return cerrors.ErrInternalServer
+	}
+
+	if err := tx.Delete(image).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to trash image: id=%d, error=%v", image.ID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	// 回收站中的图片不参与搜索
+	return IndexImages(tx, image.ID)
+}
+
+// TrashAlbum 将相册移入回收站，保留图片关联，tx 需由调用方管理
+func TrashAlbum(tx *gorm.DB, album *models.Album) error {
+	if err := tx.Delete(album).Error; err != nil {
+		log.Ctx(tx.Statement.Context).Errorf("failed to trash album: id=%d, error=%v", album.ID, err)
+		return cerrors.ErrInternalServer
+	}
+	return IndexAlbumImages(tx, album.ID)
+}
+
+// TrashedSize 获取用户回收站中图片占用的空间
+func TrashedSize(db *gorm.DB, userID uint) (int64, error) {
+	var size int64
+	err := db.Unscoped().Model(&models.Image{}).
+		Where("user_id = ? AND deleted_at IS NOT NULL", userID).
+		Select("COALESCE(SUM(file_size + thumbnail_size), 0)").
+		Scan(&size).Error
+	return size, err
+}
+
+func (s *TrashService) GetTrashedImages(ctx context.Context, currentUserID uint, page, pageSize, offset int) (*GetImagesResponse, error) {
+	var imageModels []models.Image
+	var total int64
+
+	db := s.db.Unscoped().Model(&models.Image{}).Where("user_id = ? AND deleted_at IS NOT NULL", currentUserID)
+	db.Count(&total)
+	res := db.Preload("Albums").Offset(offset).Limit(pageSize).Order("deleted_at DESC").Find(&imageModels)
+	if res.Error != nil {
+		log.Ctx(ctx).Errorf("failed to get trashed images: user_id=%d, error=%v", currentUserID, res.Error)
+		return nil, cerrors.ErrInternalServer
+	}
+
+	return &GetImagesResponse{
+		Images:   MakeImagesWithAlbum(imageModels),
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *TrashService) GetTrashedAlbums(ctx context.Context, currentUserID uint, page, pageSize, offset int) (*GetAlbumsResponse, error) {
+	albums := make([]AlbumResponse, 0)
+	var total int64
+
+	db := s.db.Unscoped().Model(&models.Album{}).Where("user_id = ? AND deleted_at IS NOT NULL", currentUserID)
+	db.Count(&total)
+	res := db.Offset(offset).Limit(pageSize).Order("deleted_at DESC").Find(&albums)
+	if res.Error != nil {
+		log.Ctx(ctx).Errorf("failed to get trashed albums: user_id=%d, error=%v", currentUserID, res.Error)
+		return nil, cerrors.ErrInternalServer
+	}
+
+	return &GetAlbumsResponse{
+		Albums:   albums,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+	}, nil
+}
+
+func (s *TrashService) RestoreImage(ctx context.Context, currentUserID uint, imageID uint) error {
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	var image models.Image
+	result := tx.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", imageID, currentUserID).First(&image)
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return cerrors.ErrImageNotFound
+	}
+
+	// 回收站中的图片不计入配额时，恢复后重新占用存储空间，需与上传一样检查配额
+	if !s.cfg.SystemSettings.Trash.CountInQuota {
+		var user models.User
+		if err := tx.Preload("Role").First(&user, currentUserID).Error; err != nil {
+			tx.Rollback()
+			return cerrors.ErrUserNotFound
+		}
+		if user.Role.MaxStorageSizeMB != -1 &&
+			user.TotalSize+image.FileSize+image.ThumbnailSize > int64(user.Role.MaxStorageSizeMB)*1024*1024 {
+			tx.Rollback()
+			return cerrors.ErrMaxStorageSizeMB
+		}
+	}
+
+	if err := tx.Unscoped().Model(&image).Update("deleted_at", nil).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to restore image: id=%d, error=%v", imageID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	// 恢复后重新计入未删除相册的图片数
+	var albumIDs []uint
+	if err := tx.Model(&models.ImageAlbum{}).Where("image_id = ?", imageID).Pluck("album_id", &albumIDs).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to find image albums: id=%d, error=%v", imageID, err)
+		return cerrors.ErrInternalServer
+	}
+	if len(albumIDs) > 0 {
+		if err := tx.Model(&models.Album{}).Where("id IN ?", albumIDs).
+			Update("image_count", gorm.Expr("image_count + ?", 1)).Error; err != nil {
+			tx.Rollback()
+			log.Ctx(ctx).Errorf("failed to update album image count: error=%v", err)
+			return cerrors.ErrInternalServer
+		}
+	}
+
+	result = tx.Model(&models.User{}).Where("id = ?", currentUserID).
+		Updates(map[string]interface{}{
+			"total_size":  gorm.Expr("total_size + ?", image.FileSize+image.ThumbnailSize),
+			"image_count": gorm.Expr("image_count + ?", 1),
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to update user storage usage: id=%d, error=%v", currentUserID, result.Error)
+		return cerrors.ErrInternalServer
+	}
+
+	if err := IndexImages(tx, imageID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
+		return cerrors.ErrInternalServer
+	}
+
+	return nil
+}
+
+func (s *TrashService) RestoreAlbum(ctx context.Context, currentUserID uint, albumID uint) error {
+	var user models.User
+	if err := s.db.Preload("Role").First(&user, currentUserID).Error; err != nil {
+		return cerrors.ErrUserNotFound
+	}
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	var album models.Album
+	result := tx.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", albumID, currentUserID).First(&album)
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return cerrors.ErrAlbumNotFound
+	}
+
+	// -1 means no limit
+	if user.Role.MaxAlbumsPerUser != -1 {
+		var count int64
+		if err := tx.Model(&models.Album{}).Where("user_id = ?", currentUserID).Count(&count).Error; err != nil {
+			tx.Rollback()
+			log.Ctx(ctx).Errorf("failed to count albums: user_id=%d, error=%v", currentUserID, err)
+			return cerrors.ErrInternalServer
+		}
+		if count >= int64(user.Role.MaxAlbumsPerUser) {
+			tx.Rollback()
+			return cerrors.ErrMaxAlbumsPerUser
+		}
+	}
+
+	// 相册在回收站期间图片可能被删除或恢复，重新统计图片数
+	var imageCount int64
+	if err := tx.Model(&models.Image{}).
+		Joins("JOIN image_albums ON image_albums.image_id = images.id").
+		Where("image_albums.album_id = ?", albumID).
+		Count(&imageCount).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to count album images: id=%d, error=%v", albumID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	if err := tx.Unscoped().Model(&album).Updates(map[string]interface{}{
+		"deleted_at":  nil,
+		"image_count": imageCount,
+	}).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to restore album: id=%d, error=%v", albumID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	if err := IndexAlbumImages(tx, albumID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
+		return cerrors.ErrInternalServer
+	}
+
+	return nil
+}
+
+// PurgeImage 永久删除回收站中的图片
+func (s *TrashService) PurgeImage(ctx context.Context, currentUserID uint, imageID uint) error {
+	var image models.Image
+	result := s.db.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", imageID, currentUserID).First(&image)
+	if result.RowsAffected == 0 {
+		return cerrors.ErrImageNotFound
+	}
+	return s.purgeImage(ctx, &image)
+}
+
+// PurgeAlbum 永久删除回收站中的相册，相册内的图片不受影响
+func (s *TrashService) PurgeAlbum(ctx context.Context, currentUserID uint, albumID uint) error {
+	var album models.Album
+	result := s.db.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", albumID, currentUserID).First(&album)
+	if result.RowsAffected == 0 {
+		return cerrors.ErrAlbumNotFound
+	}
+	return s.purgeAlbum(ctx, &album)
+}
+
+// EmptyTrash 清空用户的回收站
+func (s *TrashService) EmptyTrash(ctx context.Context, currentUserID uint) (*PurgeResult, error) {
+	return s.purge(ctx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", currentUserID)
+	})
+}
+
+// PurgeExpired 永久删除超过保留期限的回收站内容
+func (s *TrashService) PurgeExpired(ctx context.Context) (*PurgeResult, error) {
+	retentionDays := s.cfg.SystemSettings.Trash.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = DefaultTrashRetentionDays
+	}
+	cutoff := time.Now().AddDate(0, 0, -retentionDays)
+	return s.purge(ctx, func(db *gorm.DB) *gorm.DB {
+		return db.Where("deleted_at < ?", cutoff)
+	})
+}
+
+func (s *TrashService) purge(ctx context.Context, scope func(*gorm.DB) *gorm.DB) (*PurgeResult, error) {
+	purged := &PurgeResult{}
+
+	var images []models.Image
+	if err := s.db.Unscoped().Scopes(scope).Where("deleted_at IS NOT NULL").Find(&images).Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to find trashed images: error=%v", err)
+		return nil, cerrors.ErrInternalServer
+	}
+	for i := range images {
+		if err := s.purgeImage(ctx, &images[i]); err != nil {
+			return purged, err
+		}
+		purged.Images++
+	}
+
+	var albums []models.Album
+	if err := s.db.Unscoped().Scopes(scope).Where("deleted_at IS NOT NULL").Find(&albums).Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to find trashed albums: error=%v", err)
+		return purged, cerrors.ErrInternalServer
+	}
+	for i := range albums {
+		if err := s.purgeAlbum(ctx, &albums[i]); err != nil {
+			return purged, err
+		}
+		purged.Albums++
+	}
+
+	return purged, nil
+}
+
+func (s *TrashService) purgeImage(ctx context.Context, image *models.Image) error {
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := tx.Where("image_id = ?", image.ID).Delete(&models.ImageAlbum{}).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to delete image albums: id=%d, error=%v", image.ID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	// 清除标签关联
+	image.Tags = nil
+	if err := SyncImageTags(tx, image); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Unscoped().Delete(image).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to delete image: id=%d, error=%v", image.ID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
+		return cerrors.ErrInternalServer
+	}
+
+	// 数据库记录删除后再删除存储中的文件
+	storageInstance := storage.WithTracing(ctx, s.getStorageByStorageName(image.StorageName), image.StorageName)
+	if err := storageInstance.DeleteFile(image.FileURL); err != nil {
+		log.Ctx(ctx).Errorf("failed to delete image file: id=%d, error=%v", image.ID, err)
+	}
+	if err := storageInstance.DeleteFile(image.ThumbnailURL); err != nil {
+		log.Ctx(ctx).Errorf("failed to delete thumbnail image: id=%d, error=%v", image.ID, err)
+	}
+
+	return nil
+}
+
+func (s *TrashService) purgeAlbum(ctx context.Context, album *models.Album) error {
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := tx.Where("album_id = ?", album.ID).Delete(&models.ImageAlbum{}).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to delete album images: id=%d, error=%v", album.ID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	if err := tx.Unscoped().Delete(album).Error; err != nil {
+		tx.Rollback()
+		log.Ctx(ctx).Errorf("failed to delete album: id=%d, error=%v", album.ID, err)
+		return cerrors.ErrInternalServer
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Ctx(ctx).Errorf("failed to commit transaction: %v", err)
+		return cerrors.ErrInternalServer
+	}
+
+	return nil
+}
+
+// 根据存储名称获取存储实例
+func (s *TrashService) getStorageByStorageName(storageName string) storage.Storage {
+	var storageConfig models.Storage
+	result := s.db.Where("name = ?", storageName).First(&storageConfig)
+	if result.Error != nil {
+		// 存储配置不存在，使用默认本地存储
+		return storage.NewStorageByStorageName(nil, &s.cfg.Server)
+	}
+
+	return storage.NewStorageByStorageName(&storageConfig, &s.cfg.Server)
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/leleo886/lopic/internal/config"
+	cerrors "github.com/leleo886/lopic/internal/error"
+	"github.com/leleo886/lopic/migrations"
+	"github.com/leleo886/lopic/models"
+	"gorm.io/gorm"
+)
+
+// setupTrashTest 创建配额为 1 MB 的用户和一个相册，返回数据库、配置、用户和相册
+func setupTrashTest(t *testing.T) (*gorm.DB, *config.Config, models.User, models.Album) {
+	t.Helper()
+	db := openTestDB(t)
+	if err := migrations.InitializeRoles(db); err != nil {
+		t.Fatalf("failed to initialize roles: %v", err)
+	}
+	var role models.Role
+	if err := db.Where("name = ?", "user").First(&role).Error; err != nil {
+		t.Fatalf("user role not found: %v", err)
+	}
+	if err := db.Model(&role).Update("max_storage_size_mb", 1).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+
+	user := models.User{Username: "alice", Password: "x", Email: "a@example.com", RoleID: role.ID, Active: true}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	album := models.Album{Name: "trip", UserID: user.ID}
+	if err := db.Create(&album).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	if err := os.MkdirAll("uploads", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Server: config.ServerConfig{UploadDir: "uploads", StaticPath: "/uploads"}}
+	return db, cfg, user, album
+}
+
+// createTrashTestImage 创建属于用户和相册的图片及其文件，并按上传的方式更新用户和相册的统计
+func createTrashTestImage(t *testing.T, db *gorm.DB, user models.User, album models.Album, name string, size int64) models.Image {
+	t.Helper()
+	for _, file := range []string{name, "thumb_" + name} {
+		if err := os.WriteFile(filepath.Join("uploads", file), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	image := models.Image{FileName: name, OriginalName: name, FileURL: "/uploads/" + name, ThumbnailURL: "/uploads/thumb_" + name,
+		FileSize: size, ThumbnailSize: 1024, UserID: user.ID, StorageName: "local", Albums: []models.Album{album}}
+	if err := db.Create(&image).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"total_size":  gorm.Expr("total_size + ?", image.FileSize+image.ThumbnailSize),
+		"image_count": gorm.Expr("image_count + ?", 1),
+	})
+	db.Model(&models.Album{}).Where("id = ?", album.ID).Update("image_count", gorm.Expr("image_count + ?", 1))
+	return image
+}
+
+// userUsage 返回用户的已用空间和图片数
+func userUsage(t *testing.T, db *gorm.DB, userID uint) (int64, int) {
+	t.Helper()
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		t.Fatalf("user not found: %v", err)
+	}
+	return user.TotalSize, user.ImageCount
+}
+
+func TestTrashAndRestoreImage(t *testing.T) {
+	db, cfg, user, album := setupTrashTest(t)
+	imageService := NewImageService(db, cfg)
+	trashService := NewTrashService(db, cfg)
+	ctx := context.Background()
+
+	image := createTrashTestImage(t, db, user, album, "a.png", 300*1024)
+	if err := imageService.DeleteImage(ctx, user.ID, image.ID); err != nil {
+		t.Fatalf("DeleteImage() error = %v", err)
+	}
+
+	// 移入回收站后不计入用户统计和相册图片数，文件和相册关联保留
+	if size, count := userUsage(t, db, user.ID); size != 0 || count != 0 {
+		t.Errorf("usage after trash = %d bytes, %d images, want 0, 0", size, count)
+	}
+	var trashedAlbum models.Album
+	db.First(&trashedAlbum, album.ID)
+	if trashedAlbum.ImageCount != 0 {
+		t.Errorf("album image count after trash = %d, want 0", trashedAlbum.ImageCount)
+	}
+	if size, err := TrashedSize(db, user.ID); err != nil || size != image.FileSize+image.ThumbnailSize {
+		t.Errorf("TrashedSize() = %d, %v, want %d", size, err, image.FileSize+image.ThumbnailSize)
+	}
+	trashed, err := trashService.GetTrashedImages(ctx, user.ID, 1, 10, 0)
+	if err != nil || trashed.Total != 1 || len(trashed.Images[0].Albums) != 1 {
+		t.Errorf("GetTrashedImages() = %+v, %v, want the image with its album", trashed, err)
+	}
+	if _, err := os.Stat(filepath.Join("uploads", "a.png")); err != nil {
+		t.Errorf("image file removed on trash: %v", err)
+	}
+
+	if err := trashService.RestoreImage(ctx, user.ID, image.ID); err != nil {
+		t.Fatalf("RestoreImage() error = %v", err)
+	}
+	if size, count := userUsage(t, db, user.ID); size != image.FileSize+image.ThumbnailSize || count != 1 {
+		t.Errorf("usage after restore = %d bytes, %d images, want %d, 1", size, count, image.FileSize+image.ThumbnailSize)
+	}
+	db.First(&trashedAlbum, album.ID)
+	if trashedAlbum.ImageCount != 1 {
+		t.Errorf("album image count after restore = %d, want 1", trashedAlbum.ImageCount)
+	}
+	if err := trashService.RestoreImage(ctx, user.ID, image.ID); !errors.Is(err, cerrors.ErrImageNotFound) {
+		t.Errorf("RestoreImage() of image not in trash error = %v, want ErrImageNotFound", err)
+	}
+}
+
+func TestRestoreImageQuota(t *testing.T) {
+	db, cfg, user, album := setupTrashTest(t)
+	imageService := NewImageService(db, cfg)
+	trashService := NewTrashService(db, cfg)
+	ctx := context.Background()
+
+	// 移入回收站后上传新图片占满配额
+	trashedImage := createTrashTestImage(t, db, user, album, "a.png", 600*1024)
+	if err := imageService.DeleteImage(ctx, user.ID, trashedImage.ID); err != nil {
+		t.Fatalf("DeleteImage() error = %v", err)
+	}
+	createTrashTestImage(t, db, user, album, "b.png", 600*1024)
+
+	if err := trashService.RestoreImage(ctx, user.ID, trashedImage.ID); !errors.Is(err, cerrors.ErrMaxStorageSizeMB) {
+		t.Fatalf("RestoreImage() over quota error = %v, want ErrMaxStorageSizeMB", err)
+	}
+	var image models.Image
+	if err := db.Unscoped().First(&image, trashedImage.ID).Error; err != nil || !image.DeletedAt.Valid {
+		t.Errorf("image restored despite exceeding quota")
+	}
+
+	// 回收站计入配额时恢复不增加占用
+	cfg.SystemSettings.Trash.CountInQuota = true
+	if err := trashService.RestoreImage(ctx, user.ID, trashedImage.ID); err != nil {
+		t.Errorf("RestoreImage() with trash counted in quota error = %v", err)
+	}
+}
+
+func TestUploadLimitCountInQuota(t *testing.T) {
+	db, cfg, user, album := setupTrashTest(t)
+	imageService := NewImageService(db, cfg)
+	ctx := context.Background()
+
+	image := createTrashTestImage(t, db, user, album, "a.png", 600*1024)
+	if err := imageService.DeleteImage(ctx, user.ID, image.ID); err != nil {
+		t.Fatalf("DeleteImage() error = %v", err)
+	}
+
+	content, err := createTestImage(8, 8, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("upload.png", append(content, make([]byte, 500*1024)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileHeader, cleanup, err := localFileHeader("upload.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	files := []*multipart.FileHeader{fileHeader}
+
+	if err := imageService.UploadImageLimitCheck(ctx, user.ID, files); err != nil {
+		t.Errorf("UploadImageLimitCheck() with trash not counted error = %v", err)
+	}
+	cfg.SystemSettings.Trash.CountInQuota = true
+	if err := imageService.UploadImageLimitCheck(ctx, user.ID, files); !errors.Is(err, cerrors.ErrMaxStorageSizeMB) {
+		t.Errorf("UploadImageLimitCheck() with trash counted error = %v, want ErrMaxStorageSizeMB", err)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	db, cfg, user, album := setupTrashTest(t)
+	imageService := NewImageService(db, cfg)
+	trashService := NewTrashService(db, cfg)
+	ctx := context.Background()
+	cfg.SystemSettings.Trash.RetentionDays = 7
+
+	expired := createTrashTestImage(t, db, user, album, "old.png", 1024)
+	recent := createTrashTestImage(t, db, user, album, "new.png", 1024)
+	for _, image := range []models.Image{expired, recent} {
+		if err := imageService.DeleteImage(ctx, user.ID, image.ID); err != nil {
+			t.Fatalf("DeleteImage() error = %v", err)
+		}
+	}
+	db.Unscoped().Model(&models.Image{}).Where("id = ?", expired.ID).Update("deleted_at", time.Now().AddDate(0, 0, -8))
+
+	expiredAlbum := models.Album{Name: "old", UserID: user.ID}
+	if err := db.Create(&expiredAlbum).Error; err != nil {
+		t.Fatalf("failed to prepare data: %v", err)
+	}
+	db.Model(&expiredAlbum).Update("deleted_at", time.Now().AddDate(0, 0, -8))
+
+	result, err := trashService.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatalf("PurgeExpired() error = %v", err)
+	}
+	if result.Images != 1 || result.Albums != 1 {
+		t.Errorf("PurgeExpired() = %+v, want 1 image and 1 album", result)
+	}
+
+	var remaining []uint
+	db.Unscoped().Model(&models.Image{}).Order("id").Pluck("id", &remaining)
+	if len(remaining) != 1 || remaining[0] != recent.ID {
+		t.Errorf("remaining images = %v, want [%d]", remaining, recent.ID)
+	}
+	for file, want := range map[string]bool{"old.png": false, "thumb_old.png": false, "new.png": true} {
+		if _, err := os.Stat(filepath.Join("uploads", file)); (err == nil) != want {
+			t.Errorf("file %s exists = %v, want %v", file, err == nil, want)
+		}
+	}
+	var associations int64
+	db.Model(&models.ImageAlbum{}).Where("image_id = ?", expired.ID).Count(&associations)
+	if associations != 0 {
+		t.Errorf("album associations of purged image = %d, want 0", associations)
+	}
+}
@@ -2,13 +2,12 @@ package services
 
 import (
 	cerrors "github.com/leleo886/lopic/internal/error"
+	"context"
 	"github.com/leleo886/lopic/internal/config"
 	"github.com/leleo886/lopic/internal/log"
 	"github.com/leleo886/lopic/models"
-	"github.com/leleo886/lopic/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
-	"sort"
 )
 
 type UserService struct {
@@ -39,7 +38,7 @@ func (s *UserService) GetMe(currentUserID uint) (*models.User, error) {
 	return &user, nil
 }
 
-func (s *UserService) UpdateMe(currentUserID uint, username, password string) (*models.User, error) {
+func (s *UserService) UpdateMe(ctx context.Context, currentUserID uint, username, password string) (*models.User, error) {
 	// 获取要更新的用户信息
 	var user models.User
 	result := s.db.Preload("Role").First(&user, currentUserID)
@@ -61,7 +60,7 @@ func (s *UserService) UpdateMe(currentUserID uint, username, password string) (*
 
 	result = s.db.Save(&user)
 	if result.Error != nil {
-		log.Errorf("failed to update user: id=%d, error=%v", currentUserID, result.Error)
+		log.Ctx(ctx).Errorf("failed to update user: id=%d, error=%v", currentUserID, result.Error)
 		return nil, cerrors.ErrInternalServer
 	}
 	return &user, nil
@@ -80,39 +79,12 @@ func (s *UserService) GetStorageUsage(userID uint) (*StorageUsage, error) {
 	}, nil
 }
 
-// GetImagesTagsCloud 获取用户图片标签云
-func (s *UserService) GetImagesTagsCloud(userID uint) ([]TagCloudItem, error) {
-	// 1. 找到所有用户上传的图片的标签数组
-	var images []models.Image
-	result := s.db.Model(&models.Image{}).
-		Where("user_id = ? AND tags IS NOT NULL", userID).
-		Find(&images)
-
-	if result.Error != nil {
-		return nil, result.Error
-	}
-	// 2. 统计标签出现次数
-	tagsCount := utils.WordCount(images)
-
-	// 3. 转换为 TagCloudItem 切片
-	var tagCloudItems []TagCloudItem
-	for tag, count := range tagsCount {
-		tagCloudItems = append(tagCloudItems, TagCloudItem{
-			Tag:   tag,
-			Count: count,
-		})
-	}
-
-	// 按数量降序排序
-	sort.Slice(tagCloudItems, func(i, j int) bool {
-		return tagCloudItems[i].Count > tagCloudItems[j].Count
-	})
-
-	maxTags := s.cfg.SystemSettings.General.MaxTags
-
-	//不管多少个标签，都返回前maxTags个
-	if len(tagCloudItems) > maxTags {
-		tagCloudItems = tagCloudItems[:maxTags]
+// GetImagesTagsCloud 获取用户图片标签云，返回使用次数最多的前 MaxTags 个标签
+func (s *UserService) GetImagesTagsCloud(ctx context.Context, userID uint) ([]TagCloudItem, error) {
+	tagCloudItems, err := TagCloud(s.db, userID, "", s.cfg.SystemSettings.General.MaxTags)
+	if err != nil {
+		log.Ctx(ctx).Errorf("failed to get tags cloud: user_id=%d, error=%v", userID, err)
+		return nil, cerrors.ErrInternalServer
 	}
 
 	return tagCloudItems, nil
@@ -24,7 +24,7 @@ func GenerateSignedToken(email string, timestamp int64, prefix string, cfg *conf
 
 func ValidateSignedToken(token string, prefix string, cfg *config.JWTConfig) (string, int64, error) {
 	parts := strings.Split(token, ":")
-	if len(parts) < 3 {
+	if len(parts) != 4 {
 		log.Errorf("invalid token format: token=%s", token)
 		return "", 0, cerrors.ErrForbidden
 	}